@@ -0,0 +1,182 @@
+package chaincode
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// 同一个链码里部署三个合约，客户端用 "合约名:函数名" 调用，不带合约名时使用 NovelContract
+const (
+	NovelContractName  = "NovelContract"
+	CreditContractName = "CreditContract"
+	AdminContractName  = "AdminContract"
+)
+
+// NovelContract 小说的增删改查，小说 key 使用链码级别背书策略
+type NovelContract struct {
+	contractapi.Contract
+}
+
+// CreditContract 用户积分、消费、预留、充值和限额查询
+type CreditContract struct {
+	contractapi.Contract
+}
+
+// AdminContract 价格表、限额、背书策略、快照锚定和数据导入，所有交易都要求管理员身份
+// EnableSeed 为 false 时 InitLedger 不会注册为交易，生产环境不能调用
+type AdminContract struct {
+	contractapi.Contract
+	EnableSeed bool
+}
+
+// NewChaincode 创建包含三个合约的链码，enableSeed 控制是否开放测试数据 InitLedger
+func NewChaincode(enableSeed bool) (*contractapi.ContractChaincode, error) {
+	return contractapi.NewChaincode(
+		new(NovelContract),
+		new(CreditContract),
+		&AdminContract{EnableSeed: enableSeed},
+	)
+}
+
+func (c *NovelContract) GetName() string  { return NovelContractName }
+func (c *CreditContract) GetName() string { return CreditContractName }
+func (c *AdminContract) GetName() string  { return AdminContractName }
+
+// 只读交易，在元数据中标记为 evaluate，也不做写权限检查
+var (
+	novelEvaluateTransactions  = []string{"ReadNovel", "GetAllNovels", "NovelExists"}
+	creditEvaluateTransactions = []string{"ReadUserCredit", "GetAllUserCredits", "UserCreditExists", "ReadHold", "GetUserHolds",
+		"GetSpendingAllowance", "ReadRechargeOrder", "GetPricing", "GetPricingSchedule"}
+	adminEvaluateTransactions = []string{"GetEndorsementConfig", "GetKeyEndorsementPolicy", "ReadSnapshot"}
+)
+
+// 第一个参数不是记录 key 的交易，其他交易的第一个参数（小说ID、用户ID、预留ID、订单号）不能为空
+var (
+	novelKeylessTransactions  = []string{"GetAllNovels"}
+	creditKeylessTransactions = []string{"GetAllUserCredits", "GetPricing", "GetPricingSchedule"}
+)
+
+func (c *NovelContract) GetEvaluateTransactions() []string  { return novelEvaluateTransactions }
+func (c *CreditContract) GetEvaluateTransactions() []string { return creditEvaluateTransactions }
+func (c *AdminContract) GetEvaluateTransactions() []string  { return adminEvaluateTransactions }
+
+// GetIgnoredFunctions 没有开启 seed 时 InitLedger 不对外暴露
+func (c *AdminContract) GetIgnoredFunctions() []string {
+	if c.EnableSeed {
+		return nil
+	}
+	return []string{"InitLedger"}
+}
+
+func (c *NovelContract) GetBeforeTransaction() interface{}  { return c.beforeTransaction }
+func (c *CreditContract) GetBeforeTransaction() interface{} { return c.beforeTransaction }
+func (c *AdminContract) GetBeforeTransaction() interface{}  { return c.beforeTransaction }
+
+func (c *NovelContract) GetUnknownTransaction() interface{} {
+	return unknownTransaction(NovelContractName)
+}
+func (c *CreditContract) GetUnknownTransaction() interface{} {
+	return unknownTransaction(CreditContractName)
+}
+func (c *AdminContract) GetUnknownTransaction() interface{} {
+	return unknownTransaction(AdminContractName)
+}
+
+// beforeTransaction 小说写入只允许平台组织
+func (c *NovelContract) beforeTransaction(ctx contractapi.TransactionContextInterface) error {
+	fn, err := requireRecordKey(ctx, novelKeylessTransactions)
+	if err != nil {
+		return err
+	}
+	if contains(novelEvaluateTransactions, fn) {
+		return nil
+	}
+	return requireWriter(ctx, PlatformMSPID)
+}
+
+// beforeTransaction 积分写入只允许平台组织和账务组织
+func (c *CreditContract) beforeTransaction(ctx contractapi.TransactionContextInterface) error {
+	fn, err := requireRecordKey(ctx, creditKeylessTransactions)
+	if err != nil {
+		return err
+	}
+	if contains(creditEvaluateTransactions, fn) {
+		return nil
+	}
+	config, err := endorsementConfig(ctx)
+	if err != nil {
+		return err
+	}
+	return requireWriter(ctx, PlatformMSPID, config.BillingMSPID)
+}
+
+// beforeTransaction 管理合约的读写都要求管理员
+func (c *AdminContract) beforeTransaction(ctx contractapi.TransactionContextInterface) error {
+	return requireAdmin(ctx)
+}
+
+// unknownTransaction 调用了合约里不存在的函数
+func unknownTransaction(contractName string) func(ctx contractapi.TransactionContextInterface) error {
+	return func(ctx contractapi.TransactionContextInterface) error {
+		fn, _ := transactionName(ctx)
+		return fmt.Errorf("function %s does not exist in contract %s", fn, contractName)
+	}
+}
+
+// transactionName 去掉 "合约名:" 前缀后的函数名和参数
+func transactionName(ctx contractapi.TransactionContextInterface) (string, []string) {
+	fn, params := ctx.GetStub().GetFunctionAndParameters()
+	if i := strings.LastIndex(fn, ":"); i >= 0 {
+		fn = fn[i+1:]
+	}
+	return fn, params
+}
+
+// requireRecordKey 检查第一个参数（记录 key）不为空，返回函数名
+func requireRecordKey(ctx contractapi.TransactionContextInterface, keyless []string) (string, error) {
+	fn, params := transactionName(ctx)
+	if contains(keyless, fn) {
+		return fn, nil
+	}
+	if len(params) == 0 || strings.TrimSpace(params[0]) == "" {
+		return fn, fmt.Errorf("%s requires a non-empty key as the first argument", fn)
+	}
+	return fn, nil
+}
+
+// requireWriter 调用者必须属于 mspIDs 之一
+// 不接受其他组织的 role=admin 属性，任何组织的 CA 都能签发这个属性；管理员属于平台组织，本来就在 mspIDs 里
+func requireWriter(ctx contractapi.TransactionContextInterface, mspIDs ...string) error {
+	clientIdentity := ctx.GetClientIdentity()
+	if clientIdentity == nil {
+		return fmt.Errorf("permission denied: no client identity")
+	}
+	mspID, err := clientIdentity.GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get MSPID: %v", err)
+	}
+	if contains(mspIDs, mspID) {
+		return nil
+	}
+	return fmt.Errorf("permission denied: %s can not write", mspID)
+}
+
+// keyExists 跨合约检查 key 是否存在，不经过其他合约的交易函数
+func keyExists(ctx contractapi.TransactionContextInterface, key string) (bool, error) {
+	value, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	return value != nil, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/stretchr/testify/require"
+
+	"novel-resource-events/chaincode"
+	"novel-resource-events/ledgersim"
+)
+
+type hookContract interface {
+	GetBeforeTransaction() interface{}
+	GetUnknownTransaction() interface{}
+}
+
+// callHook 用 args 作为交易参数调用合约的 before/unknown 钩子
+func callHook(ledger *ledgersim.Ledger, hook interface{}, args ...string) error {
+	tx := ledger.Begin()
+	tx.Stub().SetArgs(args...)
+	return hook.(func(ctx contractapi.TransactionContextInterface) error)(tx.Context())
+}
+
+// contractTransactions 从链码元数据中读取每个合约的交易和标签
+func contractTransactions(t *testing.T, enableSeed bool) map[string]map[string][]string {
+	t.Helper()
+	cc, err := chaincode.NewChaincode(enableSeed)
+	require.NoError(t, err)
+	require.Equal(t, chaincode.NovelContractName, cc.DefaultContract)
+
+	tx := newLedger().Begin()
+	tx.Stub().SetArgs("org.hyperledger.fabric:GetMetadata")
+	response := cc.Invoke(tx.Stub())
+	require.Equal(t, int32(200), response.Status, response.Message)
+
+	var metadata struct {
+		Contracts map[string]struct {
+			Transactions []struct {
+				Name string   `json:"name"`
+				Tag  []string `json:"tag"`
+			} `json:"transactions"`
+		} `json:"contracts"`
+	}
+	require.NoError(t, json.Unmarshal(response.Payload, &metadata))
+
+	result := map[string]map[string][]string{}
+	for name, contract := range metadata.Contracts {
+		result[name] = map[string][]string{}
+		for _, transaction := range contract.Transactions {
+			result[name][transaction.Name] = transaction.Tag
+		}
+	}
+	return result
+}
+
+func TestContractMetadata(t *testing.T) {
+	transactions := contractTransactions(t, false)
+	require.Contains(t, transactions[chaincode.NovelContractName], "CreateNovel")
+	require.Contains(t, transactions[chaincode.CreditContractName], "ConsumeUserToken")
+	require.Contains(t, transactions[chaincode.AdminContractName], "SetPricing")
+	require.NotContains(t, transactions[chaincode.NovelContractName], "ConsumeUserToken")
+	require.NotContains(t, transactions[chaincode.CreditContractName], "SetPricing")
+	require.Contains(t, transactions[chaincode.CreditContractName]["ReadUserCredit"], "EVALUATE")
+	require.Contains(t, transactions[chaincode.CreditContractName]["ConsumeUserToken"], "SUBMIT")
+
+	// 默认不开放测试数据
+	require.NotContains(t, transactions[chaincode.AdminContractName], "InitLedger")
+	require.Contains(t, contractTransactions(t, true)[chaincode.AdminContractName], "InitLedger")
+}
+
+func TestBeforeTransaction(t *testing.T) {
+	tests := []struct {
+		name        string
+		contract    hookContract
+		identity    *ledgersim.ClientIdentity
+		args        []string
+		expectedErr string
+	}{
+		{name: "novel write from platform org", contract: new(chaincode.NovelContract), args: []string{"CreateNovel", "novel_001"}},
+		{name: "unprefixed novel read", contract: new(chaincode.NovelContract), args: []string{"GetAllNovels"}},
+		{name: "novel requires id", contract: new(chaincode.NovelContract), args: []string{"NovelContract:ReadNovel", " "}, expectedErr: "ReadNovel requires a non-empty key as the first argument"},
+		{
+			name:        "novel write from other org",
+			contract:    new(chaincode.NovelContract),
+			identity:    ledgersim.NewClientIdentity("Org2MSP", "CN=User1", nil),
+			args:        []string{"NovelContract:DeleteNovel", "novel_001"},
+			expectedErr: "permission denied: Org2MSP can not write",
+		},
+		{
+			name:     "credit write from billing org",
+			contract: new(chaincode.CreditContract),
+			identity: ledgersim.NewClientIdentity("Org2MSP", "CN=User1", nil),
+			args:     []string{"CreditContract:RechargeUserCredit", "user_001", "ORDER_001", "10"},
+		},
+		{
+			name:     "credit read from any org",
+			contract: new(chaincode.CreditContract),
+			identity: ledgersim.NewClientIdentity("Org3MSP", "CN=User1", nil),
+			args:     []string{"CreditContract:ReadUserCredit", "user_001"},
+		},
+		{
+			name:        "credit write from other org",
+			contract:    new(chaincode.CreditContract),
+			identity:    ledgersim.NewClientIdentity("Org3MSP", "CN=User1", nil),
+			args:        []string{"CreditContract:ConsumeUserToken", "user_001", "chat", ""},
+			expectedErr: "permission denied: Org3MSP can not write",
+		},
+		{
+			name:        "admin attribute from other org can not write credits",
+			contract:    new(chaincode.CreditContract),
+			identity:    ledgersim.NewClientIdentity("Org3MSP", "CN=ops", map[string]string{"role": "admin"}),
+			args:        []string{"CreditContract:RechargeUserCredit", "user_001", "ORDER_001", "10"},
+			expectedErr: "permission denied: Org3MSP can not write",
+		},
+		{
+			name:        "admin attribute from other org can not write novels",
+			contract:    new(chaincode.NovelContract),
+			identity:    ledgersim.NewClientIdentity("Org2MSP", "CN=ops", map[string]string{"role": "admin"}),
+			args:        []string{"NovelContract:DeleteNovel", "novel_001"},
+			expectedErr: "permission denied: Org2MSP can not write",
+		},
+		{name: "credit requires user id", contract: new(chaincode.CreditContract), args: []string{"CreditContract:HoldCredits", "", "10", "job_001", "60"}, expectedErr: "HoldCredits requires a non-empty key as the first argument"},
+		{name: "pricing needs no key", contract: new(chaincode.CreditContract), args: []string{"CreditContract:GetPricing"}},
+		{name: "admin from platform org", contract: new(chaincode.AdminContract), args: []string{"AdminContract:GetEndorsementConfig"}},
+		{
+			name:        "admin rejects other org",
+			contract:    new(chaincode.AdminContract),
+			identity:    ledgersim.NewClientIdentity("Org2MSP", "CN=User1", nil),
+			args:        []string{"AdminContract:GetEndorsementConfig"},
+			expectedErr: "permission denied: Org2MSP is not an admin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger()
+			if tt.identity != nil {
+				ledger.SetIdentity(tt.identity)
+			}
+
+			err := callHook(ledger, tt.contract.GetBeforeTransaction(), tt.args...)
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestUnknownTransaction(t *testing.T) {
+	ledger := newLedger()
+	err := callHook(ledger, new(chaincode.CreditContract).GetUnknownTransaction(), "CreditContract:SetPricing", "{}")
+	require.EqualError(t, err, "function SetPricing does not exist in contract CreditContract")
+}
+
+func TestInitLedgerDisabled(t *testing.T) {
+	ledger := newLedger()
+	contract := new(chaincode.AdminContract)
+
+	_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.InitLedger(ctx)
+		return err
+	})
+	require.EqualError(t, err, "InitLedger is disabled, start the chaincode with CHAINCODE_ENABLE_SEED=true to seed test data")
+	require.Nil(t, ledger.Get("novel_001"))
+}
@@ -0,0 +1,438 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/statebased"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+
+	model "novel-resource-model/v1"
+)
+
+// 高价值记录使用 key 级别背书策略（state-based endorsement），需要平台和账务组织同时背书
+// 小说等普通 key 不设置，继续使用链码级别的背书策略
+//
+// key 级别策略按交易之前已经提交的策略校验，同一笔交易里新建 key 时设置的策略管不到这笔交易本身，
+// 余额跨过门槛的那次写入也还是按旧策略校验。所以另有一个守卫 key endorsementguard~，
+// SetEndorsementConfig 创建它并设置平台和账务组织共同背书的策略，充值和让积分 key 升级为高价值的写入都要顺带写它
+const (
+	endorsementObjectType = "endorsement"
+	rechargeObjectType    = "recharge"
+	guardObjectType       = "endorsementguard"
+
+	// BillingMSPID 账务组织，高价值记录需要它和平台组织一起背书
+	BillingMSPID = "Org2MSP"
+	// DefaultHighValueThreshold 账本上没有配置时的高价值余额门槛
+	DefaultHighValueThreshold = 10000
+)
+
+// EndorsementConfig 高价值记录的背书配置
+// 用户余额（可用 + 预留）不低于 HighValueThreshold 时，积分 key 需要平台和账务组织背书，0 表示不按余额区分
+type EndorsementConfig = model.EndorsementConfig
+
+// KeyEndorsementPolicy 一个 key 当前的背书策略，KeyLevel 为 false 表示使用链码级别策略
+type KeyEndorsementPolicy = model.KeyEndorsementPolicy
+
+// RechargeOrder 充值订单，按订单号存在 recharge~orderSn，同一个订单只能入账一次
+type RechargeOrder = model.RechargeOrder
+
+// endorsementGuard 守卫 key 的值，只记录最后一次写入它的交易
+type endorsementGuard struct {
+	TxID      string `json:"txId"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// GetEndorsementConfig 当前的高价值背书配置，没有配置时返回默认值
+func (s *AdminContract) GetEndorsementConfig(ctx contractapi.TransactionContextInterface) (*EndorsementConfig, error) {
+	return endorsementConfig(ctx)
+}
+
+// SetEndorsementConfig 管理员修改高价值门槛和账务组织，同时按新配置设置守卫 key 的策略
+// 部署后要先调用一次，否则充值会被拒绝；已有的积分 key 在下一次写入时按新配置调整
+func (s *AdminContract) SetEndorsementConfig(ctx contractapi.TransactionContextInterface, highValueThreshold int, billingMspId string) (*EndorsementConfig, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if highValueThreshold < 0 {
+		return nil, fmt.Errorf("high value threshold can not be negative")
+	}
+	if billingMspId == "" {
+		return nil, fmt.Errorf("billingMspId can not be empty")
+	}
+
+	previous, err := endorsementConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimeString(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &EndorsementConfig{
+		HighValueThreshold: highValueThreshold,
+		BillingMSPID:       billingMspId,
+		UpdatedAt:          now,
+		UpdatedBy:          actorOf(ctx),
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(endorsementObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("create endorsement key failed:%v", err)
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("marshal failed:%v", err)
+	}
+	if err := ctx.GetStub().PutState(key, configJSON); err != nil {
+		return nil, fmt.Errorf("put state failed:%v", err)
+	}
+	guardKey, err := putEndorsementGuard(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := setKeyPolicy(ctx, guardKey, highValueOrgs(config)); err != nil {
+		return nil, err
+	}
+
+	if err := emitEvent(ctx, EventSetEndorsementConfig, EntityEndorsement, endorsementObjectType, config, previous); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// GetKeyEndorsementPolicy 查看用户积分或充值订单 key 的背书策略
+func (s *AdminContract) GetKeyEndorsementPolicy(ctx contractapi.TransactionContextInterface, entityType string, entityId string) (*KeyEndorsementPolicy, error) {
+	key, err := endorsableKey(ctx, entityType, entityId)
+	if err != nil {
+		return nil, err
+	}
+	orgs, err := keyPolicyOrgs(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if orgs == nil {
+		return &KeyEndorsementPolicy{EntityType: entityType, EntityID: entityId, Orgs: []string{}}, nil
+	}
+	return &KeyEndorsementPolicy{EntityType: entityType, EntityID: entityId, KeyLevel: true, Orgs: orgs}, nil
+}
+
+// SetKeyEndorsementPolicy 管理员修改 key 的背书策略，orgs 为空表示恢复链码级别策略
+// 注意：修改本身也要满足 key 当前的策略
+func (s *AdminContract) SetKeyEndorsementPolicy(ctx contractapi.TransactionContextInterface, entityType string, entityId string, orgs []string) (*KeyEndorsementPolicy, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	key, err := endorsableKey(ctx, entityType, entityId)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if existing == nil {
+		return nil, fmt.Errorf("%s %s does not exist", entityType, entityId)
+	}
+
+	previous, err := s.GetKeyEndorsementPolicy(ctx, entityType, entityId)
+	if err != nil {
+		return nil, err
+	}
+	orgs = sortedOrgs(orgs)
+	if err := setKeyPolicy(ctx, key, orgs); err != nil {
+		return nil, err
+	}
+
+	policy := &KeyEndorsementPolicy{EntityType: entityType, EntityID: entityId, KeyLevel: len(orgs) > 0, Orgs: orgs}
+	if err := emitEvent(ctx, EventSetKeyEndorsementPolicy, EntityEndorsement, entityId, policy, previous); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// RechargeUserCredit 充值入账，同一个订单号只能入账一次
+// 每笔充值都写守卫 key，所以总是需要平台和账务组织共同背书；订单 key 也设置同样的策略，之后的修改同样需要两个组织
+func (s *CreditContract) RechargeUserCredit(ctx contractapi.TransactionContextInterface, userId string, orderSn string, amount int) (*UserCredit, error) {
+	if orderSn == "" {
+		return nil, fmt.Errorf("orderSn can not be empty")
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("recharge amount must be positive")
+	}
+
+	orderKey, err := ctx.GetStub().CreateCompositeKey(rechargeObjectType, []string{orderSn})
+	if err != nil {
+		return nil, fmt.Errorf("create recharge key failed:%v", err)
+	}
+	existingOrder, err := ctx.GetStub().GetState(orderKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if existingOrder != nil {
+		return nil, fmt.Errorf("recharge order %s already exists", orderSn)
+	}
+
+	existing, err := s.ReadUserCredit(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("read failed:%v", err)
+	}
+	if err := touchEndorsementGuard(ctx); err != nil {
+		return nil, err
+	}
+	now, err := txTimeString(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *existing
+	updated.Credit += amount
+	updated.TotalRecharge += amount
+	updated.UpdatedAt = now
+	if err := putUserCredit(ctx, &updated); err != nil {
+		return nil, err
+	}
+
+	order := &RechargeOrder{
+		OrderSN:   orderSn,
+		UserID:    userId,
+		Amount:    amount,
+		TxID:      ctx.GetStub().GetTxID(),
+		CreatedAt: now,
+	}
+	orderJSON, err := json.Marshal(order)
+	if err != nil {
+		return nil, fmt.Errorf("marshal failed:%v", err)
+	}
+	if err := ctx.GetStub().PutState(orderKey, orderJSON); err != nil {
+		return nil, fmt.Errorf("put state failed:%v", err)
+	}
+	config, err := endorsementConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := setKeyPolicy(ctx, orderKey, highValueOrgs(config)); err != nil {
+		return nil, err
+	}
+
+	history := &CreditHistory{
+		UserID:      userId,
+		Amount:      amount,
+		Type:        "recharge",
+		Description: fmt.Sprintf("recharge order %s", orderSn),
+		Timestamp:   now,
+		TxID:        ctx.GetStub().GetTxID(),
+	}
+	if err := putCreditHistory(ctx, history); err != nil {
+		return nil, err
+	}
+
+	if err := emitCreditEvent(ctx, EventRechargeUserCredit, &updated, existing, history, nil); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// ReadRechargeOrder 按订单号读取充值订单
+func (s *CreditContract) ReadRechargeOrder(ctx contractapi.TransactionContextInterface, orderSn string) (*RechargeOrder, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(rechargeObjectType, []string{orderSn})
+	if err != nil {
+		return nil, fmt.Errorf("create recharge key failed:%v", err)
+	}
+	orderJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if orderJSON == nil {
+		return nil, fmt.Errorf("recharge order %s does not exist", orderSn)
+	}
+
+	var order RechargeOrder
+	if err := json.Unmarshal(orderJSON, &order); err != nil {
+		return nil, fmt.Errorf("unmarshal failed:%v", err)
+	}
+	return &order, nil
+}
+
+// applyCreditEndorsement 积分写入后按余额调整 key 的背书策略
+// 余额达到门槛时要求平台和账务组织背书，升级的这笔交易写守卫 key，让它本身也需要两个组织背书；
+// 低于门槛时只撤销自动加上的策略，管理员手动设置的策略保持不变
+func applyCreditEndorsement(ctx contractapi.TransactionContextInterface, userCredit *UserCredit) error {
+	config, err := endorsementConfig(ctx)
+	if err != nil {
+		return err
+	}
+	current, err := keyPolicyOrgs(ctx, userCredit.UserID)
+	if err != nil {
+		return err
+	}
+
+	highValue := highValueOrgs(config)
+	if config.HighValueThreshold > 0 && userCredit.Credit+userCredit.Held >= config.HighValueThreshold {
+		if sameOrgs(current, highValue) {
+			return nil
+		}
+		if err := touchEndorsementGuard(ctx); err != nil {
+			return err
+		}
+		return setKeyPolicy(ctx, userCredit.UserID, highValue)
+	}
+	if current != nil && sameOrgs(current, highValue) {
+		return setKeyPolicy(ctx, userCredit.UserID, nil)
+	}
+	return nil
+}
+
+// endorsementConfig 读取背书配置，没有配置时返回默认值
+func endorsementConfig(ctx contractapi.TransactionContextInterface) (*EndorsementConfig, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(endorsementObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("create endorsement key failed:%v", err)
+	}
+	configJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if configJSON == nil {
+		return &EndorsementConfig{HighValueThreshold: DefaultHighValueThreshold, BillingMSPID: BillingMSPID}, nil
+	}
+
+	var config EndorsementConfig
+	if err := json.Unmarshal(configJSON, &config); err != nil {
+		return nil, fmt.Errorf("unmarshal failed:%v", err)
+	}
+	return &config, nil
+}
+
+// touchEndorsementGuard 写一次守卫 key，让当前交易必须满足它的策略
+// 守卫 key 不存在时拒绝，否则这次写入会在没有策略的情况下新建它
+func touchEndorsementGuard(ctx contractapi.TransactionContextInterface) error {
+	key, err := ctx.GetStub().CreateCompositeKey(guardObjectType, []string{})
+	if err != nil {
+		return fmt.Errorf("create endorsement guard key failed:%v", err)
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if existing == nil {
+		return fmt.Errorf("endorsement guard is not initialized, call SetEndorsementConfig first")
+	}
+	_, err = putEndorsementGuard(ctx)
+	return err
+}
+
+// putEndorsementGuard 写入守卫 key，返回 key
+func putEndorsementGuard(ctx contractapi.TransactionContextInterface) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(guardObjectType, []string{})
+	if err != nil {
+		return "", fmt.Errorf("create endorsement guard key failed:%v", err)
+	}
+	now, err := txTimeString(ctx)
+	if err != nil {
+		return "", err
+	}
+	guardJSON, err := json.Marshal(&endorsementGuard{TxID: ctx.GetStub().GetTxID(), UpdatedAt: now})
+	if err != nil {
+		return "", fmt.Errorf("marshal failed:%v", err)
+	}
+	if err := ctx.GetStub().PutState(key, guardJSON); err != nil {
+		return "", fmt.Errorf("put state failed:%v", err)
+	}
+	return key, nil
+}
+
+// endorsableKey 只有用户积分和充值订单可以设置 key 级别策略
+func endorsableKey(ctx contractapi.TransactionContextInterface, entityType string, entityId string) (string, error) {
+	if entityId == "" {
+		return "", fmt.Errorf("entityId can not be empty")
+	}
+	switch entityType {
+	case EntityUserCredit:
+		return entityId, nil
+	case EntityRechargeOrder:
+		key, err := ctx.GetStub().CreateCompositeKey(rechargeObjectType, []string{entityId})
+		if err != nil {
+			return "", fmt.Errorf("create recharge key failed:%v", err)
+		}
+		return key, nil
+	default:
+		return "", fmt.Errorf("entity type %s does not support key level endorsement", entityType)
+	}
+}
+
+// keyPolicyOrgs 返回 key 级别策略中的组织，没有 key 级别策略时返回 nil
+func keyPolicyOrgs(ctx contractapi.TransactionContextInterface, key string) ([]string, error) {
+	ep, err := ctx.GetStub().GetStateValidationParameter(key)
+	if err != nil {
+		return nil, fmt.Errorf("get validation parameter failed:%v", err)
+	}
+	if len(ep) == 0 {
+		return nil, nil
+	}
+	policy, err := statebased.NewStateEP(ep)
+	if err != nil {
+		return nil, fmt.Errorf("parse validation parameter failed:%v", err)
+	}
+	return sortedOrgs(policy.ListOrgs()), nil
+}
+
+// setKeyPolicy 设置需要 orgs 中每个组织的成员都背书的策略，orgs 为空时清除
+func setKeyPolicy(ctx contractapi.TransactionContextInterface, key string, orgs []string) error {
+	if len(orgs) == 0 {
+		if err := ctx.GetStub().SetStateValidationParameter(key, nil); err != nil {
+			return fmt.Errorf("clear validation parameter failed:%v", err)
+		}
+		return nil
+	}
+
+	policy, err := statebased.NewStateEP(nil)
+	if err != nil {
+		return fmt.Errorf("create endorsement policy failed:%v", err)
+	}
+	if err := policy.AddOrgs(statebased.RoleTypeMember, orgs...); err != nil {
+		return fmt.Errorf("add orgs to endorsement policy failed:%v", err)
+	}
+	ep, err := policy.Policy()
+	if err != nil {
+		return fmt.Errorf("marshal endorsement policy failed:%v", err)
+	}
+	if err := ctx.GetStub().SetStateValidationParameter(key, ep); err != nil {
+		return fmt.Errorf("set validation parameter failed:%v", err)
+	}
+	return nil
+}
+
+func highValueOrgs(config *EndorsementConfig) []string {
+	return sortedOrgs([]string{PlatformMSPID, config.BillingMSPID})
+}
+
+// sortedOrgs 去重并排序，ListOrgs 的顺序不固定
+func sortedOrgs(orgs []string) []string {
+	if len(orgs) == 0 {
+		return []string{}
+	}
+	seen := make(map[string]bool, len(orgs))
+	result := make([]string, 0, len(orgs))
+	for _, org := range orgs {
+		if org != "" && !seen[org] {
+			seen[org] = true
+			result = append(result, org)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func sameOrgs(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
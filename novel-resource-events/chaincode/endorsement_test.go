@@ -0,0 +1,285 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/stretchr/testify/require"
+
+	"novel-resource-events/chaincode"
+	"novel-resource-events/ledgersim"
+)
+
+func setEndorsementThreshold(t *testing.T, ledger *ledgersim.Ledger, contract *contracts, threshold int) {
+	t.Helper()
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.SetEndorsementConfig(ctx, threshold, chaincode.BillingMSPID)
+		return err
+	})
+}
+
+func keyPolicy(t *testing.T, ledger *ledgersim.Ledger, contract *contracts, entityType, entityId string) *chaincode.KeyEndorsementPolicy {
+	t.Helper()
+	var policy *chaincode.KeyEndorsementPolicy
+	_, err := ledger.Evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		policy, err = contract.GetKeyEndorsementPolicy(ctx, entityType, entityId)
+		return err
+	})
+	require.NoError(t, err)
+	return policy
+}
+
+func TestRechargeUserCredit(t *testing.T) {
+	ledger := newLedger()
+	contract := newContracts()
+	createUserCredit(t, ledger, contract, "user_001", 100)
+
+	// 守卫 key 由 SetEndorsementConfig 创建，之前的充值没有双组织策略保护，直接拒绝
+	_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.RechargeUserCredit(ctx, "user_001", "ORDER_001", 150)
+		return err
+	})
+	require.EqualError(t, err, "endorsement guard is not initialized, call SetEndorsementConfig first")
+	setEndorsementThreshold(t, ledger, contract, chaincode.DefaultHighValueThreshold)
+
+	tx := mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.RechargeUserCredit(ctx, "user_001", "ORDER_001", 150)
+		return err
+	})
+
+	userCredit, err := readUserCredit(t, ledger, contract, "user_001")
+	require.NoError(t, err)
+	require.Equal(t, 250, userCredit.Credit)
+	require.Equal(t, 150, userCredit.TotalRecharge)
+
+	envelope := decodeEnvelope(t, tx)
+	require.Equal(t, chaincode.EventRechargeUserCredit, envelope.Type)
+	require.NotNil(t, envelope.History)
+	require.Equal(t, 150, envelope.History.Amount)
+	require.Equal(t, "recharge", envelope.History.Type)
+
+	// 订单 key 总是需要平台和账务组织背书，余额没到门槛的积分 key 不变
+	orderPolicy := keyPolicy(t, ledger, contract, chaincode.EntityRechargeOrder, "ORDER_001")
+	require.True(t, orderPolicy.KeyLevel)
+	require.Equal(t, []string{"Org1MSP", "Org2MSP"}, orderPolicy.Orgs)
+	require.False(t, keyPolicy(t, ledger, contract, chaincode.EntityUserCredit, "user_001").KeyLevel)
+
+	_, err = ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.RechargeUserCredit(ctx, "user_001", "ORDER_001", 150)
+		return err
+	})
+	require.EqualError(t, err, "recharge order ORDER_001 already exists")
+
+	var order *chaincode.RechargeOrder
+	_, err = ledger.Evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		order, err = contract.ReadRechargeOrder(ctx, "ORDER_001")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, "user_001", order.UserID)
+	require.Equal(t, tx.TxID(), order.TxID)
+}
+
+func TestRechargeUserCreditValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		userId      string
+		orderSn     string
+		amount      int
+		expectedErr string
+	}{
+		{name: "rejects empty order", userId: "user_001", amount: 10, expectedErr: "orderSn can not be empty"},
+		{name: "rejects non-positive amount", userId: "user_001", orderSn: "ORDER_001", expectedErr: "recharge amount must be positive"},
+		{name: "rejects missing user", userId: "user_404", orderSn: "ORDER_001", amount: 10, expectedErr: "read failed:user_404 is not existed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger()
+			contract := newContracts()
+			createUserCredit(t, ledger, contract, "user_001", 100)
+
+			_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+				_, err := contract.RechargeUserCredit(ctx, tt.userId, tt.orderSn, tt.amount)
+				return err
+			})
+			require.EqualError(t, err, tt.expectedErr)
+		})
+	}
+}
+
+func TestHighValueCreditEndorsement(t *testing.T) {
+	ledger := newLedger()
+	contract := newContracts()
+	setEndorsementThreshold(t, ledger, contract, 500)
+	createUserCredit(t, ledger, contract, "user_001", 100)
+	require.Nil(t, ledger.ValidationParameter("user_001"))
+
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.RechargeUserCredit(ctx, "user_001", "ORDER_001", 400)
+		return err
+	})
+	policy := keyPolicy(t, ledger, contract, chaincode.EntityUserCredit, "user_001")
+	require.True(t, policy.KeyLevel)
+	require.Equal(t, []string{"Org1MSP", "Org2MSP"}, policy.Orgs)
+
+	// 预留的积分仍然属于用户，余额按可用 + 预留计算
+	holdCredits(t, ledger, contract, "user_001", 300, "job_001", 600)
+	require.True(t, keyPolicy(t, ledger, contract, chaincode.EntityUserCredit, "user_001").KeyLevel)
+
+	// 扣款后余额低于门槛，自动加上的策略被撤销
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.CaptureHold(ctx, "job_001", 300)
+		return err
+	})
+	require.False(t, keyPolicy(t, ledger, contract, chaincode.EntityUserCredit, "user_001").KeyLevel)
+	require.Nil(t, ledger.ValidationParameter("user_001"))
+}
+
+func TestHighValueWritesNeedBillingEndorsement(t *testing.T) {
+	tests := []struct {
+		name      string
+		endorsers []string
+		write     func(ctx contractapi.TransactionContextInterface, contract *contracts) error
+		rejected  bool
+	}{
+		{
+			name:      "platform only recharge",
+			endorsers: []string{chaincode.PlatformMSPID},
+			write: func(ctx contractapi.TransactionContextInterface, contract *contracts) error {
+				_, err := contract.RechargeUserCredit(ctx, "user_001", "ORDER_001", 10)
+				return err
+			},
+			rejected: true,
+		},
+		{
+			name:      "recharge endorsed by both orgs",
+			endorsers: []string{chaincode.PlatformMSPID, chaincode.BillingMSPID},
+			write: func(ctx contractapi.TransactionContextInterface, contract *contracts) error {
+				_, err := contract.RechargeUserCredit(ctx, "user_001", "ORDER_001", 10)
+				return err
+			},
+		},
+		{
+			name:      "platform only update crossing the threshold",
+			endorsers: []string{chaincode.PlatformMSPID},
+			write: func(ctx contractapi.TransactionContextInterface, contract *contracts) error {
+				return contract.UpdateUserCredit(ctx, "user_001", 500, 0, 0)
+			},
+			rejected: true,
+		},
+		{
+			name:      "platform only update below the threshold",
+			endorsers: []string{chaincode.PlatformMSPID},
+			write: func(ctx contractapi.TransactionContextInterface, contract *contracts) error {
+				return contract.UpdateUserCredit(ctx, "user_001", 200, 0, 0)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger()
+			contract := newContracts()
+			setEndorsementThreshold(t, ledger, contract, 500)
+			createUserCredit(t, ledger, contract, "user_001", 100)
+
+			ledger.SetEndorsers(tt.endorsers...)
+			_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+				return tt.write(ctx, contract)
+			})
+			if tt.rejected {
+				require.ErrorContains(t, err, "ENDORSEMENT_POLICY_FAILURE")
+				userCredit, err := readUserCredit(t, ledger, contract, "user_001")
+				require.NoError(t, err)
+				require.Equal(t, 100, userCredit.Credit)
+				require.Nil(t, ledger.ValidationParameter("user_001"))
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestNovelKeysKeepChaincodePolicy(t *testing.T) {
+	ledger := newLedger()
+	contract := newContracts()
+	setEndorsementThreshold(t, ledger, contract, 1)
+	createNovel(t, ledger, contract, "novel_001")
+	require.Nil(t, ledger.ValidationParameter("novel_001"))
+
+	_, err := ledger.Evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.GetKeyEndorsementPolicy(ctx, chaincode.EntityNovel, "novel_001")
+		return err
+	})
+	require.EqualError(t, err, "entity type Novel does not support key level endorsement")
+}
+
+func TestSetKeyEndorsementPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		identity    *ledgersim.ClientIdentity
+		entityType  string
+		entityId    string
+		orgs        []string
+		expectedErr string
+	}{
+		{name: "admin sets a custom policy", entityType: chaincode.EntityUserCredit, entityId: "user_001", orgs: []string{"Org3MSP", "Org1MSP", "Org1MSP"}},
+		{name: "admin clears the policy", entityType: chaincode.EntityUserCredit, entityId: "user_001"},
+		{name: "missing key", entityType: chaincode.EntityUserCredit, entityId: "user_404", orgs: []string{"Org1MSP"}, expectedErr: "UserCredit user_404 does not exist"},
+		{name: "novel keys are not supported", entityType: chaincode.EntityNovel, entityId: "novel_001", orgs: []string{"Org1MSP"}, expectedErr: "entity type Novel does not support key level endorsement"},
+		{
+			name:        "rejects non admin",
+			identity:    ledgersim.NewClientIdentity("Org2MSP", "CN=User1", nil),
+			entityType:  chaincode.EntityUserCredit,
+			entityId:    "user_001",
+			orgs:        []string{"Org2MSP"},
+			expectedErr: "permission denied: Org2MSP is not an admin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger()
+			contract := newContracts()
+			createUserCredit(t, ledger, contract, "user_001", 100)
+			if tt.identity != nil {
+				ledger.SetIdentity(tt.identity)
+			}
+
+			tx, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+				_, err := contract.SetKeyEndorsementPolicy(ctx, tt.entityType, tt.entityId, tt.orgs)
+				return err
+			})
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, chaincode.EventSetKeyEndorsementPolicy, decodeEnvelope(t, tx).Type)
+
+			policy := keyPolicy(t, ledger, contract, tt.entityType, tt.entityId)
+			require.Equal(t, len(tt.orgs) > 0, policy.KeyLevel)
+			if policy.KeyLevel {
+				require.Equal(t, []string{"Org1MSP", "Org3MSP"}, policy.Orgs)
+			}
+		})
+	}
+}
+
+func TestManualPolicySurvivesLowBalance(t *testing.T) {
+	ledger := newLedger()
+	contract := newContracts()
+	createUserCredit(t, ledger, contract, "user_001", 100)
+
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.SetKeyEndorsementPolicy(ctx, chaincode.EntityUserCredit, "user_001", []string{"Org3MSP"})
+		return err
+	})
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.UpdateUserCredit(ctx, "user_001", 50, 50, 0)
+	})
+	require.Equal(t, []string{"Org3MSP"}, keyPolicy(t, ledger, contract, chaincode.EntityUserCredit, "user_001").Orgs)
+}
@@ -0,0 +1,190 @@
+package chaincode
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// EventSchemaVersion 当前事件信封的版本号，旧版（裸实体JSON）事件视为版本 0
+const EventSchemaVersion = 1
+
+// 事件类型，同时也是 SetEvent 使用的事件名
+const (
+	EventCreateNovel      = "CreateNovel"
+	EventUpdateNovel      = "UpdateNovel"
+	EventDeleteNovel      = "DeleteNovel"
+	EventCreateUserCredit = "CreateUserCredit"
+	EventUpdateUserCredit = "UpdateUserCredit"
+	EventDeleteUserCredit = "DeleteUserCredit"
+	EventConsumeUserToken = "ConsumeUserToken"
+	EventSetPricing       = "SetPricing"
+	EventHoldCredits      = "HoldCredits"
+	EventCaptureHold      = "CaptureHold"
+	EventReleaseHold      = "ReleaseHold"
+	EventExpireHolds      = "ReleaseExpiredHolds"
+
+	EventSetSpendingLimit    = "SetSpendingLimit"
+	EventDeleteSpendingLimit = "DeleteSpendingLimit"
+
+	EventRechargeUserCredit      = "RechargeUserCredit"
+	EventSetEndorsementConfig    = "SetEndorsementConfig"
+	EventSetKeyEndorsementPolicy = "SetKeyEndorsementPolicy"
+
+	EventAnchorSnapshot = "AnchorSnapshot"
+)
+
+// 实体类型
+const (
+	EntityNovel         = "Novel"
+	EntityUserCredit    = "UserCredit"
+	EntityPricing       = "Pricing"
+	EntitySpendingLimit = "SpendingLimit"
+	EntityRechargeOrder = "RechargeOrder"
+	EntityEndorsement   = "Endorsement"
+	EntitySnapshot      = "Snapshot"
+)
+
+// EventEnvelope 所有链码事件统一使用的信封结构
+// data 是变更后的实体（删除事件为空），previous 是变更前的实体（创建事件为空）
+type EventEnvelope struct {
+	Type          string          `json:"type"`
+	SchemaVersion int             `json:"schemaVersion"`
+	EntityType    string          `json:"entityType"`
+	EntityKey     string          `json:"entityKey"`
+	TxID          string          `json:"txId"`
+	Actor         string          `json:"actor"`
+	Timestamp     string          `json:"timestamp"`
+	Data          json.RawMessage `json:"data,omitempty"`
+	Previous      json.RawMessage `json:"previous,omitempty"`
+	// History 积分变动类事件附带的积分历史，其他事件为空
+	History *CreditHistory `json:"history,omitempty"`
+	// Holds 本次交易中状态发生变化的积分预留（创建、扣款、释放、过期）
+	Holds []*CreditHold `json:"holds,omitempty"`
+	// TraceParent 客户端在 transient 字段 traceparent 里传的 W3C trace context，事件监听器用它关联回发起交易的请求
+	TraceParent string `json:"traceparent,omitempty"`
+}
+
+// emitEvent 组装事件信封并调用 SetEvent
+// 注意：Fabric 每个交易只保留最后一次 SetEvent，所以一个交易只调用一次
+func emitEvent(ctx contractapi.TransactionContextInterface, eventType string, entityType string, entityKey string,
+	data interface{}, previous interface{}) error {
+	return emitEnvelope(ctx, eventType, entityType, entityKey, data, previous, nil, nil)
+}
+
+// emitCreditEvent 用户积分变动事件，额外附带积分历史和变化的预留，没有时传 nil
+func emitCreditEvent(ctx contractapi.TransactionContextInterface, eventType string, userCredit *UserCredit, previous *UserCredit,
+	history *CreditHistory, holds []*CreditHold) error {
+	return emitEnvelope(ctx, eventType, EntityUserCredit, userCredit.UserID, userCredit, previous, history, holds)
+}
+
+func emitEnvelope(ctx contractapi.TransactionContextInterface, eventType string, entityType string, entityKey string,
+	data interface{}, previous interface{}, history *CreditHistory, holds []*CreditHold) error {
+	stub := ctx.GetStub()
+
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	envelope := EventEnvelope{
+		Type:          eventType,
+		SchemaVersion: EventSchemaVersion,
+		EntityType:    entityType,
+		EntityKey:     entityKey,
+		TxID:          stub.GetTxID(),
+		Actor:         actorOf(ctx),
+		Timestamp:     timestamp.Format(time.RFC3339Nano),
+		TraceParent:   traceParentOf(ctx),
+		History:       history,
+		Holds:         holds,
+	}
+
+	if envelope.Data, err = marshalEventPart(data); err != nil {
+		return fmt.Errorf("failed to marshal event data: %v", err)
+	}
+	if envelope.Previous, err = marshalEventPart(previous); err != nil {
+		return fmt.Errorf("failed to marshal event previous: %v", err)
+	}
+
+	envelopeJSON, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event envelope: %v", err)
+	}
+
+	if err := stub.SetEvent(eventType, envelopeJSON); err != nil {
+		return fmt.Errorf("failed to set event %s: %v", eventType, err)
+	}
+	return nil
+}
+
+// traceParentKey 交易 transient 字段里 trace context 的 key
+const traceParentKey = "traceparent"
+
+// maxTraceParentLength W3C traceparent 固定 55 个字符，留一些余量给以后的版本，过长的值直接丢弃
+const maxTraceParentLength = 128
+
+// traceParentOf 读取交易 transient 字段里的 traceparent，只用来关联链路，不写入账本状态
+// transient 数据不会进入交易，但会进入事件，所以所有背书节点拿到的是同一个值，读写集保持一致
+func traceParentOf(ctx contractapi.TransactionContextInterface) string {
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return ""
+	}
+	traceParent := transient[traceParentKey]
+	if len(traceParent) > maxTraceParentLength {
+		return ""
+	}
+	return string(traceParent)
+}
+
+// marshalEventPart nil 的部分直接省略，避免出现 "data": null
+func marshalEventPart(part interface{}) (json.RawMessage, error) {
+	if part == nil {
+		return nil, nil
+	}
+	return json.Marshal(part)
+}
+
+// txTimestamp 使用交易时间戳，所有背书节点得到的结果一致
+func txTimestamp(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	ts, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get tx timestamp: %v", err)
+	}
+	return ts.AsTime().UTC(), nil
+}
+
+// ledgerTimeLayout CreatedAt/UpdatedAt 等字段使用的时间格式（UTC）
+const ledgerTimeLayout = "2006-01-02 15:04:05"
+
+// txTimeString 交易时间戳，格式和 CreatedAt/UpdatedAt 保持一致
+func txTimeString(ctx contractapi.TransactionContextInterface) (string, error) {
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return "", err
+	}
+	return timestamp.Format(ledgerTimeLayout), nil
+}
+
+// actorOf 返回 "MSPID:身份ID"，取不到身份时返回空字符串
+func actorOf(ctx contractapi.TransactionContextInterface) string {
+	clientIdentity := ctx.GetClientIdentity()
+	if clientIdentity == nil {
+		return ""
+	}
+
+	mspID, _ := clientIdentity.GetMSPID()
+	id, err := clientIdentity.GetID()
+	if err != nil {
+		return mspID
+	}
+	// GetID 返回的是 base64 编码的 "x509::subject::issuer"
+	if decoded, err := base64.StdEncoding.DecodeString(id); err == nil {
+		id = string(decoded)
+	}
+	return mspID + ":" + id
+}
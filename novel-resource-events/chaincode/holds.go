@@ -0,0 +1,403 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+
+	model "novel-resource-model/v1"
+)
+
+// 预留记录存在 hold~holdId 下；holdidx~userId~holdId 只索引还没结束的预留，便于按用户清理过期预留
+const (
+	holdObjectType      = "hold"
+	holdIndexObjectType = "holdidx"
+)
+
+// MaxHoldTTL 单个预留最长的有效期（秒）
+const MaxHoldTTL = 24 * 60 * 60
+
+// 预留状态
+const (
+	HoldStatusHeld     = model.HoldStatusHeld
+	HoldStatusCaptured = model.HoldStatusCaptured
+	HoldStatusReleased = model.HoldStatusReleased
+	HoldStatusExpired  = model.HoldStatusExpired
+)
+
+// CreditHold 两阶段扣费的积分预留：先 HoldCredits 冻结，任务成功后 CaptureHold 按实际用量扣费，失败则 ReleaseHold
+type CreditHold = model.CreditHold
+
+// HoldCredits 从可用余额中预留 amount 个积分，ttl 秒后没有扣款或释放的预留会自动退回
+func (s *CreditContract) HoldCredits(ctx contractapi.TransactionContextInterface, userId string, amount int, holdId string, ttl int) (*CreditHold, error) {
+	if holdId == "" {
+		return nil, fmt.Errorf("holdId can not be empty")
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("hold amount must be positive")
+	}
+	if ttl <= 0 || ttl > MaxHoldTTL {
+		return nil, fmt.Errorf("hold ttl must be between 1 and %d seconds", MaxHoldTTL)
+	}
+
+	existingHold, err := readHold(ctx, holdId)
+	if err != nil {
+		return nil, err
+	}
+	if existingHold != nil {
+		return nil, fmt.Errorf("hold %s already exists", holdId)
+	}
+
+	existing, err := s.ReadUserCredit(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("read failed:%v", err)
+	}
+
+	updated := *existing
+	changed, err := expireHolds(ctx, &updated)
+	if err != nil {
+		return nil, err
+	}
+	if updated.Credit < amount {
+		return nil, fmt.Errorf("insufficient credit for %s: need %d, have %d", userId, amount, updated.Credit)
+	}
+	// 预留时检查限额，扣款时只记录用量，保证跑完的任务一定能扣款
+	if err := checkSpending(ctx, &updated, amount); err != nil {
+		return nil, err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hold := &CreditHold{
+		HoldID:    holdId,
+		UserID:    userId,
+		Amount:    amount,
+		Status:    HoldStatusHeld,
+		ExpiresAt: now.Add(time.Duration(ttl) * time.Second).Format(ledgerTimeLayout),
+		CreatedAt: now.Format(ledgerTimeLayout),
+		UpdatedAt: now.Format(ledgerTimeLayout),
+	}
+	updated.Credit -= amount
+	updated.Held += amount
+	updated.UpdatedAt = hold.UpdatedAt
+
+	if err := putHold(ctx, hold); err != nil {
+		return nil, err
+	}
+	if err := putUserCredit(ctx, &updated); err != nil {
+		return nil, err
+	}
+
+	changed = append(changed, hold)
+	if err := emitCreditEvent(ctx, EventHoldCredits, &updated, existing, nil, changed); err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// CaptureHold 按实际用量扣费，actualAmount 不能超过预留的积分，多出的部分退回可用余额
+func (s *CreditContract) CaptureHold(ctx contractapi.TransactionContextInterface, holdId string, actualAmount int) (*CreditHold, error) {
+	hold, err := activeHold(ctx, holdId)
+	if err != nil {
+		return nil, err
+	}
+	if actualAmount < 0 || actualAmount > hold.Amount {
+		return nil, fmt.Errorf("actual amount must be between 0 and %d", hold.Amount)
+	}
+
+	expired, err := holdExpired(ctx, hold)
+	if err != nil {
+		return nil, err
+	}
+	if expired {
+		return nil, fmt.Errorf("hold %s expired at %s", holdId, hold.ExpiresAt)
+	}
+
+	existing, err := s.ReadUserCredit(ctx, hold.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("read failed:%v", err)
+	}
+
+	now, err := txTimeString(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *existing
+	updated.Held -= hold.Amount
+	updated.Credit += hold.Amount - actualAmount
+	updated.TotalUsed += actualAmount
+	updated.UpdatedAt = now
+
+	hold.Status = HoldStatusCaptured
+	hold.CapturedAmount = actualAmount
+	hold.UpdatedAt = now
+
+	if err := putHold(ctx, hold); err != nil {
+		return nil, err
+	}
+	if err := putUserCredit(ctx, &updated); err != nil {
+		return nil, err
+	}
+	if err := recordSpending(ctx, hold.UserID, actualAmount); err != nil {
+		return nil, err
+	}
+
+	var history *CreditHistory
+	if actualAmount > 0 {
+		history = &CreditHistory{
+			UserID:      hold.UserID,
+			Amount:      -actualAmount,
+			Type:        "consume",
+			Description: fmt.Sprintf("capture hold %s", holdId),
+			Timestamp:   now,
+			TxID:        ctx.GetStub().GetTxID(),
+		}
+		if err := putCreditHistory(ctx, history); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := emitCreditEvent(ctx, EventCaptureHold, &updated, existing, history, []*CreditHold{hold}); err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// ReleaseHold 取消预留，积分全部退回可用余额；已经过期但还没被清理的预留也可以释放
+func (s *CreditContract) ReleaseHold(ctx contractapi.TransactionContextInterface, holdId string) (*CreditHold, error) {
+	hold, err := activeHold(ctx, holdId)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.ReadUserCredit(ctx, hold.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("read failed:%v", err)
+	}
+
+	now, err := txTimeString(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *existing
+	refundHold(&updated, hold, HoldStatusReleased, now)
+
+	if err := putHold(ctx, hold); err != nil {
+		return nil, err
+	}
+	if err := putUserCredit(ctx, &updated); err != nil {
+		return nil, err
+	}
+
+	if err := emitCreditEvent(ctx, EventReleaseHold, &updated, existing, nil, []*CreditHold{hold}); err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// ReleaseExpiredHolds 把用户已过期的预留退回可用余额，返回清理的数量
+// HoldCredits/ConsumeUserToken 也会顺带清理，这个交易给定时任务用
+func (s *CreditContract) ReleaseExpiredHolds(ctx contractapi.TransactionContextInterface, userId string) (int, error) {
+	existing, err := s.ReadUserCredit(ctx, userId)
+	if err != nil {
+		return 0, fmt.Errorf("read failed:%v", err)
+	}
+
+	updated := *existing
+	expired, err := expireHolds(ctx, &updated)
+	if err != nil {
+		return 0, err
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	if err := putUserCredit(ctx, &updated); err != nil {
+		return 0, err
+	}
+	if err := emitCreditEvent(ctx, EventExpireHolds, &updated, existing, nil, expired); err != nil {
+		return 0, err
+	}
+	return len(expired), nil
+}
+
+// ReadHold 读取预留
+func (s *CreditContract) ReadHold(ctx contractapi.TransactionContextInterface, holdId string) (*CreditHold, error) {
+	hold, err := readHold(ctx, holdId)
+	if err != nil {
+		return nil, err
+	}
+	if hold == nil {
+		return nil, fmt.Errorf("hold %s does not exist", holdId)
+	}
+	return hold, nil
+}
+
+// GetUserHolds 用户还没有结束的预留（包括已过期但还没被清理的）
+func (s *CreditContract) GetUserHolds(ctx contractapi.TransactionContextInterface, userId string) ([]*CreditHold, error) {
+	return userActiveHolds(ctx, userId)
+}
+
+// expireHolds 清理用户过期的预留，积分退回 userCredit，调用方负责保存 userCredit
+func expireHolds(ctx contractapi.TransactionContextInterface, userCredit *UserCredit) ([]*CreditHold, error) {
+	holds, err := userActiveHolds(ctx, userCredit.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTimeString(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []*CreditHold
+	for _, hold := range holds {
+		isExpired, err := holdExpired(ctx, hold)
+		if err != nil {
+			return nil, err
+		}
+		if !isExpired {
+			continue
+		}
+		refundHold(userCredit, hold, HoldStatusExpired, now)
+		if err := putHold(ctx, hold); err != nil {
+			return nil, err
+		}
+		userCredit.UpdatedAt = now
+		expired = append(expired, hold)
+	}
+	return expired, nil
+}
+
+// refundHold 把预留的积分全部退回，并结束预留
+func refundHold(userCredit *UserCredit, hold *CreditHold, status string, now string) {
+	userCredit.Held -= hold.Amount
+	userCredit.Credit += hold.Amount
+	userCredit.UpdatedAt = now
+	hold.Status = status
+	hold.UpdatedAt = now
+}
+
+// holdExpired 交易时间到达 ExpiresAt 即视为过期
+func holdExpired(ctx contractapi.TransactionContextInterface, hold *CreditHold) (bool, error) {
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return false, err
+	}
+	expiresAt, err := time.Parse(ledgerTimeLayout, hold.ExpiresAt)
+	if err != nil {
+		return false, fmt.Errorf("invalid expiresAt of hold %s: %v", hold.HoldID, err)
+	}
+	return !now.Before(expiresAt), nil
+}
+
+// activeHold 读取还没有结束的预留
+func activeHold(ctx contractapi.TransactionContextInterface, holdId string) (*CreditHold, error) {
+	hold, err := readHold(ctx, holdId)
+	if err != nil {
+		return nil, err
+	}
+	if hold == nil {
+		return nil, fmt.Errorf("hold %s does not exist", holdId)
+	}
+	if hold.Status != HoldStatusHeld {
+		return nil, fmt.Errorf("hold %s is already %s", holdId, hold.Status)
+	}
+	return hold, nil
+}
+
+func userActiveHolds(ctx contractapi.TransactionContextInterface, userId string) ([]*CreditHold, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(holdIndexObjectType, []string{userId})
+	if err != nil {
+		return nil, fmt.Errorf("get holds failed:%v", err)
+	}
+	defer resultsIterator.Close()
+
+	var holds []*CreditHold
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("get next failed:%v", err)
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("split hold key failed:%v", err)
+		}
+		hold, err := readHold(ctx, attributes[1])
+		if err != nil {
+			return nil, err
+		}
+		if hold != nil {
+			holds = append(holds, hold)
+		}
+	}
+	return holds, nil
+}
+
+func readHold(ctx contractapi.TransactionContextInterface, holdId string) (*CreditHold, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(holdObjectType, []string{holdId})
+	if err != nil {
+		return nil, fmt.Errorf("create hold key failed:%v", err)
+	}
+	holdJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("read failed:%v", err)
+	}
+	if holdJSON == nil {
+		return nil, nil
+	}
+	var hold CreditHold
+	if err := json.Unmarshal(holdJSON, &hold); err != nil {
+		return nil, fmt.Errorf("unmarshal failed:%v", err)
+	}
+	return &hold, nil
+}
+
+// putHold 保存预留，并根据状态维护 holdidx 索引
+func putHold(ctx contractapi.TransactionContextInterface, hold *CreditHold) error {
+	stub := ctx.GetStub()
+	key, err := stub.CreateCompositeKey(holdObjectType, []string{hold.HoldID})
+	if err != nil {
+		return fmt.Errorf("create hold key failed:%v", err)
+	}
+	holdJSON, err := json.Marshal(hold)
+	if err != nil {
+		return fmt.Errorf("marshal failed:%v", err)
+	}
+	if err := stub.PutState(key, holdJSON); err != nil {
+		return fmt.Errorf("put state failed:%v", err)
+	}
+
+	indexKey, err := stub.CreateCompositeKey(holdIndexObjectType, []string{hold.UserID, hold.HoldID})
+	if err != nil {
+		return fmt.Errorf("create hold index key failed:%v", err)
+	}
+	if hold.Status == HoldStatusHeld {
+		// 组合键索引的值不重要，Fabric 不允许空值，所以写一个 0x00
+		err = stub.PutState(indexKey, []byte{0x00})
+	} else {
+		err = stub.DelState(indexKey)
+	}
+	if err != nil {
+		return fmt.Errorf("update hold index failed:%v", err)
+	}
+	return nil
+}
+
+func putUserCredit(ctx contractapi.TransactionContextInterface, userCredit *UserCredit) error {
+	userCreditJSON, err := json.Marshal(userCredit)
+	if err != nil {
+		return fmt.Errorf("marshal failed:%v", err)
+	}
+	if err := ctx.GetStub().PutState(userCredit.UserID, userCreditJSON); err != nil {
+		return fmt.Errorf("put state failed:%v", err)
+	}
+	return applyCreditEndorsement(ctx, userCredit)
+}
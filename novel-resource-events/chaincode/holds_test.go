@@ -0,0 +1,271 @@
+package chaincode_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/stretchr/testify/require"
+
+	"novel-resource-events/chaincode"
+	"novel-resource-events/ledgersim"
+)
+
+func holdCredits(t *testing.T, ledger *ledgersim.Ledger, contract *contracts, userId string, amount int, holdId string, ttl int) *chaincode.CreditHold {
+	t.Helper()
+	var hold *chaincode.CreditHold
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		hold, err = contract.HoldCredits(ctx, userId, amount, holdId, ttl)
+		return err
+	})
+	return hold
+}
+
+func readHold(t *testing.T, ledger *ledgersim.Ledger, contract *contracts, holdId string) *chaincode.CreditHold {
+	t.Helper()
+	var hold *chaincode.CreditHold
+	_, err := ledger.Evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		hold, err = contract.ReadHold(ctx, holdId)
+		return err
+	})
+	require.NoError(t, err)
+	return hold
+}
+
+func requireBalance(t *testing.T, ledger *ledgersim.Ledger, contract *contracts, userId string, credit, held, totalUsed int) {
+	t.Helper()
+	userCredit, err := readUserCredit(t, ledger, contract, userId)
+	require.NoError(t, err)
+	require.Equal(t, credit, userCredit.Credit, "credit")
+	require.Equal(t, held, userCredit.Held, "held")
+	require.Equal(t, totalUsed, userCredit.TotalUsed, "totalUsed")
+}
+
+func TestHoldCredits(t *testing.T) {
+	tests := []struct {
+		name        string
+		amount      int
+		holdId      string
+		ttl         int
+		expectedErr string
+	}{
+		{name: "reserves credits", amount: 30, holdId: "job_001", ttl: 600},
+		{name: "rejects empty hold id", amount: 30, ttl: 600, expectedErr: "holdId can not be empty"},
+		{name: "rejects non-positive amount", amount: 0, holdId: "job_001", ttl: 600, expectedErr: "hold amount must be positive"},
+		{name: "rejects zero ttl", amount: 30, holdId: "job_001", expectedErr: "hold ttl must be between 1 and 86400 seconds"},
+		{name: "rejects long ttl", amount: 30, holdId: "job_001", ttl: chaincode.MaxHoldTTL + 1, expectedErr: "hold ttl must be between 1 and 86400 seconds"},
+		{name: "rejects more than available", amount: 101, holdId: "job_001", ttl: 600, expectedErr: "insufficient credit for user_001: need 101, have 100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger()
+			contract := newContracts()
+			createUserCredit(t, ledger, contract, "user_001", 100)
+
+			tx, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+				_, err := contract.HoldCredits(ctx, "user_001", tt.amount, tt.holdId, tt.ttl)
+				return err
+			})
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				requireBalance(t, ledger, contract, "user_001", 100, 0, 0)
+				return
+			}
+			require.NoError(t, err)
+			requireBalance(t, ledger, contract, "user_001", 70, 30, 0)
+
+			hold := readHold(t, ledger, contract, tt.holdId)
+			require.Equal(t, chaincode.HoldStatusHeld, hold.Status)
+			require.Equal(t, tx.Timestamp().Add(10*time.Minute).Format("2006-01-02 15:04:05"), hold.ExpiresAt)
+
+			envelope := decodeEnvelope(t, tx)
+			require.Equal(t, chaincode.EventHoldCredits, envelope.Type)
+			require.Equal(t, chaincode.EntityUserCredit, envelope.EntityType)
+			require.Len(t, envelope.Holds, 1)
+			require.Equal(t, tt.holdId, envelope.Holds[0].HoldID)
+		})
+	}
+}
+
+func TestHoldCreditsRejectsDuplicateId(t *testing.T) {
+	ledger := newLedger()
+	contract := newContracts()
+	createUserCredit(t, ledger, contract, "user_001", 100)
+	holdCredits(t, ledger, contract, "user_001", 10, "job_001", 600)
+
+	_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.HoldCredits(ctx, "user_001", 10, "job_001", 600)
+		return err
+	})
+	require.EqualError(t, err, "hold job_001 already exists")
+}
+
+func TestCaptureHold(t *testing.T) {
+	tests := []struct {
+		name            string
+		actual          int
+		advance         time.Duration
+		expectedErr     string
+		expectedCredit  int
+		expectedHistory bool
+	}{
+		{name: "captures the full amount", actual: 30, expectedCredit: 70, expectedHistory: true},
+		{name: "refunds the unused part", actual: 12, expectedCredit: 88, expectedHistory: true},
+		{name: "capturing zero refunds everything", actual: 0, expectedCredit: 100},
+		{name: "rejects more than held", actual: 31, expectedErr: "actual amount must be between 0 and 30"},
+		{name: "rejects expired hold", actual: 30, advance: 11 * time.Minute, expectedErr: "hold job_001 expired at"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger()
+			contract := newContracts()
+			createUserCredit(t, ledger, contract, "user_001", 100)
+			holdCredits(t, ledger, contract, "user_001", 30, "job_001", 600)
+			ledger.Advance(tt.advance)
+
+			tx, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+				_, err := contract.CaptureHold(ctx, "job_001", tt.actual)
+				return err
+			})
+			if tt.expectedErr != "" {
+				require.ErrorContains(t, err, tt.expectedErr)
+				requireBalance(t, ledger, contract, "user_001", 70, 30, 0)
+				return
+			}
+			require.NoError(t, err)
+			requireBalance(t, ledger, contract, "user_001", tt.expectedCredit, 0, tt.actual)
+
+			hold := readHold(t, ledger, contract, "job_001")
+			require.Equal(t, chaincode.HoldStatusCaptured, hold.Status)
+			require.Equal(t, tt.actual, hold.CapturedAmount)
+
+			envelope := decodeEnvelope(t, tx)
+			require.Equal(t, chaincode.EventCaptureHold, envelope.Type)
+			require.Len(t, envelope.Holds, 1)
+			if tt.expectedHistory {
+				require.NotNil(t, envelope.History)
+				require.Equal(t, -tt.actual, envelope.History.Amount)
+			} else {
+				require.Nil(t, envelope.History)
+			}
+
+			// 结束的预留不能再次扣款
+			_, err = ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+				_, err := contract.CaptureHold(ctx, "job_001", 0)
+				return err
+			})
+			require.EqualError(t, err, "hold job_001 is already captured")
+		})
+	}
+}
+
+func TestReleaseHold(t *testing.T) {
+	tests := []struct {
+		name        string
+		holdId      string
+		advance     time.Duration
+		expectedErr string
+	}{
+		{name: "releases an active hold", holdId: "job_001"},
+		{name: "releases an expired hold that was not swept", holdId: "job_001", advance: time.Hour},
+		{name: "missing hold", holdId: "job_404", expectedErr: "hold job_404 does not exist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger()
+			contract := newContracts()
+			createUserCredit(t, ledger, contract, "user_001", 100)
+			holdCredits(t, ledger, contract, "user_001", 30, "job_001", 600)
+			ledger.Advance(tt.advance)
+
+			tx, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+				_, err := contract.ReleaseHold(ctx, tt.holdId)
+				return err
+			})
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			requireBalance(t, ledger, contract, "user_001", 100, 0, 0)
+			require.Equal(t, chaincode.HoldStatusReleased, readHold(t, ledger, contract, "job_001").Status)
+			require.Equal(t, chaincode.EventReleaseHold, decodeEnvelope(t, tx).Type)
+		})
+	}
+}
+
+func TestExpiredHoldsAreReturned(t *testing.T) {
+	ledger := newLedger()
+	contract := newContracts()
+	createUserCredit(t, ledger, contract, "user_001", 100)
+	holdCredits(t, ledger, contract, "user_001", 60, "job_short", 60)
+	holdCredits(t, ledger, contract, "user_001", 30, "job_long", 3600)
+	requireBalance(t, ledger, contract, "user_001", 10, 90, 0)
+
+	// 预留的积分不能消费，只能用剩下的可用余额
+	_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.ConsumeUserToken(ctx, "user_001", "", "")
+		return err
+	})
+	require.NoError(t, err)
+	requireBalance(t, ledger, contract, "user_001", 9, 90, 1)
+
+	ledger.Advance(2 * time.Minute)
+
+	// 新的预留会先清理过期的预留
+	tx := mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.HoldCredits(ctx, "user_001", 50, "job_next", 600)
+		return err
+	})
+	requireBalance(t, ledger, contract, "user_001", 19, 80, 1)
+	require.Equal(t, chaincode.HoldStatusExpired, readHold(t, ledger, contract, "job_short").Status)
+	require.Equal(t, chaincode.HoldStatusHeld, readHold(t, ledger, contract, "job_long").Status)
+	require.Len(t, decodeEnvelope(t, tx).Holds, 2)
+
+	ledger.Advance(2 * time.Hour)
+
+	var released int
+	tx = mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		released, err = contract.ReleaseExpiredHolds(ctx, "user_001")
+		return err
+	})
+	require.Equal(t, 2, released)
+	require.Equal(t, chaincode.EventExpireHolds, decodeEnvelope(t, tx).Type)
+	requireBalance(t, ledger, contract, "user_001", 99, 0, 1)
+
+	var holds []*chaincode.CreditHold
+	_, err = ledger.Evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		holds, err = contract.GetUserHolds(ctx, "user_001")
+		return err
+	})
+	require.NoError(t, err)
+	require.Empty(t, holds)
+
+	// 没有过期预留时不产生写入和事件
+	tx = mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		released, err = contract.ReleaseExpiredHolds(ctx, "user_001")
+		return err
+	})
+	require.Zero(t, released)
+	require.Nil(t, tx.Event())
+}
+
+func TestUpdateUserCreditKeepsHeld(t *testing.T) {
+	ledger := newLedger()
+	contract := newContracts()
+	createUserCredit(t, ledger, contract, "user_001", 100)
+	holdCredits(t, ledger, contract, "user_001", 30, "job_001", 600)
+
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.UpdateUserCredit(ctx, "user_001", 200, 0, 100)
+	})
+	requireBalance(t, ledger, contract, "user_001", 200, 30, 0)
+}
@@ -0,0 +1,374 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+
+	model "novel-resource-model/v1"
+)
+
+// 限额和用量都用组合键存储：spendlimit~userId 是单个用户的限额，defaultlimit 是全局默认限额，usage~userId 是滚动用量
+const (
+	spendingLimitObjectType  = "spendlimit"
+	defaultLimitObjectType   = "defaultlimit"
+	spendingUsageObjectType  = "usage"
+	hourlyBucketRetention    = 24 * time.Hour
+	dailyBucketRetentionDays = 30
+)
+
+// Unlimited GetSpendingAllowance 中表示没有限额
+const Unlimited = model.Unlimited
+
+// 限额来源
+const (
+	LimitSourceUser    = model.LimitSourceUser
+	LimitSourceDefault = model.LimitSourceDefault
+	LimitSourceNone    = model.LimitSourceNone
+)
+
+// SpendingLimit 消费限额，0 表示不限制
+// daily 是最近 24 小时，weekly 是最近 7 天，monthly 是最近 30 天（按 UTC 自然日）
+type SpendingLimit = model.SpendingLimit
+
+// UsageBucket 一个小时或一天的消费量，Start 是桶起点的 Unix 秒
+type UsageBucket struct {
+	Start  int64 `json:"start"`
+	Amount int   `json:"amount"`
+}
+
+// SpendingUsage 用户的滚动用量：最近 24 小时的小时桶和最近 30 天的日桶
+type SpendingUsage struct {
+	UserID string        `json:"userId"`
+	Hourly []UsageBucket `json:"hourly"`
+	Daily  []UsageBucket `json:"daily"`
+}
+
+// SpendingWindow 三个时间窗口的数值
+type SpendingWindow = model.SpendingWindow
+
+// SpendingAllowance 用户当前的限额、用量和剩余额度，Remaining 为 -1 表示不限制
+// Held 是还没有结束的预留，也会占用额度
+type SpendingAllowance = model.SpendingAllowance
+
+// SetSpendingLimit 管理员设置单个用户的限额，覆盖全局默认限额
+func (s *AdminContract) SetSpendingLimit(ctx contractapi.TransactionContextInterface, userId string, daily int, weekly int, monthly int) (*SpendingLimit, error) {
+	if userId == "" {
+		return nil, fmt.Errorf("userId can not be empty")
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(spendingLimitObjectType, []string{userId})
+	if err != nil {
+		return nil, fmt.Errorf("create limit key failed:%v", err)
+	}
+	return putSpendingLimit(ctx, key, &SpendingLimit{UserID: userId, Daily: daily, Weekly: weekly, Monthly: monthly})
+}
+
+// SetDefaultSpendingLimit 管理员设置全局默认限额，没有单独限额的用户使用它
+func (s *AdminContract) SetDefaultSpendingLimit(ctx contractapi.TransactionContextInterface, daily int, weekly int, monthly int) (*SpendingLimit, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(defaultLimitObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("create limit key failed:%v", err)
+	}
+	return putSpendingLimit(ctx, key, &SpendingLimit{Daily: daily, Weekly: weekly, Monthly: monthly})
+}
+
+// DeleteSpendingLimit 管理员删除用户的单独限额，之后使用全局默认限额
+func (s *AdminContract) DeleteSpendingLimit(ctx contractapi.TransactionContextInterface, userId string) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(spendingLimitObjectType, []string{userId})
+	if err != nil {
+		return fmt.Errorf("create limit key failed:%v", err)
+	}
+	existing, err := readSpendingLimit(ctx, key)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return fmt.Errorf("spending limit of %s does not exist", userId)
+	}
+	if err := ctx.GetStub().DelState(key); err != nil {
+		return fmt.Errorf("del failed:%v", err)
+	}
+	return emitEvent(ctx, EventDeleteSpendingLimit, EntitySpendingLimit, userId, nil, existing)
+}
+
+// GetSpendingAllowance 用户当前生效的限额和剩余额度
+func (s *CreditContract) GetSpendingAllowance(ctx contractapi.TransactionContextInterface, userId string) (*SpendingAllowance, error) {
+	userCredit, err := s.ReadUserCredit(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("read failed:%v", err)
+	}
+	return spendingAllowance(ctx, userCredit)
+}
+
+// checkSpending 检查消费 amount 之后是否超过限额，未结束的预留也算在内
+func checkSpending(ctx contractapi.TransactionContextInterface, userCredit *UserCredit, amount int) error {
+	allowance, err := spendingAllowance(ctx, userCredit)
+	if err != nil {
+		return err
+	}
+
+	windows := []struct {
+		name      string
+		limit     int
+		remaining int
+	}{
+		{"daily", allowance.Limit.Daily, allowance.Remaining.Daily},
+		{"weekly", allowance.Limit.Weekly, allowance.Remaining.Weekly},
+		{"monthly", allowance.Limit.Monthly, allowance.Remaining.Monthly},
+	}
+	for _, window := range windows {
+		if window.remaining != Unlimited && amount > window.remaining {
+			return fmt.Errorf("%s spending limit exceeded for %s: limit %d, remaining %d, requested %d",
+				window.name, userCredit.UserID, window.limit, window.remaining, amount)
+		}
+	}
+	return nil
+}
+
+// recordSpending 把 amount 记到用户的滚动用量里，不做限额检查
+func recordSpending(ctx contractapi.TransactionContextInterface, userId string, amount int) error {
+	if amount <= 0 {
+		return nil
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	usage, err := readSpendingUsage(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	usage.prune(now)
+	usage.Hourly = addToBucket(usage.Hourly, now.Truncate(time.Hour).Unix(), amount)
+	usage.Daily = addToBucket(usage.Daily, startOfDay(now).Unix(), amount)
+
+	key, err := ctx.GetStub().CreateCompositeKey(spendingUsageObjectType, []string{userId})
+	if err != nil {
+		return fmt.Errorf("create usage key failed:%v", err)
+	}
+	usageJSON, err := json.Marshal(usage)
+	if err != nil {
+		return fmt.Errorf("marshal failed:%v", err)
+	}
+	if err := ctx.GetStub().PutState(key, usageJSON); err != nil {
+		return fmt.Errorf("put state failed:%v", err)
+	}
+	return nil
+}
+
+// chargeSpending 先检查限额再记录用量，直接减少余额的交易使用
+func chargeSpending(ctx contractapi.TransactionContextInterface, userCredit *UserCredit, amount int) error {
+	if err := checkSpending(ctx, userCredit, amount); err != nil {
+		return err
+	}
+	return recordSpending(ctx, userCredit.UserID, amount)
+}
+
+func spendingAllowance(ctx contractapi.TransactionContextInterface, userCredit *UserCredit) (*SpendingAllowance, error) {
+	limit, source, err := effectiveSpendingLimit(ctx, userCredit.UserID)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := readSpendingUsage(ctx, userCredit.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	allowance := &SpendingAllowance{
+		UserID: userCredit.UserID,
+		Source: source,
+		Used:   usage.windows(now),
+		Held:   userCredit.Held,
+	}
+	if limit != nil {
+		allowance.Limit = SpendingWindow{Daily: limit.Daily, Weekly: limit.Weekly, Monthly: limit.Monthly}
+	}
+	allowance.Remaining = SpendingWindow{
+		Daily:   remainingOf(allowance.Limit.Daily, allowance.Used.Daily, userCredit.Held),
+		Weekly:  remainingOf(allowance.Limit.Weekly, allowance.Used.Weekly, userCredit.Held),
+		Monthly: remainingOf(allowance.Limit.Monthly, allowance.Used.Monthly, userCredit.Held),
+	}
+	return allowance, nil
+}
+
+func remainingOf(limit int, used int, held int) int {
+	if limit <= 0 {
+		return Unlimited
+	}
+	remaining := limit - used - held
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// effectiveSpendingLimit 用户单独限额优先，其次是全局默认限额，都没有时返回 nil
+func effectiveSpendingLimit(ctx contractapi.TransactionContextInterface, userId string) (*SpendingLimit, string, error) {
+	userKey, err := ctx.GetStub().CreateCompositeKey(spendingLimitObjectType, []string{userId})
+	if err != nil {
+		return nil, "", fmt.Errorf("create limit key failed:%v", err)
+	}
+	limit, err := readSpendingLimit(ctx, userKey)
+	if err != nil {
+		return nil, "", err
+	}
+	if limit != nil {
+		return limit, LimitSourceUser, nil
+	}
+
+	defaultKey, err := ctx.GetStub().CreateCompositeKey(defaultLimitObjectType, []string{})
+	if err != nil {
+		return nil, "", fmt.Errorf("create limit key failed:%v", err)
+	}
+	limit, err = readSpendingLimit(ctx, defaultKey)
+	if err != nil {
+		return nil, "", err
+	}
+	if limit != nil {
+		return limit, LimitSourceDefault, nil
+	}
+	return nil, LimitSourceNone, nil
+}
+
+func putSpendingLimit(ctx contractapi.TransactionContextInterface, key string, limit *SpendingLimit) (*SpendingLimit, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if err := limit.Validate(); err != nil {
+		return nil, err
+	}
+
+	now, err := txTimeString(ctx)
+	if err != nil {
+		return nil, err
+	}
+	limit.UpdatedAt = now
+	limit.UpdatedBy = actorOf(ctx)
+
+	previous, err := readSpendingLimit(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	limitJSON, err := json.Marshal(limit)
+	if err != nil {
+		return nil, fmt.Errorf("marshal failed:%v", err)
+	}
+	if err := ctx.GetStub().PutState(key, limitJSON); err != nil {
+		return nil, fmt.Errorf("put state failed:%v", err)
+	}
+
+	var previousPart interface{}
+	if previous != nil {
+		previousPart = previous
+	}
+	entityKey := limit.UserID
+	if entityKey == "" {
+		entityKey = LimitSourceDefault
+	}
+	if err := emitEvent(ctx, EventSetSpendingLimit, EntitySpendingLimit, entityKey, limit, previousPart); err != nil {
+		return nil, err
+	}
+	return limit, nil
+}
+
+func readSpendingLimit(ctx contractapi.TransactionContextInterface, key string) (*SpendingLimit, error) {
+	limitJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("read failed:%v", err)
+	}
+	if limitJSON == nil {
+		return nil, nil
+	}
+	var limit SpendingLimit
+	if err := json.Unmarshal(limitJSON, &limit); err != nil {
+		return nil, fmt.Errorf("unmarshal failed:%v", err)
+	}
+	return &limit, nil
+}
+
+// readSpendingUsage 没有用量记录时返回空的用量
+func readSpendingUsage(ctx contractapi.TransactionContextInterface, userId string) (*SpendingUsage, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(spendingUsageObjectType, []string{userId})
+	if err != nil {
+		return nil, fmt.Errorf("create usage key failed:%v", err)
+	}
+	usageJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("read failed:%v", err)
+	}
+	usage := &SpendingUsage{UserID: userId}
+	if usageJSON == nil {
+		return usage, nil
+	}
+	if err := json.Unmarshal(usageJSON, usage); err != nil {
+		return nil, fmt.Errorf("unmarshal failed:%v", err)
+	}
+	return usage, nil
+}
+
+// windows 按交易时间计算三个窗口的用量
+func (u *SpendingUsage) windows(now time.Time) SpendingWindow {
+	hourFrom := now.Truncate(time.Hour).Add(-hourlyBucketRetention + time.Hour).Unix()
+	today := startOfDay(now)
+	weekFrom := today.AddDate(0, 0, -6).Unix()
+	monthFrom := today.AddDate(0, 0, -(dailyBucketRetentionDays - 1)).Unix()
+
+	var window SpendingWindow
+	for _, bucket := range u.Hourly {
+		if bucket.Start >= hourFrom {
+			window.Daily += bucket.Amount
+		}
+	}
+	for _, bucket := range u.Daily {
+		if bucket.Start >= weekFrom {
+			window.Weekly += bucket.Amount
+		}
+		if bucket.Start >= monthFrom {
+			window.Monthly += bucket.Amount
+		}
+	}
+	return window
+}
+
+// prune 丢掉已经滑出窗口的桶，控制状态大小
+func (u *SpendingUsage) prune(now time.Time) {
+	hourFrom := now.Truncate(time.Hour).Add(-hourlyBucketRetention + time.Hour).Unix()
+	monthFrom := startOfDay(now).AddDate(0, 0, -(dailyBucketRetentionDays - 1)).Unix()
+	u.Hourly = keepBucketsFrom(u.Hourly, hourFrom)
+	u.Daily = keepBucketsFrom(u.Daily, monthFrom)
+}
+
+func keepBucketsFrom(buckets []UsageBucket, from int64) []UsageBucket {
+	kept := buckets[:0]
+	for _, bucket := range buckets {
+		if bucket.Start >= from {
+			kept = append(kept, bucket)
+		}
+	}
+	return kept
+}
+
+// addToBucket 桶按时间升序追加，新的消费一定落在最后一个桶或者新桶里
+func addToBucket(buckets []UsageBucket, start int64, amount int) []UsageBucket {
+	if n := len(buckets); n > 0 && buckets[n-1].Start == start {
+		buckets[n-1].Amount += amount
+		return buckets
+	}
+	return append(buckets, UsageBucket{Start: start, Amount: amount})
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,204 @@
+package chaincode_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/stretchr/testify/require"
+
+	"novel-resource-events/chaincode"
+	"novel-resource-events/ledgersim"
+)
+
+func setSpendingLimit(t *testing.T, ledger *ledgersim.Ledger, contract *contracts, userId string, daily, weekly, monthly int) {
+	t.Helper()
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		if userId == "" {
+			_, err = contract.SetDefaultSpendingLimit(ctx, daily, weekly, monthly)
+		} else {
+			_, err = contract.SetSpendingLimit(ctx, userId, daily, weekly, monthly)
+		}
+		return err
+	})
+}
+
+func consume(ledger *ledgersim.Ledger, contract *contracts, userId string, operation string) error {
+	_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.ConsumeUserToken(ctx, userId, operation, "")
+		return err
+	})
+	return err
+}
+
+func allowanceOf(t *testing.T, ledger *ledgersim.Ledger, contract *contracts, userId string) *chaincode.SpendingAllowance {
+	t.Helper()
+	var allowance *chaincode.SpendingAllowance
+	_, err := ledger.Evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		allowance, err = contract.GetSpendingAllowance(ctx, userId)
+		return err
+	})
+	require.NoError(t, err)
+	return allowance
+}
+
+func TestSetSpendingLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		identity    *ledgersim.ClientIdentity
+		userId      string
+		daily       int
+		expectedErr string
+	}{
+		{name: "admin sets a user limit", userId: "user_001", daily: 10},
+		{name: "rejects negative limits", userId: "user_001", daily: -1, expectedErr: "spending limits can not be negative"},
+		{name: "rejects empty user", daily: 10, expectedErr: "userId can not be empty"},
+		{
+			name:        "rejects non admin",
+			identity:    ledgersim.NewClientIdentity("Org2MSP", "CN=User1", nil),
+			userId:      "user_001",
+			daily:       10,
+			expectedErr: "permission denied: Org2MSP is not an admin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger()
+			contract := newContracts()
+			if tt.identity != nil {
+				ledger.SetIdentity(tt.identity)
+			}
+
+			tx, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+				_, err := contract.SetSpendingLimit(ctx, tt.userId, tt.daily, 0, 0)
+				return err
+			})
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			envelope := decodeEnvelope(t, tx)
+			require.Equal(t, chaincode.EventSetSpendingLimit, envelope.Type)
+			require.Equal(t, chaincode.EntitySpendingLimit, envelope.EntityType)
+			require.Equal(t, tt.userId, envelope.EntityKey)
+		})
+	}
+}
+
+func TestSpendingLimitSources(t *testing.T) {
+	ledger := newLedger()
+	contract := newContracts()
+	createUserCredit(t, ledger, contract, "user_001", 100)
+
+	allowance := allowanceOf(t, ledger, contract, "user_001")
+	require.Equal(t, chaincode.LimitSourceNone, allowance.Source)
+	require.Equal(t, chaincode.SpendingWindow{Daily: chaincode.Unlimited, Weekly: chaincode.Unlimited, Monthly: chaincode.Unlimited}, allowance.Remaining)
+
+	setSpendingLimit(t, ledger, contract, "", 10, 50, 0)
+	allowance = allowanceOf(t, ledger, contract, "user_001")
+	require.Equal(t, chaincode.LimitSourceDefault, allowance.Source)
+	require.Equal(t, chaincode.SpendingWindow{Daily: 10, Weekly: 50, Monthly: chaincode.Unlimited}, allowance.Remaining)
+
+	setSpendingLimit(t, ledger, contract, "user_001", 20, 0, 0)
+	allowance = allowanceOf(t, ledger, contract, "user_001")
+	require.Equal(t, chaincode.LimitSourceUser, allowance.Source)
+	require.Equal(t, 20, allowance.Remaining.Daily)
+
+	tx := mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.DeleteSpendingLimit(ctx, "user_001")
+	})
+	require.Equal(t, chaincode.EventDeleteSpendingLimit, decodeEnvelope(t, tx).Type)
+	require.Equal(t, chaincode.LimitSourceDefault, allowanceOf(t, ledger, contract, "user_001").Source)
+
+	_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+		return contract.DeleteSpendingLimit(ctx, "user_001")
+	})
+	require.EqualError(t, err, "spending limit of user_001 does not exist")
+}
+
+func TestConsumeUserTokenRespectsRollingLimits(t *testing.T) {
+	ledger := newLedger()
+	ledger.SetTime(time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC))
+	contract := newContracts()
+	setPricing(t, ledger, contract, `{"effectiveFrom": "2025-01-01T00:00:00Z", "operations": {"default": 1, "generate_scene": 4}}`)
+	createUserCredit(t, ledger, contract, "user_001", 1000)
+	setSpendingLimit(t, ledger, contract, "user_001", 10, 20, 30)
+
+	require.NoError(t, consume(ledger, contract, "user_001", "generate_scene"))
+	require.NoError(t, consume(ledger, contract, "user_001", "generate_scene"))
+	err := consume(ledger, contract, "user_001", "generate_scene")
+	require.EqualError(t, err, "daily spending limit exceeded for user_001: limit 10, remaining 2, requested 4")
+	require.NoError(t, consume(ledger, contract, "user_001", ""))
+
+	allowance := allowanceOf(t, ledger, contract, "user_001")
+	require.Equal(t, chaincode.SpendingWindow{Daily: 9, Weekly: 9, Monthly: 9}, allowance.Used)
+	require.Equal(t, chaincode.SpendingWindow{Daily: 1, Weekly: 11, Monthly: 21}, allowance.Remaining)
+
+	// 24 小时后日额度恢复，周额度继续累计
+	ledger.Advance(24 * time.Hour)
+	require.NoError(t, consume(ledger, contract, "user_001", "generate_scene"))
+	require.NoError(t, consume(ledger, contract, "user_001", "generate_scene"))
+	ledger.Advance(24 * time.Hour)
+	err = consume(ledger, contract, "user_001", "generate_scene")
+	require.EqualError(t, err, "weekly spending limit exceeded for user_001: limit 20, remaining 3, requested 4")
+
+	// 7 天后周额度恢复，但月额度还在
+	ledger.Advance(7 * 24 * time.Hour)
+	allowance = allowanceOf(t, ledger, contract, "user_001")
+	require.Equal(t, chaincode.SpendingWindow{Daily: 0, Weekly: 0, Monthly: 17}, allowance.Used)
+
+	userCredit, err := readUserCredit(t, ledger, contract, "user_001")
+	require.NoError(t, err)
+	require.Equal(t, 1000-17, userCredit.Credit)
+}
+
+func TestHoldsCountTowardsLimits(t *testing.T) {
+	ledger := newLedger()
+	contract := newContracts()
+	createUserCredit(t, ledger, contract, "user_001", 1000)
+	setSpendingLimit(t, ledger, contract, "", 50, 0, 0)
+
+	holdCredits(t, ledger, contract, "user_001", 40, "job_001", 600)
+
+	_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.HoldCredits(ctx, "user_001", 20, "job_002", 600)
+		return err
+	})
+	require.EqualError(t, err, "daily spending limit exceeded for user_001: limit 50, remaining 10, requested 20")
+
+	// 扣款只记录实际用量，剩余的预留释放后额度恢复
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.CaptureHold(ctx, "job_001", 15)
+		return err
+	})
+	allowance := allowanceOf(t, ledger, contract, "user_001")
+	require.Equal(t, 15, allowance.Used.Daily)
+	require.Equal(t, 0, allowance.Held)
+	require.Equal(t, 35, allowance.Remaining.Daily)
+}
+
+func TestUpdateUserCreditRespectsLimits(t *testing.T) {
+	ledger := newLedger()
+	contract := newContracts()
+	createUserCredit(t, ledger, contract, "user_001", 100)
+	setSpendingLimit(t, ledger, contract, "user_001", 10, 0, 0)
+
+	_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+		return contract.UpdateUserCredit(ctx, "user_001", 80, 20, 0)
+	})
+	require.EqualError(t, err, "daily spending limit exceeded for user_001: limit 10, remaining 10, requested 20")
+
+	// 增加余额不受限额影响
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.UpdateUserCredit(ctx, "user_001", 500, 0, 400)
+	})
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.UpdateUserCredit(ctx, "user_001", 495, 5, 400)
+	})
+	require.Equal(t, 5, allowanceOf(t, ledger, contract, "user_001").Remaining.Daily)
+}
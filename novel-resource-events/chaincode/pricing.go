@@ -0,0 +1,299 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+
+	model "novel-resource-model/v1"
+)
+
+// 价格表使用组合键 pricing~effectiveFrom 存储，不会被 GetAllNovels/GetAllUserCredits 的范围查询扫到
+const pricingObjectType = "pricing"
+
+// creditHistoryObjectType 积分历史的组合键前缀：history~userId~txId
+const creditHistoryObjectType = "history"
+
+// DefaultOperation 调用方没有传操作码时使用的操作码
+const DefaultOperation = "default"
+
+// legacyOperationCost 账本上还没有价格表时，每次消费扣 1 个积分，和之前的行为一致
+const legacyOperationCost = 1
+
+// PlatformMSPID 平台组织，管理类交易只允许平台组织里带 role=admin 属性的身份调用
+const PlatformMSPID = "Org1MSP"
+
+// pricingKeyLayout effectiveFrom 在组合键中的格式，固定长度保证字典序就是时间顺序
+const pricingKeyLayout = "20060102T150405Z"
+
+// PricingTable 价格表：操作码 -> 消耗的积分，可以按小说单独定价
+type PricingTable = model.PricingTable
+
+// normalizePricing 检查价格表，并把 effectiveFrom 规范成 UTC
+func normalizePricing(p *PricingTable) (time.Time, error) {
+	if err := p.Validate(); err != nil {
+		return time.Time{}, err
+	}
+	effectiveFrom, err := time.Parse(time.RFC3339, p.EffectiveFrom)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid effectiveFrom %q: %v", p.EffectiveFrom, err)
+	}
+	effectiveFrom = effectiveFrom.UTC()
+	p.EffectiveFrom = effectiveFrom.Format(time.RFC3339)
+	return effectiveFrom, nil
+}
+
+// SetPricing 管理员发布一版价格表，effectiveFrom 为空时立即生效
+// 同一个 effectiveFrom 再次发布会覆盖之前那一版
+func (s *AdminContract) SetPricing(ctx contractapi.TransactionContextInterface, pricingJSON string) (*PricingTable, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	var pricing PricingTable
+	if err := json.Unmarshal([]byte(pricingJSON), &pricing); err != nil {
+		return nil, fmt.Errorf("解析价格表失败: %v", err)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if pricing.EffectiveFrom == "" {
+		pricing.EffectiveFrom = now.Format(time.RFC3339)
+	}
+	effectiveFrom, err := normalizePricing(&pricing)
+	if err != nil {
+		return nil, err
+	}
+	pricing.UpdatedAt = now.Format(ledgerTimeLayout)
+	pricing.UpdatedBy = actorOf(ctx)
+
+	key, err := ctx.GetStub().CreateCompositeKey(pricingObjectType, []string{effectiveFrom.Format(pricingKeyLayout)})
+	if err != nil {
+		return nil, fmt.Errorf("create pricing key failed:%v", err)
+	}
+
+	// 覆盖同一时间点的价格表时，把旧的放到 previous 里
+	previous, err := readPricing(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	pricingBytes, err := json.Marshal(pricing)
+	if err != nil {
+		return nil, fmt.Errorf("marshal failed:%v", err)
+	}
+	if err := ctx.GetStub().PutState(key, pricingBytes); err != nil {
+		return nil, fmt.Errorf("put state failed:%v", err)
+	}
+
+	var previousPart interface{}
+	if previous != nil {
+		previousPart = previous
+	}
+	if err := emitEvent(ctx, EventSetPricing, EntityPricing, pricing.EffectiveFrom, &pricing, previousPart); err != nil {
+		return nil, err
+	}
+	return &pricing, nil
+}
+
+// GetPricing 返回按当前交易时间生效的价格表，没有配置过时返回默认价格表
+func (s *CreditContract) GetPricing(ctx contractapi.TransactionContextInterface) (*PricingTable, error) {
+	pricing, err := activePricing(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if pricing == nil {
+		return &PricingTable{Operations: map[string]int{DefaultOperation: legacyOperationCost}}, nil
+	}
+	return pricing, nil
+}
+
+// GetPricingSchedule 返回所有版本的价格表（包括还没生效的），按生效时间升序
+func (s *CreditContract) GetPricingSchedule(ctx contractapi.TransactionContextInterface) ([]*PricingTable, error) {
+	return pricingSchedule(ctx)
+}
+
+// ConsumeUserToken 按价格表扣除积分，operation 为空时按 DefaultOperation 计费
+// 扣费、积分历史和事件在同一个交易里完成，链下不再需要先读后写
+func (s *CreditContract) ConsumeUserToken(ctx contractapi.TransactionContextInterface, userId string, operation string, novelId string) (*UserCredit, error) {
+	if operation == "" {
+		operation = DefaultOperation
+	}
+
+	cost, err := operationCost(ctx, operation, novelId)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.ReadUserCredit(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("read failed:%v", err)
+	}
+
+	// 先把过期的预留退回可用余额
+	updated := *existing
+	expired, err := expireHolds(ctx, &updated)
+	if err != nil {
+		return nil, err
+	}
+	if updated.Credit < cost {
+		return nil, fmt.Errorf("insufficient credit for %s: need %d, have %d", userId, cost, updated.Credit)
+	}
+	if err := chargeSpending(ctx, &updated, cost); err != nil {
+		return nil, err
+	}
+
+	now, err := txTimeString(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	updated.Credit -= cost
+	updated.TotalUsed += cost
+	updated.UpdatedAt = now
+
+	if err := putUserCredit(ctx, &updated); err != nil {
+		return nil, err
+	}
+
+	history := &CreditHistory{
+		UserID:      userId,
+		Amount:      -cost,
+		Type:        "consume",
+		Description: fmt.Sprintf("consume %s", operation),
+		Timestamp:   now,
+		NovelID:     novelId,
+		Operation:   operation,
+		TxID:        ctx.GetStub().GetTxID(),
+	}
+	if err := putCreditHistory(ctx, history); err != nil {
+		return nil, err
+	}
+
+	if err := emitCreditEvent(ctx, EventConsumeUserToken, &updated, existing, history, expired); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// operationCost 按当前生效的价格表计算价格，账本上没有价格表时沿用每次 1 积分
+func operationCost(ctx contractapi.TransactionContextInterface, operation string, novelId string) (int, error) {
+	pricing, err := activePricing(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if pricing == nil {
+		return legacyOperationCost, nil
+	}
+	return pricing.CostOf(operation, novelId)
+}
+
+// activePricing 找到 effectiveFrom 不晚于交易时间的最新一版价格表，没有时返回 nil
+func activePricing(ctx contractapi.TransactionContextInterface) (*PricingTable, error) {
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule, err := pricingSchedule(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var active *PricingTable
+	for _, pricing := range schedule {
+		effectiveFrom, err := time.Parse(time.RFC3339, pricing.EffectiveFrom)
+		if err != nil {
+			return nil, fmt.Errorf("invalid effectiveFrom on ledger %q: %v", pricing.EffectiveFrom, err)
+		}
+		if effectiveFrom.After(now) {
+			break
+		}
+		active = pricing
+	}
+	return active, nil
+}
+
+// pricingSchedule 读取所有价格表，组合键本身就是按时间排好序的
+func pricingSchedule(ctx contractapi.TransactionContextInterface) ([]*PricingTable, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(pricingObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("get pricing failed:%v", err)
+	}
+	defer resultsIterator.Close()
+
+	var schedule []*PricingTable
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("get next failed:%v", err)
+		}
+		var pricing PricingTable
+		if err := json.Unmarshal(queryResponse.Value, &pricing); err != nil {
+			return nil, fmt.Errorf("unmarshal failed:%v", err)
+		}
+		schedule = append(schedule, &pricing)
+	}
+
+	// 保险起见按 effectiveFrom 再排一次
+	sort.SliceStable(schedule, func(i, j int) bool {
+		return schedule[i].EffectiveFrom < schedule[j].EffectiveFrom
+	})
+	return schedule, nil
+}
+
+func readPricing(ctx contractapi.TransactionContextInterface, key string) (*PricingTable, error) {
+	pricingBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("read failed:%v", err)
+	}
+	if pricingBytes == nil {
+		return nil, nil
+	}
+	var pricing PricingTable
+	if err := json.Unmarshal(pricingBytes, &pricing); err != nil {
+		return nil, fmt.Errorf("unmarshal failed:%v", err)
+	}
+	return &pricing, nil
+}
+
+// putCreditHistory 积分历史写在 history~userId~txId 下，一个交易最多一条
+func putCreditHistory(ctx contractapi.TransactionContextInterface, history *CreditHistory) error {
+	key, err := ctx.GetStub().CreateCompositeKey(creditHistoryObjectType, []string{history.UserID, history.TxID})
+	if err != nil {
+		return fmt.Errorf("create history key failed:%v", err)
+	}
+	historyJSON, err := json.Marshal(history)
+	if err != nil {
+		return fmt.Errorf("marshal failed:%v", err)
+	}
+	if err := ctx.GetStub().PutState(key, historyJSON); err != nil {
+		return fmt.Errorf("put state failed:%v", err)
+	}
+	return nil
+}
+
+// requireAdmin 只有平台组织里证书带 role=admin 属性的身份才能调用管理类交易
+// 两个条件缺一不可：其他组织的 CA 也能签发 role=admin，平台组织里的普通用户和 peer 也不是管理员
+func requireAdmin(ctx contractapi.TransactionContextInterface) error {
+	clientIdentity := ctx.GetClientIdentity()
+	if clientIdentity == nil {
+		return fmt.Errorf("permission denied: no client identity")
+	}
+	mspID, err := clientIdentity.GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get MSPID: %v", err)
+	}
+	if mspID != PlatformMSPID {
+		return fmt.Errorf("permission denied: %s is not an admin", mspID)
+	}
+	if err := clientIdentity.AssertAttributeValue("role", "admin"); err != nil {
+		return fmt.Errorf("permission denied: %s identity without role=admin is not an admin", mspID)
+	}
+	return nil
+}
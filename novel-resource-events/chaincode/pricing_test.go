@@ -0,0 +1,212 @@
+package chaincode_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/stretchr/testify/require"
+
+	"novel-resource-events/chaincode"
+	"novel-resource-events/ledgersim"
+)
+
+const basePricing = `{
+	"effectiveFrom": "2025-01-01T00:00:00Z",
+	"operations": {"default": 1, "generate_outline": 5, "generate_scene": 20},
+	"novelOverrides": {"novel_vip": {"generate_scene": 8}}
+}`
+
+func setPricing(t *testing.T, ledger *ledgersim.Ledger, contract *contracts, pricingJSON string) {
+	t.Helper()
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.SetPricing(ctx, pricingJSON)
+		return err
+	})
+}
+
+func TestChaincodeMetadata(t *testing.T) {
+	_, err := chaincode.NewChaincode(true)
+	require.NoError(t, err)
+}
+
+func TestSetPricing(t *testing.T) {
+	tests := []struct {
+		name        string
+		identity    *ledgersim.ClientIdentity
+		pricing     string
+		expectedErr string
+	}{
+		{name: "platform admin can set pricing", pricing: basePricing},
+		{
+			name:        "admin attribute from other org is rejected",
+			identity:    ledgersim.NewClientIdentity("Org2MSP", "CN=ops", map[string]string{"role": "admin"}),
+			pricing:     basePricing,
+			expectedErr: "permission denied: Org2MSP is not an admin",
+		},
+		{
+			name:        "platform org member without admin attribute is rejected",
+			identity:    ledgersim.NewClientIdentity("Org1MSP", "CN=User1@org1.example.com", nil),
+			pricing:     basePricing,
+			expectedErr: "permission denied: Org1MSP identity without role=admin is not an admin",
+		},
+		{
+			name:        "other orgs are rejected",
+			identity:    ledgersim.NewClientIdentity("Org2MSP", "CN=User1", nil),
+			pricing:     basePricing,
+			expectedErr: "permission denied: Org2MSP is not an admin",
+		},
+		{name: "rejects invalid json", pricing: `{`, expectedErr: "解析价格表失败"},
+		{name: "rejects empty operations", pricing: `{"operations": {}}`, expectedErr: "pricing table has no operations"},
+		{name: "rejects negative cost", pricing: `{"operations": {"default": -1}}`, expectedErr: "cost of operation default can not be negative"},
+		{
+			name:        "rejects override of unknown operation",
+			pricing:     `{"operations": {"default": 1}, "novelOverrides": {"novel_001": {"translate": 3}}}`,
+			expectedErr: "novel novel_001 overrides unknown operation translate",
+		},
+		{name: "rejects bad effectiveFrom", pricing: `{"effectiveFrom": "tomorrow", "operations": {"default": 1}}`, expectedErr: "invalid effectiveFrom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger()
+			contract := newContracts()
+			if tt.identity != nil {
+				ledger.SetIdentity(tt.identity)
+			}
+
+			tx, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+				_, err := contract.SetPricing(ctx, tt.pricing)
+				return err
+			})
+			if tt.expectedErr != "" {
+				require.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			envelope := decodeEnvelope(t, tx)
+			require.Equal(t, chaincode.EventSetPricing, envelope.Type)
+			require.Equal(t, chaincode.EntityPricing, envelope.EntityType)
+			require.Equal(t, "2025-01-01T00:00:00Z", envelope.EntityKey)
+			require.Empty(t, envelope.Previous)
+		})
+	}
+}
+
+func TestGetPricingHonoursEffectiveFrom(t *testing.T) {
+	ledger := newLedger()
+	ledger.SetTime(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC))
+	contract := newContracts()
+
+	getPricing := func() *chaincode.PricingTable {
+		var pricing *chaincode.PricingTable
+		_, err := ledger.Evaluate(func(ctx contractapi.TransactionContextInterface) error {
+			var err error
+			pricing, err = contract.GetPricing(ctx)
+			return err
+		})
+		require.NoError(t, err)
+		return pricing
+	}
+
+	// 没有价格表时返回默认价格
+	require.Equal(t, map[string]int{chaincode.DefaultOperation: 1}, getPricing().Operations)
+
+	setPricing(t, ledger, contract, basePricing)
+	setPricing(t, ledger, contract, `{"effectiveFrom": "2025-04-01T00:00:00+08:00", "operations": {"default": 2}}`)
+
+	require.Equal(t, "2025-01-01T00:00:00Z", getPricing().EffectiveFrom)
+
+	var schedule []*chaincode.PricingTable
+	_, err := ledger.Evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		schedule, err = contract.GetPricingSchedule(ctx)
+		return err
+	})
+	require.NoError(t, err)
+	require.Len(t, schedule, 2)
+	require.Equal(t, "2025-03-31T16:00:00Z", schedule[1].EffectiveFrom)
+
+	ledger.SetTime(time.Date(2025, 3, 31, 16, 0, 0, 0, time.UTC))
+	require.Equal(t, 2, getPricing().Operations["default"])
+}
+
+func TestConsumeUserToken(t *testing.T) {
+	tests := []struct {
+		name            string
+		pricing         string
+		credit          int
+		operation       string
+		novelId         string
+		expectedCost    int
+		expectedOp      string
+		expectedErr     string
+		expectedCredits int
+	}{
+		{name: "no pricing table charges one credit", credit: 10, operation: "generate_scene", expectedCost: 1, expectedOp: "generate_scene"},
+		{name: "empty operation uses default", pricing: basePricing, credit: 10, expectedCost: 1, expectedOp: chaincode.DefaultOperation},
+		{name: "charges from the table", pricing: basePricing, credit: 30, operation: "generate_scene", expectedCost: 20, expectedOp: "generate_scene"},
+		{name: "novel override wins", pricing: basePricing, credit: 30, operation: "generate_scene", novelId: "novel_vip", expectedCost: 8, expectedOp: "generate_scene"},
+		{name: "other novels use the base price", pricing: basePricing, credit: 30, operation: "generate_outline", novelId: "novel_vip", expectedCost: 5, expectedOp: "generate_outline"},
+		{name: "unknown operation", pricing: basePricing, credit: 30, operation: "translate", expectedErr: "unknown operation translate"},
+		{name: "insufficient credit", pricing: basePricing, credit: 19, operation: "generate_scene", expectedErr: "insufficient credit for user_001: need 20, have 19"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger()
+			contract := newContracts()
+			if tt.pricing != "" {
+				setPricing(t, ledger, contract, tt.pricing)
+			}
+			createUserCredit(t, ledger, contract, "user_001", tt.credit)
+
+			var updated *chaincode.UserCredit
+			tx, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				updated, err = contract.ConsumeUserToken(ctx, "user_001", tt.operation, tt.novelId)
+				return err
+			})
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				userCredit, err := readUserCredit(t, ledger, contract, "user_001")
+				require.NoError(t, err)
+				require.Equal(t, tt.credit, userCredit.Credit)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.credit-tt.expectedCost, updated.Credit)
+			require.Equal(t, tt.expectedCost, updated.TotalUsed)
+
+			userCredit, err := readUserCredit(t, ledger, contract, "user_001")
+			require.NoError(t, err)
+			require.Equal(t, updated, userCredit)
+
+			envelope := decodeEnvelope(t, tx)
+			require.Equal(t, chaincode.EventConsumeUserToken, envelope.Type)
+			require.Equal(t, chaincode.EntityUserCredit, envelope.EntityType)
+			require.NotEmpty(t, envelope.Previous)
+			require.NotNil(t, envelope.History)
+			require.Equal(t, -tt.expectedCost, envelope.History.Amount)
+			require.Equal(t, tt.expectedOp, envelope.History.Operation)
+			require.Equal(t, tt.novelId, envelope.History.NovelID)
+			require.Equal(t, tx.TxID(), envelope.History.TxID)
+
+			historyKey, err := tx.Stub().CreateCompositeKey("history", []string{"user_001", tx.TxID()})
+			require.NoError(t, err)
+			require.NotNil(t, ledger.Get(historyKey))
+		})
+	}
+}
+
+func TestConsumeUserTokenMissingUser(t *testing.T) {
+	ledger := newLedger()
+	contract := newContracts()
+
+	_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.ConsumeUserToken(ctx, "user_404", "", "")
+		return err
+	})
+	require.EqualError(t, err, "read failed:user_404 is not existed")
+}
@@ -7,46 +7,23 @@ import (
 	"time"
 
 	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+
+	model "novel-resource-model/v1"
 )
 
-type SmartContract struct {
-	contractapi.Contract
-}
+// 链上记录的结构体定义在共享模型 novel-resource-model/v1，管理服务也用同一份定义
 
 // Novel 结构体用于存储小说资源信息
-type Novel struct {
-	ID           string `json:"id"`
-	Author       string `json:"author,omitempty"`
-	StoryOutline string `json:"storyOutline,omitempty"`
-	Subsections  string `json:"subsections,omitempty"`
-	Characters   string `json:"characters,omitempty"`
-	Items        string `json:"items,omitempty"`
-	TotalScenes  string `json:"totalScenes,omitempty"`
-	CreatedAt    string `json:"createdAt,omitempty"`
-	UpdatedAt    string `json:"updatedAt,omitempty"`
-}
+type Novel = model.Novel
 
-type UserCredit struct {
-	UserID        string `json:"userId"`
-	Credit        int    `json:"credit"`
-	TotalUsed     int    `json:"totalUsed"`
-	TotalRecharge int    `json:"totalRecharge"`
-	CreatedAt     string `json:"createdAt,omitempty"`
-	UpdatedAt     string `json:"updatedAt,omitempty"`
-}
+// UserCredit 用户积分
+type UserCredit = model.UserCredit
 
 // CreditHistory 结构体用于存储积分变更历史
-type CreditHistory struct {
-	UserID      string `json:"userId"`
-	Amount      int    `json:"amount"` //积分变动的数额
-	Type        string `json:"type"`   // "consume", "recharge", "reward"
-	Description string `json:"description"`
-	Timestamp   string `json:"timestamp"`
-	NovelID     string `json:"novelId,omitempty"`
-}
+type CreditHistory = model.CreditHistory
 
 // CreateNovel creates a new novel in the world state
-func (s *SmartContract) CreateNovel(ctx contractapi.TransactionContextInterface, id string, author string, storyOutline string,
+func (s *NovelContract) CreateNovel(ctx contractapi.TransactionContextInterface, id string, author string, storyOutline string,
 	subsections string, characters string, items string, totalScenes string) error {
 	//judge whether novel is existed
 	exists, err := s.NovelExists(ctx, id)
@@ -75,12 +52,14 @@ func (s *SmartContract) CreateNovel(ctx contractapi.TransactionContextInterface,
 	}
 
 	//setEvent
-	ctx.GetStub().SetEvent("CreateNovel", novelJSON)
+	if err := emitEvent(ctx, EventCreateNovel, EntityNovel, id, novel, nil); err != nil {
+		return err
+	}
 	return ctx.GetStub().PutState(id, novelJSON)
 }
 
 // read
-func (s *SmartContract) ReadNovel(ctx contractapi.TransactionContextInterface, id string) (*Novel, error) {
+func (s *NovelContract) ReadNovel(ctx contractapi.TransactionContextInterface, id string) (*Novel, error) {
 
 	novelJSON, err := ctx.GetStub().GetState(id)
 
@@ -105,7 +84,7 @@ func (s *SmartContract) ReadNovel(ctx contractapi.TransactionContextInterface, i
 }
 
 // GetAllNovels returns all novels from the world state
-func (s *SmartContract) GetAllNovels(ctx contractapi.TransactionContextInterface) ([]*Novel, error) {
+func (s *NovelContract) GetAllNovels(ctx contractapi.TransactionContextInterface) ([]*Novel, error) {
 	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get state by range: %v", err)
@@ -141,7 +120,7 @@ func (s *SmartContract) GetAllNovels(ctx contractapi.TransactionContextInterface
 
 
 // UpdateNovel updates an existing novel in the world state
-func (s *SmartContract) UpdateNovel(ctx contractapi.TransactionContextInterface, id string, author string, storyOutline string,
+func (s *NovelContract) UpdateNovel(ctx contractapi.TransactionContextInterface, id string, author string, storyOutline string,
 	subsections string, characters string, items string, totalScenes string) error {
 
 	// 直接读取现有小说，一次性检查存在性和获取数据
@@ -180,13 +159,15 @@ func (s *SmartContract) UpdateNovel(ctx contractapi.TransactionContextInterface,
 		return fmt.Errorf("failed to marshal novel: %v", err)
 	}
 	//setEvent
-	ctx.GetStub().SetEvent("UpdateNovel", novelJSON)
+	if err := emitEvent(ctx, EventUpdateNovel, EntityNovel, id, updatedNovel, existingNovel); err != nil {
+		return err
+	}
 	// Save to world state，这个是需要key-value
 	return ctx.GetStub().PutState(id, novelJSON)
 }
 
 // delete novel
-func (s *SmartContract) DeleteNovel(ctx contractapi.TransactionContextInterface, id string) error {
+func (s *NovelContract) DeleteNovel(ctx contractapi.TransactionContextInterface, id string) error {
 	// isExisting,err := s.NovelExists(ctx, id)
 	novelJSON, err := s.ReadNovel(ctx, id)
 	if err != nil {
@@ -195,17 +176,15 @@ func (s *SmartContract) DeleteNovel(ctx contractapi.TransactionContextInterface,
 	if novelJSON == nil {
 		return fmt.Errorf("the novel is not found")
 	}
-	//setEvent
-	novelJSONBytes, err := json.Marshal(novelJSON)
-	if err != nil {
-		return fmt.Errorf("failed to marshal novel for event: %v", err)
+	//setEvent，删除事件只带 previous
+	if err := emitEvent(ctx, EventDeleteNovel, EntityNovel, id, nil, novelJSON); err != nil {
+		return err
 	}
-	ctx.GetStub().SetEvent("DeleteNovel", novelJSONBytes)
 	//只返回了error
 	return ctx.GetStub().DelState(id)
 }
 
-func (s *SmartContract) NovelExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+func (s *NovelContract) NovelExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
 	novelJSON, err := ctx.GetStub().GetState(id)
 	if err != nil {
 		return false, fmt.Errorf("failed to read from world state: %v", err)
@@ -215,7 +194,11 @@ func (s *SmartContract) NovelExists(ctx contractapi.TransactionContextInterface,
 }
 
 // 初始测试函数，一次性初始化多个小说对象
-func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface) (string, error) {
+// 只在链码以 CHAINCODE_ENABLE_SEED=true 启动时可用
+func (s *AdminContract) InitLedger(ctx contractapi.TransactionContextInterface) (string, error) {
+	if !s.EnableSeed {
+		return "", fmt.Errorf("InitLedger is disabled, start the chaincode with CHAINCODE_ENABLE_SEED=true to seed test data")
+	}
 	//设置前缀
 	novels := []Novel{
 		{
@@ -297,7 +280,7 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 }
 
 // 增
-func (s *SmartContract) CreateUserCredit(ctx contractapi.TransactionContextInterface, userId string, credit int, totalUsed int, totalRecharge int) error {
+func (s *CreditContract) CreateUserCredit(ctx contractapi.TransactionContextInterface, userId string, credit int, totalUsed int, totalRecharge int) error {
 
 	exists, err := s.UserCreditExists(ctx, userId)
 	if err != nil {
@@ -335,14 +318,20 @@ func (s *SmartContract) CreateUserCredit(ctx contractapi.TransactionContextInter
 	if err != nil {
 		return fmt.Errorf("put state failed:%v", err)
 	}
+	// 余额达到高价值门槛时加上 key 级别背书策略
+	if err := applyCreditEndorsement(ctx, userCredit); err != nil {
+		return err
+	}
 	//setEvent
-	ctx.GetStub().SetEvent("CreateUserCredit", userCreditJSON)
+	if err := emitEvent(ctx, EventCreateUserCredit, EntityUserCredit, userId, userCredit, nil); err != nil {
+		return err
+	}
 
 	return nil
 }
 
 // 删,
-func (s *SmartContract) DeleteUserCredit(ctx contractapi.TransactionContextInterface, userId string) error {
+func (s *CreditContract) DeleteUserCredit(ctx contractapi.TransactionContextInterface, userId string) error {
 	//先验证是否存在
 	// 先通过ReadUserCredit方法读取，再判断
 	userCreditJSON, err := s.ReadUserCredit(ctx, userId)
@@ -353,23 +342,27 @@ func (s *SmartContract) DeleteUserCredit(ctx contractapi.TransactionContextInter
 		return fmt.Errorf("用户 %s 不存在", userId)
 	}
 
+	// 还有没结束的预留时不能删，否则 hold~/holdidx~ 记录会指向一个不存在的用户
+	holds, err := userActiveHolds(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if len(holds) > 0 {
+		return fmt.Errorf("用户 %s 还有 %d 个未结束的预留，请先扣款或释放", userId, len(holds))
+	}
+
 	//最后我们去删除
 	err = ctx.GetStub().DelState(userId)
 	if err != nil {
 		return fmt.Errorf("del failed:%v", err)
 	}
 
-	//setEvent
-	userCreditJSONBytes, err := json.Marshal(userCreditJSON)
-	if err != nil {
-		return fmt.Errorf("failed to marshal user credit for event: %v", err)
-	}
-	ctx.GetStub().SetEvent("DeleteUserCredit", userCreditJSONBytes)
-	return nil
+	//setEvent，删除事件只带 previous，这样下游可以和创建区分开
+	return emitEvent(ctx, EventDeleteUserCredit, EntityUserCredit, userId, nil, userCreditJSON)
 }
 
 // 改,
-func (s *SmartContract) UpdateUserCredit(ctx contractapi.TransactionContextInterface, userId string, credit int, totalUsed int, totalRecharge int) error {
+func (s *CreditContract) UpdateUserCredit(ctx contractapi.TransactionContextInterface, userId string, credit int, totalUsed int, totalRecharge int) error {
 	existingUserCredit, err := s.ReadUserCredit(ctx, userId)
 	if err != nil {
 		return fmt.Errorf("read failed:%v", err)
@@ -378,6 +371,13 @@ func (s *SmartContract) UpdateUserCredit(ctx contractapi.TransactionContextInter
 		return fmt.Errorf("%s is not existed", userId)
 	}
 
+	// 余额减少时同样受消费限额约束
+	if decrease := existingUserCredit.Credit - credit; decrease > 0 {
+		if err := chargeSpending(ctx, existingUserCredit, decrease); err != nil {
+			return err
+		}
+	}
+
 	// 是的，这里相当于声明并初始化了一个UserCredit指针，updatedUserCredit 指向了一个新的 UserCredit 结构体实例，并且字段已经被赋值。
 	updatedUserCredit := &UserCredit{
 		//用原来的UserId，UserID不变
@@ -385,6 +385,7 @@ func (s *SmartContract) UpdateUserCredit(ctx contractapi.TransactionContextInter
 		Credit:        credit,
 		TotalUsed:     totalUsed,
 		TotalRecharge: totalRecharge,
+		Held:          existingUserCredit.Held, // 预留只能通过 CaptureHold/ReleaseHold 变化
 		CreatedAt:     existingUserCredit.CreatedAt,
 		UpdatedAt:     time.Now().Format("2006-01-02 15:04:05"),
 	}
@@ -396,16 +397,18 @@ func (s *SmartContract) UpdateUserCredit(ctx contractapi.TransactionContextInter
 	}
 
 	//setEvent
-	ctx.GetStub().SetEvent("UpdateUserCredit", updatedUserCreditJSON)
+	if err := emitEvent(ctx, EventUpdateUserCredit, EntityUserCredit, userId, updatedUserCredit, existingUserCredit); err != nil {
+		return err
+	}
 	err = ctx.GetStub().PutState(userId, updatedUserCreditJSON)
 	if err != nil {
 		return fmt.Errorf("put state failed:%v", err)
 	}
-	return nil
+	return applyCreditEndorsement(ctx, updatedUserCredit)
 }
 
 // 查,
-func (s *SmartContract) ReadUserCredit(ctx contractapi.TransactionContextInterface, userId string) (*UserCredit, error) {
+func (s *CreditContract) ReadUserCredit(ctx contractapi.TransactionContextInterface, userId string) (*UserCredit, error) {
 	//直接获取
 	userCreditJSON, err := ctx.GetStub().GetState(userId)
 	if err != nil {
@@ -425,7 +428,7 @@ func (s *SmartContract) ReadUserCredit(ctx contractapi.TransactionContextInterfa
 }
 
 // 多个查
-func (s *SmartContract) GetAllUserCredits(ctx contractapi.TransactionContextInterface) ([]*UserCredit, error) {
+func (s *CreditContract) GetAllUserCredits(ctx contractapi.TransactionContextInterface) ([]*UserCredit, error) {
 
 	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
 	if err != nil {
@@ -470,7 +473,7 @@ func (s *SmartContract) GetAllUserCredits(ctx contractapi.TransactionContextInte
 }
 
 // 先添加辅助函数
-func (s *SmartContract) UserCreditExists(ctx contractapi.TransactionContextInterface, userId string) (bool, error) {
+func (s *CreditContract) UserCreditExists(ctx contractapi.TransactionContextInterface, userId string) (bool, error) {
 	userCreditJSON, err := ctx.GetStub().GetState(userId)
 	if err != nil {
 		return false, err
@@ -486,7 +489,7 @@ type MongoImportData struct {
 
 // InitFromMongoDB 从 MongoDB 数据初始化账本
 // 参数：JSON字符串，包含从 MongoDB 读取的所有数据
-func (s *SmartContract) InitFromMongoDB(ctx contractapi.TransactionContextInterface, jsonData string) (string, error) {
+func (s *AdminContract) InitFromMongoDB(ctx contractapi.TransactionContextInterface, jsonData string) (string, error) {
 
 	// 解析 JSON 数据
 	var importData MongoImportData
@@ -499,8 +502,14 @@ func (s *SmartContract) InitFromMongoDB(ctx contractapi.TransactionContextInterf
 	novelSuccessCount := 0
 	novelErrorCount := 0
 	for _, novel := range importData.Novels {
+		if err := novel.Validate(); err != nil {
+			log.Printf("⚠️ 小说数据不合法: %v", err)
+			novelErrorCount++
+			continue
+		}
+
 		// 检查小说是否已存在，如果存在则跳过（MongoDB 数据优先）
-		exists, err := s.NovelExists(ctx, novel.ID)
+		exists, err := keyExists(ctx, novel.ID)
 		if err != nil {
 			log.Printf("⚠️ 检查小说 %s 存在性失败: %v", novel.ID, err)
 			novelErrorCount++
@@ -534,8 +543,14 @@ func (s *SmartContract) InitFromMongoDB(ctx contractapi.TransactionContextInterf
 	creditSuccessCount := 0
 	creditErrorCount := 0
 	for _, userCredit := range importData.UserCredits {
+		if err := userCredit.Validate(); err != nil {
+			log.Printf("⚠️ 用户积分数据不合法: %v", err)
+			creditErrorCount++
+			continue
+		}
+
 		// 检查用户积分是否已存在，如果存在则跳过（MongoDB 数据优先）
-		exists, err := s.UserCreditExists(ctx, userCredit.UserID)
+		exists, err := keyExists(ctx, userCredit.UserID)
 		if err != nil {
 			log.Printf("⚠️ 检查用户积分 %s 存在性失败: %v", userCredit.UserID, err)
 			creditErrorCount++
@@ -560,6 +575,11 @@ func (s *SmartContract) InitFromMongoDB(ctx contractapi.TransactionContextInterf
 			creditErrorCount++
 			continue
 		}
+		if err := applyCreditEndorsement(ctx, &userCredit); err != nil {
+			log.Printf("⚠️ 设置用户积分 %s 的背书策略失败: %v", userCredit.UserID, err)
+			creditErrorCount++
+			continue
+		}
 
 		log.Printf("✅ 成功导入用户积分: %s - credit:%d", userCredit.UserID, userCredit.Credit)
 		creditSuccessCount++
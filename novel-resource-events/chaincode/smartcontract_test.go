@@ -0,0 +1,642 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/stretchr/testify/require"
+
+	"novel-resource-events/chaincode"
+	"novel-resource-events/ledgersim"
+)
+
+// contracts 把三个合约放在一起，测试直接调用交易函数
+type contracts struct {
+	*chaincode.NovelContract
+	*chaincode.CreditContract
+	*chaincode.AdminContract
+}
+
+func newContracts() *contracts {
+	return &contracts{
+		NovelContract:  new(chaincode.NovelContract),
+		CreditContract: new(chaincode.CreditContract),
+		AdminContract:  &chaincode.AdminContract{EnableSeed: true},
+	}
+}
+
+// platformAdmin 平台组织里带 role=admin 属性的身份，只有它能调用管理类交易
+func platformAdmin() *ledgersim.ClientIdentity {
+	return ledgersim.NewClientIdentity(chaincode.PlatformMSPID, "CN=Admin@org1.example.com", map[string]string{"role": "admin"})
+}
+
+// newLedger 创建空账本，默认用平台管理员提交交易
+func newLedger() *ledgersim.Ledger {
+	ledger := ledgersim.NewLedger()
+	ledger.SetIdentity(platformAdmin())
+	return ledger
+}
+
+// mustSubmit 准备测试数据用，失败直接终止测试
+func mustSubmit(t *testing.T, ledger *ledgersim.Ledger, fn func(ctx contractapi.TransactionContextInterface) error) *ledgersim.Transaction {
+	t.Helper()
+	tx, err := ledger.Submit(fn)
+	require.NoError(t, err)
+	return tx
+}
+
+// decodeEnvelope 解析交易最终的事件信封
+func decodeEnvelope(t *testing.T, tx *ledgersim.Transaction) chaincode.EventEnvelope {
+	t.Helper()
+	event := tx.Event()
+	require.NotNil(t, event, "expected a chaincode event")
+
+	var envelope chaincode.EventEnvelope
+	require.NoError(t, json.Unmarshal(event.Payload, &envelope))
+	require.Equal(t, event.Name, envelope.Type)
+	require.Equal(t, chaincode.EventSchemaVersion, envelope.SchemaVersion)
+	require.Equal(t, tx.TxID(), envelope.TxID)
+	return envelope
+}
+
+func createNovel(t *testing.T, ledger *ledgersim.Ledger, contract *contracts, id string) {
+	t.Helper()
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.CreateNovel(ctx, id, "author-"+id, "outline-"+id, "s1,s2", "c1", "i1", "2")
+	})
+}
+
+func createUserCredit(t *testing.T, ledger *ledgersim.Ledger, contract *contracts, userId string, credit int) {
+	t.Helper()
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.CreateUserCredit(ctx, userId, credit, 0, 0)
+	})
+}
+
+func readNovel(t *testing.T, ledger *ledgersim.Ledger, contract *contracts, id string) (*chaincode.Novel, error) {
+	t.Helper()
+	var novel *chaincode.Novel
+	_, err := ledger.Evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		novel, err = contract.ReadNovel(ctx, id)
+		return err
+	})
+	return novel, err
+}
+
+func readUserCredit(t *testing.T, ledger *ledgersim.Ledger, contract *contracts, userId string) (*chaincode.UserCredit, error) {
+	t.Helper()
+	var userCredit *chaincode.UserCredit
+	_, err := ledger.Evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		userCredit, err = contract.ReadUserCredit(ctx, userId)
+		return err
+	})
+	return userCredit, err
+}
+
+func TestCreateNovel(t *testing.T) {
+	tests := []struct {
+		name        string
+		existing    []string
+		id          string
+		expectedErr string
+	}{
+		{name: "creates a new novel", id: "novel_001"},
+		{name: "rejects a duplicate id", existing: []string{"novel_001"}, id: "novel_001", expectedErr: "novel with ID novel_001 already exists"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := ledgersim.NewLedger()
+			contract := newContracts()
+			for _, id := range tt.existing {
+				createNovel(t, ledger, contract, id)
+			}
+
+			tx, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+				return contract.CreateNovel(ctx, tt.id, "作者", "大纲", "第一章", "主角", "宝物", "1")
+			})
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			novel, err := readNovel(t, ledger, contract, tt.id)
+			require.NoError(t, err)
+			require.Equal(t, "作者", novel.Author)
+			require.Equal(t, novel.CreatedAt, novel.UpdatedAt)
+
+			envelope := decodeEnvelope(t, tx)
+			require.Equal(t, chaincode.EventCreateNovel, envelope.Type)
+			require.Equal(t, chaincode.EntityNovel, envelope.EntityType)
+			require.Equal(t, tt.id, envelope.EntityKey)
+			require.NotEmpty(t, envelope.Data)
+			require.Empty(t, envelope.Previous)
+			require.Contains(t, envelope.Actor, "Org1MSP:x509::CN=User1@org1.example.com")
+		})
+	}
+}
+
+func TestEventTraceParent(t *testing.T) {
+	const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tests := []struct {
+		name      string
+		transient map[string][]byte
+		expected  string
+	}{
+		{name: "copies the traceparent from transient data", transient: map[string][]byte{"traceparent": []byte(traceParent)}, expected: traceParent},
+		{name: "omits it without transient data"},
+		{name: "drops an oversized value", transient: map[string][]byte{"traceparent": make([]byte, 200)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger()
+			contract := newContracts()
+
+			tx := ledger.Begin()
+			tx.Stub().SetTransient(tt.transient)
+			require.NoError(t, contract.CreateNovel(tx.Context(), "novel_001", "作者", "大纲", "第一章", "主角", "宝物", "1"))
+			require.NoError(t, tx.Commit())
+
+			envelope := decodeEnvelope(t, tx)
+			require.Equal(t, tt.expected, envelope.TraceParent)
+			if tt.expected == "" {
+				require.NotContains(t, string(tx.Event().Payload), "traceparent")
+			}
+		})
+	}
+}
+
+func TestReadNovel(t *testing.T) {
+	ledger := newLedger()
+	contract := newContracts()
+	createNovel(t, ledger, contract, "novel_001")
+
+	tests := []struct {
+		name        string
+		id          string
+		expectedErr string
+	}{
+		{name: "reads an existing novel", id: "novel_001"},
+		{name: "missing novel", id: "novel_404", expectedErr: "the novel is not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			novel, err := readNovel(t, ledger, contract, tt.id)
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.id, novel.ID)
+		})
+	}
+}
+
+func TestGetAllNovels(t *testing.T) {
+	tests := []struct {
+		name        string
+		novels      []string
+		credits     []string
+		expectedIDs []string
+	}{
+		{name: "empty ledger", expectedIDs: nil},
+		{name: "only novels are returned", novels: []string{"novel_002", "novel_001"}, credits: []string{"user_001"}, expectedIDs: []string{"novel_001", "novel_002"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger()
+			contract := newContracts()
+			for _, id := range tt.novels {
+				createNovel(t, ledger, contract, id)
+			}
+			for _, userId := range tt.credits {
+				createUserCredit(t, ledger, contract, userId, 10)
+			}
+
+			var novels []*chaincode.Novel
+			_, err := ledger.Evaluate(func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				novels, err = contract.GetAllNovels(ctx)
+				return err
+			})
+			require.NoError(t, err)
+
+			var ids []string
+			for _, novel := range novels {
+				ids = append(ids, novel.ID)
+			}
+			require.Equal(t, tt.expectedIDs, ids)
+		})
+	}
+}
+
+func TestUpdateNovel(t *testing.T) {
+	tests := []struct {
+		name        string
+		id          string
+		expectedErr string
+	}{
+		{name: "updates an existing novel", id: "novel_001"},
+		{name: "missing novel", id: "novel_404", expectedErr: "novel with ID novel_404 does not exist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger()
+			contract := newContracts()
+			createNovel(t, ledger, contract, "novel_001")
+			before, err := readNovel(t, ledger, contract, "novel_001")
+			require.NoError(t, err)
+
+			tx, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+				return contract.UpdateNovel(ctx, tt.id, "新作者", "新大纲", "s", "c", "i", "3")
+			})
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			after, err := readNovel(t, ledger, contract, tt.id)
+			require.NoError(t, err)
+			require.Equal(t, "新作者", after.Author)
+			require.Equal(t, before.CreatedAt, after.CreatedAt)
+
+			envelope := decodeEnvelope(t, tx)
+			require.Equal(t, chaincode.EventUpdateNovel, envelope.Type)
+
+			var previous chaincode.Novel
+			require.NoError(t, json.Unmarshal(envelope.Previous, &previous))
+			require.Equal(t, before.Author, previous.Author)
+		})
+	}
+}
+
+func TestDeleteNovel(t *testing.T) {
+	tests := []struct {
+		name        string
+		id          string
+		expectedErr string
+	}{
+		{name: "deletes an existing novel", id: "novel_001"},
+		{name: "missing novel", id: "novel_404", expectedErr: "failed to get novel:the novel is not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger()
+			contract := newContracts()
+			createNovel(t, ledger, contract, "novel_001")
+
+			tx, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+				return contract.DeleteNovel(ctx, tt.id)
+			})
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Nil(t, ledger.Get(tt.id))
+
+			envelope := decodeEnvelope(t, tx)
+			require.Equal(t, chaincode.EventDeleteNovel, envelope.Type)
+			require.Empty(t, envelope.Data)
+			require.NotEmpty(t, envelope.Previous)
+		})
+	}
+}
+
+func TestNovelExists(t *testing.T) {
+	ledger := newLedger()
+	contract := newContracts()
+	createNovel(t, ledger, contract, "novel_001")
+
+	tests := []struct {
+		name     string
+		id       string
+		expected bool
+	}{
+		{name: "existing novel", id: "novel_001", expected: true},
+		{name: "missing novel", id: "novel_404", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var exists bool
+			_, err := ledger.Evaluate(func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				exists, err = contract.NovelExists(ctx, tt.id)
+				return err
+			})
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, exists)
+		})
+	}
+}
+
+func TestInitLedger(t *testing.T) {
+	ledger := newLedger()
+	contract := newContracts()
+
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.InitLedger(ctx)
+		return err
+	})
+
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{name: "seeds novel_001", key: "novel_001"},
+		{name: "seeds novel_003", key: "novel_003"},
+		{name: "seeds usercredit_002", key: "usercredit_002"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NotNil(t, ledger.Get(tt.key))
+		})
+	}
+}
+
+func TestCreateUserCredit(t *testing.T) {
+	tests := []struct {
+		name        string
+		existing    bool
+		expectedErr string
+	}{
+		{name: "creates a user credit"},
+		{name: "rejects a duplicate user", existing: true, expectedErr: "user credit with ID user_001 already exists"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger()
+			contract := newContracts()
+			if tt.existing {
+				createUserCredit(t, ledger, contract, "user_001", 5)
+			}
+
+			tx, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+				return contract.CreateUserCredit(ctx, "user_001", 100, 1, 2)
+			})
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			userCredit, err := readUserCredit(t, ledger, contract, "user_001")
+			require.NoError(t, err)
+			require.Equal(t, 100, userCredit.Credit)
+			require.Equal(t, 1, userCredit.TotalUsed)
+			require.Equal(t, 2, userCredit.TotalRecharge)
+
+			envelope := decodeEnvelope(t, tx)
+			require.Equal(t, chaincode.EventCreateUserCredit, envelope.Type)
+			require.Equal(t, chaincode.EntityUserCredit, envelope.EntityType)
+			require.Equal(t, "user_001", envelope.EntityKey)
+		})
+	}
+}
+
+func TestDeleteUserCredit(t *testing.T) {
+	tests := []struct {
+		name        string
+		userId      string
+		hold        int // 删除前预留的积分，0 表示不预留
+		release     bool
+		expectedErr string
+	}{
+		{name: "deletes an existing user", userId: "user_001"},
+		{name: "missing user", userId: "user_404", expectedErr: "读取用户积分信息失败: user_404 is not existed"},
+		{name: "active hold", userId: "user_001", hold: 4, expectedErr: "用户 user_001 还有 1 个未结束的预留，请先扣款或释放"},
+		{name: "released hold", userId: "user_001", hold: 4, release: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger()
+			contract := newContracts()
+			createUserCredit(t, ledger, contract, "user_001", 10)
+			if tt.hold > 0 {
+				holdCredits(t, ledger, contract, "user_001", tt.hold, "hold_001", 60)
+			}
+			if tt.release {
+				mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+					_, err := contract.ReleaseHold(ctx, "hold_001")
+					return err
+				})
+			}
+
+			tx, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+				return contract.DeleteUserCredit(ctx, tt.userId)
+			})
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Nil(t, ledger.Get(tt.userId))
+
+			envelope := decodeEnvelope(t, tx)
+			require.Equal(t, chaincode.EventDeleteUserCredit, envelope.Type)
+			require.Empty(t, envelope.Data)
+
+			var previous chaincode.UserCredit
+			require.NoError(t, json.Unmarshal(envelope.Previous, &previous))
+			require.Equal(t, 10, previous.Credit)
+		})
+	}
+}
+
+func TestUpdateUserCredit(t *testing.T) {
+	tests := []struct {
+		name        string
+		userId      string
+		expectedErr string
+	}{
+		{name: "updates an existing user", userId: "user_001"},
+		{name: "missing user", userId: "user_404", expectedErr: "read failed:user_404 is not existed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger()
+			contract := newContracts()
+			createUserCredit(t, ledger, contract, "user_001", 10)
+
+			tx, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+				return contract.UpdateUserCredit(ctx, tt.userId, 9, 1, 0)
+			})
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			userCredit, err := readUserCredit(t, ledger, contract, tt.userId)
+			require.NoError(t, err)
+			require.Equal(t, 9, userCredit.Credit)
+			require.Equal(t, 1, userCredit.TotalUsed)
+
+			envelope := decodeEnvelope(t, tx)
+			require.Equal(t, chaincode.EventUpdateUserCredit, envelope.Type)
+			require.NotEmpty(t, envelope.Data)
+			require.NotEmpty(t, envelope.Previous)
+		})
+	}
+}
+
+func TestReadUserCredit(t *testing.T) {
+	ledger := newLedger()
+	contract := newContracts()
+	createUserCredit(t, ledger, contract, "user_001", 10)
+
+	tests := []struct {
+		name        string
+		userId      string
+		expectedErr string
+	}{
+		{name: "reads an existing user", userId: "user_001"},
+		{name: "missing user", userId: "user_404", expectedErr: "user_404 is not existed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userCredit, err := readUserCredit(t, ledger, contract, tt.userId)
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, 10, userCredit.Credit)
+		})
+	}
+}
+
+func TestGetAllUserCredits(t *testing.T) {
+	tests := []struct {
+		name            string
+		novels          []string
+		credits         []string
+		expectedUserIDs []string
+	}{
+		{name: "empty ledger", expectedUserIDs: nil},
+		{name: "only user credits are returned", novels: []string{"novel_001"}, credits: []string{"user_002", "user_001"}, expectedUserIDs: []string{"user_001", "user_002"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger()
+			contract := newContracts()
+			for _, id := range tt.novels {
+				createNovel(t, ledger, contract, id)
+			}
+			for _, userId := range tt.credits {
+				createUserCredit(t, ledger, contract, userId, 10)
+			}
+
+			var userCredits []*chaincode.UserCredit
+			_, err := ledger.Evaluate(func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				userCredits, err = contract.GetAllUserCredits(ctx)
+				return err
+			})
+			require.NoError(t, err)
+
+			var userIDs []string
+			for _, userCredit := range userCredits {
+				userIDs = append(userIDs, userCredit.UserID)
+			}
+			require.Equal(t, tt.expectedUserIDs, userIDs)
+		})
+	}
+}
+
+func TestUserCreditExists(t *testing.T) {
+	ledger := newLedger()
+	contract := newContracts()
+	createUserCredit(t, ledger, contract, "user_001", 10)
+
+	tests := []struct {
+		name     string
+		userId   string
+		expected bool
+	}{
+		{name: "existing user", userId: "user_001", expected: true},
+		{name: "missing user", userId: "user_404", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var exists bool
+			_, err := ledger.Evaluate(func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				exists, err = contract.UserCreditExists(ctx, tt.userId)
+				return err
+			})
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, exists)
+		})
+	}
+}
+
+func TestInitFromMongoDB(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     string
+		expectedErr string
+		present     []string
+		credit      int
+	}{
+		{
+			name:    "imports novels and credits, skipping existing ones",
+			payload: `{"novels":[{"id":"novel_001","author":"mongo"},{"id":"novel_002","author":"mongo"}],"userCredits":[{"userId":"user_001","credit":99}]}`,
+			present: []string{"novel_001", "novel_002", "user_001"},
+			credit:  10,
+		},
+		{
+			name:        "rejects invalid json",
+			payload:     `{not json`,
+			expectedErr: "解析 MongoDB 数据失败",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger()
+			contract := newContracts()
+			createUserCredit(t, ledger, contract, "user_001", 10)
+
+			var result string
+			_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				result, err = contract.InitFromMongoDB(ctx, tt.payload)
+				return err
+			})
+			if tt.expectedErr != "" {
+				require.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Contains(t, result, "小说数据: 成功 2 个")
+
+			for _, key := range tt.present {
+				require.NotNil(t, ledger.Get(key), key)
+			}
+
+			// 链上已存在的数据不会被 MongoDB 覆盖
+			userCredit, err := readUserCredit(t, ledger, contract, "user_001")
+			require.NoError(t, err)
+			require.Equal(t, tt.credit, userCredit.Credit)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package chaincode_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/stretchr/testify/require"
+
+	"novel-resource-events/chaincode"
+	"novel-resource-events/ledgersim"
+)
+
+var snapshotRoot = strings.Repeat("ab", 32)
+
+func TestAnchorSnapshot(t *testing.T) {
+	ledger := newLedger()
+	contract := newContracts()
+
+	tx := mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.AnchorSnapshot(ctx, snapshotRoot, 42, "2025-09-01T16:00:00+08:00")
+		return err
+	})
+
+	envelope := decodeEnvelope(t, tx)
+	require.Equal(t, chaincode.EventAnchorSnapshot, envelope.Type)
+	require.Equal(t, chaincode.EntitySnapshot, envelope.EntityType)
+	require.Equal(t, "2025-09-01T08:00:00Z", envelope.EntityKey)
+
+	// takenAt 统一成 UTC，用任意时区都能读到
+	var anchor *chaincode.SnapshotAnchor
+	_, err := ledger.Evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		anchor, err = contract.ReadSnapshot(ctx, "2025-09-01T08:00:00Z")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, snapshotRoot, anchor.Root)
+	require.Equal(t, 42, anchor.Count)
+	require.Equal(t, tx.TxID(), anchor.TxID)
+
+	_, err = ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.AnchorSnapshot(ctx, snapshotRoot, 42, "2025-09-01T08:00:00Z")
+		return err
+	})
+	require.EqualError(t, err, "snapshot 2025-09-01T08:00:00Z already anchored")
+}
+
+func TestAnchorSnapshotsInTheSameSecond(t *testing.T) {
+	ledger := newLedger()
+	contract := newContracts()
+
+	// 管理服务传的是补零的定宽纳秒时间，账本上按 RFC3339Nano 保存
+	for _, takenAt := range []string{"2025-09-01T08:00:00.100000000Z", "2025-09-01T08:00:00.200000000Z"} {
+		mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+			_, err := contract.AnchorSnapshot(ctx, snapshotRoot, 1, takenAt)
+			return err
+		})
+	}
+
+	var anchor *chaincode.SnapshotAnchor
+	_, err := ledger.Evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		anchor, err = contract.ReadSnapshot(ctx, "2025-09-01T08:00:00.200000000Z")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, "2025-09-01T08:00:00.2Z", anchor.TakenAt)
+}
+
+func TestAnchorSnapshotValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		identity    *ledgersim.ClientIdentity
+		root        string
+		count       int
+		takenAt     string
+		expectedErr string
+	}{
+		{name: "rejects short root", root: "abcd", takenAt: "2025-09-01T08:00:00Z", expectedErr: "root must be a hex encoded sha256 hash"},
+		{name: "rejects non hex root", root: strings.Repeat("zz", 32), takenAt: "2025-09-01T08:00:00Z", expectedErr: "root must be a hex encoded sha256 hash"},
+		{name: "rejects negative count", root: snapshotRoot, count: -1, takenAt: "2025-09-01T08:00:00Z", expectedErr: "count can not be negative"},
+		{name: "rejects bad takenAt", root: snapshotRoot, takenAt: "2025-09-01 08:00:00", expectedErr: `invalid takenAt: parsing time "2025-09-01 08:00:00" as "2006-01-02T15:04:05Z07:00": cannot parse " 08:00:00" as "T"`},
+		{
+			name:        "rejects non admin",
+			identity:    ledgersim.NewClientIdentity("Org2MSP", "CN=User1", nil),
+			root:        snapshotRoot,
+			takenAt:     "2025-09-01T08:00:00Z",
+			expectedErr: "permission denied: Org2MSP is not an admin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger()
+			contract := newContracts()
+			if tt.identity != nil {
+				ledger.SetIdentity(tt.identity)
+			}
+
+			_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+				_, err := contract.AnchorSnapshot(ctx, tt.root, tt.count, tt.takenAt)
+				return err
+			})
+			require.EqualError(t, err, tt.expectedErr)
+		})
+	}
+}
+
+func TestReadSnapshotMissing(t *testing.T) {
+	ledger := newLedger()
+	contract := newContracts()
+
+	_, err := ledger.Evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.ReadSnapshot(ctx, "2025-09-01T08:00:00Z")
+		return err
+	})
+	require.EqualError(t, err, "snapshot 2025-09-01T08:00:00Z is not anchored")
+}
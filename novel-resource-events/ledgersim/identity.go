@@ -0,0 +1,70 @@
+package ledgersim
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/cid"
+)
+
+// DefaultIssuer 模拟身份使用的 CA，和 test-network 的 Org1 CA 一致
+const DefaultIssuer = "CN=ca.org1.example.com,O=org1.example.com,L=Durham,ST=North Carolina,C=US"
+
+// ClientIdentity 可配置的客户端身份，实现 cid.ClientIdentity
+type ClientIdentity struct {
+	MSPID       string
+	Subject     string
+	Issuer      string
+	Attributes  map[string]string
+	Certificate *x509.Certificate
+}
+
+var _ cid.ClientIdentity = (*ClientIdentity)(nil)
+
+// NewClientIdentity 创建身份，subject 形如 "CN=User1@org1.example.com"
+func NewClientIdentity(mspID string, subject string, attributes map[string]string) *ClientIdentity {
+	if attributes == nil {
+		attributes = map[string]string{}
+	}
+	return &ClientIdentity{
+		MSPID:      mspID,
+		Subject:    subject,
+		Issuer:     DefaultIssuer,
+		Attributes: attributes,
+	}
+}
+
+// GetID 和 cid 包一样返回 base64("x509::subject::issuer")
+func (ci *ClientIdentity) GetID() (string, error) {
+	id := fmt.Sprintf("x509::%s::%s", ci.Subject, ci.Issuer)
+	return base64.StdEncoding.EncodeToString([]byte(id)), nil
+}
+
+// GetMSPID 实现 cid.ClientIdentity
+func (ci *ClientIdentity) GetMSPID() (string, error) {
+	return ci.MSPID, nil
+}
+
+// GetAttributeValue 实现 cid.ClientIdentity
+func (ci *ClientIdentity) GetAttributeValue(attrName string) (string, bool, error) {
+	value, found := ci.Attributes[attrName]
+	return value, found, nil
+}
+
+// AssertAttributeValue 实现 cid.ClientIdentity
+func (ci *ClientIdentity) AssertAttributeValue(attrName, attrValue string) error {
+	value, found := ci.Attributes[attrName]
+	if !found {
+		return fmt.Errorf("attribute '%s' was not found", attrName)
+	}
+	if value != attrValue {
+		return fmt.Errorf("attribute '%s' equals '%s', not '%s'", attrName, value, attrValue)
+	}
+	return nil
+}
+
+// GetX509Certificate 实现 cid.ClientIdentity
+func (ci *ClientIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return ci.Certificate, nil
+}
@@ -0,0 +1,67 @@
+package ledgersim
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
+)
+
+// stateIterator 实现 shim.StateQueryIteratorInterface
+type stateIterator struct {
+	results []*queryresult.KV
+	index   int
+	closed  bool
+}
+
+func newStateIterator(results []*queryresult.KV) *stateIterator {
+	return &stateIterator{results: results}
+}
+
+// HasNext 实现 shim.StateQueryIteratorInterface
+func (it *stateIterator) HasNext() bool {
+	return !it.closed && it.index < len(it.results)
+}
+
+// Next 实现 shim.StateQueryIteratorInterface
+func (it *stateIterator) Next() (*queryresult.KV, error) {
+	if !it.HasNext() {
+		return nil, fmt.Errorf("no more results")
+	}
+	result := it.results[it.index]
+	it.index++
+	return result, nil
+}
+
+// Close 实现 shim.StateQueryIteratorInterface
+func (it *stateIterator) Close() error {
+	it.closed = true
+	return nil
+}
+
+// historyIterator 实现 shim.HistoryQueryIteratorInterface
+type historyIterator struct {
+	entries []*queryresult.KeyModification
+	index   int
+	closed  bool
+}
+
+// HasNext 实现 shim.HistoryQueryIteratorInterface
+func (it *historyIterator) HasNext() bool {
+	return !it.closed && it.index < len(it.entries)
+}
+
+// Next 实现 shim.HistoryQueryIteratorInterface
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	if !it.HasNext() {
+		return nil, fmt.Errorf("no more results")
+	}
+	entry := it.entries[it.index]
+	it.index++
+	return entry, nil
+}
+
+// Close 实现 shim.HistoryQueryIteratorInterface
+func (it *historyIterator) Close() error {
+	it.closed = true
+	return nil
+}
@@ -0,0 +1,420 @@
+// Package ledgersim 提供一个内存版的 Fabric 账本模拟器，用于在不启动测试网络的情况下测试链码
+//
+// 用法：
+//
+//	ledger := ledgersim.NewLedger()
+//	tx, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+//		return contract.CreateNovel(ctx, "novel_001", ...)
+//	})
+//
+// Submit 成功时提交写集合，失败时丢弃；Evaluate 只读不提交。
+// 和真实的 peer 一样，交易内的读取只能看到已提交的状态，看不到本交易自己的写入。
+// 用 SetEndorsers 指定背书组织后，提交时按已提交的 key 级别背书策略校验写集合。
+package ledgersim
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/statebased"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// DefaultChannel 默认通道名，和 test-network 保持一致
+const DefaultChannel = "mychannel"
+
+// DefaultStartTime 模拟时钟的默认起点，固定值保证测试结果可复现
+var DefaultStartTime = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Ledger 内存账本，保存已提交的世界状态、私有数据、背书策略和历史记录
+type Ledger struct {
+	mu sync.Mutex
+
+	channelID  string
+	state      map[string][]byte
+	private    map[string]map[string][]byte
+	validation map[string][]byte
+	history    map[string][]*queryresult.KeyModification
+
+	identity   *ClientIdentity
+	endorsers  []string
+	clock      time.Time
+	txInterval time.Duration
+	txCounter  int
+}
+
+// NewLedger 创建一个空账本，默认身份是 Org1MSP 的 User1
+func NewLedger() *Ledger {
+	return &Ledger{
+		channelID:  DefaultChannel,
+		state:      make(map[string][]byte),
+		private:    make(map[string]map[string][]byte),
+		validation: make(map[string][]byte),
+		history:    make(map[string][]*queryresult.KeyModification),
+		identity:   NewClientIdentity("Org1MSP", "CN=User1@org1.example.com", nil),
+		clock:      DefaultStartTime,
+		txInterval: time.Second,
+	}
+}
+
+// SetIdentity 设置之后交易使用的客户端身份
+func (l *Ledger) SetIdentity(identity *ClientIdentity) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.identity = identity
+}
+
+// SetEndorsers 设置之后交易的背书组织，不传参数表示不校验 key 级别背书策略（默认）
+func (l *Ledger) SetEndorsers(mspIDs ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.endorsers = append([]string(nil), mspIDs...)
+}
+
+// SetTime 设置下一笔交易的时间戳
+func (l *Ledger) SetTime(t time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clock = t.UTC()
+}
+
+// Advance 把模拟时钟往后拨
+func (l *Ledger) Advance(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clock = l.clock.Add(d)
+}
+
+// Now 返回下一笔交易将使用的时间戳
+func (l *Ledger) Now() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.clock
+}
+
+// SetTxInterval 设置每笔交易之后时钟前进的步长，默认 1 秒
+func (l *Ledger) SetTxInterval(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.txInterval = d
+}
+
+// Begin 开始一笔新交易，返回的 Transaction 需要调用 Commit 才会写入账本
+func (l *Ledger) Begin() *Transaction {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.txCounter++
+	txID := fmt.Sprintf("tx%06d", l.txCounter)
+	timestamp := l.clock
+	l.clock = l.clock.Add(l.txInterval)
+
+	stub := newStub(l, l.identity, txID, timestamp)
+	ctx := new(contractapi.TransactionContext)
+	ctx.SetStub(stub)
+	ctx.SetClientIdentity(l.identity)
+
+	return &Transaction{ledger: l, stub: stub, ctx: ctx, endorsers: l.endorsers}
+}
+
+// Submit 在一笔交易中执行 fn，成功则提交，失败则丢弃写集合
+func (l *Ledger) Submit(fn func(ctx contractapi.TransactionContextInterface) error) (*Transaction, error) {
+	tx := l.Begin()
+	if err := fn(tx.Context()); err != nil {
+		return tx, err
+	}
+	return tx, tx.Commit()
+}
+
+// Evaluate 在一笔交易中执行 fn，但不提交任何写入（相当于 EvaluateTransaction）
+func (l *Ledger) Evaluate(fn func(ctx contractapi.TransactionContextInterface) error) (*Transaction, error) {
+	tx := l.Begin()
+	return tx, fn(tx.Context())
+}
+
+// Get 直接读取已提交的状态，方便测试断言
+func (l *Ledger) Get(key string) []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return cloneBytes(l.state[key])
+}
+
+// Put 直接写入已提交的状态（不产生历史记录），用于准备测试数据
+func (l *Ledger) Put(key string, value []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.state[key] = cloneBytes(value)
+}
+
+// Keys 返回所有已提交的 key（包括组合键），按字典序排列
+func (l *Ledger) Keys() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return sortedKeys(l.state)
+}
+
+// ValidationParameter 返回 key 级别背书策略
+func (l *Ledger) ValidationParameter(key string) []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return cloneBytes(l.validation[key])
+}
+
+// readState 读取已提交状态
+func (l *Ledger) readState(key string) []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return cloneBytes(l.state[key])
+}
+
+// rangeState 返回 [startKey, endKey) 内的已提交状态，endKey 为空表示没有上界
+func (l *Ledger) rangeState(startKey, endKey string) []*queryresult.KV {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var results []*queryresult.KV
+	for _, key := range sortedKeys(l.state) {
+		if key < startKey {
+			continue
+		}
+		if endKey != "" && key >= endKey {
+			continue
+		}
+		results = append(results, &queryresult.KV{
+			Namespace: "",
+			Key:       key,
+			Value:     cloneBytes(l.state[key]),
+		})
+	}
+	return results
+}
+
+// readHistory 历史记录按从新到旧返回，和 Fabric v2 一致
+func (l *Ledger) readHistory(key string) []*queryresult.KeyModification {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := l.history[key]
+	results := make([]*queryresult.KeyModification, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		results = append(results, &queryresult.KeyModification{
+			TxId:      entry.TxId,
+			Value:     cloneBytes(entry.Value),
+			Timestamp: entry.Timestamp,
+			IsDelete:  entry.IsDelete,
+		})
+	}
+	return results
+}
+
+func (l *Ledger) readPrivate(collection, key string) []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return cloneBytes(l.private[collection][key])
+}
+
+func (l *Ledger) rangePrivate(collection, startKey, endKey string) []*queryresult.KV {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var results []*queryresult.KV
+	for _, key := range sortedKeys(l.private[collection]) {
+		if key < startKey || (endKey != "" && key >= endKey) {
+			continue
+		}
+		results = append(results, &queryresult.KV{
+			Namespace: collection,
+			Key:       key,
+			Value:     cloneBytes(l.private[collection][key]),
+		})
+	}
+	return results
+}
+
+// commit 把交易写集合应用到账本，背书不满足 key 级别策略时整笔交易无效
+func (l *Ledger) commit(s *Stub, endorsers []string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if endorsers != nil {
+		if err := l.validateEndorsement(s, endorsers); err != nil {
+			return err
+		}
+	}
+
+	timestamp := timestamppb.New(s.timestamp)
+	for _, key := range sortedWriteKeys(s.writes) {
+		w := s.writes[key]
+		if w.delete {
+			delete(l.state, key)
+		} else {
+			l.state[key] = w.value
+		}
+		l.history[key] = append(l.history[key], &queryresult.KeyModification{
+			TxId:      s.txID,
+			Value:     w.value,
+			Timestamp: timestamp,
+			IsDelete:  w.delete,
+		})
+	}
+
+	for collection, writes := range s.privateWrites {
+		if l.private[collection] == nil {
+			l.private[collection] = make(map[string][]byte)
+		}
+		for key, w := range writes {
+			if w.delete {
+				delete(l.private[collection], key)
+			} else {
+				l.private[collection][key] = w.value
+			}
+		}
+	}
+
+	for key, ep := range s.validationWrites {
+		if ep == nil {
+			delete(l.validation, key)
+		} else {
+			l.validation[key] = ep
+		}
+	}
+	return nil
+}
+
+// validateEndorsement 和 peer 的验证一样，用交易之前已提交的策略校验写入的 key 和修改策略的 key
+// 同一笔交易里新设置的策略只对之后的交易生效
+// 只支持 statebased 生成的策略，即策略里的每个组织都要背书
+func (l *Ledger) validateEndorsement(s *Stub, endorsers []string) error {
+	keys := make(map[string]bool)
+	for key := range s.writes {
+		keys[key] = true
+	}
+	for collection, writes := range s.privateWrites {
+		for key := range writes {
+			keys[collection+compositeKeyNamespace+key] = true
+		}
+	}
+	for key := range s.validationWrites {
+		keys[key] = true
+	}
+
+	endorsed := make(map[string]bool, len(endorsers))
+	for _, mspID := range endorsers {
+		endorsed[mspID] = true
+	}
+	for _, key := range sortedFlagKeys(keys) {
+		ep := l.validation[key]
+		if len(ep) == 0 {
+			continue
+		}
+		policy, err := statebased.NewStateEP(ep)
+		if err != nil {
+			return fmt.Errorf("invalid validation parameter of key %q: %v", key, err)
+		}
+		for _, org := range policy.ListOrgs() {
+			if !endorsed[org] {
+				return fmt.Errorf("transaction %s failed to commit with status code ENDORSEMENT_POLICY_FAILURE: key %q requires an endorsement from %s", s.txID, key, org)
+			}
+		}
+	}
+	return nil
+}
+
+// Transaction 一笔模拟交易
+type Transaction struct {
+	ledger    *Ledger
+	stub      *Stub
+	ctx       *contractapi.TransactionContext
+	endorsers []string
+	committed bool
+}
+
+// Context 返回传给链码函数的交易上下文
+func (t *Transaction) Context() contractapi.TransactionContextInterface {
+	return t.ctx
+}
+
+// Stub 返回底层的 ChaincodeStubInterface 实现
+func (t *Transaction) Stub() *Stub {
+	return t.stub
+}
+
+// TxID 交易ID
+func (t *Transaction) TxID() string {
+	return t.stub.txID
+}
+
+// Timestamp 交易时间戳
+func (t *Transaction) Timestamp() time.Time {
+	return t.stub.timestamp
+}
+
+// Event 返回交易最终的链码事件，Fabric 每笔交易只保留最后一次 SetEvent
+func (t *Transaction) Event() *Event {
+	if len(t.stub.events) == 0 {
+		return nil
+	}
+	return t.stub.events[len(t.stub.events)-1]
+}
+
+// Events 返回交易中所有 SetEvent 调用，便于发现被覆盖的事件
+func (t *Transaction) Events() []*Event {
+	return t.stub.events
+}
+
+// Commit 提交交易写集合，重复提交或者背书不满足 key 级别策略会报错
+func (t *Transaction) Commit() error {
+	if t.committed {
+		return fmt.Errorf("transaction %s already committed", t.stub.txID)
+	}
+	if err := t.ledger.commit(t.stub, t.endorsers); err != nil {
+		return err
+	}
+	t.committed = true
+	return nil
+}
+
+// Event 捕获到的链码事件
+type Event struct {
+	Name    string
+	Payload []byte
+}
+
+func cloneBytes(value []byte) []byte {
+	if value == nil {
+		return nil
+	}
+	return append([]byte(nil), value...)
+}
+
+func sortedKeys(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedFlagKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedWriteKeys(m map[string]*write) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
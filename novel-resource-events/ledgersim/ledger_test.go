@@ -0,0 +1,331 @@
+package ledgersim_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/statebased"
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/stretchr/testify/require"
+
+	"novel-resource-events/ledgersim"
+)
+
+var errFailed = errors.New("chaincode failed")
+
+func put(t *testing.T, ledger *ledgersim.Ledger, kv map[string]string) {
+	t.Helper()
+	_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+		for key, value := range kv {
+			if err := ctx.GetStub().PutState(key, []byte(value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func collectKeys(t *testing.T, it shim.StateQueryIteratorInterface) []string {
+	t.Helper()
+	defer it.Close()
+	var keys []string
+	for it.HasNext() {
+		kv, err := it.Next()
+		require.NoError(t, err)
+		keys = append(keys, kv.Key)
+	}
+	return keys
+}
+
+func TestWritesAreBufferedUntilCommit(t *testing.T) {
+	ledger := ledgersim.NewLedger()
+
+	tx := ledger.Begin()
+	stub := tx.Context().GetStub()
+	require.NoError(t, stub.PutState("k1", []byte("v1")))
+
+	value, err := stub.GetState("k1")
+	require.NoError(t, err)
+	require.Nil(t, value, "a transaction must not read its own writes")
+	require.Nil(t, ledger.Get("k1"))
+
+	require.NoError(t, tx.Commit())
+	require.Equal(t, []byte("v1"), ledger.Get("k1"))
+	require.Error(t, tx.Commit())
+}
+
+func TestFailedSubmitDiscardsWrites(t *testing.T) {
+	ledger := ledgersim.NewLedger()
+
+	_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+		require.NoError(t, ctx.GetStub().PutState("k1", []byte("v1")))
+		return errFailed
+	})
+	require.ErrorIs(t, err, errFailed)
+	require.Nil(t, ledger.Get("k1"))
+}
+
+func TestDelState(t *testing.T) {
+	ledger := ledgersim.NewLedger()
+	put(t, ledger, map[string]string{"k1": "v1"})
+
+	_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+		return ctx.GetStub().DelState("k1")
+	})
+	require.NoError(t, err)
+	require.Nil(t, ledger.Get("k1"))
+}
+
+func TestRangeQueriesSkipCompositeKeys(t *testing.T) {
+	ledger := ledgersim.NewLedger()
+	put(t, ledger, map[string]string{"a": "1", "b": "2", "c": "3"})
+
+	_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+		key, err := ctx.GetStub().CreateCompositeKey("hold", []string{"user1", "h1"})
+		if err != nil {
+			return err
+		}
+		return ctx.GetStub().PutState(key, []byte("x"))
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		start    string
+		end      string
+		expected []string
+	}{
+		{name: "all simple keys", start: "", end: "", expected: []string{"a", "b", "c"}},
+		{name: "end is exclusive", start: "a", end: "c", expected: []string{"a", "b"}},
+		{name: "open end", start: "b", end: "", expected: []string{"b", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := ledger.Begin()
+			it, err := tx.Context().GetStub().GetStateByRange(tt.start, tt.end)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, collectKeys(t, it))
+		})
+	}
+}
+
+func TestCompositeKeys(t *testing.T) {
+	ledger := ledgersim.NewLedger()
+
+	_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+		stub := ctx.GetStub()
+		for _, attrs := range [][]string{{"user1", "h1"}, {"user1", "h2"}, {"user2", "h3"}} {
+			key, err := stub.CreateCompositeKey("hold", attrs)
+			if err != nil {
+				return err
+			}
+			if err := stub.PutState(key, []byte(attrs[1])); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	stub := ledger.Begin().Context().GetStub()
+
+	it, err := stub.GetStateByPartialCompositeKey("hold", []string{"user1"})
+	require.NoError(t, err)
+	keys := collectKeys(t, it)
+	require.Len(t, keys, 2)
+
+	objectType, attrs, err := stub.SplitCompositeKey(keys[1])
+	require.NoError(t, err)
+	require.Equal(t, "hold", objectType)
+	require.Equal(t, []string{"user1", "h2"}, attrs)
+
+	_, err = stub.CreateCompositeKey("hold", []string{"bad\x00attr"})
+	require.Error(t, err)
+
+	_, err = stub.GetStateByRange("\x00hold", "")
+	require.Error(t, err)
+}
+
+func TestPagination(t *testing.T) {
+	ledger := ledgersim.NewLedger()
+	put(t, ledger, map[string]string{"k1": "1", "k2": "2", "k3": "3", "k4": "4", "k5": "5"})
+
+	stub := ledger.Begin().Context().GetStub()
+
+	var pages [][]string
+	bookmark := ""
+	for {
+		it, metadata, err := stub.GetStateByRangeWithPagination("", "", 2, bookmark)
+		require.NoError(t, err)
+		page := collectKeys(t, it)
+		require.Equal(t, int32(len(page)), metadata.FetchedRecordsCount)
+		pages = append(pages, page)
+		if metadata.Bookmark == "" {
+			break
+		}
+		bookmark = metadata.Bookmark
+	}
+
+	require.Equal(t, [][]string{{"k1", "k2"}, {"k3", "k4"}, {"k5"}}, pages)
+
+	_, _, err := stub.GetStateByRangeWithPagination("", "", 0, "")
+	require.Error(t, err)
+}
+
+func TestHistoryForKey(t *testing.T) {
+	ledger := ledgersim.NewLedger()
+	put(t, ledger, map[string]string{"k1": "v1"})
+	put(t, ledger, map[string]string{"k1": "v2"})
+	_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+		return ctx.GetStub().DelState("k1")
+	})
+	require.NoError(t, err)
+
+	it, err := ledger.Begin().Context().GetStub().GetHistoryForKey("k1")
+	require.NoError(t, err)
+	defer it.Close()
+
+	var values []string
+	var deletes []bool
+	for it.HasNext() {
+		entry, err := it.Next()
+		require.NoError(t, err)
+		require.NotEmpty(t, entry.TxId)
+		values = append(values, string(entry.Value))
+		deletes = append(deletes, entry.IsDelete)
+	}
+
+	require.Equal(t, []string{"", "v2", "v1"}, values)
+	require.Equal(t, []bool{true, false, false}, deletes)
+}
+
+func TestEventsAndTimestamps(t *testing.T) {
+	ledger := ledgersim.NewLedger()
+	start := time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC)
+	ledger.SetTime(start)
+
+	tx, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+		stub := ctx.GetStub()
+		if err := stub.SetEvent("First", []byte("1")); err != nil {
+			return err
+		}
+		return stub.SetEvent("Second", []byte("2"))
+	})
+	require.NoError(t, err)
+	require.Len(t, tx.Events(), 2)
+	require.Equal(t, "Second", tx.Event().Name, "only the last event survives")
+
+	ts, err := tx.Context().GetStub().GetTxTimestamp()
+	require.NoError(t, err)
+	require.Equal(t, start, ts.AsTime())
+
+	next := ledger.Begin()
+	require.Equal(t, start.Add(time.Second), next.Timestamp())
+	require.NotEqual(t, tx.TxID(), next.TxID())
+
+	require.Error(t, next.Context().GetStub().SetEvent("", nil))
+}
+
+func TestClientIdentity(t *testing.T) {
+	ledger := ledgersim.NewLedger()
+	ledger.SetIdentity(ledgersim.NewClientIdentity("Org2MSP", "CN=admin", map[string]string{"role": "admin"}))
+
+	ci := ledger.Begin().Context().GetClientIdentity()
+
+	mspID, err := ci.GetMSPID()
+	require.NoError(t, err)
+	require.Equal(t, "Org2MSP", mspID)
+
+	require.NoError(t, ci.AssertAttributeValue("role", "admin"))
+	require.Error(t, ci.AssertAttributeValue("role", "user"))
+
+	_, found, err := ci.GetAttributeValue("missing")
+	require.NoError(t, err)
+	require.False(t, found)
+}
+
+func TestValidationParameters(t *testing.T) {
+	ledger := ledgersim.NewLedger()
+
+	_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+		return ctx.GetStub().SetStateValidationParameter("k1", []byte("policy"))
+	})
+	require.NoError(t, err)
+
+	ep, err := ledger.Begin().Context().GetStub().GetStateValidationParameter("k1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("policy"), ep)
+}
+
+func TestKeyLevelEndorsement(t *testing.T) {
+	policy, err := statebased.NewStateEP(nil)
+	require.NoError(t, err)
+	require.NoError(t, policy.AddOrgs(statebased.RoleTypeMember, "Org1MSP", "Org2MSP"))
+	ep, err := policy.Policy()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		endorsers []string
+		write     func(stub shim.ChaincodeStubInterface) error
+		rejected  bool
+	}{
+		{
+			name:      "every org endorsed",
+			endorsers: []string{"Org1MSP", "Org2MSP"},
+			write:     func(stub shim.ChaincodeStubInterface) error { return stub.PutState("k1", []byte("v2")) },
+		},
+		{
+			name:      "missing org",
+			endorsers: []string{"Org1MSP"},
+			write:     func(stub shim.ChaincodeStubInterface) error { return stub.PutState("k1", []byte("v2")) },
+			rejected:  true,
+		},
+		{
+			name:      "clearing the policy needs the policy too",
+			endorsers: []string{"Org1MSP"},
+			write:     func(stub shim.ChaincodeStubInterface) error { return stub.SetStateValidationParameter("k1", nil) },
+			rejected:  true,
+		},
+		{
+			name:      "keys without a policy",
+			endorsers: []string{"Org1MSP"},
+			write:     func(stub shim.ChaincodeStubInterface) error { return stub.PutState("k2", []byte("v2")) },
+		},
+		{
+			name:  "no endorsers means no validation",
+			write: func(stub shim.ChaincodeStubInterface) error { return stub.PutState("k1", []byte("v2")) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := ledgersim.NewLedger()
+			// 策略和值在同一笔交易里设置，这笔交易本身不受新策略约束
+			ledger.SetEndorsers("Org1MSP")
+			_, err := ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+				if err := ctx.GetStub().PutState("k1", []byte("v1")); err != nil {
+					return err
+				}
+				return ctx.GetStub().SetStateValidationParameter("k1", ep)
+			})
+			require.NoError(t, err)
+
+			ledger.SetEndorsers(tt.endorsers...)
+			_, err = ledger.Submit(func(ctx contractapi.TransactionContextInterface) error {
+				return tt.write(ctx.GetStub())
+			})
+			if tt.rejected {
+				require.ErrorContains(t, err, "ENDORSEMENT_POLICY_FAILURE")
+				require.Equal(t, []byte("v1"), ledger.Get("k1"))
+				require.Equal(t, ep, ledger.ValidationParameter("k1"))
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,437 @@
+package ledgersim
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// 和 shim 包中的常量保持一致
+const (
+	minUnicodeRuneValue   = 0
+	maxUnicodeRuneValue   = utf8.MaxRune
+	compositeKeyNamespace = "\x00"
+	emptyKeySubstitute    = "\x01"
+)
+
+// write 写集合中的一项，delete 为 true 表示删除
+type write struct {
+	value  []byte
+	delete bool
+}
+
+// Stub 内存版 shim.ChaincodeStubInterface
+type Stub struct {
+	ledger    *Ledger
+	identity  *ClientIdentity
+	txID      string
+	timestamp time.Time
+
+	args      [][]byte
+	transient map[string][]byte
+	events    []*Event
+
+	writes           map[string]*write
+	privateWrites    map[string]map[string]*write
+	validationWrites map[string][]byte
+}
+
+var _ shim.ChaincodeStubInterface = (*Stub)(nil)
+
+func newStub(ledger *Ledger, identity *ClientIdentity, txID string, timestamp time.Time) *Stub {
+	return &Stub{
+		ledger:           ledger,
+		identity:         identity,
+		txID:             txID,
+		timestamp:        timestamp,
+		transient:        make(map[string][]byte),
+		writes:           make(map[string]*write),
+		privateWrites:    make(map[string]map[string]*write),
+		validationWrites: make(map[string][]byte),
+	}
+}
+
+// SetArgs 设置 GetArgs 系列方法返回的参数，第一个参数是函数名
+func (s *Stub) SetArgs(args ...string) {
+	s.args = make([][]byte, 0, len(args))
+	for _, arg := range args {
+		s.args = append(s.args, []byte(arg))
+	}
+}
+
+// SetTransient 设置 GetTransient 返回的瞬态数据
+func (s *Stub) SetTransient(transient map[string][]byte) {
+	s.transient = transient
+}
+
+// GetArgs 实现 shim.ChaincodeStubInterface
+func (s *Stub) GetArgs() [][]byte {
+	return s.args
+}
+
+// GetStringArgs 实现 shim.ChaincodeStubInterface
+func (s *Stub) GetStringArgs() []string {
+	args := make([]string, 0, len(s.args))
+	for _, arg := range s.args {
+		args = append(args, string(arg))
+	}
+	return args
+}
+
+// GetFunctionAndParameters 实现 shim.ChaincodeStubInterface
+func (s *Stub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+	return args[0], args[1:]
+}
+
+// GetArgsSlice 实现 shim.ChaincodeStubInterface
+func (s *Stub) GetArgsSlice() ([]byte, error) {
+	var slice []byte
+	for _, arg := range s.args {
+		slice = append(slice, arg...)
+	}
+	return slice, nil
+}
+
+// GetTxID 实现 shim.ChaincodeStubInterface
+func (s *Stub) GetTxID() string {
+	return s.txID
+}
+
+// GetChannelID 实现 shim.ChaincodeStubInterface
+func (s *Stub) GetChannelID() string {
+	return s.ledger.channelID
+}
+
+// InvokeChaincode 模拟器不支持跨链码调用
+func (s *Stub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) *peer.Response {
+	return shim.Error(fmt.Sprintf("ledgersim: InvokeChaincode %s is not supported", chaincodeName))
+}
+
+// GetState 读取已提交的状态，看不到本交易自己的写入
+func (s *Stub) GetState(key string) ([]byte, error) {
+	return s.ledger.readState(key), nil
+}
+
+// PutState 写入写集合，Commit 后生效
+func (s *Stub) PutState(key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key must not be an empty string")
+	}
+	if len(value) == 0 {
+		// 和 peer 一样，空值等价于删除
+		return s.DelState(key)
+	}
+	s.writes[key] = &write{value: cloneBytes(value)}
+	return nil
+}
+
+// DelState 在写集合中标记删除
+func (s *Stub) DelState(key string) error {
+	if key == "" {
+		return fmt.Errorf("key must not be an empty string")
+	}
+	s.writes[key] = &write{delete: true}
+	return nil
+}
+
+// SetStateValidationParameter 设置 key 级别背书策略，ep 为 nil 表示清除
+func (s *Stub) SetStateValidationParameter(key string, ep []byte) error {
+	s.validationWrites[key] = cloneBytes(ep)
+	return nil
+}
+
+// GetStateValidationParameter 读取已提交的 key 级别背书策略
+func (s *Stub) GetStateValidationParameter(key string) ([]byte, error) {
+	return s.ledger.ValidationParameter(key), nil
+}
+
+// GetStateByRange 范围查询，和 shim 一样空的 startKey 会跳过组合键
+func (s *Stub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if startKey == "" {
+		startKey = emptyKeySubstitute
+	}
+	if err := validateSimpleKeys(startKey, endKey); err != nil {
+		return nil, err
+	}
+	return newStateIterator(s.ledger.rangeState(startKey, endKey)), nil
+}
+
+// GetStateByRangeWithPagination 分页范围查询，bookmark 是下一页的起始 key
+func (s *Stub) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32,
+	bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	if startKey == "" {
+		startKey = emptyKeySubstitute
+	}
+	if err := validateSimpleKeys(startKey, endKey); err != nil {
+		return nil, nil, err
+	}
+	return paginate(s.ledger.rangeState(startKey, endKey), pageSize, bookmark)
+}
+
+// GetStateByPartialCompositeKey 组合键前缀查询
+func (s *Stub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	startKey, endKey, err := partialCompositeKeyRange(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+	return newStateIterator(s.ledger.rangeState(startKey, endKey)), nil
+}
+
+// GetStateByPartialCompositeKeyWithPagination 分页的组合键前缀查询
+func (s *Stub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string,
+	pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	startKey, endKey, err := partialCompositeKeyRange(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	return paginate(s.ledger.rangeState(startKey, endKey), pageSize, bookmark)
+}
+
+// CreateCompositeKey 实现 shim.ChaincodeStubInterface
+func (s *Stub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return createCompositeKey(objectType, attributes)
+}
+
+// SplitCompositeKey 实现 shim.ChaincodeStubInterface
+func (s *Stub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	componentIndex := 1
+	var components []string
+	for i := 1; i < len(compositeKey); i++ {
+		if compositeKey[i] == minUnicodeRuneValue {
+			components = append(components, compositeKey[componentIndex:i])
+			componentIndex = i + 1
+		}
+	}
+	if len(components) == 0 {
+		return "", nil, fmt.Errorf("invalid composite key: %q", compositeKey)
+	}
+	return components[0], components[1:], nil
+}
+
+// GetQueryResult 富查询只有 CouchDB 支持，模拟器的行为和 LevelDB 一致
+func (s *Stub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	return nil, fmt.Errorf("ledgersim: rich queries are not supported (LevelDB state database)")
+}
+
+// GetQueryResultWithPagination 同 GetQueryResult
+func (s *Stub) GetQueryResultWithPagination(query string, pageSize int32,
+	bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	return nil, nil, fmt.Errorf("ledgersim: rich queries are not supported (LevelDB state database)")
+}
+
+// GetHistoryForKey 返回 key 的历史修改记录，从新到旧
+func (s *Stub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &historyIterator{entries: s.ledger.readHistory(key)}, nil
+}
+
+// GetPrivateData 读取已提交的私有数据
+func (s *Stub) GetPrivateData(collection, key string) ([]byte, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("collection must not be an empty string")
+	}
+	return s.ledger.readPrivate(collection, key), nil
+}
+
+// GetPrivateDataHash 返回私有数据的 SHA256
+func (s *Stub) GetPrivateDataHash(collection, key string) ([]byte, error) {
+	value, err := s.GetPrivateData(collection, key)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(value)
+	return sum[:], nil
+}
+
+// PutPrivateData 写入私有数据写集合
+func (s *Stub) PutPrivateData(collection string, key string, value []byte) error {
+	if collection == "" || key == "" {
+		return fmt.Errorf("collection and key must not be empty strings")
+	}
+	if len(value) == 0 {
+		return fmt.Errorf("value must not be empty")
+	}
+	s.privateWrite(collection)[key] = &write{value: cloneBytes(value)}
+	return nil
+}
+
+// DelPrivateData 标记删除私有数据
+func (s *Stub) DelPrivateData(collection, key string) error {
+	if collection == "" || key == "" {
+		return fmt.Errorf("collection and key must not be empty strings")
+	}
+	s.privateWrite(collection)[key] = &write{delete: true}
+	return nil
+}
+
+// PurgePrivateData 模拟器中等价于删除
+func (s *Stub) PurgePrivateData(collection, key string) error {
+	return s.DelPrivateData(collection, key)
+}
+
+// SetPrivateDataValidationParameter 私有数据的 key 级别背书策略，和公共数据共用存储
+func (s *Stub) SetPrivateDataValidationParameter(collection, key string, ep []byte) error {
+	return s.SetStateValidationParameter(collection+compositeKeyNamespace+key, ep)
+}
+
+// GetPrivateDataValidationParameter 读取私有数据的 key 级别背书策略
+func (s *Stub) GetPrivateDataValidationParameter(collection, key string) ([]byte, error) {
+	return s.GetStateValidationParameter(collection + compositeKeyNamespace + key)
+}
+
+// GetPrivateDataByRange 私有数据范围查询
+func (s *Stub) GetPrivateDataByRange(collection, startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if startKey == "" {
+		startKey = emptyKeySubstitute
+	}
+	return newStateIterator(s.ledger.rangePrivate(collection, startKey, endKey)), nil
+}
+
+// GetPrivateDataByPartialCompositeKey 私有数据组合键前缀查询
+func (s *Stub) GetPrivateDataByPartialCompositeKey(collection, objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	startKey, endKey, err := partialCompositeKeyRange(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+	return newStateIterator(s.ledger.rangePrivate(collection, startKey, endKey)), nil
+}
+
+// GetPrivateDataQueryResult 不支持富查询
+func (s *Stub) GetPrivateDataQueryResult(collection, query string) (shim.StateQueryIteratorInterface, error) {
+	return nil, fmt.Errorf("ledgersim: rich queries are not supported (LevelDB state database)")
+}
+
+// GetCreator 返回序列化后的身份（只包含 MSPID 和证书）
+func (s *Stub) GetCreator() ([]byte, error) {
+	identity := s.identity
+	serialized := &msp.SerializedIdentity{Mspid: identity.MSPID}
+	if identity.Certificate != nil {
+		serialized.IdBytes = identity.Certificate.Raw
+	}
+	return proto.Marshal(serialized)
+}
+
+// GetTransient 实现 shim.ChaincodeStubInterface
+func (s *Stub) GetTransient() (map[string][]byte, error) {
+	return s.transient, nil
+}
+
+// GetBinding 模拟器没有真实的提案，返回空
+func (s *Stub) GetBinding() ([]byte, error) {
+	return nil, nil
+}
+
+// GetDecorations 实现 shim.ChaincodeStubInterface
+func (s *Stub) GetDecorations() map[string][]byte {
+	return map[string][]byte{}
+}
+
+// GetSignedProposal 模拟器没有真实的签名提案
+func (s *Stub) GetSignedProposal() (*peer.SignedProposal, error) {
+	return nil, fmt.Errorf("ledgersim: signed proposals are not available")
+}
+
+// GetTxTimestamp 返回模拟时钟分配给本交易的时间戳
+func (s *Stub) GetTxTimestamp() (*timestamppb.Timestamp, error) {
+	return timestamppb.New(s.timestamp), nil
+}
+
+// SetEvent 记录链码事件，和 peer 一样事件名不能为空
+func (s *Stub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return fmt.Errorf("event name can not be empty string")
+	}
+	s.events = append(s.events, &Event{Name: name, Payload: cloneBytes(payload)})
+	return nil
+}
+
+func (s *Stub) privateWrite(collection string) map[string]*write {
+	if s.privateWrites[collection] == nil {
+		s.privateWrites[collection] = make(map[string]*write)
+	}
+	return s.privateWrites[collection]
+}
+
+func createCompositeKey(objectType string, attributes []string) (string, error) {
+	if err := validateCompositeKeyAttribute(objectType); err != nil {
+		return "", err
+	}
+	ck := compositeKeyNamespace + objectType + string(rune(minUnicodeRuneValue))
+	for _, att := range attributes {
+		if err := validateCompositeKeyAttribute(att); err != nil {
+			return "", err
+		}
+		ck += att + string(rune(minUnicodeRuneValue))
+	}
+	return ck, nil
+}
+
+func partialCompositeKeyRange(objectType string, keys []string) (string, string, error) {
+	partialCompositeKey, err := createCompositeKey(objectType, keys)
+	if err != nil {
+		return "", "", err
+	}
+	return partialCompositeKey, partialCompositeKey + string(maxUnicodeRuneValue), nil
+}
+
+func validateCompositeKeyAttribute(str string) error {
+	if !utf8.ValidString(str) {
+		return fmt.Errorf("not a valid utf8 string: [%x]", str)
+	}
+	for index, runeValue := range str {
+		if runeValue == minUnicodeRuneValue || runeValue == maxUnicodeRuneValue {
+			return fmt.Errorf("input contains unicode %#U starting at position [%d]", runeValue, index)
+		}
+	}
+	return nil
+}
+
+func validateSimpleKeys(simpleKeys ...string) error {
+	for _, key := range simpleKeys {
+		if len(key) > 0 && key[0] == compositeKeyNamespace[0] {
+			return fmt.Errorf("first character of the key [%s] contains a null character which is not allowed", key)
+		}
+	}
+	return nil
+}
+
+// paginate 从 bookmark 开始取 pageSize 条，bookmark 为空表示从头开始
+func paginate(results []*queryresult.KV, pageSize int32,
+	bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	if pageSize <= 0 {
+		return nil, nil, fmt.Errorf("pageSize must be greater than zero")
+	}
+
+	start := 0
+	if bookmark != "" {
+		for start < len(results) && results[start].Key < bookmark {
+			start++
+		}
+	}
+
+	end := start + int(pageSize)
+	nextBookmark := ""
+	if end < len(results) {
+		nextBookmark = results[end].Key
+	} else {
+		end = len(results)
+	}
+
+	page := results[start:end]
+	metadata := &peer.QueryResponseMetadata{
+		FetchedRecordsCount: int32(len(page)),
+		Bookmark:            nextBookmark,
+	}
+	return newStateIterator(page), metadata, nil
+}
@@ -2,15 +2,16 @@ package main
 
 import (
 	"log"
+	"os"
 
-	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
 	"novel-resource-events/chaincode"
 )
 
 
 func main() {
-	novelContract := new(chaincode.SmartContract)
-	chaincode, err := contractapi.NewChaincode(novelContract)
+	// 测试数据 InitLedger 只在开发环境开放，生产环境不设置这个变量
+	enableSeed := os.Getenv("CHAINCODE_ENABLE_SEED") == "true"
+	chaincode, err := chaincode.NewChaincode(enableSeed)
 	if err != nil {
 		log.Panicf("Error creating novel chaincode: %v", err)
 	}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+)
+
+// openAPISpec API 契约，编进二进制，保证 /openapi.json 和运行的代码是同一个版本
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// LoadOpenAPISpec 解析并检查内置的 OpenAPI 文档
+func LoadOpenAPISpec() (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	spec, err := loader.LoadFromData(openAPISpec)
+	if err != nil {
+		return nil, fmt.Errorf("parse openapi spec failed: %v", err)
+	}
+	if err := spec.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid openapi spec: %v", err)
+	}
+	return spec, nil
+}
+
+// getOpenAPISpec 以 JSON 返回 OpenAPI 文档，前端用它生成客户端 SDK
+func (s *Server) getOpenAPISpec(c *gin.Context) {
+	c.JSON(http.StatusOK, s.openAPISpec)
+}
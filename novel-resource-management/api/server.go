@@ -4,58 +4,132 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/gin-gonic/gin" //用gin
-	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"novel-resource-management/config"
+	"novel-resource-management/database"
+	"novel-resource-management/metrics"
 	"novel-resource-management/middleware"
 	"novel-resource-management/service"
 	"novel-resource-management/utils"
 )
 
 type Server struct {
-	router        *gin.Engine
-	httpServer    *http.Server
-	novelService  *service.NovelService
-	creditService *service.UserCreditService
-	eventService  *service.EventService
-	network       *client.Network
+	router             *gin.Engine
+	httpServer         *http.Server
+	novelService       *service.NovelService
+	creditService      *service.UserCreditService
+	eventService       *service.EventService
+	pricingService     *service.PricingService
+	limitService       *service.SpendingLimitService
+	packageService     *service.PackageService
+	analyticsService   *service.AnalyticsService
+	endorsementService *service.EndorsementService
+	auditService       *service.AuditService
+	transactionTracker *service.TransactionTracker
+	queryService       *service.QueryService
+	searchService      *service.SearchService
+	authService        *service.AuthService
+	ownershipService   *service.OwnershipService
+	apiKeyService      *service.APIKeyService
+	policy             *middleware.Policy
+	rateLimiter        *middleware.RateLimiter
+	idempotencyService *service.IdempotencyService
+	openAPISpec        *openapi3.T
+	validator          *middleware.OpenAPIValidator
+	healthService      *service.HealthService
+	chaincode          *service.Chaincode
+	rechargeSecretKey  string
 }
 
 // create new service interface
-func NewServer(gateway *client.Gateway) *Server {
+// cfg 是启动时加载并校验过的配置，chaincode 是配置里的通道和链码
+// conn 是 gateway 使用的 gRPC 连接，就绪检查要看它的状态
+func NewServer(cfg *config.Config, chaincode *service.Chaincode, conn *grpc.ClientConn) *Server {
 	// 初始化RSA加密解密器
-	if err := utils.InitRSACrypto(); err != nil {
+	if err := utils.InitRSACrypto(cfg.RSA); err != nil {
 		log.Printf("警告: RSA加密解密器初始化失败: %v", err)
 	}
 
-	//network
-	network := gateway.GetNetwork("mychannel")
+	// 路由授权策略，配置 auth.policy_file（AUTH_POLICY_FILE）可以指定其他路径
+	policyFile := cfg.Auth.PolicyFile
+	policy, err := middleware.LoadPolicy(policyFile)
+	if err != nil {
+		panic(fmt.Sprintf("加载授权策略 %s 失败: %v", policyFile, err))
+	}
 
-	novelService, err := service.NewNovelService(gateway)
+	// 限流配置，配置 rate_limit.file（RATE_LIMIT_FILE）可以指定其他路径
+	rateLimitFile := cfg.RateLimit.File
+	rateLimitConfig, err := middleware.LoadRateLimitConfig(rateLimitFile)
 	if err != nil {
-		panic(fmt.Sprintf("初始化 NovelService 失败: %v", err))
+		panic(fmt.Sprintf("加载限流配置 %s 失败: %v", rateLimitFile, err))
 	}
-	creditService, err := service.NewUserCreditService(gateway)
+	var rateLimitStore middleware.RateLimitStore = middleware.NewMemoryRateLimitStore()
+	if rateLimitConfig.Backend == middleware.RateLimitBackendMongoDB {
+		rateLimitStore = service.NewRateLimitStore()
+	}
+	log.Printf("🚦 限流配置 %s，存储 %s", rateLimitFile, rateLimitConfig.Backend)
+
+	// API 契约，请求和响应都按它校验
+	openAPISpec, err := LoadOpenAPISpec()
 	if err != nil {
-		panic(fmt.Sprintf("初始化 UserCreditService 失败: %v", err))
+		panic(fmt.Sprintf("加载 OpenAPI 文档失败: %v", err))
+	}
+
+	// gin 默认信任所有代理，任何人都能用 X-Forwarded-For 伪造 ClientIP，绕过按 IP 的限流
+	router := gin.Default()
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		panic(fmt.Sprintf("server.trusted_proxies 配置有误: %v", err))
 	}
-	eventService := service.NewEventService(gateway)
 
 	server := &Server{
-		router:        gin.Default(),
-		novelService:  novelService,
-		creditService: creditService,
-		eventService:  eventService,
-		network:       network,
+		router:             router,
+		novelService:       service.NewNovelService(chaincode),
+		creditService:      service.NewUserCreditService(chaincode),
+		eventService:       service.NewEventService(chaincode),
+		pricingService:     service.NewPricingService(chaincode),
+		limitService:       service.NewSpendingLimitService(chaincode),
+		packageService:     service.NewPackageService(),
+		analyticsService:   service.NewAnalyticsService(),
+		endorsementService: service.NewEndorsementService(chaincode),
+		auditService:       service.NewAuditService(chaincode, cfg.Audit.RetainSnapshots),
+		transactionTracker: service.NewTransactionTracker(cfg.Fabric.TransactionStatusTimeout.Duration),
+		queryService:       service.NewQueryService(),
+		searchService:      service.NewSearchService(),
+		authService:        service.NewAuthService(cfg.Auth),
+		ownershipService:   service.NewOwnershipService(),
+		apiKeyService:      service.NewAPIKeyService(),
+		policy:             policy,
+		rateLimiter:        middleware.NewRateLimiter(rateLimitConfig, rateLimitStore),
+		idempotencyService: service.NewIdempotencyService(cfg.Idempotency),
+		openAPISpec:        openAPISpec,
+		validator:          middleware.NewOpenAPIValidator(openAPISpec),
+		healthService:      service.NewHealthService(chaincode, conn, cfg.Fabric.EventListenerMaxLag.Duration),
+		chaincode:          chaincode,
+		rechargeSecretKey:  cfg.Recharge.SecretKey,
 	}
 
 	server.setupRoutes()
+	if err := policy.CheckResolvers(server.ownerResolvers()); err != nil {
+		panic(fmt.Sprintf("授权策略 %s 有误: %v", policyFile, err))
+	}
+	for _, route := range policy.UncoveredRoutes(server.router.Routes(), "/api/v1/") {
+		log.Printf("⚠️ 路由 %s 没有授权规则，所有请求都会被拒绝", route)
+	}
+	for _, route := range server.validator.UndocumentedRoutes(server.router.Routes(), "/api/v1/") {
+		log.Printf("⚠️ 路由 %s 没有写进 OpenAPI 文档，请求不会被校验", route)
+	}
 	
 	return server
 }
@@ -64,16 +138,56 @@ func NewServer(gateway *client.Gateway) *Server {
 func (s *Server) setupRoutes() {
 	// 先接路由，再接方法
 
-	// 添加全局防抖中间件
-	debounce := middleware.NewDebounceMiddleware()
-	s.router.Use(debounce.Debounce())
+	// 所有请求都有 trace，耗时都记进 Prometheus 指标，包括被认证、限流拒绝的
+	s.router.Use(middleware.Tracing("novel-resource-management")...)
+	s.router.Use(middleware.Metrics())
 
 	s.router.GET("/health", s.healthCheck)
+	// 存活和就绪探针：/livez 只说明进程在响应，/readyz 检查 Fabric、MongoDB 和事件监听器
+	s.router.GET("/livez", s.livez)
+	s.router.GET("/readyz", s.readyz)
+	// Prometheus 指标：HTTP、Fabric 各阶段和提交重试、事件监听延迟、MongoDB、充值结果
+	s.router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	// API 契约，前端用它生成客户端 SDK
+	s.router.GET("/openapi.json", s.getOpenAPISpec)
+
+	// 登录认证，其他 /api/v1 接口都要带 Authorization: Bearer <accessToken>
+	// 还没有登录，按 IP 限流
+	auth := s.router.Group("/api/v1/auth", s.rateLimiter.Limit(), s.validator.Validate())
+	{
+		auth.POST("/login", s.login)
+		auth.POST("/refresh", s.refreshToken)
+		auth.POST("/logout", s.logout)
+	}
+	// 先认证，再按 config/ratelimit.yaml 对调用方限流，然后按 config/policy.yaml 授权，路由模板要和配置文件里的一致
+	// 授权通过的 POST、PUT、DELETE 请求可以带 Idempotency-Key，重试时返回第一次的响应
+	// 最后按 api/openapi.yaml 校验请求，加密的请求体在 RSARequestMiddleware 解密后才校验
+	authorized := []gin.HandlerFunc{
+		middleware.Authenticate(s.authService.VerifyAccessToken, s.apiKeyService.Verify),
+		s.rateLimiter.Limit(),
+		s.policy.Authorize(s.ownerResolvers()),
+		middleware.Idempotency(s.idempotencyService),
+		s.validator.Validate(),
+	}
+
+	// 充值接口 - 接收第三方回调，用 HMAC 签名或带 recharge scope 的 API Key 认证，不需要登录
+	s.router.POST("/api/v1/users/recharge", middleware.OptionalAPIKey(s.apiKeyService.Verify), s.rateLimiter.Limit(), middleware.Idempotency(s.idempotencyService), s.validator.Validate(), s.rechargeUserTokens)
+
+	// 机器调用方的 API Key 管理
+	apiKeys := s.router.Group("/api/v1/apikeys", authorized...)
+	{
+		apiKeys.GET("", s.listAPIKeys)
+		apiKeys.POST("", s.createAPIKey)
+		apiKeys.DELETE("/:keyId", s.revokeAPIKey)
+		apiKeys.POST("/:keyId/rotate", s.rotateAPIKey)
+	}
 
-	novels := s.router.Group("/api/v1/novels")
+	novels := s.router.Group("/api/v1/novels", authorized...)
 	{
 		//RESTFUL API
 		novels.GET("", s.getAllNovels)
+		// 全文搜索读 MongoDB 读模型，静态路由优先于 /:id
+		novels.GET("/search", s.searchNovels)
 		novels.GET("/:id", s.getNovel)
 		//delete
 		novels.DELETE("/:id", s.deleteNovel)
@@ -96,17 +210,14 @@ func (s *Server) setupRoutes() {
 		*/
 	}
 
-	users := s.router.Group("/api/v1/users")
+	users := s.router.Group("/api/v1/users", authorized...)
 	{
 		//get
-		users.GET("",s.getAllUserCredits)
-		users.GET("/:id",s.getUserCredit)
+		users.GET("", s.getAllUserCredits)
+		users.GET("/:id", s.getUserCredit)
 
 		//delete
-		users.DELETE("/:id",s.deleteUserCredit)
-
-		// 充值接口 - 接收第三方回调
-		users.POST("/recharge", s.rechargeUserTokens)
+		users.DELETE("/:id", s.deleteUserCredit)
 
 		// 需要RSA加密的路由
 
@@ -115,24 +226,112 @@ func (s *Server) setupRoutes() {
 		// 如果 package 和文件夹名不一致——比如文件在 middleware 目录，但声明 package mware——
 		// 你在 import 时依然写 import "novel-resource-management/middleware"，但代码中用 mware.xxx 来访问。
 		// 总之，"import 路径"（即文件夹路径）用于定位代码源文件，而"包名"决定了代码里实际的调用前缀。
-		encryptedUsers.Use(middleware.RSARequestMiddleware())
+		encryptedUsers.Use(middleware.RSARequestMiddleware(), s.validator.Validate())
 		{
 			//create
-			encryptedUsers.POST("",s.createUserCredit)
+			encryptedUsers.POST("", s.createUserCredit)
 
 			//update
-			encryptedUsers.PUT("/:id",s.updateUserCredit)
+			encryptedUsers.PUT("/:id", s.updateUserCredit)
 
 			// token消费接口 - 需要RSA加密
 			encryptedUsers.POST("/:id/consume-token", s.consumeUserToken)
+
+			// 积分预留（两阶段扣费）
+			encryptedUsers.POST("/:id/holds", s.holdCredits)
+
+			// 管理员覆盖用户的消费限额，链码会校验管理员身份
+			encryptedUsers.PUT("/:id/limits", s.setSpendingLimit)
+		}
+
+		users.GET("/:id/limits", s.getSpendingAllowance)
+		users.DELETE("/:id/limits", s.deleteSpendingLimit)
+
+		users.GET("/:id/holds", s.getUserHolds)
+		users.POST("/:id/holds/release-expired", s.releaseExpiredHolds)
+	}
+
+	holds := s.router.Group("/api/v1/holds", authorized...)
+	{
+		holds.GET("/:holdId", s.getHold)
+
+		encryptedHolds := holds.Group("")
+		encryptedHolds.Use(middleware.RSARequestMiddleware(), s.validator.Validate())
+		{
+			encryptedHolds.POST("/:holdId/capture", s.captureHold)
+			encryptedHolds.POST("/:holdId/release", s.releaseHold)
 		}
 	}
 
-	events := s.router.Group("/api/v1/events")
+	events := s.router.Group("/api/v1/events", authorized...)
 	{
 		events.GET("/listen",s.streamEvents)
 	}
 
+	// 充值套餐目录，回调按 good_id 和 actual_price 匹配套餐
+	packages := s.router.Group("/api/v1/packages", authorized...)
+	{
+		packages.GET("", s.listPackages)
+		packages.GET("/:goodId", s.getPackage)
+		packages.DELETE("/:goodId", s.deletePackage)
+
+		encryptedPackages := packages.Group("")
+		encryptedPackages.Use(middleware.RSARequestMiddleware(), s.validator.Validate())
+		{
+			encryptedPackages.POST("", s.createPackage)
+			encryptedPackages.PUT("/:goodId", s.updatePackage)
+		}
+	}
+
+	limits := s.router.Group("/api/v1/limits", authorized...)
+	limits.Use(middleware.RSARequestMiddleware(), s.validator.Validate())
+	{
+		limits.PUT("/default", s.setDefaultSpendingLimit)
+	}
+
+	// 价格表只读，修改走链码的 SetPricing 管理交易
+	pricing := s.router.Group("/api/v1/pricing", authorized...)
+	{
+		pricing.GET("", s.getPricing)
+		pricing.GET("/schedule", s.getPricingSchedule)
+	}
+
+	// 高价值记录的 key 级别背书策略，entityType 是 UserCredit 或 RechargeOrder
+	endorsement := s.router.Group("/api/v1/endorsement", authorized...)
+	{
+		endorsement.GET("/config", s.getEndorsementConfig)
+		endorsement.GET("/policies/:entityType/:id", s.getKeyEndorsementPolicy)
+
+		encryptedEndorsement := endorsement.Group("")
+		encryptedEndorsement.Use(middleware.RSARequestMiddleware(), s.validator.Validate())
+		{
+			encryptedEndorsement.PUT("/config", s.setEndorsementConfig)
+			encryptedEndorsement.PUT("/policies/:entityType/:id", s.setKeyEndorsementPolicy)
+		}
+	}
+
+	// 小说用量统计，数据来自事件监听维护的 novel_usage_daily 汇总
+	analytics := s.router.Group("/api/v1/analytics", authorized...)
+	{
+		analytics.GET("/novels/:id", s.getNovelAnalytics)
+		analytics.GET("/authors/:author", s.getAuthorAnalytics)
+		analytics.GET("/leaderboard", s.getLeaderboard)
+		analytics.POST("/rebuild", s.rebuildAnalytics)
+	}
+
+	// 异步提交的交易状态
+	transactions := s.router.Group("/api/v1/transactions", authorized...)
+	{
+		transactions.GET("/:txId", s.getTransaction)
+	}
+
+	// 读模型快照：Merkle 根锚定在账本上，审计用包含证明核对链下数据
+	audit := s.router.Group("/api/v1/audit", authorized...)
+	{
+		audit.POST("/snapshots", s.takeAuditSnapshot)
+		audit.GET("/proof/:collection/:id", s.getAuditProof)
+	}
+
 	
 }
 
@@ -145,9 +344,24 @@ func (s *Server) Shutdown(ctx context.Context) error {
 }
 
 // GIN do not need to return some data
+// 默认从 MongoDB 读模型分页查询，?consistency=ledger 时直接查链
 func (s *Server) getAllNovels(c *gin.Context) {
+	if !ledgerConsistency(c) {
+		opts, ok := listOptions(c)
+		if !ok {
+			return
+		}
+		filter := service.NovelFilter{
+			Author:      c.Query("author"),
+			CreatedFrom: c.Query("createdFrom"),
+			CreatedTo:   c.Query("createdTo"),
+		}
+		page, err := s.queryService.ListNovels(c.Request.Context(), filter, opts)
+		respondListPage(c, "novels", page, err)
+		return
+	}
 
-	novels, err := s.novelService.GetAllNovels()
+	novels, err := s.novelService.GetAllNovels(c.Request.Context())
 	if err != nil {
 		//注意c.JSON和gin.H
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -156,20 +370,78 @@ func (s *Server) getAllNovels(c *gin.Context) {
 		return
 	}
 
-	if novels == nil {
-		novels = []map[string]interface{}{}
-	}
-
 	//c.JSON不用return
 	c.JSON(
 		http.StatusOK,
 		gin.H{
-			"novels": novels,
-			"count":  len(novels),
+			"novels":      novels,
+			"count":       len(novels),
+			"consistency": "ledger",
 		},
 	)
 }
 
+// searchNovels 按相关度搜索小说，支持 author、createdFrom、createdTo 过滤和 limit、offset 分页
+func (s *Server) searchNovels(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "q is required",
+		})
+		return
+	}
+
+	limit := 20
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 || parsed > service.MaxSearchLimit {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("limit must be between 1 and %d", service.MaxSearchLimit),
+			})
+			return
+		}
+		limit = parsed
+	}
+	offset := 0
+	if raw := c.Query("offset"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "offset must be a non-negative integer",
+			})
+			return
+		}
+		offset = parsed
+	}
+
+	filter := service.NovelFilter{
+		Author:      c.Query("author"),
+		CreatedFrom: c.Query("createdFrom"),
+		CreatedTo:   c.Query("createdTo"),
+	}
+	result, err := s.searchService.SearchNovels(c.Request.Context(), q, filter, limit, offset)
+	if errors.Is(err, service.ErrInvalidQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":       q,
+		"hits":        result.Hits,
+		"count":       result.Count,
+		"blockHeight": result.BlockHeight,
+		"syncedAt":    result.SyncedAt,
+	})
+}
+
 func (s *Server) getNovel(c *gin.Context) {
 	id := c.Param("id")
 	//3.id == nil是指针判断
@@ -180,7 +452,7 @@ func (s *Server) getNovel(c *gin.Context) {
 		return
 	}
 	//1. 短变量声明
-	novel, err := s.novelService.ReadNovel(id)
+	novel, err := s.novelService.ReadNovel(c.Request.Context(), id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			//2.结构体逗号
@@ -196,15 +468,16 @@ func (s *Server) getNovel(c *gin.Context) {
 func (s *Server) createNovel(c *gin.Context) {
 	//先声明后挂值，区别于短变量声明
 	//不用逗号，key:"value"
+	// 必填和长度由 OpenAPI 的 NovelInput 校验，这里不再重复 binding 规则
 	var req struct {
-		ID           string `json:"id" binding:"required"`
-		Author       string `json:"author" binding:"required"`
-		StoryOutline string `json:"storyOutline" binding:"required"`
-		Subsections  string `json:"subsections" binding:"required"`
-		Characters   string `json:"characters" binding:"required"`
-		Items        string `json:"items" binding:"required"`
-		TotalScenes  string `json:"totalScenes" binding:"required"`
-		CreatedAt    string `json:"createdAt" binding:"omitempty"`
+		ID           string `json:"id"`
+		Author       string `json:"author"`
+		StoryOutline string `json:"storyOutline"`
+		Subsections  string `json:"subsections"`
+		Characters   string `json:"characters"`
+		Items        string `json:"items"`
+		TotalScenes  string `json:"totalScenes"`
+		CreatedAt    string `json:"createdAt"`
 	}
 
 	//这个err := 只在这个if作用域； 
@@ -215,14 +488,22 @@ func (s *Server) createNovel(c *gin.Context) {
 		return
 	}
 
+	if wantsAsync(c) {
+		s.respondAsync(c, func(callbackURL string) (*database.TransactionRecord, error) {
+			return s.novelService.CreateNovelAsync(c.Request.Context(), s.transactionTracker, callbackURL, s.novelOwnerHook(c, req.ID), req.ID, req.Author, req.StoryOutline, req.Subsections, req.Characters, req.Items, req.TotalScenes)
+		})
+		return
+	}
+
 	//参数顺序
 	//id, author, storyOutline, subsections, characters, items, totalScenes string
-	if err := s.novelService.CreateNovel(req.ID, req.Author, req.StoryOutline, req.Subsections, req.Characters, req.Items, req.TotalScenes); err != nil {
+	if err := s.novelService.CreateNovel(c.Request.Context(), req.ID, req.Author, req.StoryOutline, req.Subsections, req.Characters, req.Items, req.TotalScenes); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
+	runCommitHook(c.Request.Context(), s.novelOwnerHook(c, req.ID))
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "create novel successful",
@@ -241,15 +522,16 @@ func (s *Server) updateNovel(c *gin.Context) {
 		return
 	}
 
+	// 必填和长度由 OpenAPI 的 NovelInput 校验
 	var req struct {
 		// Update请求不需要ID字段，使用URL路径中的ID
-		Author       string `json:"author" binding:"required"`
-		StoryOutline string `json:"storyOutline" binding:"required"`
-		Subsections  string `json:"subsections" binding:"required"`
-		Characters   string `json:"characters" binding:"required"`
-		Items        string `json:"items" binding:"required"`
-		TotalScenes  string `json:"totalScenes" binding:"required"`
-		UpdatedAt    string `json:"updatedAt" binding:"omitempty"`
+		Author       string `json:"author"`
+		StoryOutline string `json:"storyOutline"`
+		Subsections  string `json:"subsections"`
+		Characters   string `json:"characters"`
+		Items        string `json:"items"`
+		TotalScenes  string `json:"totalScenes"`
+		UpdatedAt    string `json:"updatedAt"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -259,7 +541,14 @@ func (s *Server) updateNovel(c *gin.Context) {
 		return
 	}
 
-	if err := s.novelService.UpdateNovel(id, req.Author, req.StoryOutline, req.Subsections, req.Characters, req.Items, req.TotalScenes); err != nil {
+	if wantsAsync(c) {
+		s.respondAsync(c, func(callbackURL string) (*database.TransactionRecord, error) {
+			return s.novelService.UpdateNovelAsync(c.Request.Context(), s.transactionTracker, callbackURL, id, req.Author, req.StoryOutline, req.Subsections, req.Characters, req.Items, req.TotalScenes)
+		})
+		return
+	}
+
+	if err := s.novelService.UpdateNovel(c.Request.Context(), id, req.Author, req.StoryOutline, req.Subsections, req.Characters, req.Items, req.TotalScenes); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
@@ -280,13 +569,21 @@ func (s *Server) deleteNovel(c *gin.Context) {
 		})
 		return
 	}
+	if wantsAsync(c) {
+		s.respondAsync(c, func(callbackURL string) (*database.TransactionRecord, error) {
+			return s.novelService.DeleteNovelAsync(c.Request.Context(), s.transactionTracker, callbackURL, s.novelRemovedHook(id), id)
+		})
+		return
+	}
+
 	//novel
-	if err := s.novelService.DeleteNovel(id); err != nil {
+	if err := s.novelService.DeleteNovel(c.Request.Context(), id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
+	runCommitHook(c.Request.Context(), s.novelRemovedHook(id))
 	c.JSON(http.StatusOK, gin.H{
 		"message": "delete successfully",
 		"id":      id,
@@ -307,7 +604,7 @@ func (s *Server) streamEvents(c *gin.Context){
 	defer cancel()
 	
 	//chain code 都返回两个参数
-	events,err := s.network.ChaincodeEvents(ctx,"novel-basic")
+	events, err := s.chaincode.Network().ChaincodeEvents(ctx, s.chaincode.Name())
 
 	if err != nil{
 		//spritf会返回字符串，println不会
@@ -316,14 +613,26 @@ func (s *Server) streamEvents(c *gin.Context){
 	}
 
 	//c.stream和闭包
-	c.Stream(func(w io.Writer) bool{
-		select{
-		case event := <- events:
-			//todo,最终的操作
-			//hyper success
-			novel := s.formatJSON(event.Payload)
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			// 统一解码成事件信封，旧版事件也会被包装成 schemaVersion 0
+			envelope, err := service.DecodeChaincodeEvent(event)
+			if err != nil {
+				log.Printf("⚠️ 跳过无法解析的事件 %s: %v", event.EventName, err)
+				return true
+			}
+			envelopeJSON, err := json.Marshal(envelope)
+			if err != nil {
+				log.Printf("⚠️ 事件信封序列化失败 %s: %v", event.EventName, err)
+				return true
+			}
+			// id 使用 txId，客户端可以据此去重；不写 event 字段，保证 EventSource.onmessage 能收到
 			//Fprintf用于将指定的字符串写入io.Writer
-			fmt.Fprintf(w, "data: %s - %s\n\n", event.EventName, novel)
+			fmt.Fprintf(w, "id: %s\ndata: %s\n\n", envelope.TxID, envelopeJSON)
 			return true
 		case <- ctx.Done():
 			return false
@@ -333,21 +642,32 @@ func (s *Server) streamEvents(c *gin.Context){
 
 
 func (s *Server) getAllUserCredits(c *gin.Context){
-	credits, err := s.creditService.GetAllUserCredits()
+	if !ledgerConsistency(c) {
+		opts, ok := listOptions(c)
+		if !ok {
+			return
+		}
+		var filter service.UserCreditFilter
+		if !intQuery(c, "minCredit", &filter.MinCredit) || !intQuery(c, "maxCredit", &filter.MaxCredit) {
+			return
+		}
+		page, err := s.queryService.ListUserCredits(c.Request.Context(), filter, opts)
+		respondListPage(c, "credits", page, err)
+		return
+	}
+
+	credits, err := s.creditService.GetAllUserCredits(c.Request.Context())
 	if err != nil{
 		c.JSON(http.StatusBadRequest,gin.H{
 			"error":err.Error(),
 		})
 		return
 	}
-	//如果是nil，我们返回空数组
-	if credits == nil{
-		credits = []map[string]interface{}{}
-	}
 
 	c.JSON(http.StatusOK,gin.H{
 		"credits":credits,
 		"count":len(credits),
+		"consistency": "ledger",
 	})
 }
 
@@ -361,7 +681,7 @@ func (s *Server)getUserCredit(c *gin.Context){
 		return
 	}
 
-	credit, err := s.creditService.ReadUserCredit(id)
+	credit, err := s.creditService.ReadUserCredit(c.Request.Context(), id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -440,11 +760,18 @@ func (s *Server)createUserCredit(c *gin.Context){
 		return
 	}
 
+	if wantsAsync(c) {
+		s.respondAsync(c, func(callbackURL string) (*database.TransactionRecord, error) {
+			return s.creditService.CreateUserCreditAsync(c.Request.Context(), s.transactionTracker, callbackURL, req.UserID, req.Credit, req.TotalUsed, req.TotalRecharge)
+		})
+		return
+	}
+
 	// then we create the user credit
 	// userId string, credit int, totalUsed int, totalRecharge int
-    if err:= s.creditService.CreateUserCredit(req.UserID,req.Credit,req.TotalUsed,req.TotalRecharge); err != nil{
-		c.JSON(http.StatusInternalServerError,gin.H{
-			"error":err.Error(),
+	if err := s.creditService.CreateUserCredit(c.Request.Context(), req.UserID, req.Credit, req.TotalUsed, req.TotalRecharge); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
 		})
 		return
 	}
@@ -463,6 +790,28 @@ func (s *Server) healthCheck(c *gin.Context) {
 	})
 }
 
+// livez 存活探针，不检查依赖，依赖出问题时重启进程也没用
+func (s *Server) livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+		"time":   time.Now().Format(time.RFC3339),
+	})
+}
+
+// readyz 就绪探针，任何一个依赖不可用都返回 503，checks 里是每个依赖的详情
+func (s *Server) readyz(c *gin.Context) {
+	report := s.healthService.Readiness(c.Request.Context())
+	status, code := "ready", http.StatusOK
+	if !report.Ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{
+		"status": status,
+		"checks": report.Checks,
+		"time":   time.Now().Format(time.RFC3339),
+	})
+}
+
 
 func (s * Server)updateUserCredit(c *gin.Context){
 
@@ -474,11 +823,12 @@ func (s * Server)updateUserCredit(c *gin.Context){
 		return
 	}
 
+	// 必填和取值范围由 OpenAPI 校验，binding:"required" 会把合法的 0 当成没传
 	var req  struct {
-		UserID        string `json:"userId" binding:"required"`
-		Credit        int    `json:"credit" binding:"required"`
-		TotalUsed     int    `json:"totalUsed" binding:"required"`
-		TotalRecharge int    `json:"totalRecharge" binding:"required"`
+		UserID        string `json:"userId"`
+		Credit        int    `json:"credit"`
+		TotalUsed     int    `json:"totalUsed"`
+		TotalRecharge int    `json:"totalRecharge"`
 		CreatedAt     string `json:"createdAt" binding:"omitempty"`
 		UpdatedAt     string `json:"updatedAt" binding:"omitempty"`
 	}
@@ -490,9 +840,16 @@ func (s * Server)updateUserCredit(c *gin.Context){
 		return
 	}	
 	
+	if wantsAsync(c) {
+		s.respondAsync(c, func(callbackURL string) (*database.TransactionRecord, error) {
+			return s.creditService.UpdateUserCreditAsync(c.Request.Context(), s.transactionTracker, callbackURL, id, req.Credit, req.TotalUsed, req.TotalRecharge)
+		})
+		return
+	}
+
 	//拿到对应的参数去处理
 	//userId string, credit int, totalUsed int, totalRecharge int
-	if err := s.creditService.UpdateUserCredit(id,req.Credit,req.TotalUsed,req.TotalRecharge) ; err != nil{
+	if err := s.creditService.UpdateUserCredit(c.Request.Context(), id, req.Credit, req.TotalUsed, req.TotalRecharge); err != nil {
 		//todo
 		c.JSON(http.StatusInternalServerError,gin.H{
 			"error":err.Error(),
@@ -516,9 +873,16 @@ func (s *Server)deleteUserCredit(c * gin.Context){
 		return
 	}
 
-	if err := s.creditService.DeleteUserCredit(id); err != nil{
-		c.JSON(http.StatusInternalServerError,gin.H{
-			"error":err.Error(),
+	if wantsAsync(c) {
+		s.respondAsync(c, func(callbackURL string) (*database.TransactionRecord, error) {
+			return s.creditService.DeleteUserCreditAsync(c.Request.Context(), s.transactionTracker, callbackURL, id)
+		})
+		return
+	}
+
+	if err := s.creditService.DeleteUserCredit(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
 		})
 		return
 	}
@@ -538,8 +902,28 @@ func (s *Server) consumeUserToken(c *gin.Context) {
 		return
 	}
 
+	// 请求体可选，不传时按默认操作计费，兼容旧客户端
+	var req struct {
+		Operation string `json:"operation"`
+		NovelID   string `json:"novelId"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if wantsAsync(c) {
+		s.respondAsync(c, func(callbackURL string) (*database.TransactionRecord, error) {
+			return s.creditService.ConsumeUserTokenAsync(c.Request.Context(), s.transactionTracker, callbackURL, userId, req.Operation, req.NovelID)
+		})
+		return
+	}
+
 	// 调用service层的ConsumeUserToken方法
-	if err := s.creditService.ConsumeUserToken(userId); err != nil {
+	userCredit, err := s.creditService.ConsumeUserToken(c.Request.Context(), userId, req.Operation, req.NovelID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
@@ -549,91 +933,111 @@ func (s *Server) consumeUserToken(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"message": "consume token successfully",
 		"id":  userId,
+		"userCredit": userCredit,
 	})
 }
 
-// rechargeUserTokens 充值接口 - 接收第三方平台回调（P0 安全加固版）
-func (s *Server) rechargeUserTokens(c *gin.Context) {
-	// 接收完整的第三方回调数据
+func (s *Server) holdCredits(c *gin.Context) {
+	userId := c.Param("id")
+
 	var req struct {
-		Title       string `json:"title"`
-		OrderSN     string `json:"order_sn" binding:"required"`
-		Email       string `json:"email" binding:"required"`
-		ActualPrice int    `json:"actual_price" binding:"required"`
-		OrderInfo   string `json:"order_info"`
-		GoodID      string `json:"good_id"`
-		GoodName    string `json:"gd_name"`
-		Timestamp   string `json:"timestamp" binding:"required"`   // 新增：时间戳
-		Signature   string `json:"signature" binding:"required"`   // 新增：HMAC 签名
+		HoldID     string `json:"holdId" binding:"required"`
+		Amount     int    `json:"amount" binding:"required,min=1"`
+		TTLSeconds int    `json:"ttlSeconds" binding:"required,min=1"`
 	}
-
-	// 绑定JSON请求体
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("❌ 请求参数错误: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "请求参数错误: " + err.Error(),
+			"error": err.Error(),
 		})
 		return
 	}
 
-	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-	// P0-1: 安全验证 - HMAC 签名验证
-	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+	hold, err := s.creditService.HoldCredits(c.Request.Context(), userId, req.Amount, req.HoldID, req.TTLSeconds)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 
-	// 1. 验证时间戳（防重放攻击）
-	// 添加详细时间戳日志
-	currentTime := time.Now().Unix()
-	log.Printf("🕐 时间戳验证开始: 请求时间戳=%s, 当前时间戳=%d", req.Timestamp, currentTime)
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "hold created successfully",
+		"hold":    hold,
+	})
+}
 
-	timestampInt, err := strconv.ParseInt(req.Timestamp, 10, 64)
+func (s *Server) getUserHolds(c *gin.Context) {
+	holds, err := s.creditService.GetUserHolds(c.Request.Context(), c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "时间戳格式错误",
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
 		})
 		return
 	}
 
-	// 计算时间差（秒）（保留计算逻辑但移除未使用的变量）
-	_ = currentTime - timestampInt // timeDiff不再使用，保留计算逻辑
-	if err := service.ValidateTimestamp(timestampInt); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "时间戳验证失败: " + err.Error(),
+	c.JSON(http.StatusOK, gin.H{
+		"holds": holds,
+		"count": len(holds),
+	})
+}
+
+func (s *Server) releaseExpiredHolds(c *gin.Context) {
+	released, err := s.creditService.ReleaseExpiredHolds(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
 		})
 		return
 	}
 
-	// 2. 验证 HMAC 签名
-	params := map[string]string{
-		"actual_price": strconv.Itoa(req.ActualPrice),
-		"email":        req.Email,
-		"order_sn":     req.OrderSN,
-		"timestamp":    req.Timestamp,
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "expired holds released",
+		"released": released,
+	})
+}
+
+func (s *Server) getHold(c *gin.Context) {
+	hold, err := s.creditService.ReadHold(c.Request.Context(), c.Param("holdId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
 	}
 
-	// 计算签名用于调试
-	// computedSignature := service.ComputeHMACSignature(params, service.GetRechargeSecretKey())
-	// log.Printf("📊 签名计算: 计算签名=%s, 接收签名=%s", computedSignature, req.Signature)
+	c.JSON(http.StatusOK, gin.H{
+		"hold": hold,
+	})
+}
 
-	if !service.ValidateHMACSignature(params, req.Signature, service.GetRechargeSecretKey()) {
-		log.Printf("❌ HMAC 签名验证失败: orderSN=%s", req.OrderSN)
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "签名验证失败",
+func (s *Server) captureHold(c *gin.Context) {
+	var req struct {
+		// 用指针区分没传和传了 0，0 表示任务没有实际消耗
+		ActualAmount *int `json:"actualAmount" binding:"required,min=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
 		})
 		return
 	}
-	
-	log.Printf("✅ 安全验证通过: orderSN=%s", req.OrderSN)
 
-	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-	// P0-2: 幂等性保证 + 充值逻辑
-	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+	hold, err := s.creditService.CaptureHold(c.Request.Context(), c.Param("holdId"), *req.ActualAmount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 
-	userId, newCredit, err := s.creditService.AddTokensByEmailWithIdempotency(
-		req.Email,
-		req.OrderSN,
-		req.ActualPrice,
-	)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "hold captured successfully",
+		"hold":    hold,
+	})
+}
 
+func (s *Server) releaseHold(c *gin.Context) {
+	hold, err := s.creditService.ReleaseHold(c.Request.Context(), c.Param("holdId"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -642,33 +1046,1060 @@ func (s *Server) rechargeUserTokens(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":  "充值成功",
-		"userId":   userId,
-		"email":    req.Email,
-		"orderSn":  req.OrderSN,
-		"goodName": req.GoodName,
-		"newCredit": newCredit,
+		"message": "hold released successfully",
+		"hold":    hold,
 	})
 }
 
-
-func (s *Server) Start(address string) error{
-	// 初始化 http.Server，使用传入的地址
-	s.httpServer = &http.Server{
-		Addr:    address,
-		Handler: s.router,
-	}
-	
-	log.Printf("🚀 Starting server on %s", address)
-	return s.httpServer.ListenAndServe()
+// spendingLimitRequest 0 表示不限制
+type spendingLimitRequest struct {
+	Daily   int `json:"daily" binding:"min=0"`
+	Weekly  int `json:"weekly" binding:"min=0"`
+	Monthly int `json:"monthly" binding:"min=0"`
 }
 
-func (s *Server) formatJSON(data []byte)string {
-	var result bytes.Buffer
-	//第三个参数字符串的前缀，第四个参数是缩进
-	if err :=json.Indent(&result,data,"","    "); err != nil{
-		return string(data)
+func (s *Server) getSpendingAllowance(c *gin.Context) {
+	allowance, err := s.limitService.GetSpendingAllowance(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
 	}
-	return result.String()
-}
 
+	c.JSON(http.StatusOK, gin.H{
+		"allowance": allowance,
+	})
+}
+
+func (s *Server) setSpendingLimit(c *gin.Context) {
+	var req spendingLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	limit, err := s.limitService.SetSpendingLimit(c.Request.Context(), c.Param("id"), req.Daily, req.Weekly, req.Monthly)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "spending limit updated successfully",
+		"limit":   limit,
+	})
+}
+
+func (s *Server) deleteSpendingLimit(c *gin.Context) {
+	userId := c.Param("id")
+	if err := s.limitService.DeleteSpendingLimit(c.Request.Context(), userId); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "spending limit deleted, default limit applies",
+		"id":      userId,
+	})
+}
+
+func (s *Server) setDefaultSpendingLimit(c *gin.Context) {
+	var req spendingLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	limit, err := s.limitService.SetDefaultSpendingLimit(c.Request.Context(), req.Daily, req.Weekly, req.Monthly)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "default spending limit updated successfully",
+		"limit":   limit,
+	})
+}
+
+// endorsementConfigRequest threshold 为 0 表示不按余额区分
+type endorsementConfigRequest struct {
+	HighValueThreshold int    `json:"highValueThreshold" binding:"min=0"`
+	BillingMSPID       string `json:"billingMspId" binding:"required"`
+}
+
+// keyEndorsementPolicyRequest orgs 为空表示恢复链码级别策略
+type keyEndorsementPolicyRequest struct {
+	Orgs []string `json:"orgs"`
+}
+
+func (s *Server) getEndorsementConfig(c *gin.Context) {
+	config, err := s.endorsementService.GetEndorsementConfig(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"config": config,
+	})
+}
+
+func (s *Server) setEndorsementConfig(c *gin.Context) {
+	var req endorsementConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	config, err := s.endorsementService.SetEndorsementConfig(c.Request.Context(), req.HighValueThreshold, req.BillingMSPID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "endorsement config updated successfully",
+		"config":  config,
+	})
+}
+
+func (s *Server) getKeyEndorsementPolicy(c *gin.Context) {
+	policy, err := s.endorsementService.GetKeyEndorsementPolicy(c.Request.Context(), c.Param("entityType"), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"policy": policy,
+	})
+}
+
+func (s *Server) setKeyEndorsementPolicy(c *gin.Context) {
+	var req keyEndorsementPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	policy, err := s.endorsementService.SetKeyEndorsementPolicy(c.Request.Context(), c.Param("entityType"), c.Param("id"), req.Orgs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "key endorsement policy updated successfully",
+		"policy":  policy,
+	})
+}
+
+func (s *Server) getPricing(c *gin.Context) {
+	pricing, err := s.pricingService.GetPricing(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pricing": pricing,
+	})
+}
+
+func (s *Server) getPricingSchedule(c *gin.Context) {
+	schedule, err := s.pricingService.GetPricingSchedule(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"schedule": schedule,
+		"count":    len(schedule),
+	})
+}
+
+// rechargeUserTokens 充值接口 - 接收第三方平台回调（P0 安全加固版）
+func (s *Server) rechargeUserTokens(c *gin.Context) {
+	// 接收完整的第三方回调数据
+	var req struct {
+		Title       string `json:"title"`
+		OrderSN     string `json:"order_sn" binding:"required"`
+		Email       string `json:"email" binding:"required"`
+		ActualPrice int    `json:"actual_price" binding:"required"`
+		OrderInfo   string `json:"order_info"`
+		GoodID      string `json:"good_id"`
+		GoodName    string `json:"gd_name"`
+		Timestamp   string `json:"timestamp"` // 新增：时间戳，用 API Key 认证时可以不传
+		Signature   string `json:"signature"` // 新增：HMAC 签名，用 API Key 认证时可以不传
+	}
+
+	// 绑定JSON请求体
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("❌ 请求参数错误: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+	// P0-1: 安全验证 - API Key 或 HMAC 签名验证
+	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+	// 带 API Key 的请求已经由 OptionalAPIKey 校验过，只需要有 recharge scope
+	if middleware.IsAPIKey(c) {
+		if !middleware.HasScope(c, rechargeScope) {
+			metrics.RechargeOutcomes.WithLabelValues(metrics.RechargeUnauthorized).Inc()
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "api key does not have the recharge scope",
+			})
+			return
+		}
+		log.Printf("✅ API Key %s 验证通过: orderSN=%s", middleware.CurrentUserID(c), req.OrderSN)
+	} else if !s.validateRechargeSignature(c, req.OrderSN, req.Email, req.GoodID, req.ActualPrice, req.Timestamp, req.Signature) {
+		metrics.RechargeOutcomes.WithLabelValues(metrics.RechargeUnauthorized).Inc()
+		return
+	}
+
+	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+	// P0-2: 幂等性保证 + 充值逻辑
+	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+	userId, newCredit, err := s.creditService.AddTokensByEmailWithIdempotency(
+		c.Request.Context(),
+		req.Email,
+		req.OrderSN,
+		req.GoodID,
+		req.ActualPrice,
+	)
+
+	// 未知套餐或价格不一致属于请求错误
+	if errors.Is(err, service.ErrPackageNotFound) || errors.Is(err, service.ErrPackagePriceMismatch) {
+		log.Printf("❌ 充值套餐校验失败: orderSN=%s, goodId=%s, err=%v", req.OrderSN, req.GoodID, err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "充值成功",
+		"userId":    userId,
+		"email":     req.Email,
+		"orderSn":   req.OrderSN,
+		"goodId":    req.GoodID,
+		"goodName":  req.GoodName,
+		"newCredit": newCredit,
+	})
+}
+
+// rechargeScope 充值回调用 API Key 认证时需要的 scope
+const rechargeScope = "recharge"
+
+// validateRechargeSignature 没有 API Key 时用时间戳和 HMAC 签名认证充值回调，失败时已经写好响应
+// good_id 决定充值的套餐，总是参与签名；没有签 good_id 的回调算出的签名不一致，会被拒绝
+func (s *Server) validateRechargeSignature(c *gin.Context, orderSN, email, goodID string, actualPrice int, timestamp, signature string) bool {
+	if timestamp == "" || signature == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "缺少 API Key 或 HMAC 签名",
+		})
+		return false
+	}
+
+	// 1. 验证时间戳（防重放攻击）
+	// 添加详细时间戳日志
+	currentTime := time.Now().Unix()
+	log.Printf("🕐 时间戳验证开始: 请求时间戳=%s, 当前时间戳=%d", timestamp, currentTime)
+
+	timestampInt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "时间戳格式错误",
+		})
+		return false
+	}
+
+	// 计算时间差（秒）（保留计算逻辑但移除未使用的变量）
+	_ = currentTime - timestampInt // timeDiff不再使用，保留计算逻辑
+	if err := service.ValidateTimestamp(timestampInt); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "时间戳验证失败: " + err.Error(),
+		})
+		return false
+	}
+
+	// 2. 验证 HMAC 签名
+	params := map[string]string{
+		"actual_price": strconv.Itoa(actualPrice),
+		"email":        email,
+		"good_id":      goodID,
+		"order_sn":     orderSN,
+		"timestamp":    timestamp,
+	}
+
+	// 计算签名用于调试
+	// computedSignature := service.ComputeHMACSignature(params, s.rechargeSecretKey)
+	// log.Printf("📊 签名计算: 计算签名=%s, 接收签名=%s", computedSignature, signature)
+
+	if !service.ValidateHMACSignature(params, signature, s.rechargeSecretKey) {
+		log.Printf("❌ HMAC 签名验证失败: orderSN=%s", orderSN)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "签名验证失败",
+		})
+		return false
+	}
+
+	log.Printf("✅ 安全验证通过: orderSN=%s", orderSN)
+	return true
+}
+
+// analyticsRange 解析 ?from=&to=，格式错误时直接返回 400
+func analyticsRange(c *gin.Context) (service.DateRange, bool) {
+	r, err := service.ParseDateRange(c.Query("from"), c.Query("to"), time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return r, false
+	}
+	return r, true
+}
+
+func (s *Server) getNovelAnalytics(c *gin.Context) {
+	r, ok := analyticsRange(c)
+	if !ok {
+		return
+	}
+
+	usage, err := s.analyticsService.GetNovelUsage(c.Param("id"), r)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"usage": usage,
+	})
+}
+
+func (s *Server) getAuthorAnalytics(c *gin.Context) {
+	r, ok := analyticsRange(c)
+	if !ok {
+		return
+	}
+
+	usage, err := s.analyticsService.GetAuthorUsage(c.Param("author"), r)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"usage": usage,
+	})
+}
+
+func (s *Server) getLeaderboard(c *gin.Context) {
+	r, ok := analyticsRange(c)
+	if !ok {
+		return
+	}
+
+	limit := 10
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 || parsed > service.MaxLeaderboardLimit {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("limit must be between 1 and %d", service.MaxLeaderboardLimit),
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	by := c.DefaultQuery("by", service.RankByCredits)
+	if by != service.RankByCredits && by != service.RankByCount && by != service.RankByUniqueUsers {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "by must be one of credits, count, uniqueUsers",
+		})
+		return
+	}
+
+	leaderboard, err := s.analyticsService.GetLeaderboard(r, by, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"range":       r,
+		"by":          by,
+		"leaderboard": leaderboard,
+	})
+}
+
+func (s *Server) rebuildAnalytics(c *gin.Context) {
+	count, err := s.analyticsService.RebuildNovelUsageDaily()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "novel usage rollup rebuilt",
+		"count":   count,
+	})
+}
+
+// takeAuditSnapshot 立即做一次快照并锚定，不等定时任务
+func (s *Server) takeAuditSnapshot(c *gin.Context) {
+	snapshot, err := s.auditService.TakeSnapshot(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "snapshot anchored",
+		"snapshot": snapshot,
+	})
+}
+
+// getAuditProof 文档在最新快照中的 Merkle 包含证明和锚定交易ID
+func (s *Server) getAuditProof(c *gin.Context) {
+	proof, err := s.auditService.GetProof(c.Request.Context(), c.Param("collection"), c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, service.ErrUnknownAuditCollection):
+			status = http.StatusBadRequest
+		case errors.Is(err, service.ErrNoAuditSnapshot), errors.Is(err, service.ErrAuditLeafNotFound):
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, proof)
+}
+
+// wantsAsync 客户端用 Prefer: respond-async 或 ?async=true 要求异步提交
+func wantsAsync(c *gin.Context) bool {
+	if async, err := strconv.ParseBool(c.Query("async")); err == nil && async {
+		return true
+	}
+	for _, prefer := range c.Request.Header.Values("Prefer") {
+		for _, preference := range strings.Split(prefer, ",") {
+			if strings.EqualFold(strings.TrimSpace(preference), "respond-async") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// respondAsync 异步提交后返回 202 和 txId，回调地址来自 ?callbackUrl=
+func (s *Server) respondAsync(c *gin.Context, submit func(callbackURL string) (*database.TransactionRecord, error)) {
+	callbackURL := c.Query("callbackUrl")
+	if err := service.ValidateCallbackURL(c.Request.Context(), callbackURL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	record, err := submit(callbackURL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	statusURL := "/api/v1/transactions/" + record.TxID
+	c.Header("Location", statusURL)
+	c.Header("Preference-Applied", "respond-async")
+	c.JSON(http.StatusAccepted, gin.H{
+		"txId":      record.TxID,
+		"status":    record.Status,
+		"statusUrl": statusURL,
+	})
+}
+
+// getTransaction 查询异步提交的交易状态
+func (s *Server) getTransaction(c *gin.Context) {
+	record, err := s.transactionTracker.Get(c.Request.Context(), c.Param("txId"))
+	if errors.Is(err, service.ErrTransactionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"transaction": record})
+}
+
+// packageRequest 创建和更新套餐的请求体，price 单位是分
+type packageRequest struct {
+	GoodID            string `json:"goodId"`
+	Name              string `json:"name" binding:"required"`
+	Price             int    `json:"price" binding:"required,min=1"`
+	Credits           int    `json:"credits" binding:"required,min=1"`
+	BonusCredits      int    `json:"bonusCredits" binding:"min=0"`
+	PromoBonusCredits int    `json:"promoBonusCredits" binding:"min=0"`
+	PromoStart        string `json:"promoStart"`
+	PromoEnd          string `json:"promoEnd"`
+	Active            *bool  `json:"active"` // 不传默认上架
+}
+
+func (r *packageRequest) toPackage(goodID string) *database.RechargePackage {
+	active := true
+	if r.Active != nil {
+		active = *r.Active
+	}
+	return &database.RechargePackage{
+		GoodID:            goodID,
+		Name:              r.Name,
+		Price:             r.Price,
+		Credits:           r.Credits,
+		BonusCredits:      r.BonusCredits,
+		PromoBonusCredits: r.PromoBonusCredits,
+		PromoStart:        r.PromoStart,
+		PromoEnd:          r.PromoEnd,
+		Active:            active,
+	}
+}
+
+// packageErrorStatus 把套餐错误映射成 HTTP 状态码
+func packageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrPackageNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrPackageExists):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidPackage):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (s *Server) listPackages(c *gin.Context) {
+	// 默认只返回上架的套餐，?all=true 返回全部
+	activeOnly := c.Query("all") != "true"
+	packages, err := s.packageService.ListPackages(activeOnly)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"packages": packages,
+		"count":    len(packages),
+	})
+}
+
+func (s *Server) getPackage(c *gin.Context) {
+	pkg, err := s.packageService.GetPackage(c.Param("goodId"))
+	if err != nil {
+		c.JSON(packageErrorStatus(err), gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"package": pkg,
+	})
+}
+
+func (s *Server) createPackage(c *gin.Context) {
+	var req packageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if req.GoodID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "goodId is required",
+		})
+		return
+	}
+
+	pkg := req.toPackage(req.GoodID)
+	if err := s.packageService.CreatePackage(pkg); err != nil {
+		c.JSON(packageErrorStatus(err), gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "package created successfully",
+		"package": pkg,
+	})
+}
+
+func (s *Server) updatePackage(c *gin.Context) {
+	var req packageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	pkg := req.toPackage(c.Param("goodId"))
+	if err := s.packageService.UpdatePackage(pkg); err != nil {
+		c.JSON(packageErrorStatus(err), gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "package updated successfully",
+		"package": pkg,
+	})
+}
+
+func (s *Server) deletePackage(c *gin.Context) {
+	goodID := c.Param("goodId")
+	if err := s.packageService.DeletePackage(goodID); err != nil {
+		c.JSON(packageErrorStatus(err), gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "package deleted successfully",
+		"goodId":  goodID,
+	})
+}
+
+// novelOwnerHook 创建小说的交易提交后把小说记到当前用户名下，API Key 调用方没有用户，返回 nil
+func (s *Server) novelOwnerHook(c *gin.Context, novelID string) service.CommitHook {
+	userID := middleware.CurrentUserID(c)
+	if userID == "" || middleware.IsAPIKey(c) {
+		return nil
+	}
+	return func(ctx context.Context) error {
+		return s.ownershipService.AddNovel(ctx, novelID, userID)
+	}
+}
+
+// novelRemovedHook 删除小说的交易提交后清掉它的所有者
+func (s *Server) novelRemovedHook(novelID string) service.CommitHook {
+	return func(ctx context.Context) error {
+		return s.ownershipService.RemoveNovel(ctx, novelID)
+	}
+}
+
+// runCommitHook 同步提交成功后执行 hook，交易已经上链，失败只记录日志
+func runCommitHook(ctx context.Context, hook service.CommitHook) {
+	if hook == nil {
+		return
+	}
+	if err := hook(ctx); err != nil {
+		log.Printf("⚠️ 交易提交后的处理失败: %v", err)
+	}
+}
+
+// ownerResolvers 授权策略里 owner 规则用到的所有权查询
+func (s *Server) ownerResolvers() map[string]middleware.OwnerResolver {
+	return map[string]middleware.OwnerResolver{
+		// 路径里的用户ID就是自己
+		"user": func(ctx context.Context, c *gin.Context, userID string) (bool, error) {
+			return c.Param("id") == userID, nil
+		},
+		"novel": func(ctx context.Context, c *gin.Context, userID string) (bool, error) {
+			return s.ownershipService.IsNovelOwner(ctx, c.Param("id"), userID)
+		},
+		"hold": func(ctx context.Context, c *gin.Context, userID string) (bool, error) {
+			return s.ownershipService.IsHoldOwner(ctx, c.Param("holdId"), userID)
+		},
+	}
+}
+
+// login 用邮箱或用户名和密码登录，返回访问令牌和刷新令牌
+func (s *Server) login(c *gin.Context) {
+	var req struct {
+		Login    string `json:"login" binding:"required"` // 邮箱或用户名
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	tokens, user, err := s.authService.Login(c.Request.Context(), req.Login, req.Password)
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, service.ErrUserInactive) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": tokens,
+		"user": gin.H{
+			"id":       user.ID,
+			"email":    user.Email,
+			"username": user.Username,
+			"role":     user.Role,
+		},
+	})
+}
+
+// refreshToken 用刷新令牌换一对新令牌，旧的刷新令牌不能再用
+func (s *Server) refreshToken(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	tokens, err := s.authService.Refresh(c.Request.Context(), req.RefreshToken)
+	if errors.Is(err, service.ErrInvalidToken) || errors.Is(err, service.ErrUserInactive) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": tokens,
+	})
+}
+
+// logout 吊销当前会话，会话下的访问令牌和刷新令牌都会失效
+func (s *Server) logout(c *gin.Context) {
+	token, ok := middleware.BearerToken(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "missing bearer token",
+		})
+		return
+	}
+
+	err := s.authService.Logout(c.Request.Context(), token)
+	if errors.Is(err, service.ErrInvalidToken) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "logged out",
+	})
+}
+
+// listAPIKeys 列出全部 API Key，不返回密钥
+func (s *Server) listAPIKeys(c *gin.Context) {
+	keys, err := s.apiKeyService.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"apiKeys": keys,
+		"count":   len(keys),
+	})
+}
+
+// createAPIKey 创建 API Key，完整的 key 只在响应里出现这一次
+func (s *Server) createAPIKey(c *gin.Context) {
+	var req struct {
+		Name      string   `json:"name" binding:"required"`
+		Scopes    []string `json:"scopes" binding:"required"`
+		ExpiresIn string   `json:"expiresIn"` // 有效期，如 720h，不传表示不过期
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !s.policy.HasScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "unknown scope: " + scope,
+			})
+			return
+		}
+	}
+	expiresIn, ok := durationParam(c, "expiresIn", req.ExpiresIn)
+	if !ok {
+		return
+	}
+
+	key, plaintext, err := s.apiKeyService.Create(c.Request.Context(), req.Name, req.Scopes, expiresIn, middleware.CurrentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"key":    plaintext,
+		"apiKey": key,
+	})
+}
+
+// revokeAPIKey 吊销 API Key
+func (s *Server) revokeAPIKey(c *gin.Context) {
+	err := s.apiKeyService.Revoke(c.Request.Context(), c.Param("keyId"))
+	if errors.Is(err, service.ErrAPIKeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "api key revoked",
+		"keyId":   c.Param("keyId"),
+	})
+}
+
+// rotateAPIKey 轮换 API Key，旧 key 在 gracePeriod 内仍然可用
+func (s *Server) rotateAPIKey(c *gin.Context) {
+	var req struct {
+		GracePeriod string `json:"gracePeriod"` // 旧 key 的宽限期，如 24h，不传表示立即吊销
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	grace, ok := durationParam(c, "gracePeriod", req.GracePeriod)
+	if !ok {
+		return
+	}
+
+	key, plaintext, err := s.apiKeyService.Rotate(c.Request.Context(), c.Param("keyId"), grace, middleware.CurrentUserID(c))
+	if errors.Is(err, service.ErrAPIKeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"key":    plaintext,
+		"apiKey": key,
+	})
+}
+
+// durationParam 解析可选的时长参数，空字符串是 0，格式错误或为负时返回 400
+func durationParam(c *gin.Context, name, value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, true
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid " + name + ": " + value,
+		})
+		return 0, false
+	}
+	return duration, true
+}
+
+func (s *Server) Start(address string) error {
+	// 初始化 http.Server，使用传入的地址
+	s.httpServer = &http.Server{
+		Addr:    address,
+		Handler: s.router,
+	}
+
+	log.Printf("🚀 Starting server on %s", address)
+	return s.httpServer.ListenAndServe()
+}
+
+func (s *Server) formatJSON(data []byte) string {
+	var result bytes.Buffer
+	//第三个参数字符串的前缀，第四个参数是缩进
+	if err := json.Indent(&result, data, "", "    "); err != nil {
+		return string(data)
+	}
+	return result.String()
+}
+
+// ledgerConsistency 列表查询是否要求直接查链，默认读 MongoDB 读模型
+func ledgerConsistency(c *gin.Context) bool {
+	return c.Query("consistency") == "ledger"
+}
+
+// listOptions 解析读模型列表的 sort、fields、limit、cursor 参数
+func listOptions(c *gin.Context) (service.ListOptions, bool) {
+	opts := service.ListOptions{
+		Sort:   c.Query("sort"),
+		Cursor: c.Query("cursor"),
+		Limit:  service.DefaultQueryLimit,
+	}
+	if consistency := c.Query("consistency"); consistency != "" && consistency != "eventual" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "consistency must be eventual or ledger",
+		})
+		return opts, false
+	}
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 || parsed > service.MaxQueryLimit {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("limit must be between 1 and %d", service.MaxQueryLimit),
+			})
+			return opts, false
+		}
+		opts.Limit = parsed
+	}
+	for _, field := range strings.Split(c.Query("fields"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			opts.Fields = append(opts.Fields, field)
+		}
+	}
+	return opts, true
+}
+
+// intQuery 解析可选的整数参数，没有传时 target 保持 nil
+func intQuery(c *gin.Context, name string, target **int) bool {
+	raw := c.Query(name)
+	if raw == "" {
+		return true
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("%s must be an integer", name),
+		})
+		return false
+	}
+	*target = &value
+	return true
+}
+
+// respondListPage 返回读模型的一页结果，blockHeight 说明数据已经同步到哪个区块
+func respondListPage(c *gin.Context, name string, page *service.ListPage, err error) {
+	if errors.Is(err, service.ErrInvalidQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	response := gin.H{
+		name:          page.Items,
+		"count":       page.Count,
+		"consistency": "eventual",
+		"blockHeight": page.BlockHeight,
+		"syncedAt":    page.SyncedAt,
+	}
+	if page.NextCursor != "" {
+		response["nextCursor"] = page.NextCursor
+	}
+	c.JSON(http.StatusOK, response)
+}
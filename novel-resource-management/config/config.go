@@ -0,0 +1,355 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// 应用配置：默认值 -> 配置文件（YAML 或 TOML）-> 环境变量，后面的覆盖前面的，最后统一校验
+// 配置文件默认是 config/app.<APP_ENV>.yaml，APP_ENV 默认 dev；CONFIG_FILE 可以指定其他文件
+// 每个字段的 env 标签是覆盖它的环境变量，secret 标签的字段打印时会被隐藏
+
+// 运行环境
+const (
+	EnvDev     = "dev"
+	EnvStaging = "staging"
+	EnvProd    = "prod"
+)
+
+// 没有配置充值密钥时使用的占位值，只允许在 dev 环境使用
+const placeholderRechargeSecret = "your-secret-key-change-in-production"
+
+// Config 应用的全部配置
+type Config struct {
+	Environment string            `yaml:"environment" toml:"environment" env:"APP_ENV"`
+	Server      ServerConfig      `yaml:"server" toml:"server"`
+	Fabric      FabricConfig      `yaml:"fabric" toml:"fabric"`
+	MongoDB     MongoDBConfig     `yaml:"mongodb" toml:"mongodb"`
+	Auth        AuthConfig        `yaml:"auth" toml:"auth"`
+	Recharge    RechargeConfig    `yaml:"recharge" toml:"recharge"`
+	RSA         RSAConfig         `yaml:"rsa" toml:"rsa"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit" toml:"rate_limit"`
+	Idempotency IdempotencyConfig `yaml:"idempotency" toml:"idempotency"`
+	Audit       AuditConfig       `yaml:"audit" toml:"audit"`
+	Holds       HoldsConfig       `yaml:"holds" toml:"holds"`
+	Tracing     TracingConfig     `yaml:"tracing" toml:"tracing"`
+
+	// Source 实际加载的配置文件，没有配置文件时为空
+	Source string `yaml:"-" toml:"-"`
+}
+
+// ServerConfig HTTP 服务
+type ServerConfig struct {
+	Port            int      `yaml:"port" toml:"port" env:"SERVER_PORT"`
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+	// TrustedProxies 反向代理的 IP 或 CIDR，只采用这些地址转发来的 X-Forwarded-For
+	// 为空时不信任任何代理，客户端 IP 就是连接的对端地址；环境变量用逗号分隔
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies" env:"SERVER_TRUSTED_PROXIES"`
+}
+
+// Addr http.Server 监听的地址
+func (s ServerConfig) Addr() string {
+	return fmt.Sprintf(":%d", s.Port)
+}
+
+// FabricConfig Fabric 网络、身份和交易设置
+// 证书和私钥的路径是相对 cert_path 的，写绝对路径时直接使用
+type FabricConfig struct {
+	Channel   string `yaml:"channel" toml:"channel" env:"FABRIC_CHANNEL"`
+	Chaincode string `yaml:"chaincode" toml:"chaincode" env:"FABRIC_CHAINCODE"`
+	MSPID     string `yaml:"msp_id" toml:"msp_id" env:"FABRIC_MSP_ID"`
+
+	// PeerHost 为空时自动判断：Docker 容器里用 host.docker.internal，否则用 localhost
+	PeerHost string `yaml:"peer_host" toml:"peer_host" env:"FABRIC_PEER_HOST"`
+	PeerPort int    `yaml:"peer_port" toml:"peer_port" env:"FABRIC_PEER_PORT"`
+	// GatewayPeer peer TLS 证书里的主机名，用 host.docker.internal 之类的地址连接时靠它校验证书
+	GatewayPeer string `yaml:"gateway_peer" toml:"gateway_peer" env:"FABRIC_GATEWAY_PEER"`
+
+	CertPath     string `yaml:"cert_path" toml:"cert_path" env:"FABRIC_CERT_PATH"`
+	TLSCertFile  string `yaml:"tls_cert_file" toml:"tls_cert_file" env:"FABRIC_TLS_CERT_FILE"`
+	SignCertFile string `yaml:"sign_cert_file" toml:"sign_cert_file" env:"FABRIC_SIGN_CERT_FILE"`
+	KeyFile      string `yaml:"key_file" toml:"key_file" env:"FABRIC_KEY_FILE"`
+	// AdminContract 的交易用平台管理员身份签名：Org1 里证书带 role=admin 属性的身份
+	// 在 test-network 上用 scripts/enroll-platform-admin.sh 登记；dev 环境不配置时用上面的身份，管理类交易会被链码拒绝
+	AdminSignCertFile string `yaml:"admin_sign_cert_file" toml:"admin_sign_cert_file" env:"FABRIC_ADMIN_SIGN_CERT_FILE"`
+	AdminKeyFile      string `yaml:"admin_key_file" toml:"admin_key_file" env:"FABRIC_ADMIN_KEY_FILE"`
+
+	// Gateway 各阶段的默认超时
+	EvaluateTimeout     Duration `yaml:"evaluate_timeout" toml:"evaluate_timeout" env:"FABRIC_EVALUATE_TIMEOUT"`
+	EndorseTimeout      Duration `yaml:"endorse_timeout" toml:"endorse_timeout" env:"FABRIC_ENDORSE_TIMEOUT"`
+	SubmitTimeout       Duration `yaml:"submit_timeout" toml:"submit_timeout" env:"FABRIC_SUBMIT_TIMEOUT"`
+	CommitStatusTimeout Duration `yaml:"commit_status_timeout" toml:"commit_status_timeout" env:"FABRIC_COMMIT_STATUS_TIMEOUT"`
+
+	Retry SubmitRetryConfig `yaml:"retry" toml:"retry"`
+
+	// TransactionStatusTimeout 异步提交等待提交状态的时长，超过后状态为 timeout
+	TransactionStatusTimeout Duration `yaml:"transaction_status_timeout" toml:"transaction_status_timeout" env:"TRANSACTION_STATUS_TIMEOUT"`
+	// EventListenerMaxLag 交易提交后超过这个时长还没投影到 MongoDB，/readyz 认为事件监听器落后
+	EventListenerMaxLag Duration `yaml:"event_listener_max_lag" toml:"event_listener_max_lag" env:"EVENT_LISTENER_MAX_LAG"`
+}
+
+// ResolvePath 相对路径按 cert_path 拼接
+func (f FabricConfig) ResolvePath(path string) string {
+	if path == "" || strings.HasPrefix(path, "/") {
+		return path
+	}
+	return strings.TrimRight(f.CertPath, "/") + "/" + path
+}
+
+// SubmitRetryConfig 提交交易遇到 MVCC/幻读冲突时的重试
+// MaxAttempts 包括第一次提交；Timeout 是一次调用（包括所有重试）的总时长
+type SubmitRetryConfig struct {
+	MaxAttempts int      `yaml:"max_attempts" toml:"max_attempts" env:"SUBMIT_MAX_ATTEMPTS"`
+	BaseDelay   Duration `yaml:"base_delay" toml:"base_delay" env:"SUBMIT_RETRY_BASE_DELAY"`
+	MaxDelay    Duration `yaml:"max_delay" toml:"max_delay" env:"SUBMIT_RETRY_MAX_DELAY"`
+	Timeout     Duration `yaml:"timeout" toml:"timeout" env:"SUBMIT_TIMEOUT"`
+}
+
+// MongoDBConfig MongoDB 连接
+type MongoDBConfig struct {
+	// URI 里可能带用户名和密码，打印时隐藏密码
+	URI            string   `yaml:"uri" toml:"uri" env:"MONGODB_URI" secret:"url"`
+	Database       string   `yaml:"database" toml:"database" env:"MONGODB_DATABASE"`
+	Timeout        Duration `yaml:"timeout" toml:"timeout" env:"MONGODB_TIMEOUT"`
+	MaxPoolSize    uint64   `yaml:"max_pool_size" toml:"max_pool_size" env:"MONGODB_MAX_POOL_SIZE"`
+	MinPoolSize    uint64   `yaml:"min_pool_size" toml:"min_pool_size" env:"MONGODB_MIN_POOL_SIZE"`
+	MaxConnIdleTTL Duration `yaml:"max_conn_idle_ttl" toml:"max_conn_idle_ttl" env:"MONGODB_MAX_CONN_IDLE_TTL"`
+}
+
+// AuthConfig 登录令牌和路由授权
+type AuthConfig struct {
+	// JWTSecret 为空时每次启动随机生成，重启后需要重新登录，多实例部署时令牌也不通用
+	JWTSecret  string   `yaml:"jwt_secret" toml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	AccessTTL  Duration `yaml:"access_ttl" toml:"access_ttl" env:"JWT_ACCESS_TTL"`
+	RefreshTTL Duration `yaml:"refresh_ttl" toml:"refresh_ttl" env:"JWT_REFRESH_TTL"`
+	PolicyFile string   `yaml:"policy_file" toml:"policy_file" env:"AUTH_POLICY_FILE"`
+}
+
+// RechargeConfig 充值回调
+type RechargeConfig struct {
+	// SecretKey 充值回调的 HMAC 签名密钥
+	SecretKey string `yaml:"secret_key" toml:"secret_key" env:"RECHARGE_SECRET_KEY" secret:"true"`
+}
+
+// RSAConfig 前端加密请求用的 RSA 密钥，直接配置的 PEM 优先，没有时读文件
+type RSAConfig struct {
+	PrivateKey     string `yaml:"private_key" toml:"private_key" env:"RSA_PRIVATE_KEY" secret:"true"`
+	PublicKey      string `yaml:"public_key" toml:"public_key" env:"RSA_PUBLIC_KEY"`
+	PrivateKeyFile string `yaml:"private_key_file" toml:"private_key_file" env:"RSA_PRIVATE_KEY_FILE"`
+	PublicKeyFile  string `yaml:"public_key_file" toml:"public_key_file" env:"RSA_PUBLIC_KEY_FILE"`
+}
+
+// RateLimitConfig 限流规则文件，格式见 config/ratelimit.yaml
+type RateLimitConfig struct {
+	File string `yaml:"file" toml:"file" env:"RATE_LIMIT_FILE"`
+}
+
+// IdempotencyConfig Idempotency-Key 记录的保存时长，以及处理中的请求多久没有完成后允许重试接手
+type IdempotencyConfig struct {
+	TTL     Duration `yaml:"ttl" toml:"ttl" env:"IDEMPOTENCY_TTL"`
+	LockTTL Duration `yaml:"lock_ttl" toml:"lock_ttl" env:"IDEMPOTENCY_LOCK_TTL"`
+}
+
+// AuditConfig 读模型快照
+type AuditConfig struct {
+	// SnapshotInterval 定时快照的间隔，0 表示关闭
+	SnapshotInterval Duration `yaml:"snapshot_interval" toml:"snapshot_interval" env:"AUDIT_SNAPSHOT_INTERVAL"`
+	// RetainSnapshots 保留叶子和内部节点的最近快照数，更早的快照只保留根，不能再生成证明
+	RetainSnapshots int `yaml:"retain_snapshots" toml:"retain_snapshots" env:"AUDIT_RETAIN_SNAPSHOTS"`
+}
+
+// HoldsConfig 积分预留
+type HoldsConfig struct {
+	// ExpiryInterval 定时清理过期预留的间隔，0 表示关闭，只在用户下一次预留、消费时顺带清理
+	ExpiryInterval Duration `yaml:"expiry_interval" toml:"expiry_interval" env:"HOLD_EXPIRY_INTERVAL"`
+}
+
+// TracingConfig 链路追踪，OTLP 地址等其他设置按 OpenTelemetry 规范从 OTEL_* 环境变量读取
+type TracingConfig struct {
+	// Exporter otlp、stdout（或 console）、none
+	Exporter string `yaml:"exporter" toml:"exporter" env:"OTEL_TRACES_EXPORTER"`
+}
+
+// Default 所有配置项的默认值，对应本地 test-network
+func Default() *Config {
+	return &Config{
+		Environment: EnvDev,
+		Server: ServerConfig{
+			Port:            8080,
+			ShutdownTimeout: Duration{10 * time.Second},
+		},
+		Fabric: FabricConfig{
+			Channel:             "mychannel",
+			Chaincode:           "novel-basic",
+			MSPID:               "Org1MSP",
+			PeerPort:            7051,
+			GatewayPeer:         "peer0.org1.example.com",
+			CertPath:            "../test-network/organizations/peerOrganizations/org1.example.com",
+			TLSCertFile:         "tlsca/tlsca.org1.example.com-cert.pem",
+			SignCertFile:        "users/User1@org1.example.com/msp/signcerts/User1@org1.example.com-cert.pem",
+			KeyFile:             "users/User1@org1.example.com/msp/keystore/priv_sk",
+			EvaluateTimeout:     Duration{15 * time.Second},
+			EndorseTimeout:      Duration{30 * time.Second},
+			SubmitTimeout:       Duration{15 * time.Second},
+			CommitStatusTimeout: Duration{2 * time.Minute},
+			Retry: SubmitRetryConfig{
+				MaxAttempts: 5,
+				BaseDelay:   Duration{100 * time.Millisecond},
+				MaxDelay:    Duration{2 * time.Second},
+				Timeout:     Duration{60 * time.Second},
+			},
+			TransactionStatusTimeout: Duration{2 * time.Minute},
+			EventListenerMaxLag:      Duration{30 * time.Second},
+		},
+		MongoDB: MongoDBConfig{
+			URI:            "mongodb://localhost:27017",
+			Database:       "novel",
+			Timeout:        Duration{10 * time.Second},
+			MaxPoolSize:    10,
+			MinPoolSize:    2,
+			MaxConnIdleTTL: Duration{30 * time.Minute},
+		},
+		Auth: AuthConfig{
+			AccessTTL:  Duration{15 * time.Minute},
+			RefreshTTL: Duration{7 * 24 * time.Hour},
+			PolicyFile: "config/policy.yaml",
+		},
+		RSA: RSAConfig{
+			PrivateKeyFile: "security/rsa_private_key.pem",
+			PublicKeyFile:  "security/rsa_public_key.pem",
+		},
+		RateLimit: RateLimitConfig{File: "config/ratelimit.yaml"},
+		Idempotency: IdempotencyConfig{
+			TTL:     Duration{24 * time.Hour},
+			LockTTL: Duration{2 * time.Minute},
+		},
+		Audit:   AuditConfig{SnapshotInterval: Duration{time.Hour}, RetainSnapshots: 24},
+		Holds:   HoldsConfig{ExpiryInterval: Duration{time.Minute}},
+		Tracing: TracingConfig{Exporter: "none"},
+	}
+}
+
+// Validate 检查所有配置项，把全部问题一次报出来，而不是改一个报一个
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	required := func(field, value string) {
+		if strings.TrimSpace(value) == "" {
+			add("%s is required", field)
+		}
+	}
+	positive := func(field string, value Duration) {
+		if value.Duration <= 0 {
+			add("%s must be a positive duration, got %s", field, value)
+		}
+	}
+	port := func(field string, value int) {
+		if value <= 0 || value > 65535 {
+			add("%s must be between 1 and 65535, got %d", field, value)
+		}
+	}
+
+	switch c.Environment {
+	case EnvDev, EnvStaging, EnvProd:
+	default:
+		add("environment must be one of %s, %s, %s, got %q", EnvDev, EnvStaging, EnvProd, c.Environment)
+	}
+
+	port("server.port", c.Server.Port)
+	positive("server.shutdown_timeout", c.Server.ShutdownTimeout)
+	for _, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				add("server.trusted_proxies must contain IP addresses or CIDRs, got %q", proxy)
+			}
+		}
+	}
+
+	required("fabric.channel", c.Fabric.Channel)
+	required("fabric.chaincode", c.Fabric.Chaincode)
+	required("fabric.msp_id", c.Fabric.MSPID)
+	port("fabric.peer_port", c.Fabric.PeerPort)
+	required("fabric.gateway_peer", c.Fabric.GatewayPeer)
+	required("fabric.cert_path", c.Fabric.CertPath)
+	required("fabric.tls_cert_file", c.Fabric.TLSCertFile)
+	required("fabric.sign_cert_file", c.Fabric.SignCertFile)
+	required("fabric.key_file", c.Fabric.KeyFile)
+	if (c.Fabric.AdminSignCertFile == "") != (c.Fabric.AdminKeyFile == "") {
+		add("fabric.admin_sign_cert_file and fabric.admin_key_file must be set together")
+	}
+	positive("fabric.evaluate_timeout", c.Fabric.EvaluateTimeout)
+	positive("fabric.endorse_timeout", c.Fabric.EndorseTimeout)
+	positive("fabric.submit_timeout", c.Fabric.SubmitTimeout)
+	positive("fabric.commit_status_timeout", c.Fabric.CommitStatusTimeout)
+	if c.Fabric.Retry.MaxAttempts < 1 {
+		add("fabric.retry.max_attempts must be at least 1, got %d", c.Fabric.Retry.MaxAttempts)
+	}
+	positive("fabric.retry.base_delay", c.Fabric.Retry.BaseDelay)
+	positive("fabric.retry.max_delay", c.Fabric.Retry.MaxDelay)
+	positive("fabric.retry.timeout", c.Fabric.Retry.Timeout)
+	if c.Fabric.Retry.MaxDelay.Duration < c.Fabric.Retry.BaseDelay.Duration {
+		add("fabric.retry.max_delay (%s) must not be less than fabric.retry.base_delay (%s)", c.Fabric.Retry.MaxDelay, c.Fabric.Retry.BaseDelay)
+	}
+	positive("fabric.transaction_status_timeout", c.Fabric.TransactionStatusTimeout)
+	positive("fabric.event_listener_max_lag", c.Fabric.EventListenerMaxLag)
+
+	required("mongodb.uri", c.MongoDB.URI)
+	required("mongodb.database", c.MongoDB.Database)
+	positive("mongodb.timeout", c.MongoDB.Timeout)
+	if c.MongoDB.MaxPoolSize == 0 {
+		add("mongodb.max_pool_size must be at least 1")
+	}
+	if c.MongoDB.MinPoolSize > c.MongoDB.MaxPoolSize {
+		add("mongodb.min_pool_size (%d) must not exceed mongodb.max_pool_size (%d)", c.MongoDB.MinPoolSize, c.MongoDB.MaxPoolSize)
+	}
+	positive("mongodb.max_conn_idle_ttl", c.MongoDB.MaxConnIdleTTL)
+
+	positive("auth.access_ttl", c.Auth.AccessTTL)
+	positive("auth.refresh_ttl", c.Auth.RefreshTTL)
+	required("auth.policy_file", c.Auth.PolicyFile)
+	required("rate_limit.file", c.RateLimit.File)
+	positive("idempotency.ttl", c.Idempotency.TTL)
+	positive("idempotency.lock_ttl", c.Idempotency.LockTTL)
+	// 锁过期前请求应该已经处理完，否则正常处理中的请求也会被重试接手
+	if c.Idempotency.LockTTL.Duration <= c.Fabric.Retry.Timeout.Duration {
+		add("idempotency.lock_ttl (%s) must be longer than fabric.retry.timeout (%s)", c.Idempotency.LockTTL, c.Fabric.Retry.Timeout)
+	}
+	if c.Audit.SnapshotInterval.Duration < 0 {
+		add("audit.snapshot_interval must not be negative, got %s", c.Audit.SnapshotInterval)
+	}
+	if c.Audit.RetainSnapshots < 1 {
+		add("audit.retain_snapshots must be at least 1, got %d", c.Audit.RetainSnapshots)
+	}
+	if c.Holds.ExpiryInterval.Duration < 0 {
+		add("holds.expiry_interval must not be negative, got %s", c.Holds.ExpiryInterval)
+	}
+
+	switch c.Tracing.Exporter {
+	case "", "none", "otlp", "stdout", "console":
+	default:
+		add("tracing.exporter must be one of otlp, stdout, console, none, got %q", c.Tracing.Exporter)
+	}
+
+	// staging 和 prod 不允许使用随机或占位的密钥
+	if c.Environment != EnvDev {
+		if c.Fabric.AdminSignCertFile == "" {
+			add("fabric.admin_sign_cert_file is required in %s (set FABRIC_ADMIN_SIGN_CERT_FILE)", c.Environment)
+		}
+		if c.Auth.JWTSecret == "" {
+			add("auth.jwt_secret is required in %s (set JWT_SECRET)", c.Environment)
+		}
+		if c.Recharge.SecretKey == "" || c.Recharge.SecretKey == placeholderRechargeSecret {
+			add("recharge.secret_key is required in %s (set RECHARGE_SECRET_KEY)", c.Environment)
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New("invalid config:\n  - " + strings.Join(problems, "\n  - "))
+}
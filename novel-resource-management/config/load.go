@@ -0,0 +1,227 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Duration 配置文件里写成 "30s"、"2m" 这样的字符串，YAML 和 TOML 都按 time.ParseDuration 解析
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
+// Load 读取 .env、配置文件和环境变量，校验通过后返回配置
+// 配置文件是 CONFIG_FILE，没有设置时是 config/app.<APP_ENV>.yaml，这个默认文件不存在时只用默认值和环境变量
+func Load() (*Config, error) {
+	// .env 里的变量不会覆盖已经设置的环境变量
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		log.Printf("⚠️ 读取 .env 文件失败: %v", err)
+	}
+
+	cfg := Default()
+
+	path, explicit := os.LookupEnv("CONFIG_FILE")
+	if !explicit || path == "" {
+		env := os.Getenv("APP_ENV")
+		if env == "" {
+			env = EnvDev
+		}
+		path = fmt.Sprintf("config/app.%s.yaml", env)
+		explicit = false
+	}
+	if err := cfg.loadFile(path); err != nil {
+		if explicit || !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		log.Printf("ℹ️ 配置文件 %s 不存在，使用默认值和环境变量", path)
+	}
+
+	if err := applyEnv(reflect.ValueOf(cfg).Elem()); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		if cfg.Source != "" {
+			return nil, fmt.Errorf("%s: %v", cfg.Source, err)
+		}
+		return nil, err
+	}
+
+	if cfg.Recharge.SecretKey == "" {
+		log.Printf("⚠️ 警告: 没有配置充值密钥 RECHARGE_SECRET_KEY，使用默认值")
+		cfg.Recharge.SecretKey = placeholderRechargeSecret
+	}
+	return cfg, nil
+}
+
+// loadFile 按扩展名解析 YAML 或 TOML，文件里没写的字段保留默认值，写错的字段名直接报错
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file %s failed: %w", path, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(c)
+		// 默认的错误信息不带字段名，换成带行号和字段的详细信息
+		var strictErr *toml.StrictMissingError
+		if errors.As(err, &strictErr) {
+			err = errors.New(strictErr.String())
+		}
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(c)
+	default:
+		return fmt.Errorf("config file %s: unsupported format, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parse config file %s failed: %v", path, err)
+	}
+	c.Source = path
+	return nil
+}
+
+var durationType = reflect.TypeOf(Duration{})
+
+// applyEnv 按字段的 env 标签用环境变量覆盖配置，空字符串视为没有设置
+func applyEnv(value reflect.Value) error {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		fieldType := value.Type().Field(i)
+
+		name := fieldType.Tag.Get("env")
+		if name == "" {
+			if field.Kind() == reflect.Struct && field.Type() != durationType {
+				if err := applyEnv(field); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		raw := os.Getenv(name)
+		if raw == "" {
+			continue
+		}
+		if err := setField(field, raw); err != nil {
+			return fmt.Errorf("invalid environment variable %s=%q: %v", name, raw, err)
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, raw string) error {
+	if field.Type() == durationType {
+		var duration Duration
+		if err := duration.UnmarshalText([]byte(raw)); err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(duration))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Int:
+		number, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(number))
+	case reflect.Uint64:
+		number, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetUint(number)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported field type %s", field.Type())
+		}
+		// 逗号分隔，忽略空项
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+// redactedValue 替换密钥的固定字符串，不透露密钥长度
+const redactedValue = "[REDACTED]"
+
+// Redacted 返回隐藏了密钥的副本：secret:"true" 的字段整个替换，secret:"url" 的字段只隐藏 URL 里的密码
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	redact(reflect.ValueOf(&redacted).Elem())
+	return &redacted
+}
+
+func redact(value reflect.Value) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if field.Kind() == reflect.Struct && field.Type() != durationType {
+			redact(field)
+			continue
+		}
+		if field.Kind() != reflect.String || field.String() == "" {
+			continue
+		}
+
+		switch value.Type().Field(i).Tag.Get("secret") {
+		case "true":
+			field.SetString(redactedValue)
+		case "url":
+			if parsed, err := url.Parse(field.String()); err == nil {
+				field.SetString(parsed.Redacted())
+			} else {
+				field.SetString(redactedValue)
+			}
+		}
+	}
+}
+
+// String 隐藏密钥后的 YAML，启动日志里打印
+func (c *Config) String() string {
+	data, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return fmt.Sprintf("<marshal config failed: %v>", err)
+	}
+	return string(data)
+}
@@ -1,42 +1,92 @@
 package database
 
 import (
-	// 不再需要 primitive 包
+	"time"
+
+	model "novel-resource-model/v1"
 )
 
-// Novel 与链码中的 Novel 结构体保持一致
-type Novel struct {
-	ID           string `bson:"_id,omitempty" json:"id"`           // 改为string类型，与链码一致
-	Author       string `bson:"author,omitempty" json:"author,omitempty"`
-	StoryOutline string `bson:"storyOutline,omitempty" json:"storyOutline,omitempty"`
-	Subsections  string `bson:"subsections,omitempty" json:"subsections,omitempty"`
-	Characters   string `bson:"characters,omitempty" json:"characters,omitempty"`
-	Items        string `bson:"items,omitempty" json:"items,omitempty"`
-	TotalScenes  string `bson:"totalScenes,omitempty" json:"totalScenes,omitempty"`
-	CreatedAt    string `bson:"createdAt,omitempty" json:"createdAt,omitempty"`
-	UpdatedAt    string `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"`
+// Novel 直接使用共享模型，_id 就是链上的小说ID
+type Novel = model.Novel
+
+// NovelDocument novels 集合的文档，search 是事件投影生成的分词，只给全文索引用，不会返回给调用方
+type NovelDocument struct {
+	model.Novel `bson:",inline"`
+	Search      map[string]string `bson:"search,omitempty" json:"-"`
 }
 
-// UserCredit 与链码中的 UserCredit 结构体保持一致
+// UserCredit MongoDB user_credits 集合，_id 是同步时生成的，链上字段来自共享模型
 type UserCredit struct {
-	ID            string `bson:"_id,omitempty" json:"id"`           // 改为string类型，与链码一致
-	UserID        string `bson:"userId" json:"userId"`
-	Credit        int    `bson:"credit" json:"credit"`
-	TotalUsed     int    `bson:"totalUsed" json:"totalUsed"`
-	TotalRecharge int    `bson:"totalRecharge" json:"totalRecharge"`
-	CreatedAt     string `bson:"createdAt,omitempty" json:"createdAt,omitempty"`
-	UpdatedAt     string `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"`
+	ID               string `bson:"_id,omitempty" json:"id"`
+	model.UserCredit `bson:",inline"`
 }
 
-// CreditHistory 与链码中的 CreditHistory 结构体保持一致
+// CreditHold 直接使用共享模型，holdId 作为 _id
+type CreditHold = model.CreditHold
+
+// CreditHistory MongoDB credit_histories 集合，_id 一般是交易ID，链上字段来自共享模型
 type CreditHistory struct {
-	ID          string `bson:"_id,omitempty" json:"id"`               // 改为string类型，与链码一致
-	UserID      string `bson:"userId" json:"userId"`
-	Amount      int    `bson:"amount" json:"amount"`                   //积分变动的数额
-	Type        string `bson:"type" json:"type"`                     // "consume", "recharge", "reward"
-	Description string `bson:"description" json:"description"`
-	Timestamp   string `bson:"timestamp" json:"timestamp"`
-	NovelID     string `bson:"novelId,omitempty" json:"novelId,omitempty"`
+	ID                  string `bson:"_id,omitempty" json:"id"`
+	model.CreditHistory `bson:",inline"`
+}
+
+// NovelUsageDaily 小说每日用量汇总，MongoDB novel_usage_daily 集合，_id 是 novelId|date
+// 由事件监听写入消费历史时增量更新，也可以从 credit_histories 全量重建
+type NovelUsageDaily struct {
+	ID         string         `bson:"_id" json:"id"`
+	NovelID    string         `bson:"novelId" json:"novelId"`
+	Date       string         `bson:"date" json:"date"`             // 2006-01-02，和链上时间一样是 UTC
+	Credits    int            `bson:"credits" json:"credits"`       // 消费的积分
+	Count      int            `bson:"count" json:"count"`           // 消费次数
+	Operations map[string]int `bson:"operations" json:"operations"` // 操作码 -> 次数
+	Users      []string       `bson:"users" json:"-"`
+	UpdatedAt  string         `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"`
+}
+
+// AuditSnapshot MongoDB audit_snapshots 集合，一次锚定到账本的读模型快照，takenAt 作为 _id
+type AuditSnapshot struct {
+	ID      string `bson:"_id" json:"snapshotId"` // 和 TakenAt 相同，UTC 定宽纳秒时间，按字符串排序就是时间顺序
+	Root    string `bson:"root" json:"root"`
+	Count   int    `bson:"count" json:"count"`
+	TakenAt string `bson:"takenAt" json:"takenAt"`
+	TxID    string `bson:"txId" json:"txId"` // AnchorSnapshot 交易ID
+}
+
+// AuditLeaf MongoDB audit_snapshot_leaves 集合，快照里一个文档的叶子哈希，_id 是 snapshotId|index
+type AuditLeaf struct {
+	ID         string `bson:"_id" json:"-"`
+	SnapshotID string `bson:"snapshotId" json:"snapshotId"`
+	Index      int    `bson:"index" json:"index"`
+	Collection string `bson:"collection" json:"collection"`
+	DocID      string `bson:"docId" json:"docId"`
+	Hash       string `bson:"hash" json:"hash"`
+}
+
+// AuditNode MongoDB audit_snapshot_nodes 集合，快照 Merkle 树第 level 层（从 1 开始，第 0 层是叶子）的节点
+// _id 是 snapshotId|level|index，生成证明时只读取路径上的兄弟节点
+type AuditNode struct {
+	ID         string `bson:"_id" json:"-"`
+	SnapshotID string `bson:"snapshotId" json:"snapshotId"`
+	Level      int    `bson:"level" json:"level"`
+	Index      int    `bson:"index" json:"index"`
+	Hash       string `bson:"hash" json:"hash"`
+}
+
+// RechargePackage MongoDB recharge_packages 集合的结构体，good_id 作为 _id
+// Price 单位是分，和充值回调的 actual_price 一致
+type RechargePackage struct {
+	GoodID       string `bson:"_id" json:"goodId"`
+	Name         string `bson:"name" json:"name"`
+	Price        int    `bson:"price" json:"price"`
+	Credits      int    `bson:"credits" json:"credits"`
+	BonusCredits int    `bson:"bonusCredits" json:"bonusCredits"`
+	// 活动期间额外赠送 PromoBonusCredits，时间格式 2006-01-02 15:04:05（UTC），为空表示不限
+	PromoBonusCredits int    `bson:"promoBonusCredits" json:"promoBonusCredits"`
+	PromoStart        string `bson:"promoStart,omitempty" json:"promoStart,omitempty"`
+	PromoEnd          string `bson:"promoEnd,omitempty" json:"promoEnd,omitempty"`
+	Active            bool   `bson:"active" json:"active"`
+	CreatedAt         string `bson:"createdAt,omitempty" json:"createdAt,omitempty"`
+	UpdatedAt         string `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"`
 }
 
 // User MongoDB users 集合的结构体
@@ -51,4 +101,74 @@ type User struct {
 	NovelIds          []string `bson:"novelIds,omitempty" json:"novelIds,omitempty"`
 	CreatedAt         string   `bson:"createdAt,omitempty" json:"createdAt,omitempty"`
 	UpdatedAt         string   `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"`
-}
\ No newline at end of file
+}
+
+// TransactionRecord MongoDB transactions 集合，异步提交的交易及其提交状态，txId 作为 _id
+type TransactionRecord struct {
+	TxID           string `bson:"_id" json:"txId"`
+	Transaction    string `bson:"transaction" json:"transaction"`       // 链码函数名，如 CreateNovel
+	Status         string `bson:"status" json:"status"`                 // pending, committed, invalid, timeout
+	Code           string `bson:"code,omitempty" json:"code,omitempty"` // 交易验证码，如 VALID、MVCC_READ_CONFLICT
+	BlockNumber    uint64 `bson:"blockNumber,omitempty" json:"blockNumber,omitempty"`
+	Error          string `bson:"error,omitempty" json:"error,omitempty"` // 查询提交状态失败的原因
+	CallbackURL    string `bson:"callbackUrl,omitempty" json:"callbackUrl,omitempty"`
+	CallbackStatus int    `bson:"callbackStatus,omitempty" json:"callbackStatus,omitempty"` // 回调返回的 HTTP 状态码
+	CallbackError  string `bson:"callbackError,omitempty" json:"callbackError,omitempty"`
+	SubmittedAt    string `bson:"submittedAt" json:"submittedAt"`
+	UpdatedAt      string `bson:"updatedAt" json:"updatedAt"`
+}
+
+// SyncState MongoDB sync_state 集合，记录读模型同步到的位置
+type SyncState struct {
+	ID          string `bson:"_id" json:"id"`
+	BlockNumber uint64 `bson:"blockNumber" json:"blockNumber"` // 已经处理过事件的最高区块
+	UpdatedAt   string `bson:"updatedAt" json:"updatedAt"`
+}
+
+// AuthSession MongoDB auth_sessions 集合，一次登录对应一个会话，sessionId 作为 _id
+// 访问令牌和刷新令牌都带 sessionId，退出登录或发现刷新令牌被重复使用时吊销整个会话
+type AuthSession struct {
+	ID        string    `bson:"_id" json:"id"`
+	UserID    string    `bson:"userId" json:"userId"`
+	RefreshID string    `bson:"refreshId" json:"-"` // 当前有效的刷新令牌 jti，刷新时轮换
+	Revoked   bool      `bson:"revoked" json:"revoked"`
+	ExpiresAt time.Time `bson:"expiresAt" json:"expiresAt"` // TTL 索引按它清理过期会话
+	CreatedAt string    `bson:"createdAt" json:"createdAt"`
+	UpdatedAt string    `bson:"updatedAt" json:"updatedAt"`
+}
+
+// APIKey MongoDB api_keys 集合，给机器调用方使用，keyId 作为 _id，只保存密钥部分的 SHA-256
+type APIKey struct {
+	ID         string     `bson:"_id" json:"id"`
+	Name       string     `bson:"name" json:"name"`
+	SecretHash string     `bson:"secretHash" json:"-"`
+	Scopes     []string   `bson:"scopes" json:"scopes"`                             // 见 config/policy.yaml 的 scopes
+	ExpiresAt  *time.Time `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`   // 为空表示不过期
+	LastUsedAt *time.Time `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"` // 按分钟更新
+	Revoked    bool       `bson:"revoked" json:"revoked"`
+	RotatedTo  string     `bson:"rotatedTo,omitempty" json:"rotatedTo,omitempty"` // 轮换后的新 keyId
+	CreatedBy  string     `bson:"createdBy" json:"createdBy"`
+	CreatedAt  string     `bson:"createdAt" json:"createdAt"`
+	UpdatedAt  string     `bson:"updatedAt" json:"updatedAt"`
+}
+
+// 幂等记录的状态
+const (
+	IdempotencyProcessing = "processing"
+	IdempotencyCompleted  = "completed"
+)
+
+// IdempotencyRecord 一个 Idempotency-Key 对应的请求和响应，重试时直接返回保存的响应
+type IdempotencyRecord struct {
+	ID          string    `bson:"_id" json:"id"` // 调用方 + Idempotency-Key
+	RequestHash string    `bson:"requestHash" json:"requestHash"`
+	Method      string    `bson:"method" json:"method"`
+	Path        string    `bson:"path" json:"path"`
+	State       string    `bson:"state" json:"state"`
+	StatusCode  int       `bson:"statusCode,omitempty" json:"statusCode,omitempty"`
+	ContentType string    `bson:"contentType,omitempty" json:"contentType,omitempty"`
+	Body        []byte    `bson:"body,omitempty" json:"-"`
+	LockedUntil time.Time `bson:"lockedUntil" json:"lockedUntil"` // 处理中的请求超过这个时间认为已经中断，重试可以接手
+	ExpiresAt   time.Time `bson:"expiresAt" json:"expiresAt"`     // TTL 索引按这个时间删除
+	CreatedAt   time.Time `bson:"createdAt" json:"createdAt"`
+}
@@ -4,44 +4,20 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
-	"strconv"
 	"sync"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
-	"github.com/joho/godotenv"
+	"novel-resource-management/config"
 )
 
-// MongoDBConfig MongoDB连接配置
-type MongoDBConfig struct {
-	URI            string
-	Database       string
-	Timeout        time.Duration
-	MaxPoolSize    uint64
-	MinPoolSize    uint64
-	MaxConnIdleTTL time.Duration
-}
-
-// DefaultMongoDBConfig 默认MongoDB配置
-func DefaultMongoDBConfig() *MongoDBConfig {
-	return &MongoDBConfig{
-		URI:            "mongodb://localhost:27017",
-		Database:       "novel",
-		Timeout:        10 * time.Second,
-		MaxPoolSize:    10,
-		MinPoolSize:    2,
-		MaxConnIdleTTL: 30 * time.Minute,
-	}
-}
-
 // MongoDBInstance MongoDB单例实例
 type MongoDBInstance struct {
 	client   *mongo.Client
 	database *mongo.Database
-	config   *MongoDBConfig
+	config   config.MongoDBConfig
 	mu       sync.RWMutex
 }
 
@@ -62,64 +38,30 @@ var (
 	mongoOnce     sync.Once
 )
 
-// loadMongoConfig 从环境变量加载配置
-func loadMongoConfig() *MongoDBConfig {
-	// 尝试加载 .env 文件
-	if err := godotenv.Load(); err != nil {
-		log.Printf("未找到 .env 文件，使用系统环境变量: %v", err)
-	}
-
-	config := DefaultMongoDBConfig()
-
-	// 从环境变量读取配置
-	if uri := os.Getenv("MONGODB_URI"); uri != "" {
-		log.Printf("从环境变量读取到MONGODB_URI: %s", uri)
-		config.URI = uri
-	} else {
-		log.Printf("环境变量MONGODB_URI为空，使用默认值: %s", config.URI)
-	}
-
-	if database := os.Getenv("MONGODB_DATABASE"); database != "" {
-		config.Database = database
-	}
-
-	if timeout := os.Getenv("MONGODB_TIMEOUT"); timeout != "" {
-		if duration, err := time.ParseDuration(timeout); err == nil {
-			config.Timeout = duration
-		}
-	}
-
-	if maxPool := os.Getenv("MONGODB_MAX_POOL_SIZE"); maxPool != "" {
-		if size, err := strconv.ParseUint(maxPool, 10, 64); err == nil {
-			config.MaxPoolSize = size
-		}
-	}
-
-	if minPool := os.Getenv("MONGODB_MIN_POOL_SIZE"); minPool != "" {
-		if size, err := strconv.ParseUint(minPool, 10, 64); err == nil {
-			config.MinPoolSize = size
-		}
-	}
-
-	if idleTTL := os.Getenv("MONGODB_MAX_CONN_IDLE_TTL"); idleTTL != "" {
-		if duration, err := time.ParseDuration(idleTTL); err == nil {
-			config.MaxConnIdleTTL = duration
-		}
-	}
-
-	return config
+// Init 按配置连接 MongoDB，main 在创建服务之前调用，之后 GetMongoInstance 返回这个连接
+func Init(cfg config.MongoDBConfig) error {
+	var err error
+	mongoOnce.Do(func() {
+		mongoInstance = &MongoDBInstance{config: cfg}
+		err = mongoInstance.Connect()
+	})
+	return err
 }
 
-// GetMongoInstance 获取MongoDB单例实例（自动初始化）
+// GetMongoInstance 获取MongoDB单例实例
+// 没有调用过 Init 时（比如单独运行的测试脚本）按 config.Load() 的配置自动初始化
 func GetMongoInstance() *MongoDBInstance {
 	//sync.Once的读方法，内置一个匿名函数
 	mongoOnce.Do(func() {
 		// 加载配置
-		config := loadMongoConfig()
+		cfg, err := config.Load()
+		if err != nil {
+			log.Fatalf("加载配置失败: %v", err)
+		}
 
 		// 创建实例
 		mongoInstance = &MongoDBInstance{
-			config: config,
+			config: cfg.MongoDB,
 		}
 
 		// 自动连接
@@ -128,20 +70,11 @@ func GetMongoInstance() *MongoDBInstance {
 			log.Fatalf("MongoDB自动连接失败: %v", err)
 		}
 
-		log.Printf("✅ MongoDB自动连接成功! 数据库: %s", config.Database)
+		log.Printf("✅ MongoDB自动连接成功! 数据库: %s", cfg.MongoDB.Database)
 	})
 	return mongoInstance
 }
 
-// WithConfig 设置配置
-func (m *MongoDBInstance) WithConfig(config *MongoDBConfig) *MongoDBInstance {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	m.config = config
-	return m
-}
-
 // Connect 连接到MongoDB
 func (m *MongoDBInstance) Connect() error {
 	m.mu.Lock()
@@ -155,12 +88,13 @@ func (m *MongoDBInstance) Connect() error {
 	clientOptions := options.Client().ApplyURI(m.config.URI)
 	clientOptions.SetMaxPoolSize(m.config.MaxPoolSize)
 	clientOptions.SetMinPoolSize(m.config.MinPoolSize)
-	clientOptions.SetMaxConnIdleTime(m.config.MaxConnIdleTTL)
-	clientOptions.SetConnectTimeout(m.config.Timeout)
-	clientOptions.SetServerSelectionTimeout(m.config.Timeout)
+	clientOptions.SetMaxConnIdleTime(m.config.MaxConnIdleTTL.Duration)
+	clientOptions.SetConnectTimeout(m.config.Timeout.Duration)
+	clientOptions.SetServerSelectionTimeout(m.config.Timeout.Duration)
+	clientOptions.SetMonitor(commandMonitor())
 
 	// 连接到MongoDB
-	ctx, cancel := context.WithTimeout(context.Background(), m.config.Timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), m.config.Timeout.Duration)
 	defer cancel()
 
 	// 对于单节点连接，禁用副本集发现
@@ -193,7 +127,7 @@ func (m *MongoDBInstance) Disconnect() error {
 		return nil
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), m.config.Timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), m.config.Timeout.Duration)
 	defer cancel()
 
 	err := m.client.Disconnect(ctx)
@@ -253,6 +187,17 @@ func (m *MongoDBInstance) IsConnected() bool {
 	return err == nil
 }
 
+// Ping 检查 MongoDB 是否可用，和 IsConnected 不同，它返回具体的错误，超时由调用方的 ctx 控制
+func (m *MongoDBInstance) Ping(ctx context.Context) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.client == nil {
+		return fmt.Errorf("MongoDB client is not connected")
+	}
+	return m.client.Ping(ctx, nil)
+}
+
 // GetStats 获取连接统计信息，这个是一个很有意思的使用
 func (m *MongoDBInstance) GetStats() map[string]interface{} {
 	m.mu.RLock()
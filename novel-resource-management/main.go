@@ -10,21 +10,47 @@ import(
 
 	"github.com/hyperledger/fabric-gateway/pkg/client"
 	"github.com/hyperledger/fabric-gateway/pkg/hash"
+	"google.golang.org/grpc"
+	"novel-resource-management/config"
+	"novel-resource-management/database"
 	"novel-resource-management/network"
 	"novel-resource-management/api"
 	"novel-resource-management/service"
+	"novel-resource-management/tracing"
 )
 
 
 func main(){
-	clientConnection,err := network.NewGrpcConnection()
-	if err != nil{
+	// 配置：默认值 <- 配置文件（CONFIG_FILE 或 config/app.<APP_ENV>.yaml）<- 环境变量，校验不通过直接退出
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	source := cfg.Source
+	if source == "" {
+		source = "defaults + environment"
+	}
+	log.Printf("⚙️ 环境 %s，配置来源 %s\n%s", cfg.Environment, source, cfg)
+
+	// 链路追踪，exporter 由配置 tracing.exporter 决定，要在创建服务之前初始化
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to init tracing: %v", err)
+	}
+
+	// MongoDB 读模型，服务创建时就会用到
+	if err := database.Init(cfg.MongoDB); err != nil {
+		log.Fatalf("Failed to connect to MongoDB: %v", err)
+	}
+
+	clientConnection, err := network.NewGrpcConnection(cfg.Fabric)
+	if err != nil {
 		log.Fatalf("Failed to create gRPC connection: %v", err)
 	}
 	defer clientConnection.Close()
 
-	id := network.NewIdentity()
-	sign := network.NewSign()
+	id := network.NewIdentity(cfg.Fabric)
+	sign := network.NewSign(cfg.Fabric)
 
 	// INSERT_YOUR_CODE
 	// 这里的gateWay（其实应该叫gateway，变量名建议统一）是 *client.Gateway 类型的指针，代表 Fabric Gateway 客户端的连接对象，不是地址字符串。
@@ -59,10 +85,11 @@ func main(){
 			   你的交易被排序后，会入账并要等 peer 节点确认提交。
 			   这个阶段可能等得最久，因为涉及区块打包、排序网络广播等，所以时间拉长到 2 分钟。
 		*/
-		client.WithEvaluateTimeout(15*time.Second),
-		client.WithEndorseTimeout(30*time.Second),
-		client.WithSubmitTimeout(15*time.Second),
-		client.WithCommitStatusTimeout(2*time.Minute),
+		// 各阶段的超时在配置 fabric.*_timeout 里调整
+		client.WithEvaluateTimeout(cfg.Fabric.EvaluateTimeout.Duration),
+		client.WithEndorseTimeout(cfg.Fabric.EndorseTimeout.Duration),
+		client.WithSubmitTimeout(cfg.Fabric.SubmitTimeout.Duration),
+		client.WithCommitStatusTimeout(cfg.Fabric.CommitStatusTimeout.Duration),
 	)
 	
 	if err != nil {
@@ -70,8 +97,17 @@ func main(){
 	}
 	defer gateWay.Close()
 
+	// AdminContract 的交易用平台管理员身份，和服务身份共用同一个 gRPC 连接
+	adminGateway := connectAdminGateway(cfg, clientConnection, gateWay)
+	if adminGateway != gateWay {
+		defer adminGateway.Close()
+	}
+
+	// 配置里的通道和链码，所有服务都从它获取合约
+	chaincode := service.NewChaincode(gateWay, adminGateway, cfg.Fabric)
+
 	// 创建事件服务并启动事件监听
-	eventService := service.NewEventService(gateWay)
+	eventService := service.NewEventService(chaincode)
 	ctx := context.Background()
 
 	// 启动事件监听（在后台goroutine中运行），如果不启动服务是没有意义的
@@ -85,11 +121,7 @@ func main(){
 	// 启动时自动初始化链码（从MongoDB同步数据）
 	go func() {
 		log.Println("🔄 开始从MongoDB初始化链码...")
-		chaincodeService, err := service.NewChaincodeMigrationService(gateWay)
-		if err != nil {
-			log.Printf("❌ 创建链码迁移服务失败: %v", err)
-			return
-		}
+		chaincodeService := service.NewChaincodeMigrationService(chaincode)
 
 		// 等待3秒，确保MongoDB连接稳定
 		time.Sleep(3 * time.Second)
@@ -115,7 +147,13 @@ func main(){
 		}
 	}()
 
-	server := api.NewServer(gateWay)
+	// 定时对 MongoDB 读模型做快照并把 Merkle 根锚定到账本
+	go service.NewAuditService(chaincode, cfg.Audit.RetainSnapshots).StartSnapshotJob(ctx, cfg.Audit.SnapshotInterval.Duration)
+
+	// 定时把过期的积分预留退回用户，不用等用户下一次操作
+	go service.NewUserCreditService(chaincode).StartHoldExpiryJob(ctx, cfg.Holds.ExpiryInterval.Duration)
+
+	server := api.NewServer(cfg, chaincode, clientConnection)
 
 	//handle gracefully shutdown
 	sigChan := make(chan os.Signal,1)
@@ -133,7 +171,11 @@ func main(){
 	go func() {
 		log.Println("🚀 Starting Fabric Gateway API Server...")
 		log.Println("📋 Available endpoints:")
+		log.Println("  POST   /api/v1/auth/login")
+		log.Println("  POST   /api/v1/auth/refresh")
+		log.Println("  POST   /api/v1/auth/logout")
 		log.Println("  GET    /api/v1/novels")
+		log.Println("  GET    /api/v1/novels/search")
 		log.Println("  GET    /api/v1/novels/:id")
 		log.Println("  POST   /api/v1/novels")
 		log.Println("  PUT    /api/v1/novels/:id")
@@ -145,10 +187,46 @@ func main(){
 		log.Println("  DELETE /api/v1/users/:id")
 		log.Println("  POST   /api/v1/users/recharge       <- 充值接口")
 		log.Println("  POST   /api/v1/users/:id/consume-token")
+		log.Println("  POST   /api/v1/users/:id/holds")
+		log.Println("  GET    /api/v1/users/:id/holds")
+		log.Println("  POST   /api/v1/users/:id/holds/release-expired")
+		log.Println("  GET    /api/v1/holds/:holdId")
+		log.Println("  POST   /api/v1/holds/:holdId/capture")
+		log.Println("  POST   /api/v1/holds/:holdId/release")
+		log.Println("  GET    /api/v1/users/:id/limits")
+		log.Println("  PUT    /api/v1/users/:id/limits")
+		log.Println("  DELETE /api/v1/users/:id/limits")
+		log.Println("  PUT    /api/v1/limits/default")
+		log.Println("  GET    /api/v1/packages")
+		log.Println("  GET    /api/v1/packages/:goodId")
+		log.Println("  POST   /api/v1/packages")
+		log.Println("  PUT    /api/v1/packages/:goodId")
+		log.Println("  DELETE /api/v1/packages/:goodId")
+		log.Println("  GET    /api/v1/pricing")
+		log.Println("  GET    /api/v1/pricing/schedule")
+		log.Println("  GET    /api/v1/endorsement/config")
+		log.Println("  PUT    /api/v1/endorsement/config")
+		log.Println("  GET    /api/v1/endorsement/policies/:entityType/:id")
+		log.Println("  PUT    /api/v1/endorsement/policies/:entityType/:id")
+		log.Println("  GET    /api/v1/analytics/novels/:id")
+		log.Println("  GET    /api/v1/analytics/authors/:author")
+		log.Println("  GET    /api/v1/analytics/leaderboard")
+		log.Println("  POST   /api/v1/analytics/rebuild")
+		log.Println("  POST   /api/v1/audit/snapshots")
+		log.Println("  GET    /api/v1/audit/proof/:collection/:id")
 		log.Println("  GET    /api/v1/events/listen")
+		log.Println("  GET    /api/v1/transactions/:txId")
+		log.Println("  GET    /api/v1/apikeys")
+		log.Println("  POST   /api/v1/apikeys")
+		log.Println("  DELETE /api/v1/apikeys/:keyId")
+		log.Println("  POST   /api/v1/apikeys/:keyId/rotate")
+		log.Println("  GET    /openapi.json")
+		log.Println("  GET    /metrics")
 		log.Println("  GET    /health")
+		log.Println("  GET    /livez")
+		log.Println("  GET    /readyz")
 
-		if err := server.Start(":8080"); err != nil {
+		if err := server.Start(cfg.Server.Addr()); err != nil {
 			log.Fatalf("Failed to start server: %v", err)
 		}
 	}()
@@ -159,13 +237,50 @@ func main(){
 	log.Println("🛑 Shutting down gracefully...")
 
 	//防止泄漏
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout.Duration)
 	defer cancel()
 
 	// 调用Shutdown方法清理gin资源
 	if err := server.Shutdown(ctx); err != nil {
 		log.Printf("Warning: graceful shutdown failed: %v", err)
 	}
+	// 把还没导出的 span 发出去
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Warning: flush traces failed: %v", err)
+	}
 
 	log.Println("✅ Server stopped")
-}
\ No newline at end of file
+}
+
+// connectAdminGateway 用 fabric.admin_sign_cert_file 的身份再连一个 gateway
+// 没有配置管理员身份，或者 dev 环境读不到证书时退回服务身份，管理类交易（价格表、额度、背书配置、快照锚定、迁移）会被链码拒绝
+func connectAdminGateway(cfg *config.Config, conn *grpc.ClientConn, fallback *client.Gateway) *client.Gateway {
+	if cfg.Fabric.AdminSignCertFile == "" {
+		log.Printf("⚠️ 没有配置 fabric.admin_sign_cert_file，管理类交易使用服务身份，链码会拒绝")
+		return fallback
+	}
+	adminID, adminSign, err := network.NewAdminIdentity(cfg.Fabric)
+	if err != nil {
+		if cfg.Environment != config.EnvDev {
+			log.Fatalf("Failed to load admin identity: %v", err)
+		}
+		log.Printf("⚠️ 读取平台管理员身份失败，管理类交易使用服务身份（运行 scripts/enroll-platform-admin.sh 登记）: %v", err)
+		return fallback
+	}
+
+	adminGateway, err := client.Connect(
+		adminID,
+		client.WithSign(adminSign),
+		client.WithHash(hash.SHA256),
+		client.WithClientConnection(conn),
+		client.WithEvaluateTimeout(cfg.Fabric.EvaluateTimeout.Duration),
+		client.WithEndorseTimeout(cfg.Fabric.EndorseTimeout.Duration),
+		client.WithSubmitTimeout(cfg.Fabric.SubmitTimeout.Duration),
+		client.WithCommitStatusTimeout(cfg.Fabric.CommitStatusTimeout.Duration),
+	)
+	if err != nil {
+		log.Fatalf("Failed to connect admin gateway: %v", err)
+	}
+	log.Printf("🔑 管理类交易使用平台管理员身份 %s", cfg.Fabric.AdminSignCertFile)
+	return adminGateway
+}
@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Prometheus 指标，通过 GET /metrics 抓取
+// 标签只用路由模板、链码函数名这类取值有限的字段，不能放用户ID、订单号，否则时间序列会无限增长
+
+const namespace = "novel"
+
+var (
+	// HTTPRequestDuration 按路由模板（/api/v1/novels/:id）统计，没有匹配到路由的请求 route 为 unmatched
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// FabricDuration phase 是 evaluate、endorse、submit、commit；code 是 gRPC 状态码，commit 阶段是交易验证码（VALID、MVCC_READ_CONFLICT 等）
+	FabricDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "fabric_duration_seconds",
+		Help:      "Fabric Gateway call latency by phase, chaincode function and outcome code.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"phase", "function", "code"})
+
+	// FabricConflicts commit 阶段的 MVCC_READ_CONFLICT、PHANTOM_READ_CONFLICT，包括之后重试成功的
+	FabricConflicts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fabric_mvcc_conflicts_total",
+		Help:      "Transactions invalidated by read conflicts at commit.",
+	}, []string{"function", "code"})
+
+	// FabricSubmitRetries 提交交易遇到读写冲突后的重试次数
+	FabricSubmitRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fabric_submit_retries_total",
+		Help:      "Submit retries after read conflicts by chaincode function.",
+	}, []string{"function"})
+
+	// FabricSubmitOutcomes 一次提交调用（包括所有重试）的最终结果，outcome 见 Submit* 常量
+	FabricSubmitOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fabric_submit_outcomes_total",
+		Help:      "Submit calls by chaincode function and final outcome, including retries.",
+	}, []string{"function", "outcome"})
+
+	// EventLastBlock 事件监听器收到的最后一个区块
+	EventLastBlock = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "event_listener_last_block",
+		Help:      "Block number of the last chaincode event received.",
+	})
+
+	// EventLastReceived 最后一次收到事件的时间，time() - 它就是监听器多久没收到事件
+	EventLastReceived = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "event_listener_last_received_timestamp_seconds",
+		Help:      "Unix time the last chaincode event was received.",
+	})
+
+	// EventLag 收到事件的时间减去交易时间戳，旧版没有时间戳的事件不统计
+	EventLag = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "event_listener_lag_seconds",
+		Help:      "Delay between the transaction timestamp and receiving its chaincode event.",
+		Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300, 900},
+	})
+
+	// MongoDuration MongoDB 命令耗时，由 database 包的 CommandMonitor 记录
+	MongoDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mongo_command_duration_seconds",
+		Help:      "MongoDB command latency by command name and outcome.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"command", "outcome"})
+
+	// MongoProjectionFailures 链码事件没能同步到 MongoDB 读模型的次数，event 是事件类型
+	MongoProjectionFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mongo_projection_failures_total",
+		Help:      "Chaincode events that failed to project into the MongoDB read model.",
+	}, []string{"event"})
+
+	// RechargeOutcomes 充值回调的处理结果
+	RechargeOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "recharge_outcomes_total",
+		Help:      "Recharge callbacks by outcome status.",
+	}, []string{"status"})
+)
+
+// 充值结果，RechargeOutcomes 的 status 标签
+const (
+	RechargeSuccess      = "success"
+	RechargeReplayed     = "replayed"     // 订单之前已经成功，直接返回原结果
+	RechargeInProgress   = "in_progress"  // 同一订单正在处理
+	RechargeRejected     = "rejected"     // 套餐不存在、价格不一致或者用户不存在
+	RechargeFailed       = "failed"       // 上链或者写充值记录失败
+	RechargeUnauthorized = "unauthorized" // 签名或者 API key 校验不通过
+)
+
+// 提交调用的最终结果，FabricSubmitOutcomes 的 outcome 标签
+const (
+	SubmitSucceeded           = "succeeded"
+	SubmitSucceededAfterRetry = "succeeded_after_retry" // 冲突后重试成功
+	SubmitExhausted           = "exhausted"             // 重试次数或总超时用完，仍然冲突
+	SubmitFailed              = "failed"                // 其他错误，不重试
+)
+
+// ObserveFabric 记录一次 Fabric 调用，code 为空时按 err 取 gRPC 状态码
+func ObserveFabric(phase, function, code string, start time.Time, err error) {
+	if code == "" {
+		code = GRPCCode(err)
+	}
+	FabricDuration.WithLabelValues(phase, function, code).Observe(time.Since(start).Seconds())
+}
+
+// GRPCCode err 的 gRPC 状态码，Fabric Gateway 的错误都带 gRPC 状态
+func GRPCCode(err error) string {
+	if err == nil {
+		return codes.OK.String()
+	}
+	if s, ok := status.FromError(err); ok {
+		return s.Code().String()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return codes.DeadlineExceeded.String()
+	}
+	return codes.Unknown.String()
+}
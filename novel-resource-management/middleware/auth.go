@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 认证中间件把调用方的身份放进 gin.Context，后面的 handler 用 CurrentUserID、CurrentRole 读取
+// 登录用户用 Authorization: Bearer <accessToken>，机器调用方用 Authorization: ApiKey <key>
+const (
+	ContextUserID   = "userId"
+	ContextRole     = "role"
+	ContextAuthType = "authType"
+	ContextScopes   = "scopes"
+)
+
+// 认证方式
+const (
+	AuthTypeJWT    = "jwt"
+	AuthTypeAPIKey = "apikey"
+)
+
+// apiKeyPrincipalPrefix API Key 调用方在 ContextUserID 里的前缀，和用户ID区分开
+const apiKeyPrincipalPrefix = "apikey:"
+
+// TokenVerifier 校验访问令牌，返回用户ID和角色
+type TokenVerifier func(ctx context.Context, token string) (userID string, role string, err error)
+
+// APIKeyVerifier 校验 API Key，返回 keyId 和 scopes
+type APIKeyVerifier func(ctx context.Context, key string) (keyID string, scopes []string, err error)
+
+// Authenticate 要求请求带访问令牌或 API Key，校验失败返回 401
+func Authenticate(tokens TokenVerifier, keys APIKeyVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scheme, credential := authorization(c)
+		var err error
+		switch {
+		case strings.EqualFold(scheme, "Bearer") && credential != "":
+			var userID, role string
+			if userID, role, err = tokens(c.Request.Context(), credential); err == nil {
+				c.Set(ContextUserID, userID)
+				c.Set(ContextRole, role)
+				c.Set(ContextAuthType, AuthTypeJWT)
+			}
+		case strings.EqualFold(scheme, "ApiKey") && credential != "":
+			err = setAPIKey(c, keys, credential)
+		default:
+			unauthorized(c, "missing bearer token or api key")
+			return
+		}
+		if err != nil {
+			unauthorized(c, err.Error())
+			return
+		}
+		c.Next()
+	}
+}
+
+// OptionalAPIKey 请求带了 API Key 时校验它，没带时交给 handler 用其他方式认证（如充值回调的 HMAC 签名）
+func OptionalAPIKey(keys APIKeyVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scheme, credential := authorization(c)
+		if !strings.EqualFold(scheme, "ApiKey") {
+			c.Next()
+			return
+		}
+		if err := setAPIKey(c, keys, credential); err != nil {
+			unauthorized(c, err.Error())
+			return
+		}
+		c.Next()
+	}
+}
+
+func setAPIKey(c *gin.Context, keys APIKeyVerifier, credential string) error {
+	keyID, scopes, err := keys(c.Request.Context(), credential)
+	if err != nil {
+		return err
+	}
+	c.Set(ContextUserID, apiKeyPrincipalPrefix+keyID)
+	c.Set(ContextAuthType, AuthTypeAPIKey)
+	c.Set(ContextScopes, scopes)
+	return nil
+}
+
+func authorization(c *gin.Context) (string, string) {
+	scheme, credential, _ := strings.Cut(c.GetHeader("Authorization"), " ")
+	return scheme, strings.TrimSpace(credential)
+}
+
+func unauthorized(c *gin.Context, message string) {
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"error": message,
+		"code":  "UNAUTHORIZED",
+	})
+	c.Abort()
+}
+
+// BearerToken 读取 Authorization 头里的 Bearer 令牌
+func BearerToken(c *gin.Context) (string, bool) {
+	scheme, token := authorization(c)
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return token, token != ""
+}
+
+// CurrentUserID 当前登录的用户ID，API Key 调用方是 apikey:<keyId>
+func CurrentUserID(c *gin.Context) string {
+	return c.GetString(ContextUserID)
+}
+
+// CurrentRole 当前登录用户的角色，API Key 调用方没有角色
+func CurrentRole(c *gin.Context) string {
+	return c.GetString(ContextRole)
+}
+
+// IsAPIKey 当前调用方是不是用 API Key 认证的
+func IsAPIKey(c *gin.Context) bool {
+	return c.GetString(ContextAuthType) == AuthTypeAPIKey
+}
+
+// HasScope 当前 API Key 是否带有 scope
+func HasScope(c *gin.Context, scope string) bool {
+	return IsAPIKey(c) && slices.Contains(c.GetStringSlice(ContextScopes), scope)
+}
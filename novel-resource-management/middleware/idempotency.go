@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"novel-resource-management/database"
+)
+
+// 幂等键：POST、PUT、DELETE 请求带 Idempotency-Key 头时，同一个调用方用同一个 key 重试只会执行一次
+// 第一次请求执行完保存状态码和响应体，之后的重试直接返回保存的响应，并带 Idempotent-Replayed: true
+// 同一个 key 用在不同的请求体上返回 409；第一次请求还在处理时，重复请求等它完成后返回同样的响应
+// 5xx 响应不保存，调用方可以用同一个 key 重试
+// RSA 加密的请求按密文计算哈希，重试时要发送原来的密文，不能重新加密
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	idempotencyWaitTimeout    = 30 * time.Second
+	idempotencyPollInterval   = 200 * time.Millisecond
+	idempotencyInProgressCode = "IDEMPOTENCY_IN_PROGRESS"
+)
+
+// IdempotencyStore 保存幂等记录，由 service.IdempotencyService 实现
+type IdempotencyStore interface {
+	Begin(ctx context.Context, key, requestHash, method, path string) (*database.IdempotencyRecord, bool, error)
+	Get(ctx context.Context, key string) (*database.IdempotencyRecord, error)
+	Complete(ctx context.Context, key string, statusCode int, contentType string, body []byte) error
+	Release(ctx context.Context, key string) error
+}
+
+// Idempotency 返回幂等键中间件，要放在认证之后，key 按调用方隔离
+func Idempotency(store IdempotencyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.Request.Method
+		idempotencyKey := c.GetHeader(IdempotencyKeyHeader)
+		if idempotencyKey == "" || (method != http.MethodPost && method != http.MethodPut && method != http.MethodDelete) {
+			c.Next()
+			return
+		}
+		if len(idempotencyKey) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Idempotency-Key is too long",
+			})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "读取请求体失败: " + err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		key := idempotencyPrincipal(c) + "|" + idempotencyKey
+		requestHash := hashRequest(method, c.Request.URL.RequestURI(), body)
+		record, acquired, err := waitForIdempotencyKey(c.Request.Context(), store, key, requestHash, method, c.Request.URL.Path)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		if !acquired {
+			replayIdempotent(c, record, requestHash)
+			return
+		}
+
+		// 客户端断开后也要把结果保存下来，不能用请求的 context
+		storeCtx := context.WithoutCancel(c.Request.Context())
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		completed := false
+		defer func() {
+			// handler panic 或者没有保存响应时释放 key，调用方可以重试
+			if !completed {
+				if err := store.Release(storeCtx, key); err != nil {
+					log.Printf("⚠️ 释放 Idempotency-Key %s 失败: %v", key, err)
+				}
+			}
+		}()
+
+		c.Next()
+
+		status := writer.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+		if err := store.Complete(storeCtx, key, status, writer.Header().Get("Content-Type"), writer.body.Bytes()); err != nil {
+			log.Printf("⚠️ 保存 Idempotency-Key %s 的响应失败: %v", key, err)
+			return
+		}
+		completed = true
+	}
+}
+
+// waitForIdempotencyKey 占用 key；key 的第一次请求还在处理时轮询等待，直到它完成、被释放或者等待超时
+func waitForIdempotencyKey(ctx context.Context, store IdempotencyStore, key, requestHash, method, path string) (*database.IdempotencyRecord, bool, error) {
+	record, acquired, err := store.Begin(ctx, key, requestHash, method, path)
+	deadline := time.Now().Add(idempotencyWaitTimeout)
+	for err == nil && !acquired && record != nil &&
+		record.State == database.IdempotencyProcessing && record.RequestHash == requestHash && time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		case <-time.After(idempotencyPollInterval):
+		}
+		record, err = store.Get(ctx, key)
+		if err == nil && record == nil {
+			// 第一次请求失败释放了 key，由这个请求重新执行
+			record, acquired, err = store.Begin(ctx, key, requestHash, method, path)
+		}
+	}
+	return record, acquired, err
+}
+
+// replayIdempotent key 已经被占用时的响应：请求体不同返回 409，已完成的请求返回保存的响应
+func replayIdempotent(c *gin.Context, record *database.IdempotencyRecord, requestHash string) {
+	switch {
+	case record == nil:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Idempotency-Key was released, please retry",
+			"code":  idempotencyInProgressCode,
+		})
+	case record.RequestHash != requestHash:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Idempotency-Key has already been used with a different request",
+			"code":  "IDEMPOTENCY_KEY_REUSED",
+		})
+	case record.State != database.IdempotencyCompleted:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "a request with this Idempotency-Key is still being processed",
+			"code":  idempotencyInProgressCode,
+		})
+	default:
+		c.Header(IdempotentReplayedHeader, "true")
+		c.Data(record.StatusCode, record.ContentType, record.Body)
+	}
+	c.Abort()
+}
+
+// idempotencyPrincipal 幂等键按调用方隔离，没有认证的请求按 IP 隔离
+func idempotencyPrincipal(c *gin.Context) string {
+	if userID := CurrentUserID(c); userID != "" {
+		return userID
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// hashRequest 请求的 method、路径和请求体的 SHA-256，用来判断 key 是否被用在了不同的请求上
+func hashRequest(method, uri string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + uri + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// recordingWriter 写响应的同时保存一份响应体
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
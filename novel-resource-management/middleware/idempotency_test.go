@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"novel-resource-management/database"
+)
+
+// memoryIdempotencyStore 测试用的内存存储，行为和 service.IdempotencyService 一致
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*database.IdempotencyRecord
+	// beginReleased 为 true 时 Begin 模拟 key 刚好被释放：没有占用成功，也查不到记录
+	beginReleased bool
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{records: map[string]*database.IdempotencyRecord{}}
+}
+
+func (s *memoryIdempotencyStore) Begin(_ context.Context, key, requestHash, method, path string) (*database.IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.beginReleased {
+		return nil, false, nil
+	}
+	if record, ok := s.records[key]; ok {
+		copied := *record
+		return &copied, false, nil
+	}
+	s.records[key] = &database.IdempotencyRecord{ID: key, RequestHash: requestHash, Method: method, Path: path, State: database.IdempotencyProcessing}
+	return nil, true, nil
+}
+
+func (s *memoryIdempotencyStore) Get(_ context.Context, key string) (*database.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[key]
+	if !ok {
+		return nil, nil
+	}
+	copied := *record
+	return &copied, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(_ context.Context, key string, statusCode int, contentType string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := s.records[key]
+	record.State = database.IdempotencyCompleted
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.Body = append([]byte(nil), body...)
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func TestIdempotency(t *testing.T) {
+	type request struct {
+		method string
+		key    string
+		body   string
+	}
+	type expected struct {
+		status   int
+		body     string
+		replayed bool
+	}
+	tests := []struct {
+		name string
+		// handlerStatus 每次调用 handler 返回的状态码，不够时用 201
+		handlerStatus []int
+		// existing 预先存在的 k1 记录，模拟另一个请求正在处理
+		existing      *database.IdempotencyRecord
+		beginReleased bool
+		requests      []request
+		expected      []expected
+		calls         int
+	}{
+		{
+			name:     "replays the stored response",
+			requests: []request{{method: "POST", key: "k1", body: `{"a":1}`}, {method: "POST", key: "k1", body: `{"a":1}`}},
+			expected: []expected{{status: http.StatusCreated, body: `{"call":1}`}, {status: http.StatusCreated, body: `{"call":1}`, replayed: true}},
+			calls:    1,
+		},
+		{
+			name:     "different body with the same key is a conflict",
+			requests: []request{{method: "POST", key: "k1", body: `{"a":1}`}, {method: "POST", key: "k1", body: `{"a":2}`}},
+			expected: []expected{{status: http.StatusCreated, body: `{"call":1}`}, {status: http.StatusConflict, body: "IDEMPOTENCY_KEY_REUSED"}},
+			calls:    1,
+		},
+		{
+			name:     "different keys both execute",
+			requests: []request{{method: "PUT", key: "k1", body: `{}`}, {method: "PUT", key: "k2", body: `{}`}},
+			expected: []expected{{status: http.StatusCreated, body: `{"call":1}`}, {status: http.StatusCreated, body: `{"call":2}`}},
+			calls:    2,
+		},
+		{
+			name:          "5xx is not stored and can be retried",
+			handlerStatus: []int{http.StatusBadGateway},
+			requests:      []request{{method: "POST", key: "k1", body: `{}`}, {method: "POST", key: "k1", body: `{}`}},
+			expected:      []expected{{status: http.StatusBadGateway, body: `{"call":1}`}, {status: http.StatusCreated, body: `{"call":2}`}},
+			calls:         2,
+		},
+		{
+			name:          "4xx is stored",
+			handlerStatus: []int{http.StatusBadRequest},
+			requests:      []request{{method: "DELETE", key: "k1"}, {method: "DELETE", key: "k1"}},
+			expected:      []expected{{status: http.StatusBadRequest, body: `{"call":1}`}, {status: http.StatusBadRequest, body: `{"call":1}`, replayed: true}},
+			calls:         1,
+		},
+		{
+			name:     "processing with a different body is a conflict without waiting",
+			existing: &database.IdempotencyRecord{RequestHash: "other", State: database.IdempotencyProcessing},
+			requests: []request{{method: "POST", key: "k1", body: `{}`}},
+			expected: []expected{{status: http.StatusConflict, body: "IDEMPOTENCY_KEY_REUSED"}},
+		},
+		{
+			name:          "released key asks the caller to retry",
+			beginReleased: true,
+			requests:      []request{{method: "POST", key: "k1", body: `{}`}},
+			expected:      []expected{{status: http.StatusConflict, body: "IDEMPOTENCY_IN_PROGRESS"}},
+		},
+		{
+			name:     "requests without a key are not deduplicated",
+			requests: []request{{method: "POST", body: `{}`}, {method: "POST", body: `{}`}},
+			expected: []expected{{status: http.StatusCreated, body: `{"call":1}`}, {status: http.StatusCreated, body: `{"call":2}`}},
+			calls:    2,
+		},
+		{
+			name:     "GET ignores the key",
+			requests: []request{{method: "GET", key: "k1"}, {method: "GET", key: "k1"}},
+			expected: []expected{{status: http.StatusCreated, body: `{"call":1}`}, {status: http.StatusCreated, body: `{"call":2}`}},
+			calls:    2,
+		},
+		{
+			name:     "key too long",
+			requests: []request{{method: "POST", key: strings.Repeat("k", maxIdempotencyKeyLength+1), body: `{}`}},
+			expected: []expected{{status: http.StatusBadRequest, body: "Idempotency-Key is too long"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryIdempotencyStore()
+			store.beginReleased = tt.beginReleased
+			if tt.existing != nil {
+				record := *tt.existing
+				record.ID = "ip:192.0.2.1|k1"
+				store.records[record.ID] = &record
+			}
+
+			calls := 0
+			router := gin.New()
+			handler := func(c *gin.Context) {
+				calls++
+				status := http.StatusCreated
+				if calls <= len(tt.handlerStatus) {
+					status = tt.handlerStatus[calls-1]
+				}
+				c.JSON(status, gin.H{"call": calls})
+			}
+			router.Use(Idempotency(store))
+			router.Handle("GET", "/items", handler)
+			router.Handle("POST", "/items", handler)
+			router.Handle("PUT", "/items", handler)
+			router.Handle("DELETE", "/items", handler)
+
+			for i, req := range tt.requests {
+				httpReq := httptest.NewRequest(req.method, "/items", strings.NewReader(req.body))
+				httpReq.RemoteAddr = "192.0.2.1:1234"
+				if req.key != "" {
+					httpReq.Header.Set(IdempotencyKeyHeader, req.key)
+				}
+				recorder := httptest.NewRecorder()
+				router.ServeHTTP(recorder, httpReq)
+
+				want := tt.expected[i]
+				require.Equal(t, want.status, recorder.Code, "request %d", i)
+				require.Contains(t, recorder.Body.String(), want.body, "request %d", i)
+				if want.replayed {
+					require.Equal(t, "true", recorder.Header().Get(IdempotentReplayedHeader), "request %d", i)
+				} else {
+					require.Empty(t, recorder.Header().Get(IdempotentReplayedHeader), "request %d", i)
+				}
+			}
+			require.Equal(t, tt.calls, calls)
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"novel-resource-management/metrics"
+)
+
+// Metrics 记录每个请求的耗时，按 method、路由模板和状态码分组
+// 要挂在 router 上，放在认证、限流之前，被拒绝的请求也要统计
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		// 用路由模板而不是实际路径，/api/v1/novels/:id 只有一个时间序列
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequestDuration.
+			WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
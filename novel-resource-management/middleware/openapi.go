@@ -0,0 +1,232 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+)
+
+// 按 OpenAPI 文档校验请求和响应：路由按 gin 路由模板找到文档里的 operation，/:id 对应 /{id}
+// 请求的路径参数、查询参数和请求体不合法时返回 422，details 列出每个不合法的字段
+// 响应和文档不一致只写日志，不影响调用方，用来发现文档和 handler 不同步
+// RSA 加密的请求要等 RSARequestMiddleware 解密后再校验，所以加密路由组在解密之后还要再挂一次 Validate
+
+const (
+	// contextRequestDecrypted RSARequestMiddleware 解密请求体后设置
+	contextRequestDecrypted = "requestDecrypted"
+	// contextOpenAPIValidated 请求已经校验过，同一个请求不重复校验
+	contextOpenAPIValidated = "openapiValidated"
+)
+
+// ValidationDetail 422 响应里一个不合法的字段
+type ValidationDetail struct {
+	In      string `json:"in"`              // path、query、header、body
+	Field   string `json:"field,omitempty"` // 参数名或请求体里的 JSON 路径，如 /scopes/0
+	Message string `json:"message"`
+}
+
+// OpenAPIValidator 用 OpenAPI 文档校验请求和响应
+type OpenAPIValidator struct {
+	spec    *openapi3.T
+	options *openapi3filter.Options
+}
+
+// NewOpenAPIValidator spec 需要已经通过 Validate 检查
+func NewOpenAPIValidator(spec *openapi3.T) *OpenAPIValidator {
+	return &OpenAPIValidator{
+		spec: spec,
+		options: &openapi3filter.Options{
+			MultiError: true,
+			// 认证和授权由 Authenticate、Policy 负责，这里只校验数据
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		},
+	}
+}
+
+// Validate 返回校验中间件，文档里没有的路由直接放行
+func (v *OpenAPIValidator) Validate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool(contextOpenAPIValidated) || (isEncryptedRequest(c) && !c.GetBool(contextRequestDecrypted)) {
+			c.Next()
+			return
+		}
+		route := v.route(c.Request.Method, c.FullPath())
+		if route == nil {
+			c.Next()
+			return
+		}
+		c.Set(contextOpenAPIValidated, true)
+
+		pathParams := make(map[string]string, len(c.Params))
+		for _, param := range c.Params {
+			pathParams[param.Key] = param.Value
+		}
+		input := &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    v.options,
+		}
+		if err := openapi3filter.ValidateRequest(c.Request.Context(), input); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":   "request does not match the API schema",
+				"code":    "VALIDATION_FAILED",
+				"details": validationDetails(err),
+			})
+			c.Abort()
+			return
+		}
+
+		// SSE 之类的流式响应不能缓存下来校验
+		if streamingResponse(route.Operation) {
+			c.Next()
+			return
+		}
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		response := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 writer.Status(),
+			Header:                 writer.Header(),
+			Body:                   io.NopCloser(bytes.NewReader(writer.body.Bytes())),
+			Options:                v.options,
+		}
+		if err := openapi3filter.ValidateResponse(c.Request.Context(), response); err != nil {
+			log.Printf("⚠️ 响应和 OpenAPI 文档不一致 %s %s -> %d: %v", c.Request.Method, c.FullPath(), writer.Status(), err)
+		}
+	}
+}
+
+// UndocumentedRoutes 已注册但文档里没有的路由
+func (v *OpenAPIValidator) UndocumentedRoutes(routes gin.RoutesInfo, prefix string) []string {
+	var undocumented []string
+	for _, route := range routes {
+		if strings.HasPrefix(route.Path, prefix) && v.route(route.Method, route.Path) == nil {
+			undocumented = append(undocumented, route.Method+" "+route.Path)
+		}
+	}
+	return undocumented
+}
+
+// route 按 gin 路由模板找到文档里的 operation
+func (v *OpenAPIValidator) route(method, ginPath string) *routers.Route {
+	if ginPath == "" {
+		return nil
+	}
+	path := openAPIPath(ginPath)
+	pathItem := v.spec.Paths.Value(path)
+	if pathItem == nil {
+		return nil
+	}
+	operation := pathItem.GetOperation(method)
+	if operation == nil {
+		return nil
+	}
+	return &routers.Route{
+		Spec:      v.spec,
+		Path:      path,
+		PathItem:  pathItem,
+		Method:    method,
+		Operation: operation,
+	}
+}
+
+// openAPIPath 把 gin 的 /:id、/*path 换成 OpenAPI 的 /{id}、/{path}
+func openAPIPath(ginPath string) string {
+	segments := strings.Split(ginPath, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func streamingResponse(operation *openapi3.Operation) bool {
+	ok := operation.Responses.Status(http.StatusOK)
+	return ok != nil && ok.Value != nil && ok.Value.Content.Get("text/event-stream") != nil
+}
+
+// validationDetails 把 kin-openapi 的错误展开成每个字段一条
+func validationDetails(err error) []ValidationDetail {
+	var multi openapi3.MultiError
+	if errors.As(err, &multi) {
+		var details []ValidationDetail
+		for _, e := range multi {
+			details = append(details, validationDetails(e)...)
+		}
+		return details
+	}
+
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		return []ValidationDetail{bodyDetail(schemaErr)}
+	}
+	var requestErr *openapi3filter.RequestError
+	if !errors.As(err, &requestErr) {
+		return []ValidationDetail{{In: "body", Message: err.Error()}}
+	}
+	if requestErr.Parameter != nil {
+		return []ValidationDetail{{
+			In:      requestErr.Parameter.In,
+			Field:   requestErr.Parameter.Name,
+			Message: parameterMessage(requestErr),
+		}}
+	}
+
+	var details []ValidationDetail
+	collectSchemaErrors(requestErr.Err, func(schemaErr *openapi3.SchemaError) {
+		details = append(details, bodyDetail(schemaErr))
+	})
+	if len(details) == 0 {
+		details = append(details, ValidationDetail{In: "body", Message: requestErr.Error()})
+	}
+	return details
+}
+
+func bodyDetail(schemaErr *openapi3.SchemaError) ValidationDetail {
+	return ValidationDetail{
+		In:      "body",
+		Field:   "/" + strings.Join(schemaErr.JSONPointer(), "/"),
+		Message: schemaErr.Reason,
+	}
+}
+
+// collectSchemaErrors 找出 err 里的全部 SchemaError
+func collectSchemaErrors(err error, collect func(*openapi3.SchemaError)) {
+	var multi openapi3.MultiError
+	if errors.As(err, &multi) {
+		for _, e := range multi {
+			collectSchemaErrors(e, collect)
+		}
+		return
+	}
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		collect(schemaErr)
+	}
+}
+
+func parameterMessage(requestErr *openapi3filter.RequestError) string {
+	var messages []string
+	collectSchemaErrors(requestErr.Err, func(schemaErr *openapi3.SchemaError) {
+		messages = append(messages, schemaErr.Reason)
+	})
+	if len(messages) > 0 {
+		return strings.Join(messages, "; ")
+	}
+	if requestErr.Err != nil {
+		return requestErr.Err.Error()
+	}
+	return requestErr.Reason
+}
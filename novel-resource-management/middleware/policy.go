@@ -0,0 +1,280 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// 基于角色的路由授权：策略文件声明角色继承关系和每个路由允许的角色
+// 规则按 method + gin 路由模板（如 /api/v1/novels/:id）匹配，没有匹配的规则一律拒绝
+// 规则可以指定 owner，资源所有者即使角色不够也可以访问，所有者由 OwnerResolver 查询
+// API Key 调用方没有角色，按 scopes 授权：scope 可以声明允许所有路由或某些 method，规则也可以列出允许的 scope
+
+// AnyRole 规则的 roles 里写 "*" 表示任何登录用户
+const AnyRole = "*"
+
+// PolicyRole 角色定义，inherits 的角色拥有的权限这个角色也有
+type PolicyRole struct {
+	Inherits []string `yaml:"inherits"`
+}
+
+// PolicyScope API Key 的 scope 定义，all 允许所有有规则的路由
+// methods 只允许这些 method 里对任何登录用户开放（roles 含 "*"）的路由，其他路由要在规则的 scopes 里列出
+type PolicyScope struct {
+	All     bool     `yaml:"all"`
+	Methods []string `yaml:"methods"`
+}
+
+// PolicyRule 一个路由的授权规则，method 为 "*" 时匹配所有方法
+type PolicyRule struct {
+	Method string   `yaml:"method"`
+	Path   string   `yaml:"path"`
+	Roles  []string `yaml:"roles"`
+	Owner  string   `yaml:"owner,omitempty"`  // 所有权解析器的名字，如 user、novel、hold
+	Scopes []string `yaml:"scopes,omitempty"` // 允许访问的 API Key scope
+}
+
+// Policy 授权策略文件的内容
+type Policy struct {
+	Roles  map[string]PolicyRole  `yaml:"roles"`
+	Scopes map[string]PolicyScope `yaml:"scopes"`
+	Rules  []PolicyRule           `yaml:"rules"`
+
+	// expanded 每个角色展开继承后拥有的全部角色
+	expanded map[string]map[string]bool
+}
+
+// OwnerResolver 判断当前用户是不是请求资源的所有者
+type OwnerResolver func(ctx context.Context, c *gin.Context, userID string) (bool, error)
+
+// PolicyDecision 一次授权判断，以 JSON 写入日志供审计
+type PolicyDecision struct {
+	Allowed  bool   `json:"allowed"`
+	Reason   string `json:"reason"`
+	UserID   string `json:"userId"`
+	Role     string `json:"role,omitempty"`
+	AuthType string `json:"authType"`
+	Method   string `json:"method"`
+	Route    string `json:"route"`
+	Path     string `json:"path"`
+	IP       string `json:"ip"`
+}
+
+// LoadPolicy 读取 YAML 策略文件并检查角色引用和继承关系
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read policy file failed: %v", err)
+	}
+	return ParsePolicy(data)
+}
+
+// ParsePolicy 解析策略内容，未知字段、未定义的角色和循环继承都会报错
+func ParsePolicy(data []byte) (*Policy, error) {
+	var policy Policy
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("parse policy failed: %v", err)
+	}
+
+	policy.expanded = make(map[string]map[string]bool, len(policy.Roles))
+	for role := range policy.Roles {
+		granted := map[string]bool{}
+		if err := policy.expand(role, granted, nil); err != nil {
+			return nil, err
+		}
+		policy.expanded[role] = granted
+	}
+
+	for i, rule := range policy.Rules {
+		if rule.Method == "" || rule.Path == "" {
+			return nil, fmt.Errorf("rule %d: method and path are required", i)
+		}
+		policy.Rules[i].Method = strings.ToUpper(rule.Method)
+		for _, role := range rule.Roles {
+			if _, ok := policy.Roles[role]; !ok && role != AnyRole {
+				return nil, fmt.Errorf("rule %d (%s %s): unknown role %s", i, rule.Method, rule.Path, role)
+			}
+		}
+		for _, scope := range rule.Scopes {
+			if !policy.HasScope(scope) {
+				return nil, fmt.Errorf("rule %d (%s %s): unknown scope %s", i, rule.Method, rule.Path, scope)
+			}
+		}
+	}
+	for name, scope := range policy.Scopes {
+		for i, method := range scope.Methods {
+			scope.Methods[i] = strings.ToUpper(method)
+		}
+		policy.Scopes[name] = scope
+	}
+	return &policy, nil
+}
+
+func (p *Policy) expand(role string, granted map[string]bool, path []string) error {
+	if slices.Contains(path, role) {
+		return fmt.Errorf("role %s inherits itself: %s", role, strings.Join(append(path, role), " -> "))
+	}
+	definition, ok := p.Roles[role]
+	if !ok {
+		return fmt.Errorf("unknown role %s in inherits of %s", role, path[len(path)-1])
+	}
+	granted[role] = true
+	for _, parent := range definition.Inherits {
+		if err := p.expand(parent, granted, append(path, role)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HasRole 角色 role 本身或通过继承拥有 required
+func (p *Policy) HasRole(role, required string) bool {
+	return p.expanded[role][required]
+}
+
+// HasScope scope 是否在策略文件里定义过
+func (p *Policy) HasScope(scope string) bool {
+	_, ok := p.Scopes[scope]
+	return ok
+}
+
+// rule 找出路由对应的规则，精确的 method 优先于 "*"
+func (p *Policy) rule(method, route string) *PolicyRule {
+	var wildcard *PolicyRule
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.Path != route {
+			continue
+		}
+		if rule.Method == method {
+			return rule
+		}
+		if rule.Method == "*" && wildcard == nil {
+			wildcard = rule
+		}
+	}
+	return wildcard
+}
+
+// CheckResolvers 确认规则里用到的所有权解析器都已注册
+func (p *Policy) CheckResolvers(resolvers map[string]OwnerResolver) error {
+	for _, rule := range p.Rules {
+		if rule.Owner == "" {
+			continue
+		}
+		if _, ok := resolvers[rule.Owner]; !ok {
+			return fmt.Errorf("rule %s %s: unknown owner resolver %s", rule.Method, rule.Path, rule.Owner)
+		}
+	}
+	return nil
+}
+
+// UncoveredRoutes 已注册但没有任何规则的路由，这些路由会被全部拒绝
+func (p *Policy) UncoveredRoutes(routes gin.RoutesInfo, prefix string) []string {
+	var uncovered []string
+	for _, route := range routes {
+		if strings.HasPrefix(route.Path, prefix) && p.rule(route.Method, route.Path) == nil {
+			uncovered = append(uncovered, route.Method+" "+route.Path)
+		}
+	}
+	return uncovered
+}
+
+// Authorize 按策略授权，要放在 JWTAuth 之后；拒绝时返回 403，每次判断都写审计日志
+func (p *Policy) Authorize(resolvers map[string]OwnerResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		decision := PolicyDecision{
+			UserID:   CurrentUserID(c),
+			Role:     CurrentRole(c),
+			AuthType: c.GetString(ContextAuthType),
+			Method:   c.Request.Method,
+			Route:    c.FullPath(),
+			Path:     c.Request.URL.Path,
+			IP:       c.ClientIP(),
+		}
+		decision.Allowed, decision.Reason = p.decide(c, decision, resolvers)
+		logDecision(decision)
+
+		if !decision.Allowed {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "permission denied",
+				"code":  "FORBIDDEN",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func (p *Policy) decide(c *gin.Context, decision PolicyDecision, resolvers map[string]OwnerResolver) (bool, string) {
+	rule := p.rule(decision.Method, decision.Route)
+	if rule == nil {
+		return false, "no matching rule"
+	}
+	if decision.AuthType == AuthTypeAPIKey {
+		return p.decideScopes(rule, decision.Method, c.GetStringSlice(ContextScopes))
+	}
+	for _, role := range rule.Roles {
+		if role == AnyRole {
+			return true, "any authenticated user"
+		}
+		if p.HasRole(decision.Role, role) {
+			return true, "role " + role
+		}
+	}
+	if rule.Owner == "" {
+		return false, "role not allowed"
+	}
+
+	resolver, ok := resolvers[rule.Owner]
+	if !ok {
+		return false, "unknown owner resolver " + rule.Owner
+	}
+	owns, err := resolver(c.Request.Context(), c, decision.UserID)
+	if err != nil {
+		return false, fmt.Sprintf("owner %s lookup failed: %v", rule.Owner, err)
+	}
+	if !owns {
+		return false, "not the " + rule.Owner + " owner"
+	}
+	return true, rule.Owner + " owner"
+}
+
+// decideScopes API Key 按 scope 授权，不适用角色和所有权规则
+// 按 method 授权的 scope 不能打开需要角色或所有权的路由，否则 read-only 就能读到任何用户的积分和预留
+func (p *Policy) decideScopes(rule *PolicyRule, method string, scopes []string) (bool, string) {
+	public := slices.Contains(rule.Roles, AnyRole)
+	for _, name := range scopes {
+		scope, ok := p.Scopes[name]
+		if !ok {
+			continue
+		}
+		if scope.All || (public && slices.Contains(scope.Methods, method)) || slices.Contains(rule.Scopes, name) {
+			return true, "scope " + name
+		}
+	}
+	return false, "scope not allowed"
+}
+
+// logDecision 授权判断写成一行 JSON，前缀固定便于从日志里筛选
+func logDecision(decision PolicyDecision) {
+	data, err := json.Marshal(decision)
+	if err != nil {
+		log.Printf("🛡️ authz %+v", decision)
+		return
+	}
+	log.Printf("🛡️ authz %s", data)
+}
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `
+roles:
+  admin:
+    inherits: [credit-admin]
+  credit-admin:
+    inherits: [user]
+  user: {}
+
+scopes:
+  admin: { all: true }
+  read-only: { methods: [GET] }
+  consume: {}
+
+rules:
+  - { method: GET, path: /api/v1/novels/:id, roles: ["*"] }
+  - { method: PUT, path: /api/v1/novels/:id, roles: [admin], owner: novel }
+  - { method: GET, path: /api/v1/users/:id, roles: [credit-admin], owner: user }
+  - { method: POST, path: /api/v1/users/:id/consume-token, roles: [credit-admin], owner: user, scopes: [consume] }
+  - { method: GET, path: /api/v1/users/:id/holds, roles: [credit-admin], owner: user, scopes: [read-only] }
+  - { method: "*", path: /api/v1/transactions/:txId, roles: [user] }
+`
+
+func testResolvers() map[string]OwnerResolver {
+	return map[string]OwnerResolver{
+		"user": func(ctx context.Context, c *gin.Context, userID string) (bool, error) {
+			return userID == "u1", nil
+		},
+		"novel": func(ctx context.Context, c *gin.Context, userID string) (bool, error) {
+			return false, errors.New("mongo unavailable")
+		},
+	}
+}
+
+func TestPolicyDecide(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		decision PolicyDecision
+		scopes   []string
+		allowed  bool
+		reason   string
+	}{
+		{
+			name:     "no matching rule is denied",
+			decision: PolicyDecision{Method: "GET", Route: "/api/v1/unknown", AuthType: AuthTypeJWT, Role: "admin"},
+			reason:   "no matching rule",
+		},
+		{
+			name:     "any authenticated user",
+			decision: PolicyDecision{Method: "GET", Route: "/api/v1/novels/:id", AuthType: AuthTypeJWT, Role: "user"},
+			allowed:  true,
+			reason:   "any authenticated user",
+		},
+		{
+			name:     "inherited role",
+			decision: PolicyDecision{Method: "GET", Route: "/api/v1/users/:id", AuthType: AuthTypeJWT, Role: "admin", UserID: "u2"},
+			allowed:  true,
+			reason:   "role credit-admin",
+		},
+		{
+			name:     "owner without the role",
+			decision: PolicyDecision{Method: "GET", Route: "/api/v1/users/:id", AuthType: AuthTypeJWT, Role: "user", UserID: "u1"},
+			allowed:  true,
+			reason:   "user owner",
+		},
+		{
+			name:     "not the owner",
+			decision: PolicyDecision{Method: "GET", Route: "/api/v1/users/:id", AuthType: AuthTypeJWT, Role: "user", UserID: "u2"},
+			reason:   "not the user owner",
+		},
+		{
+			name:     "owner lookup failure is denied",
+			decision: PolicyDecision{Method: "PUT", Route: "/api/v1/novels/:id", AuthType: AuthTypeJWT, Role: "user", UserID: "u1"},
+			reason:   "owner novel lookup failed: mongo unavailable",
+		},
+		{
+			name:     "wildcard method rule",
+			decision: PolicyDecision{Method: "DELETE", Route: "/api/v1/transactions/:txId", AuthType: AuthTypeJWT, Role: "user"},
+			allowed:  true,
+			reason:   "role user",
+		},
+		{
+			name:     "role without owner rule",
+			decision: PolicyDecision{Method: "DELETE", Route: "/api/v1/transactions/:txId", AuthType: AuthTypeJWT, Role: ""},
+			reason:   "role not allowed",
+		},
+		{
+			name:     "api key uses scopes, not the owner rule",
+			decision: PolicyDecision{Method: "GET", Route: "/api/v1/users/:id", AuthType: AuthTypeAPIKey, UserID: "u1"},
+			scopes:   []string{"consume"},
+			reason:   "scope not allowed",
+		},
+		{
+			name:     "api key with a scope listed on the rule",
+			decision: PolicyDecision{Method: "POST", Route: "/api/v1/users/:id/consume-token", AuthType: AuthTypeAPIKey},
+			scopes:   []string{"consume"},
+			allowed:  true,
+			reason:   "scope consume",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(tt.decision.Method, "/", nil)
+			if tt.scopes != nil {
+				c.Set(ContextScopes, tt.scopes)
+			}
+
+			allowed, reason := policy.decide(c, tt.decision, testResolvers())
+			require.Equal(t, tt.allowed, allowed)
+			require.Equal(t, tt.reason, reason)
+		})
+	}
+}
+
+func TestPolicyDecideScopes(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		method  string
+		route   string
+		scopes  []string
+		allowed bool
+		reason  string
+	}{
+		{name: "all scope allows any rule", method: "PUT", route: "/api/v1/novels/:id", scopes: []string{"admin"}, allowed: true, reason: "scope admin"},
+		{name: "method scope allows public rule", method: "GET", route: "/api/v1/novels/:id", scopes: []string{"read-only"}, allowed: true, reason: "scope read-only"},
+		{name: "method scope does not allow role rule", method: "GET", route: "/api/v1/users/:id", scopes: []string{"read-only"}, reason: "scope not allowed"},
+		{name: "method scope listed on role rule", method: "GET", route: "/api/v1/users/:id/holds", scopes: []string{"read-only"}, allowed: true, reason: "scope read-only"},
+		{name: "method scope with other method", method: "PUT", route: "/api/v1/novels/:id", scopes: []string{"read-only"}, reason: "scope not allowed"},
+		{name: "scope not listed on rule", method: "POST", route: "/api/v1/users/:id/consume-token", scopes: []string{"read-only"}, reason: "scope not allowed"},
+		{name: "undefined scope is ignored", method: "GET", route: "/api/v1/novels/:id", scopes: []string{"unknown", "read-only"}, allowed: true, reason: "scope read-only"},
+		{name: "no scopes", method: "GET", route: "/api/v1/novels/:id", reason: "scope not allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := policy.rule(tt.method, tt.route)
+			require.NotNil(t, rule)
+
+			allowed, reason := policy.decideScopes(rule, tt.method, tt.scopes)
+			require.Equal(t, tt.allowed, allowed)
+			require.Equal(t, tt.reason, reason)
+		})
+	}
+}
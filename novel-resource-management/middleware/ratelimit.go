@@ -0,0 +1,293 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// 按调用方限流：每个调用方一个令牌桶，令牌按 limit/period 的速度补充，最多攒 burst 个
+// 正常客户端偶尔的突发请求可以用攒下的令牌，持续高频的请求会被限制在 limit/period
+// 调用方分三类：API Key、登录用户、匿名请求的 IP，每类可以有不同的配额
+// 路由规则按 method + gin 路由模板匹配，有单独的令牌桶；没有匹配规则的请求共用 default 的令牌桶
+// 响应带 RateLimit-Limit、RateLimit-Remaining、RateLimit-Reset，被限流时返回 429 和 Retry-After
+
+// 令牌桶存储后端
+const (
+	RateLimitBackendMemory  = "memory"
+	RateLimitBackendMongoDB = "mongodb"
+)
+
+// 限流的调用方类型
+const (
+	PrincipalUser   = "user"
+	PrincipalAPIKey = "apikey"
+	PrincipalIP     = "ip"
+)
+
+// RateLimit 一类调用方的配额：每 period 补充 limit 个令牌，桶容量是 burst，不填时等于 limit
+type RateLimit struct {
+	Limit  int           `yaml:"limit"`
+	Period time.Duration `yaml:"period"`
+	Burst  int           `yaml:"burst"`
+}
+
+// rate 每秒补充的令牌数
+func (l *RateLimit) rate() float64 {
+	return float64(l.Limit) / l.Period.Seconds()
+}
+
+// RateLimitRule 一个路由的配额，没有写的调用方类型使用 default 里的配额和令牌桶
+type RateLimitRule struct {
+	Method string     `yaml:"method"`
+	Path   string     `yaml:"path"`
+	User   *RateLimit `yaml:"user"`
+	APIKey *RateLimit `yaml:"apikey"`
+	IP     *RateLimit `yaml:"ip"`
+}
+
+func (r *RateLimitRule) limit(principal string) *RateLimit {
+	switch principal {
+	case PrincipalAPIKey:
+		return r.APIKey
+	case PrincipalUser:
+		return r.User
+	default:
+		return r.IP
+	}
+}
+
+// RateLimitConfig 限流配置文件的内容
+type RateLimitConfig struct {
+	Backend string          `yaml:"backend"`
+	Default RateLimitRule   `yaml:"default"`
+	Rules   []RateLimitRule `yaml:"rules"`
+}
+
+// RateLimitStore 令牌桶存储，单实例用内存，多实例部署用 MongoDB 共享令牌桶
+type RateLimitStore interface {
+	// Take 先按 rate 补充令牌再取一个，返回取之后剩余的令牌数和是否取到
+	Take(ctx context.Context, key string, rate float64, burst int, now time.Time) (tokens float64, allowed bool, err error)
+}
+
+// LoadRateLimitConfig 读取 YAML 限流配置
+func LoadRateLimitConfig(path string) (*RateLimitConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read rate limit file failed: %v", err)
+	}
+	return ParseRateLimitConfig(data)
+}
+
+// ParseRateLimitConfig 解析限流配置，未知字段和不合法的配额都会报错
+func ParseRateLimitConfig(data []byte) (*RateLimitConfig, error) {
+	var config RateLimitConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("parse rate limit config failed: %v", err)
+	}
+
+	switch config.Backend {
+	case "":
+		config.Backend = RateLimitBackendMemory
+	case RateLimitBackendMemory, RateLimitBackendMongoDB:
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %s", config.Backend)
+	}
+
+	if err := config.Default.validate("default"); err != nil {
+		return nil, err
+	}
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+		if rule.Method == "" || rule.Path == "" {
+			return nil, fmt.Errorf("rule %d: method and path are required", i)
+		}
+		rule.Method = strings.ToUpper(rule.Method)
+		if err := rule.validate(fmt.Sprintf("rule %d (%s %s)", i, rule.Method, rule.Path)); err != nil {
+			return nil, err
+		}
+	}
+	return &config, nil
+}
+
+func (r *RateLimitRule) validate(name string) error {
+	for principal, limit := range map[string]*RateLimit{PrincipalUser: r.User, PrincipalAPIKey: r.APIKey, PrincipalIP: r.IP} {
+		if limit == nil {
+			continue
+		}
+		if limit.Limit <= 0 || limit.Period <= 0 {
+			return fmt.Errorf("%s: %s limit and period must be positive", name, principal)
+		}
+		if limit.Burst == 0 {
+			limit.Burst = limit.Limit
+		}
+		if limit.Burst < 1 {
+			return fmt.Errorf("%s: %s burst must be positive", name, principal)
+		}
+	}
+	return nil
+}
+
+// RateLimiter 限流中间件
+type RateLimiter struct {
+	config *RateLimitConfig
+	store  RateLimitStore
+}
+
+func NewRateLimiter(config *RateLimitConfig, store RateLimitStore) *RateLimiter {
+	return &RateLimiter{config: config, store: store}
+}
+
+// Limit 返回限流中间件，要放在认证之后才能按用户和 API Key 限流，放在认证之前只能按 IP 限流
+func (rl *RateLimiter) Limit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, id := rateLimitPrincipal(c)
+		bucket := "default"
+		limit := rl.config.Default.limit(principal)
+		if rule := rl.rule(c.Request.Method, c.FullPath()); rule != nil && rule.limit(principal) != nil {
+			bucket = rule.Method + " " + rule.Path
+			limit = rule.limit(principal)
+		}
+		if limit == nil {
+			c.Next()
+			return
+		}
+
+		tokens, allowed, err := rl.store.Take(c.Request.Context(), bucket+"|"+principal+":"+id, limit.rate(), limit.Burst, time.Now())
+		if err != nil {
+			// 存储不可用时放行，限流不应该让整个服务不可用
+			log.Printf("⚠️ 限流存储出错，放行请求 %s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		c.Header("RateLimit-Remaining", strconv.Itoa(int(math.Floor(tokens))))
+		c.Header("RateLimit-Reset", strconv.Itoa(secondsUntil(float64(limit.Burst)-tokens, limit.rate())))
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(secondsUntil(1-tokens, limit.rate())))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "请求过于频繁，请稍后重试",
+				"code":  "RATE_LIMITED",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// rule 找出路由对应的规则，精确的 method 优先于 "*"
+func (rl *RateLimiter) rule(method, route string) *RateLimitRule {
+	var wildcard *RateLimitRule
+	for i := range rl.config.Rules {
+		rule := &rl.config.Rules[i]
+		if rule.Path != route {
+			continue
+		}
+		if rule.Method == method {
+			return rule
+		}
+		if rule.Method == "*" && wildcard == nil {
+			wildcard = rule
+		}
+	}
+	return wildcard
+}
+
+// rateLimitPrincipal 认证过的请求按 API Key 或用户限流，其他请求按 IP 限流
+func rateLimitPrincipal(c *gin.Context) (string, string) {
+	if IsAPIKey(c) {
+		return PrincipalAPIKey, CurrentUserID(c)
+	}
+	if userID := CurrentUserID(c); userID != "" {
+		return PrincipalUser, userID
+	}
+	return PrincipalIP, c.ClientIP()
+}
+
+// secondsUntil 补充 missing 个令牌需要的秒数，向上取整
+func secondsUntil(missing, rate float64) int {
+	if missing <= 0 {
+		return 0
+	}
+	return int(math.Ceil(missing / rate))
+}
+
+// RefillTokens 按上次更新时间补充令牌，不超过 burst，两种存储共用同样的计算
+func RefillTokens(tokens float64, updatedAt, now time.Time, rate float64, burst int) float64 {
+	if elapsed := now.Sub(updatedAt).Seconds(); elapsed > 0 {
+		tokens += elapsed * rate
+	}
+	return math.Min(tokens, float64(burst))
+}
+
+// memoryBucket 内存里的一个令牌桶，fullAt 之后桶已经补满，可以清理掉
+type memoryBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	fullAt    time.Time
+}
+
+// MemoryRateLimitStore 进程内的令牌桶，只适合单实例部署
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+// NewMemoryRateLimitStore 创建内存存储，后台每分钟清理一次已经补满的令牌桶
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	store := &MemoryRateLimitStore{buckets: map[string]*memoryBucket{}}
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			store.sweep(now)
+		}
+	}()
+	return store
+}
+
+func (ms *MemoryRateLimitStore) Take(_ context.Context, key string, rate float64, burst int, now time.Time) (float64, bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	bucket, ok := ms.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: float64(burst), updatedAt: now}
+		ms.buckets[key] = bucket
+	}
+	bucket.tokens = RefillTokens(bucket.tokens, bucket.updatedAt, now, rate, burst)
+	bucket.updatedAt = now
+
+	allowed := bucket.tokens >= 1
+	if allowed {
+		bucket.tokens--
+	}
+	bucket.fullAt = now.Add(time.Duration((float64(burst) - bucket.tokens) / rate * float64(time.Second)))
+	return bucket.tokens, allowed, nil
+}
+
+// sweep 删除已经补满的令牌桶，下次请求重新创建的桶也是满的，结果一样
+func (ms *MemoryRateLimitStore) sweep(now time.Time) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for key, bucket := range ms.buckets {
+		if !now.Before(bucket.fullAt) {
+			delete(ms.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefillTokens(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		tokens   float64
+		elapsed  time.Duration
+		rate     float64
+		burst    int
+		expected float64
+	}{
+		{name: "no time passed", tokens: 2, rate: 1, burst: 5, expected: 2},
+		{name: "refills by elapsed seconds", tokens: 1, elapsed: 2 * time.Second, rate: 1, burst: 5, expected: 3},
+		{name: "fractional refill", tokens: 0, elapsed: 500 * time.Millisecond, rate: 1, burst: 5, expected: 0.5},
+		{name: "capped at burst", tokens: 4, elapsed: time.Minute, rate: 1, burst: 5, expected: 5},
+		{name: "clock going backwards does not refill", tokens: 1, elapsed: -time.Second, rate: 1, burst: 5, expected: 1},
+		{name: "tokens above a lowered burst are trimmed", tokens: 10, rate: 1, burst: 5, expected: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RefillTokens(tt.tokens, start, start.Add(tt.elapsed), tt.rate, tt.burst)
+			require.InDelta(t, tt.expected, got, 1e-9)
+		})
+	}
+}
+
+func TestMemoryRateLimitStoreTake(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	type take struct {
+		key     string
+		at      time.Duration
+		allowed bool
+		tokens  float64
+	}
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		takes []take
+	}{
+		{
+			name: "burst then denied",
+			rate: 1, burst: 2,
+			takes: []take{
+				{key: "a", allowed: true, tokens: 1},
+				{key: "a", allowed: true, tokens: 0},
+				{key: "a", allowed: false, tokens: 0},
+			},
+		},
+		{
+			name: "refills over time",
+			rate: 2, burst: 1,
+			takes: []take{
+				{key: "a", allowed: true, tokens: 0},
+				{key: "a", at: 250 * time.Millisecond, allowed: false, tokens: 0.5},
+				{key: "a", at: 500 * time.Millisecond, allowed: true, tokens: 0},
+			},
+		},
+		{
+			name: "keys are independent",
+			rate: 1, burst: 1,
+			takes: []take{
+				{key: "a", allowed: true, tokens: 0},
+				{key: "b", allowed: true, tokens: 0},
+				{key: "a", allowed: false, tokens: 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &MemoryRateLimitStore{buckets: map[string]*memoryBucket{}}
+			for i, step := range tt.takes {
+				tokens, allowed, err := store.Take(context.Background(), step.key, tt.rate, tt.burst, start.Add(step.at))
+				require.NoError(t, err)
+				require.Equal(t, step.allowed, allowed, "take %d", i)
+				require.InDelta(t, step.tokens, tokens, 1e-9, "take %d", i)
+			}
+		})
+	}
+}
+
+func TestRateLimitPrincipalIgnoresUntrustedForwardedFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		trusted  []string
+		expected string
+	}{
+		{name: "no trusted proxies", expected: "203.0.113.7"},
+		{name: "request from a trusted proxy", trusted: []string{"203.0.113.0/24"}, expected: "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := gin.New()
+			require.NoError(t, engine.SetTrustedProxies(tt.trusted))
+			c := gin.CreateTestContextOnly(httptest.NewRecorder(), engine)
+			c.Request = httptest.NewRequest("GET", "/", nil)
+			c.Request.RemoteAddr = "203.0.113.7:40000"
+			c.Request.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+			principal, id := rateLimitPrincipal(c)
+			require.Equal(t, PrincipalIP, principal)
+			require.Equal(t, tt.expected, id)
+		})
+	}
+}
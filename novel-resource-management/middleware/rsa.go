@@ -43,6 +43,8 @@ func RSARequestMiddleware() gin.HandlerFunc {
 
 		// 将解密后的数据重新设置到请求体中
 		c.Request.Body = io.NopCloser(strings.NewReader(decryptedBody))
+		// 标记请求体已经解密，OpenAPI 校验等到这之后再校验请求体
+		c.Set(contextRequestDecrypted, true)
 		
 		// 继续处理请求
 		c.Next()
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceIDHeader 响应头，用户反馈问题时带上它就能找到请求、链码交易和 MongoDB 同步的整条链路
+const TraceIDHeader = "X-Trace-Id"
+
+var untracedPaths = map[string]bool{
+	"/metrics": true,
+	"/health":  true,
+	"/livez":   true,
+	"/readyz":  true,
+}
+
+// Tracing 每个请求一个 span，名字是路由模板；上游带了 traceparent 时接在上游的 trace 后面
+// /metrics、/health、/livez、/readyz 这类探活和抓取请求不记录
+func Tracing(serviceName string) []gin.HandlerFunc {
+	return []gin.HandlerFunc{
+		otelgin.Middleware(serviceName, otelgin.WithFilter(func(r *http.Request) bool {
+			return !untracedPaths[r.URL.Path]
+		})),
+		func(c *gin.Context) {
+			if spanContext := trace.SpanContextFromContext(c.Request.Context()); spanContext.HasTraceID() {
+				c.Header(TraceIDHeader, spanContext.TraceID().String())
+			}
+			c.Next()
+		},
+	}
+}
@@ -9,18 +9,13 @@ import (
 	"github.com/hyperledger/fabric-gateway/pkg/identity" // Fabric网关身份验证包
 	"google.golang.org/grpc"                             // gRPC客户端通信库
 	"google.golang.org/grpc/credentials"                 // gRPC凭证管理
-)
 
-func NewGrpcConnection() (*grpc.ClientConn, error) {
-	// 获取Fabric证书路径
-	certPath := os.Getenv("FABRIC_CERT_PATH")
-	if certPath == "" {
-		certPath = "../test-network/organizations/peerOrganizations/org1.example.com" // 默认路径
-	}
+	"novel-resource-management/config" // 证书路径、peer 地址和 MSP 从配置读取
+)
 
+func NewGrpcConnection(cfg config.FabricConfig) (*grpc.ClientConn, error) {
 	// 获取Fabric连接地址
-	peerHost := os.Getenv("FABRIC_PEER_HOST")
-	peerPort := os.Getenv("FABRIC_PEER_PORT")
+	peerHost := cfg.PeerHost
 
 	// 智能判断运行环境
 	if peerHost == "" {
@@ -37,12 +32,8 @@ func NewGrpcConnection() (*grpc.ClientConn, error) {
 		}
 	}
 
-	if peerPort == "" {
-		peerPort = "7051" // 默认端口
-	}
-
 	//pem是最原始的证书，没有经过解析的证书，由start和end组成
-	tlsCertificatePEM, err := os.ReadFile(fmt.Sprintf("%s/tlsca/tlsca.org1.example.com-cert.pem", certPath))
+	tlsCertificatePEM, err := os.ReadFile(cfg.ResolvePath(cfg.TLSCertFile))
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to read TLS certificate: %w", err)
@@ -58,25 +49,19 @@ func NewGrpcConnection() (*grpc.ClientConn, error) {
 	certPool := x509.NewCertPool()
 	certPool.AddCert(tlsCertificate)
 	//credentials是凭证，用于验证服务器证书
-	transportCredentials := credentials.NewClientTLSFromCert(certPool, "peer0.org1.example.com")
+	transportCredentials := credentials.NewClientTLSFromCert(certPool, cfg.GatewayPeer)
 
 	//注意返回的是grpc的client对象，供gateway使用
-	peerAddress := fmt.Sprintf("%s:%s", peerHost, peerPort)
+	peerAddress := fmt.Sprintf("%s:%d", peerHost, cfg.PeerPort)
 	log.Printf("连接Fabric网络: %s", peerAddress)
 	return grpc.NewClient(peerAddress, grpc.WithTransportCredentials(transportCredentials))
 
 }
 
 // NewIdentity用于生成Fabric网络所需的X.509身份
-func NewIdentity() *identity.X509Identity {
-	// 获取Fabric证书路径
-	certPath := os.Getenv("FABRIC_CERT_PATH")
-	if certPath == "" {
-		certPath = "../test-network/organizations/peerOrganizations/org1.example.com" // 默认路径
-	}
-
+func NewIdentity(cfg config.FabricConfig) *identity.X509Identity {
 	//先读pem
-	certificatePEM, err := os.ReadFile(fmt.Sprintf("%s/users/User1@org1.example.com/msp/signcerts/User1@org1.example.com-cert.pem", certPath))
+	certificatePEM, err := os.ReadFile(cfg.ResolvePath(cfg.SignCertFile))
 	if err != nil {
 
 		panic(fmt.Errorf("failed to read certificate: %w", err))
@@ -88,7 +73,7 @@ func NewIdentity() *identity.X509Identity {
 		panic(fmt.Errorf("failed to parse certificate: %w", err))
 	}
 	//创建身份对象
-	id, err := identity.NewX509Identity("Org1MSP", certificate)
+	id, err := identity.NewX509Identity(cfg.MSPID, certificate)
 	if err != nil {
 		panic(fmt.Errorf("failed to create identity: %w", err))
 	}
@@ -96,15 +81,9 @@ func NewIdentity() *identity.X509Identity {
 	return id
 }
 
-func NewSign() identity.Sign {
-	// 获取Fabric证书路径
-	certPath := os.Getenv("FABRIC_CERT_PATH")
-	if certPath == "" {
-		certPath = "../test-network/organizations/peerOrganizations/org1.example.com" // 默认路径
-	}
-
+func NewSign(cfg config.FabricConfig) identity.Sign {
 	//还是先拿pem
-	privateKeyPEM, err := os.ReadFile(fmt.Sprintf("%s/users/User1@org1.example.com/msp/keystore/priv_sk", certPath))
+	privateKeyPEM, err := os.ReadFile(cfg.ResolvePath(cfg.KeyFile))
 	if err != nil {
 		panic(fmt.Errorf("failed to read private key: %w", err))
 	}
@@ -124,6 +103,37 @@ func NewSign() identity.Sign {
 	return sign
 }
 
+// NewAdminIdentity 调用 AdminContract 用的平台管理员身份和签名，证书和私钥是 fabric.admin_sign_cert_file、fabric.admin_key_file
+// 和 NewIdentity 不同，文件读不出来时返回错误，由调用方决定是否退回普通身份
+func NewAdminIdentity(cfg config.FabricConfig) (*identity.X509Identity, identity.Sign, error) {
+	certificatePEM, err := os.ReadFile(cfg.ResolvePath(cfg.AdminSignCertFile))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read admin certificate: %w", err)
+	}
+	certificate, err := identity.CertificateFromPEM(certificatePEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse admin certificate: %w", err)
+	}
+	id, err := identity.NewX509Identity(cfg.MSPID, certificate)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create admin identity: %w", err)
+	}
+
+	privateKeyPEM, err := os.ReadFile(cfg.ResolvePath(cfg.AdminKeyFile))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read admin private key: %w", err)
+	}
+	privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse admin private key: %w", err)
+	}
+	sign, err := identity.NewPrivateKeySign(privateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create admin sign function: %w", err)
+	}
+	return id, sign, nil
+}
+
 /**
 反正都需要一个x509证书;
 then一个通过pool new一个NewClientTLSFromCert
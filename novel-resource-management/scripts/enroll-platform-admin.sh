@@ -0,0 +1,55 @@
+#!/bin/bash
+
+###############################################################################
+# 在 test-network 的 Org1 CA 上登记平台管理员，证书带 role=admin 属性
+# 链码的 AdminContract（价格表、消费额度、背书配置、快照锚定、InitFromMongoDB）只接受 Org1MSP + role=admin
+#
+# 前提：test-network 用 CA 启动（./network.sh up createChannel -ca），cryptogen 生成的身份没有属性
+# 生成的证书和私钥和 config/app.dev.yaml 里 fabric.admin_sign_cert_file、fabric.admin_key_file 的默认路径一致
+#
+# 用法：scripts/enroll-platform-admin.sh [test-network 目录]
+###############################################################################
+
+set -euo pipefail
+
+SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
+TEST_NETWORK=${1:-"$SCRIPT_DIR/../../test-network"}
+TEST_NETWORK="$(cd "$TEST_NETWORK" && pwd)"
+
+ADMIN_NAME=${PLATFORM_ADMIN_NAME:-"platformadmin"}
+ADMIN_SECRET=${PLATFORM_ADMIN_SECRET:-"platformadminpw"}
+CA_URL=${ORG1_CA_URL:-"localhost:7054"}
+
+ORG_DIR="$TEST_NETWORK/organizations/peerOrganizations/org1.example.com"
+CA_CERT="$TEST_NETWORK/organizations/fabric-ca/org1/ca-cert.pem"
+MSP_DIR="$ORG_DIR/users/PlatformAdmin@org1.example.com/msp"
+
+if ! command -v fabric-ca-client >/dev/null 2>&1; then
+    export PATH="$TEST_NETWORK/../bin:$PATH"
+fi
+if [ ! -f "$CA_CERT" ]; then
+    echo "❌ 没有找到 $CA_CERT，请先用 ./network.sh up createChannel -ca 启动 test-network"
+    exit 1
+fi
+
+# 用 Org1 CA 的引导管理员身份注册，registerEnroll.sh 已经把它登记在 org1.example.com 目录下
+export FABRIC_CA_CLIENT_HOME="$ORG_DIR"
+
+echo "📝 注册平台管理员 $ADMIN_NAME（role=admin:ecert）..."
+if ! fabric-ca-client register --caname ca-org1 \
+    --id.name "$ADMIN_NAME" --id.secret "$ADMIN_SECRET" --id.type client \
+    --id.attrs 'role=admin:ecert' \
+    --tls.certfiles "$CA_CERT"; then
+    echo "ℹ️ 注册失败，可能已经注册过，继续登记"
+fi
+
+echo "🔑 登记证书到 $MSP_DIR ..."
+rm -rf "$MSP_DIR"
+fabric-ca-client enroll -u "https://$ADMIN_NAME:$ADMIN_SECRET@$CA_URL" --caname ca-org1 \
+    -M "$MSP_DIR" --tls.certfiles "$CA_CERT"
+
+# fabric-ca-client 生成的私钥文件名是随机的，复制成固定的文件名
+cp "$MSP_DIR"/keystore/*_sk "$MSP_DIR/keystore/priv_sk"
+cp "$ORG_DIR/msp/config.yaml" "$MSP_DIR/config.yaml"
+
+echo "✅ 完成，证书 users/PlatformAdmin@org1.example.com/msp/signcerts/cert.pem，私钥 users/PlatformAdmin@org1.example.com/msp/keystore/priv_sk"
@@ -0,0 +1,458 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"novel-resource-management/database"
+)
+
+const (
+	// analyticsDateLayout 汇总按天统计，日期是 UTC
+	analyticsDateLayout = "2006-01-02"
+	// defaultAnalyticsDays 不传时间范围时统计最近 30 天
+	defaultAnalyticsDays = 30
+	// MaxLeaderboardLimit 排行榜最多返回的条数
+	MaxLeaderboardLimit = 100
+	// novelUsageRebuildCollection 重建汇总时的临时集合
+	novelUsageRebuildCollection = "novel_usage_daily_rebuild"
+)
+
+// ErrInvalidDateRange 时间范围格式不对或者起止颠倒
+var ErrInvalidDateRange = errors.New("invalid date range")
+
+// 排行榜支持的排序字段
+const (
+	RankByCredits     = "credits"
+	RankByCount       = "count"
+	RankByUniqueUsers = "uniqueUsers"
+)
+
+// DateRange 统计的日期范围，包含起止两天
+type DateRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ParseDateRange 解析 from/to（2006-01-02），为空时默认截止到今天的最近 30 天
+func ParseDateRange(from, to string, now time.Time) (DateRange, error) {
+	now = now.UTC()
+	if to == "" {
+		to = now.Format(analyticsDateLayout)
+	}
+	end, err := time.Parse(analyticsDateLayout, to)
+	if err != nil {
+		return DateRange{}, fmt.Errorf("%w: to %q", ErrInvalidDateRange, to)
+	}
+	if from == "" {
+		from = end.AddDate(0, 0, -(defaultAnalyticsDays - 1)).Format(analyticsDateLayout)
+	}
+	start, err := time.Parse(analyticsDateLayout, from)
+	if err != nil {
+		return DateRange{}, fmt.Errorf("%w: from %q", ErrInvalidDateRange, from)
+	}
+	if start.After(end) {
+		return DateRange{}, fmt.Errorf("%w: from %s is after to %s", ErrInvalidDateRange, from, to)
+	}
+	return DateRange{From: from, To: to}, nil
+}
+
+// filter 日期是定长字符串，可以直接按字典序比较
+func (r DateRange) filter() bson.M {
+	return bson.M{"date": bson.M{"$gte": r.From, "$lte": r.To}}
+}
+
+// operationKey 操作码作为 MongoDB 字段名，空操作码记为 default，去掉 . 和 $
+func operationKey(operation string) string {
+	if operation == "" {
+		return "default"
+	}
+	return strings.NewReplacer(".", "_", "$", "_").Replace(operation)
+}
+
+// UsagePoint 某一天的用量
+type UsagePoint struct {
+	Date        string         `json:"date" bson:"_id"`
+	Credits     int            `json:"credits" bson:"credits"`
+	Count       int            `json:"count" bson:"count"`
+	UniqueUsers int            `json:"uniqueUsers" bson:"uniqueUsers"`
+	Operations  map[string]int `json:"operations" bson:"-"`
+}
+
+// UsageTotals 整个时间范围的合计，uniqueUsers 是范围内去重后的用户数
+type UsageTotals struct {
+	Credits     int            `json:"credits"`
+	Count       int            `json:"count"`
+	UniqueUsers int            `json:"uniqueUsers"`
+	Operations  map[string]int `json:"operations"`
+}
+
+// NovelUsageSummary 一本小说在时间范围内的用量，用于作者统计和排行榜
+type NovelUsageSummary struct {
+	Rank        int    `json:"rank,omitempty" bson:"-"`
+	NovelID     string `json:"novelId" bson:"_id"`
+	Author      string `json:"author,omitempty" bson:"author"`
+	Credits     int    `json:"credits" bson:"credits"`
+	Count       int    `json:"count" bson:"count"`
+	UniqueUsers int    `json:"uniqueUsers" bson:"uniqueUsers"`
+}
+
+// NovelUsage 单本小说的统计
+type NovelUsage struct {
+	NovelID string       `json:"novelId"`
+	Author  string       `json:"author,omitempty"`
+	Range   DateRange    `json:"range"`
+	Totals  UsageTotals  `json:"totals"`
+	Series  []UsagePoint `json:"series"`
+}
+
+// AuthorUsage 作者名下所有小说的统计
+type AuthorUsage struct {
+	Author string              `json:"author"`
+	Range  DateRange           `json:"range"`
+	Totals UsageTotals         `json:"totals"`
+	Series []UsagePoint        `json:"series"`
+	Novels []NovelUsageSummary `json:"novels"`
+}
+
+// AnalyticsService 小说用量统计，查询 novel_usage_daily 汇总
+type AnalyticsService struct {
+	db *database.MongoDBInstance
+}
+
+func NewAnalyticsService() *AnalyticsService {
+	return &AnalyticsService{
+		db: database.GetMongoInstance(),
+	}
+}
+
+// GetNovelUsage 单本小说的每日序列和合计
+func (as *AnalyticsService) GetNovelUsage(novelID string, r DateRange) (*NovelUsage, error) {
+	filter := r.filter()
+	filter["novelId"] = novelID
+
+	series, totals, err := as.usage(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &NovelUsage{
+		NovelID: novelID,
+		Range:   r,
+		Totals:  *totals,
+		Series:  series,
+	}
+
+	var novel database.Novel
+	err = as.db.GetCollection("novels").FindOne(context.Background(), bson.M{"_id": novelID}).Decode(&novel)
+	if err == nil {
+		usage.Author = novel.Author
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("find novel failed: %v", err)
+	}
+	return usage, nil
+}
+
+// GetAuthorUsage 作者名下所有小说的每日序列、合计和每本小说的用量
+func (as *AnalyticsService) GetAuthorUsage(author string, r DateRange) (*AuthorUsage, error) {
+	novelIDs, err := as.db.GetCollection("novels").Distinct(context.Background(), "_id", bson.M{"author": author})
+	if err != nil {
+		return nil, fmt.Errorf("find novels of author failed: %v", err)
+	}
+
+	usage := &AuthorUsage{
+		Author: author,
+		Range:  r,
+		Totals: UsageTotals{Operations: map[string]int{}},
+		Series: []UsagePoint{},
+		Novels: []NovelUsageSummary{},
+	}
+	if len(novelIDs) == 0 {
+		return usage, nil
+	}
+
+	filter := r.filter()
+	filter["novelId"] = bson.M{"$in": novelIDs}
+
+	series, totals, err := as.usage(filter)
+	if err != nil {
+		return nil, err
+	}
+	novels, err := as.summaries(filter, RankByCredits, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	usage.Series = series
+	usage.Totals = *totals
+	usage.Novels = novels
+	return usage, nil
+}
+
+// GetLeaderboard 时间范围内用量最高的 limit 本小说
+func (as *AnalyticsService) GetLeaderboard(r DateRange, by string, limit int) ([]NovelUsageSummary, error) {
+	if by == "" {
+		by = RankByCredits
+	}
+	if by != RankByCredits && by != RankByCount && by != RankByUniqueUsers {
+		return nil, fmt.Errorf("unknown leaderboard metric %q", by)
+	}
+	if limit <= 0 || limit > MaxLeaderboardLimit {
+		return nil, fmt.Errorf("limit must be between 1 and %d", MaxLeaderboardLimit)
+	}
+
+	leaderboard, err := as.summaries(r.filter(), by, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range leaderboard {
+		leaderboard[i].Rank = i + 1
+	}
+	return leaderboard, nil
+}
+
+// usage 按天聚合汇总记录，同一天多本小说的用户取并集
+func (as *AnalyticsService) usage(filter bson.M) ([]UsagePoint, *UsageTotals, error) {
+	ctx := context.Background()
+	collection := as.db.GetCollection("novel_usage_daily")
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{
+			"_id":        "$date",
+			"credits":    bson.M{"$sum": "$credits"},
+			"count":      bson.M{"$sum": "$count"},
+			"users":      bson.M{"$push": "$users"},
+			"operations": bson.M{"$push": bson.M{"$objectToArray": "$operations"}},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"credits":     1,
+			"count":       1,
+			"uniqueUsers": bson.M{"$size": unionOf("$users")},
+			"operations": bson.M{"$reduce": bson.M{
+				"input":        "$operations",
+				"initialValue": bson.A{},
+				"in":           bson.M{"$concatArrays": bson.A{"$$value", "$$this"}},
+			}},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, nil, fmt.Errorf("aggregate novel usage failed: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	series := []UsagePoint{}
+	totals := &UsageTotals{Operations: map[string]int{}}
+	for cursor.Next(ctx) {
+		var row struct {
+			UsagePoint `bson:",inline"`
+			Operations []struct {
+				K string `bson:"k"`
+				V int    `bson:"v"`
+			} `bson:"operations"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, nil, fmt.Errorf("decode novel usage failed: %v", err)
+		}
+
+		point := row.UsagePoint
+		point.Operations = map[string]int{}
+		for _, op := range row.Operations {
+			point.Operations[op.K] += op.V
+			totals.Operations[op.K] += op.V
+		}
+		totals.Credits += point.Credits
+		totals.Count += point.Count
+		series = append(series, point)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, nil, fmt.Errorf("read novel usage failed: %v", err)
+	}
+
+	// 去重用户数不能由每天的数字相加得到，单独聚合一次
+	cursor, err = collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$unwind", Value: "$users"}},
+		{{Key: "$group", Value: bson.M{"_id": "$users"}}},
+		{{Key: "$count", Value: "uniqueUsers"}},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("aggregate unique users failed: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	if cursor.Next(ctx) {
+		var row struct {
+			UniqueUsers int `bson:"uniqueUsers"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, nil, fmt.Errorf("decode unique users failed: %v", err)
+		}
+		totals.UniqueUsers = row.UniqueUsers
+	}
+	return series, totals, cursor.Err()
+}
+
+// summaries 按小说聚合并排序，limit 为 0 表示不限制，结果带上作者
+func (as *AnalyticsService) summaries(filter bson.M, by string, limit int) ([]NovelUsageSummary, error) {
+	ctx := context.Background()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     "$novelId",
+			"credits": bson.M{"$sum": "$credits"},
+			"count":   bson.M{"$sum": "$count"},
+			"users":   bson.M{"$push": "$users"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"credits":     1,
+			"count":       1,
+			"uniqueUsers": bson.M{"$size": unionOf("$users")},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: by, Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$lookup", Value: bson.M{
+			"from":         "novels",
+			"localField":   "_id",
+			"foreignField": "_id",
+			"as":           "novel",
+		}}},
+		bson.D{{Key: "$addFields", Value: bson.M{
+			"author": bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{"$novel.author", 0}}, ""}},
+		}}},
+	)
+
+	cursor, err := as.db.GetCollection("novel_usage_daily").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate novel summaries failed: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	summaries := []NovelUsageSummary{}
+	if err := cursor.All(ctx, &summaries); err != nil {
+		return nil, fmt.Errorf("decode novel summaries failed: %v", err)
+	}
+	return summaries, nil
+}
+
+// unionOf 把二维的用户数组合并成去重后的一维数组
+func unionOf(field string) bson.M {
+	return bson.M{"$reduce": bson.M{
+		"input":        field,
+		"initialValue": bson.A{},
+		"in":           bson.M{"$setUnion": bson.A{"$$value", "$$this"}},
+	}}
+}
+
+// RebuildNovelUsageDaily 从 credit_histories 全量重建 novel_usage_daily，返回汇总的条数
+// 先写到临时集合，再用 renameCollection 整体替换，查询不会看到清空了一半的汇总
+// 重建期间事件监听写入的增量可能丢失，应在低峰期执行
+func (as *AnalyticsService) RebuildNovelUsageDaily() (int, error) {
+	ctx := context.Background()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"type":    "consume",
+			"novelId": bson.M{"$nin": bson.A{nil, ""}},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"novelId": "$novelId",
+				"date":    bson.M{"$substrBytes": bson.A{"$timestamp", 0, len(analyticsDateLayout)}},
+			},
+			"credits":    bson.M{"$sum": bson.M{"$multiply": bson.A{"$amount", -1}}},
+			"count":      bson.M{"$sum": 1},
+			"users":      bson.M{"$addToSet": "$userId"},
+			"operations": bson.M{"$push": bson.M{"$ifNull": bson.A{"$operation", ""}}},
+		}}},
+	}
+
+	cursor, err := as.db.GetCollection("credit_histories").Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return 0, fmt.Errorf("aggregate credit histories failed: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+	rollups := []interface{}{}
+	for cursor.Next(ctx) {
+		var row struct {
+			ID struct {
+				NovelID string `bson:"novelId"`
+				Date    string `bson:"date"`
+			} `bson:"_id"`
+			Credits    int      `bson:"credits"`
+			Count      int      `bson:"count"`
+			Users      []string `bson:"users"`
+			Operations []string `bson:"operations"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return 0, fmt.Errorf("decode credit history rollup failed: %v", err)
+		}
+
+		// 操作码的字段名处理和增量更新保持一致
+		operations := map[string]int{}
+		for _, op := range row.Operations {
+			operations[operationKey(op)]++
+		}
+		rollups = append(rollups, &database.NovelUsageDaily{
+			ID:         row.ID.NovelID + "|" + row.ID.Date,
+			NovelID:    row.ID.NovelID,
+			Date:       row.ID.Date,
+			Credits:    row.Credits,
+			Count:      row.Count,
+			Operations: operations,
+			Users:      row.Users,
+			UpdatedAt:  now,
+		})
+	}
+	if err := cursor.Err(); err != nil {
+		return 0, fmt.Errorf("read credit history rollup failed: %v", err)
+	}
+
+	db := as.db.GetDatabase()
+	temp := db.Collection(novelUsageRebuildCollection)
+	if err := temp.Drop(ctx); err != nil {
+		return 0, fmt.Errorf("drop novel usage rebuild collection failed: %v", err)
+	}
+	if err := db.CreateCollection(ctx, novelUsageRebuildCollection); err != nil {
+		return 0, fmt.Errorf("create novel usage rebuild collection failed: %v", err)
+	}
+	if len(rollups) > 0 {
+		if _, err := temp.InsertMany(ctx, rollups); err != nil {
+			return 0, fmt.Errorf("insert novel usage rollup failed: %v", err)
+		}
+	}
+	if _, err := temp.Indexes().CreateMany(ctx, novelUsageDailyIndexes()); err != nil {
+		return 0, fmt.Errorf("create novel usage rollup indexes failed: %v", err)
+	}
+
+	// renameCollection 是管理命令，dropTarget 会原子地替换旧的汇总
+	rename := bson.D{
+		{Key: "renameCollection", Value: db.Name() + "." + novelUsageRebuildCollection},
+		{Key: "to", Value: db.Name() + ".novel_usage_daily"},
+		{Key: "dropTarget", Value: true},
+	}
+	if err := as.db.GetClient().Database("admin").RunCommand(ctx, rename).Err(); err != nil {
+		return 0, fmt.Errorf("replace novel usage rollup failed: %v", err)
+	}
+
+	log.Printf("✅ 重建小说用量汇总: %d 条", len(rollups))
+	return len(rollups), nil
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"novel-resource-management/database"
+)
+
+// API Key 给充值回调和内部批处理这类不能登录的调用方使用，请求头是 Authorization: ApiKey <key>
+// key 的格式是 <keyId>.<secret>，只在创建和轮换时返回一次，数据库里只保存 secret 的 SHA-256
+// secret 是 32 字节随机数，不需要 bcrypt 这类慢哈希
+
+const (
+	apiKeyIDPrefix = "ak_"
+	// apiKeyLastUsedInterval lastUsedAt 最多每分钟写一次，避免每个请求都写数据库
+	apiKeyLastUsedInterval = time.Minute
+)
+
+var (
+	ErrInvalidAPIKey  = errors.New("invalid, revoked or expired api key")
+	ErrAPIKeyNotFound = errors.New("api key not found")
+)
+
+// APIKeyService 创建、列出、吊销、轮换和校验 API Key
+type APIKeyService struct {
+	keys *mongo.Collection
+}
+
+func NewAPIKeyService() *APIKeyService {
+	return &APIKeyService{
+		keys: database.GetMongoInstance().GetCollection("api_keys"),
+	}
+}
+
+// Create 创建 API Key，expiresIn 为 0 表示不过期，返回记录和只出现这一次的完整 key
+func (ks *APIKeyService) Create(ctx context.Context, name string, scopes []string, expiresIn time.Duration, createdBy string) (*database.APIKey, string, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, "", fmt.Errorf("api key name can not be empty")
+	}
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("api key needs at least one scope")
+	}
+
+	now := time.Now()
+	key := &database.APIKey{
+		Name:      name,
+		Scopes:    scopes,
+		CreatedBy: createdBy,
+		CreatedAt: now.Format("2006-01-02 15:04:05"),
+		UpdatedAt: now.Format("2006-01-02 15:04:05"),
+	}
+	if expiresIn > 0 {
+		expiresAt := now.Add(expiresIn)
+		key.ExpiresAt = &expiresAt
+	}
+	plaintext, err := ks.insert(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+	log.Printf("🔑 创建 API Key %s (%s)，scopes=%v，创建人 %s", key.ID, name, scopes, createdBy)
+	return key, plaintext, nil
+}
+
+// List 列出全部 API Key，不包含密钥
+func (ks *APIKeyService) List(ctx context.Context) ([]database.APIKey, error) {
+	cursor, err := ks.keys.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		return nil, fmt.Errorf("list api keys failed: %v", err)
+	}
+	keys := []database.APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, fmt.Errorf("decode api keys failed: %v", err)
+	}
+	return keys, nil
+}
+
+// Revoke 吊销 API Key，立即失效
+func (ks *APIKeyService) Revoke(ctx context.Context, keyID string) error {
+	result, err := ks.keys.UpdateOne(ctx, bson.M{"_id": keyID}, bson.M{"$set": bson.M{
+		"revoked":   true,
+		"updatedAt": time.Now().Format("2006-01-02 15:04:05"),
+	}})
+	if err != nil {
+		return fmt.Errorf("revoke api key failed: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrAPIKeyNotFound
+	}
+	log.Printf("🔑 吊销 API Key %s", keyID)
+	return nil
+}
+
+// Rotate 用同样的名字、scopes 和有效期创建新 key，旧 key 在 grace 之后失效，grace 为 0 时立即吊销
+// 调用方可以在宽限期内切换到新 key，不需要停机
+func (ks *APIKeyService) Rotate(ctx context.Context, keyID string, grace time.Duration, rotatedBy string) (*database.APIKey, string, error) {
+	var old database.APIKey
+	err := ks.keys.FindOne(ctx, bson.M{"_id": keyID, "revoked": false}).Decode(&old)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, "", ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("find api key failed: %v", err)
+	}
+
+	now := time.Now()
+	key := &database.APIKey{
+		Name:      old.Name,
+		Scopes:    old.Scopes,
+		ExpiresAt: old.ExpiresAt,
+		CreatedBy: rotatedBy,
+		CreatedAt: now.Format("2006-01-02 15:04:05"),
+		UpdatedAt: now.Format("2006-01-02 15:04:05"),
+	}
+	plaintext, err := ks.insert(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	update := bson.M{"rotatedTo": key.ID, "updatedAt": now.Format("2006-01-02 15:04:05")}
+	if grace > 0 {
+		graceEnd := now.Add(grace)
+		if old.ExpiresAt == nil || graceEnd.Before(*old.ExpiresAt) {
+			update["expiresAt"] = graceEnd
+		}
+	} else {
+		update["revoked"] = true
+	}
+	if _, err := ks.keys.UpdateOne(ctx, bson.M{"_id": old.ID}, bson.M{"$set": update}); err != nil {
+		return nil, "", fmt.Errorf("retire old api key failed: %v", err)
+	}
+	log.Printf("🔑 轮换 API Key %s -> %s，旧 key 宽限期 %s", old.ID, key.ID, grace)
+	return key, plaintext, nil
+}
+
+// Verify 校验完整的 key，返回 keyId 和 scopes
+func (ks *APIKeyService) Verify(ctx context.Context, plaintext string) (string, []string, error) {
+	keyID, secret, found := strings.Cut(plaintext, ".")
+	if !found || !strings.HasPrefix(keyID, apiKeyIDPrefix) || secret == "" {
+		return "", nil, ErrInvalidAPIKey
+	}
+
+	var key database.APIKey
+	err := ks.keys.FindOne(ctx, bson.M{"_id": keyID}).Decode(&key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("find api key failed: %v", err)
+	}
+
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(hashAPIKeySecret(secret)), []byte(key.SecretHash)) != 1 ||
+		key.Revoked || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return "", nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyLastUsedInterval {
+		if _, err := ks.keys.UpdateOne(ctx, bson.M{"_id": key.ID}, bson.M{"$set": bson.M{"lastUsedAt": now}}); err != nil {
+			log.Printf("⚠️ 更新 API Key %s 的 lastUsedAt 失败: %v", key.ID, err)
+		}
+	}
+	return key.ID, key.Scopes, nil
+}
+
+// insert 生成 keyId 和 secret 并保存，返回完整 key
+func (ks *APIKeyService) insert(ctx context.Context, key *database.APIKey) (string, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("generate api key failed: %v", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("generate api key failed: %v", err)
+	}
+
+	key.ID = apiKeyIDPrefix + hex.EncodeToString(id)
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+	key.SecretHash = hashAPIKeySecret(encodedSecret)
+	if _, err := ks.keys.InsertOne(ctx, key); err != nil {
+		return "", fmt.Errorf("save api key failed: %v", err)
+	}
+	return key.ID + "." + encodedSecret, nil
+}
+
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,376 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"novel-resource-management/database"
+)
+
+// auditCollections 参与快照的集合和文档的业务主键，顺序固定，叶子按集合、主键排序
+var auditCollections = []struct {
+	name     string
+	keyField string
+}{
+	{name: "novels", keyField: "_id"},
+	{name: "user_credits", keyField: "userId"},
+}
+
+var (
+	// ErrUnknownAuditCollection 不参与快照的集合
+	ErrUnknownAuditCollection = errors.New("collection is not covered by audit snapshots")
+	// ErrNoAuditSnapshot 还没有锚定过快照
+	ErrNoAuditSnapshot = errors.New("no audit snapshot has been anchored")
+	// ErrAuditLeafNotFound 文档不在最新的快照里
+	ErrAuditLeafNotFound = errors.New("document is not in the latest audit snapshot")
+)
+
+// auditSnapshotMu 定时任务和手动触发用的是不同的 AuditService，同一时间只做一次快照
+var auditSnapshotMu sync.Mutex
+
+// auditTakenAtLayout 快照时间，UTC 定宽纳秒，同一秒内的多次快照不会冲突，按字符串排序就是时间顺序
+const auditTakenAtLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// AuditService 对 MongoDB 读模型做 Merkle 快照并锚定到账本，给审计提供包含证明
+type AuditService struct {
+	contract *Contract
+	db       *database.MongoDBInstance
+	// retain 保留叶子和内部节点的最近快照数
+	retain int
+}
+
+func NewAuditService(chaincode *Chaincode, retainSnapshots int) *AuditService {
+	return &AuditService{contract: chaincode.Contract(AdminContractName), db: database.GetMongoInstance(), retain: retainSnapshots}
+}
+
+// AuditProof 一个文档在快照中的包含证明
+// 审计方用 leafHash 和 proof 重新计算 root，再用 txId / takenAt 到账本上核对 root
+type AuditProof struct {
+	Collection string            `json:"collection"`
+	DocID      string            `json:"docId"`
+	SnapshotID string            `json:"snapshotId"`
+	TakenAt    string            `json:"takenAt"`
+	Root       string            `json:"root"`
+	Count      int               `json:"count"`
+	TxID       string            `json:"txId"`
+	LeafIndex  int               `json:"leafIndex"`
+	LeafHash   string            `json:"leafHash"`
+	Proof      []MerkleProofStep `json:"proof"`
+	// CurrentHash 文档当前内容的叶子哈希，文档已删除时为空，和 LeafHash 不同说明快照后被修改过
+	CurrentHash     string `json:"currentHash"`
+	MatchesSnapshot bool   `json:"matchesSnapshot"`
+	// Anchored 账本上 takenAt 对应的根和 Root 一致
+	Anchored bool `json:"anchored"`
+}
+
+// StartSnapshotJob 按 interval（配置的 audit.snapshot_interval）定时做快照，ctx 取消后退出，0 表示不做定时快照
+func (as *AuditService) StartSnapshotJob(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		log.Println("ℹ️ 定时快照已关闭")
+		return
+	}
+	log.Printf("🔏 启动快照锚定任务，间隔 %s", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			snapshot, err := as.TakeSnapshot(ctx)
+			if err != nil {
+				log.Printf("❌ 快照锚定失败: %v", err)
+				continue
+			}
+			log.Printf("✅ 快照已锚定: takenAt=%s, root=%s, count=%d, txId=%s",
+				snapshot.TakenAt, snapshot.Root, snapshot.Count, snapshot.TxID)
+		}
+	}
+}
+
+// TakeSnapshot 计算 novels 和 user_credits 的 Merkle 树，调用 AnchorSnapshot 上链后保存根、叶子和内部节点
+// 上链失败时什么都不保存；快照记录最后写入，证明只使用写完整的快照
+func (as *AuditService) TakeSnapshot(ctx context.Context) (*database.AuditSnapshot, error) {
+	auditSnapshotMu.Lock()
+	defer auditSnapshotMu.Unlock()
+
+	takenAt := time.Now().UTC().Format(auditTakenAtLayout)
+	leaves, hashes, err := as.collectLeaves(ctx, takenAt)
+	if err != nil {
+		return nil, err
+	}
+	levels := merkleLevels(hashes)
+	root := hex.EncodeToString(merkleRoot(hashes))
+
+	result, err := submitWithRetry(ctx, as.contract, "AnchorSnapshot", root, strconv.Itoa(len(leaves)), takenAt)
+	if err != nil {
+		return nil, fmt.Errorf("anchor snapshot failed: %v", err)
+	}
+	var anchor struct {
+		TxID string `json:"txId"`
+	}
+	if err := json.Unmarshal(result, &anchor); err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %v", err)
+	}
+
+	if len(leaves) > 0 {
+		docs := make([]interface{}, len(leaves))
+		for i := range leaves {
+			docs[i] = leaves[i]
+		}
+		if _, err := as.db.GetCollection("audit_snapshot_leaves").InsertMany(ctx, docs); err != nil {
+			return nil, fmt.Errorf("save snapshot leaves failed (anchored in tx %s): %v", anchor.TxID, err)
+		}
+	}
+	// 第 0 层是叶子，已经保存过了
+	nodes := []interface{}{}
+	for level := 1; level < len(levels); level++ {
+		for index, hash := range levels[level] {
+			nodes = append(nodes, database.AuditNode{
+				ID:         fmt.Sprintf("%s|%d|%d", takenAt, level, index),
+				SnapshotID: takenAt,
+				Level:      level,
+				Index:      index,
+				Hash:       hex.EncodeToString(hash),
+			})
+		}
+	}
+	if len(nodes) > 0 {
+		if _, err := as.db.GetCollection("audit_snapshot_nodes").InsertMany(ctx, nodes); err != nil {
+			return nil, fmt.Errorf("save snapshot nodes failed (anchored in tx %s): %v", anchor.TxID, err)
+		}
+	}
+
+	snapshot := &database.AuditSnapshot{
+		ID:      takenAt,
+		Root:    root,
+		Count:   len(leaves),
+		TakenAt: takenAt,
+		TxID:    anchor.TxID,
+	}
+	if _, err := as.db.GetCollection("audit_snapshots").InsertOne(ctx, snapshot); err != nil {
+		return nil, fmt.Errorf("save snapshot failed (anchored in tx %s): %v", anchor.TxID, err)
+	}
+
+	// 清理失败不影响这次快照，下次快照会再清理
+	if err := as.pruneSnapshots(ctx); err != nil {
+		log.Printf("⚠️ 清理旧快照的叶子失败: %v", err)
+	}
+	return snapshot, nil
+}
+
+// pruneSnapshots 只保留最近 retain 次快照的叶子和内部节点，更早的快照记录（根和交易ID）保留
+// 没有写完快照记录的叶子也会在它之后的快照超出保留数时一起清理
+func (as *AuditService) pruneSnapshots(ctx context.Context) error {
+	if as.retain < 1 {
+		return nil
+	}
+	var oldest database.AuditSnapshot
+	opts := options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}}).SetSkip(int64(as.retain - 1))
+	err := as.db.GetCollection("audit_snapshots").FindOne(ctx, bson.M{}, opts).Decode(&oldest)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("find oldest retained snapshot failed: %v", err)
+	}
+
+	filter := bson.M{"snapshotId": bson.M{"$lt": oldest.ID}}
+	for _, name := range []string{"audit_snapshot_leaves", "audit_snapshot_nodes"} {
+		if _, err := as.db.GetCollection(name).DeleteMany(ctx, filter); err != nil {
+			return fmt.Errorf("prune %s failed: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// collectLeaves 按集合、主键顺序读取所有文档，计算叶子哈希
+func (as *AuditService) collectLeaves(ctx context.Context, snapshotID string) ([]database.AuditLeaf, [][]byte, error) {
+	leaves := []database.AuditLeaf{}
+	hashes := [][]byte{}
+
+	for _, c := range auditCollections {
+		opts := options.Find().SetSort(bson.D{{Key: c.keyField, Value: 1}})
+		cursor, err := as.db.GetCollection(c.name).Find(ctx, bson.M{}, opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read %s failed: %v", c.name, err)
+		}
+
+		for cursor.Next(ctx) {
+			docID, hash, err := auditLeafHash(c.name, cursor.Current)
+			if err != nil {
+				cursor.Close(ctx)
+				return nil, nil, err
+			}
+			index := len(leaves)
+			leaves = append(leaves, database.AuditLeaf{
+				ID:         fmt.Sprintf("%s|%d", snapshotID, index),
+				SnapshotID: snapshotID,
+				Index:      index,
+				Collection: c.name,
+				DocID:      docID,
+				Hash:       hex.EncodeToString(hash),
+			})
+			hashes = append(hashes, hash)
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read %s failed: %v", c.name, err)
+		}
+	}
+	return leaves, hashes, nil
+}
+
+// auditLeafHash 把文档解码成和链码一致的结构体，用它的 JSON 作为规范化内容
+// 结构体字段顺序固定，所以同样的数据总是得到同样的 JSON
+func auditLeafHash(collection string, raw bson.Raw) (string, []byte, error) {
+	var docID string
+	var canonical []byte
+	var err error
+
+	switch collection {
+	case "novels":
+		var novel database.Novel
+		if err = bson.Unmarshal(raw, &novel); err != nil {
+			return "", nil, fmt.Errorf("decode novel failed: %v", err)
+		}
+		docID = novel.ID
+		canonical, err = json.Marshal(novel)
+	case "user_credits":
+		var userCredit database.UserCredit
+		if err = bson.Unmarshal(raw, &userCredit); err != nil {
+			return "", nil, fmt.Errorf("decode user credit failed: %v", err)
+		}
+		docID = userCredit.UserID
+		canonical, err = json.Marshal(userCredit)
+	default:
+		return "", nil, ErrUnknownAuditCollection
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("marshal %s failed: %v", collection, err)
+	}
+	return docID, merkleLeafHash(collection, docID, canonical), nil
+}
+
+// GetProof 文档在最新快照中的包含证明，并核对账本上锚定的根
+func (as *AuditService) GetProof(ctx context.Context, collection, docID string) (*AuditProof, error) {
+	keyField := ""
+	for _, c := range auditCollections {
+		if c.name == collection {
+			keyField = c.keyField
+		}
+	}
+	if keyField == "" {
+		return nil, ErrUnknownAuditCollection
+	}
+
+	var snapshot database.AuditSnapshot
+	opts := options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}})
+	err := as.db.GetCollection("audit_snapshots").FindOne(ctx, bson.M{}, opts).Decode(&snapshot)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNoAuditSnapshot
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get latest snapshot failed: %v", err)
+	}
+
+	leavesCollection := as.db.GetCollection("audit_snapshot_leaves")
+	var leaf database.AuditLeaf
+	err = leavesCollection.FindOne(ctx, bson.M{"snapshotId": snapshot.ID, "collection": collection, "docId": docID}).Decode(&leaf)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrAuditLeafNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get snapshot leaf failed: %v", err)
+	}
+
+	// 只读取路径上的兄弟节点，再用证明重新计算根，和快照的根核对
+	steps, err := as.proofSteps(ctx, snapshot, leaf.Index)
+	if err != nil {
+		return nil, err
+	}
+	if !VerifyMerkleProof(leaf.Hash, steps, snapshot.Root) {
+		return nil, fmt.Errorf("snapshot %s proof does not match root", snapshot.ID)
+	}
+
+	proof := &AuditProof{
+		Collection: collection,
+		DocID:      docID,
+		SnapshotID: snapshot.ID,
+		TakenAt:    snapshot.TakenAt,
+		Root:       snapshot.Root,
+		Count:      snapshot.Count,
+		TxID:       snapshot.TxID,
+		LeafIndex:  leaf.Index,
+		LeafHash:   leaf.Hash,
+		Proof:      steps,
+	}
+
+	// 当前文档内容，删除了就留空
+	raw, err := as.db.GetCollection(collection).FindOne(ctx, bson.M{keyField: docID}).Raw()
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("read %s %s failed: %v", collection, docID, err)
+	}
+	if err == nil {
+		_, current, err := auditLeafHash(collection, raw)
+		if err != nil {
+			return nil, err
+		}
+		proof.CurrentHash = hex.EncodeToString(current)
+		proof.MatchesSnapshot = proof.CurrentHash == leaf.Hash
+	}
+
+	result, err := evaluateTransaction(ctx, as.contract, "ReadSnapshot", snapshot.TakenAt)
+	if err != nil {
+		return nil, fmt.Errorf("read anchored snapshot failed: %v", err)
+	}
+	var anchor struct {
+		Root string `json:"root"`
+	}
+	if err := json.Unmarshal(result, &anchor); err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %v", err)
+	}
+	proof.Anchored = anchor.Root == snapshot.Root
+
+	return proof, nil
+}
+
+// proofSteps 按 merkleProofPath 读取第 index 个叶子的兄弟节点：第 0 层在 audit_snapshot_leaves，其他层在 audit_snapshot_nodes
+func (as *AuditService) proofSteps(ctx context.Context, snapshot database.AuditSnapshot, index int) ([]MerkleProofStep, error) {
+	path := merkleProofPath(snapshot.Count, index)
+	steps := make([]MerkleProofStep, len(path))
+	for i, ref := range path {
+		collection := "audit_snapshot_nodes"
+		id := fmt.Sprintf("%s|%d|%d", snapshot.ID, ref.Level, ref.Index)
+		if ref.Level == 0 {
+			collection = "audit_snapshot_leaves"
+			id = fmt.Sprintf("%s|%d", snapshot.ID, ref.Index)
+		}
+
+		var node struct {
+			Hash string `bson:"hash"`
+		}
+		err := as.db.GetCollection(collection).FindOne(ctx, bson.M{"_id": id}).Decode(&node)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("snapshot %s is missing node %d/%d", snapshot.ID, ref.Level, ref.Index)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read snapshot node failed: %v", err)
+		}
+		steps[i] = MerkleProofStep{Hash: node.Hash, Position: ref.Position}
+	}
+	return steps, nil
+}
@@ -0,0 +1,340 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"novel-resource-management/config"
+	"novel-resource-management/database"
+)
+
+// 登录认证：users 集合里的密码哈希支持 bcrypt 和 argon2id，登录成功后签发 HS256 的访问令牌和刷新令牌
+// 两种令牌都带会话ID，校验访问令牌时确认会话没有被吊销，所以退出登录立即生效
+
+// RoleUser 没有设置角色的用户按普通用户处理，各角色的权限见 config/policy.yaml
+const RoleUser = "user"
+
+const (
+	tokenIssuer = "novel-resource-management"
+
+	tokenTypeAccess  = "access"
+	tokenTypeRefresh = "refresh"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrUserInactive       = errors.New("user is inactive")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+)
+
+// dummyPasswordHash 用户不存在时也比较一次哈希，避免通过响应时间判断邮箱是否注册
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+// AuthClaims JWT 载荷，Subject 是用户ID
+type AuthClaims struct {
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+	TokenType string `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+// TokenPair 登录和刷新返回的令牌
+type TokenPair struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int    `json:"expiresIn"` // 访问令牌的有效秒数
+}
+
+// AuthService 登录、刷新、退出和访问令牌校验
+type AuthService struct {
+	users      *mongo.Collection
+	sessions   *mongo.Collection
+	secret     []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+// NewAuthService 令牌密钥和有效期来自配置的 auth 部分
+func NewAuthService(cfg config.AuthConfig) *AuthService {
+	secret := []byte(cfg.JWTSecret)
+	if len(secret) == 0 {
+		// 随机密钥只在本进程有效，重启后所有令牌失效，多实例部署时令牌也不通用，所以只有 dev 环境允许不配置
+		log.Printf("⚠️ 警告: JWT_SECRET 未设置，使用随机密钥")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic(fmt.Sprintf("生成 JWT 密钥失败: %v", err))
+		}
+	}
+
+	db := database.GetMongoInstance()
+	as := &AuthService{
+		users:      db.GetCollection("users"),
+		sessions:   db.GetCollection("auth_sessions"),
+		secret:     secret,
+		accessTTL:  cfg.AccessTTL.Duration,
+		refreshTTL: cfg.RefreshTTL.Duration,
+	}
+
+	// 过期的会话由 TTL 索引清理
+	_, err := as.sessions.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.M{"expiresAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Printf("⚠️ 创建 auth_sessions 集合的 TTL 索引失败: %v", err)
+	}
+	return as
+}
+
+// Login 用邮箱或用户名加密码登录，成功后创建会话并签发令牌
+func (as *AuthService) Login(ctx context.Context, login, password string) (*TokenPair, *database.User, error) {
+	var user database.User
+	err := as.users.FindOne(ctx, bson.M{"$or": bson.A{
+		bson.M{"email": login},
+		bson.M{"username": login},
+	}}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("find user failed: %v", err)
+	}
+
+	ok, err := VerifyPassword(user.PasswordHash, password)
+	if err != nil {
+		log.Printf("⚠️ 用户 %s 的密码哈希无法识别: %v", user.ID, err)
+		return nil, nil, ErrInvalidCredentials
+	}
+	if !ok {
+		return nil, nil, ErrInvalidCredentials
+	}
+	if !user.IsActive {
+		return nil, nil, ErrUserInactive
+	}
+
+	now := time.Now()
+	session := &database.AuthSession{
+		ID:        randomTokenID(),
+		UserID:    user.ID,
+		RefreshID: randomTokenID(),
+		ExpiresAt: now.Add(as.refreshTTL),
+		CreatedAt: now.Format("2006-01-02 15:04:05"),
+		UpdatedAt: now.Format("2006-01-02 15:04:05"),
+	}
+	if _, err := as.sessions.InsertOne(ctx, session); err != nil {
+		return nil, nil, fmt.Errorf("create session failed: %v", err)
+	}
+
+	pair, err := as.issue(&user, session, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	user.PasswordHash = ""
+	return pair, &user, nil
+}
+
+// Refresh 用刷新令牌换一对新令牌，旧的刷新令牌立即失效
+// 已经轮换掉的刷新令牌再次出现说明可能被盗用，吊销整个会话
+func (as *AuthService) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	claims, err := as.parse(refreshToken, tokenTypeRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	newRefreshID := randomTokenID()
+	var session database.AuthSession
+	err = as.sessions.FindOneAndUpdate(ctx,
+		bson.M{"_id": claims.SessionID, "refreshId": claims.ID, "revoked": false},
+		bson.M{"$set": bson.M{
+			"refreshId": newRefreshID,
+			"expiresAt": now.Add(as.refreshTTL),
+			"updatedAt": now.Format("2006-01-02 15:04:05"),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if revokeErr := as.revokeSession(ctx, claims.SessionID); revokeErr != nil {
+			log.Printf("⚠️ 吊销会话 %s 失败: %v", claims.SessionID, revokeErr)
+		}
+		log.Printf("🚨 会话 %s 的刷新令牌无效或被重复使用，已吊销", claims.SessionID)
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rotate refresh token failed: %v", err)
+	}
+
+	// 重新读取用户，角色变更和停用在刷新时生效
+	var user database.User
+	if err := as.users.FindOne(ctx, bson.M{"_id": session.UserID}).Decode(&user); err != nil {
+		_ = as.revokeSession(ctx, session.ID)
+		return nil, ErrInvalidToken
+	}
+	if !user.IsActive {
+		_ = as.revokeSession(ctx, session.ID)
+		return nil, ErrUserInactive
+	}
+	return as.issue(&user, &session, now)
+}
+
+// Logout 吊销访问令牌所在的会话，会话下的访问令牌和刷新令牌都会失效
+func (as *AuthService) Logout(ctx context.Context, accessToken string) error {
+	claims, err := as.parse(accessToken, tokenTypeAccess)
+	if err != nil {
+		return err
+	}
+	return as.revokeSession(ctx, claims.SessionID)
+}
+
+// VerifyAccessToken 校验访问令牌并确认会话仍然有效，返回用户ID和角色
+func (as *AuthService) VerifyAccessToken(ctx context.Context, accessToken string) (string, string, error) {
+	claims, err := as.parse(accessToken, tokenTypeAccess)
+	if err != nil {
+		return "", "", err
+	}
+	count, err := as.sessions.CountDocuments(ctx, bson.M{"_id": claims.SessionID, "revoked": false}, options.Count().SetLimit(1))
+	if err != nil {
+		return "", "", fmt.Errorf("check session failed: %v", err)
+	}
+	if count == 0 {
+		return "", "", ErrInvalidToken
+	}
+	return claims.Subject, claims.Role, nil
+}
+
+func (as *AuthService) issue(user *database.User, session *database.AuthSession, now time.Time) (*TokenPair, error) {
+	role := user.Role
+	if role == "" {
+		role = RoleUser
+	}
+
+	access, err := as.sign(&AuthClaims{
+		Role:      role,
+		SessionID: session.ID,
+		TokenType: tokenTypeAccess,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   user.ID,
+			ID:        randomTokenID(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(as.accessTTL)),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := as.sign(&AuthClaims{
+		Role:      role,
+		SessionID: session.ID,
+		TokenType: tokenTypeRefresh,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   user.ID,
+			ID:        session.RefreshID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(session.ExpiresAt),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(as.accessTTL.Seconds()),
+	}, nil
+}
+
+func (as *AuthService) sign(claims *AuthClaims) (string, error) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(as.secret)
+	if err != nil {
+		return "", fmt.Errorf("sign token failed: %v", err)
+	}
+	return token, nil
+}
+
+// parse 校验签名、过期时间、签发方和令牌类型
+func (as *AuthService) parse(token, tokenType string) (*AuthClaims, error) {
+	var claims AuthClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return as.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(tokenIssuer), jwt.WithExpirationRequired())
+	if err != nil || claims.TokenType != tokenType || claims.SessionID == "" || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+func (as *AuthService) revokeSession(ctx context.Context, sessionID string) error {
+	_, err := as.sessions.UpdateOne(ctx, bson.M{"_id": sessionID}, bson.M{"$set": bson.M{
+		"revoked":   true,
+		"updatedAt": time.Now().Format("2006-01-02 15:04:05"),
+	}})
+	return err
+}
+
+// VerifyPassword 比较密码和哈希，支持 bcrypt（$2a$、$2b$、$2y$）和 argon2id 的 PHC 格式
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>，salt 和 hash 是不带填充的 base64
+func VerifyPassword(hash, password string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	case strings.HasPrefix(hash, "$argon2id$"):
+		parts := strings.Split(hash, "$")
+		if len(parts) != 6 {
+			return false, fmt.Errorf("malformed argon2id hash")
+		}
+		var version int
+		if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+			return false, fmt.Errorf("unsupported argon2id version %s", parts[2])
+		}
+		var memory, iterations uint32
+		var threads uint8
+		if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+			return false, fmt.Errorf("malformed argon2id parameters: %v", err)
+		}
+		salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+		if err != nil {
+			return false, fmt.Errorf("malformed argon2id salt: %v", err)
+		}
+		expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+		if err != nil {
+			return false, fmt.Errorf("malformed argon2id hash: %v", err)
+		}
+		actual := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(expected)))
+		return subtle.ConstantTimeCompare(actual, expected) == 1, nil
+	default:
+		return false, fmt.Errorf("unsupported password hash")
+	}
+}
+
+func randomTokenID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("生成随机ID失败: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
@@ -5,31 +5,24 @@ import (
 	"fmt"
 	"log"
 
-	"github.com/hyperledger/fabric-gateway/pkg/client"
+	model "novel-resource-model/v1"
 )
 
 // ChaincodeMigrationService 链码迁移服务
+// 导入走 AdminContract，状态检查分别读 NovelContract 和 CreditContract
 type ChaincodeMigrationService struct {
-	contract *client.Contract
+	contract       *Contract
+	novelContract  *Contract
+	creditContract *Contract
 }
 
 // NewChaincodeMigrationService 创建链码迁移服务
-func NewChaincodeMigrationService(gateway *client.Gateway) (*ChaincodeMigrationService, error) {
-	//先找到channel
-	network := gateway.GetNetwork("mychannel")
-	if network == nil {
-		return nil, fmt.Errorf("无法获取network对象")
-	}
-
-	//再拿到合约
-	contract := network.GetContract("novel-basic")
-	if contract == nil {
-		return nil, fmt.Errorf("无法获取contract")
-	}
-
+func NewChaincodeMigrationService(chaincode *Chaincode) *ChaincodeMigrationService {
 	return &ChaincodeMigrationService{
-		contract: contract,
-	}, nil
+		contract:       chaincode.Contract(AdminContractName),
+		novelContract:  chaincode.Contract(NovelContractName),
+		creditContract: chaincode.Contract(CreditContractName),
+	}
 }
 
 // InitChaincodeFromMongoDB 从 MongoDB 数据初始化链码
@@ -64,7 +57,7 @@ func (cms *ChaincodeMigrationService) InitChaincodeFromMongoDB(ctx context.Conte
 	log.Printf("📦 准备导入链码的数据大小: %d 字符", len(jsonData))
 
 	// 调用链码的 InitFromMongoDB 方法
-	result, err := cms.contract.SubmitTransaction("InitFromMongoDB", jsonData)
+	result, err := submitWithRetry(ctx, cms.contract, "InitFromMongoDB", jsonData)
 	if err != nil {
 		return "", fmt.Errorf("调用链码 InitFromMongoDB 失败: %v", err)
 	}
@@ -78,22 +71,32 @@ func (cms *ChaincodeMigrationService) GetChaincodeStatus(ctx context.Context) (m
 	log.Println("🔍 检查链码状态...")
 
 	// 获取所有 novels
-	novelsResult, err := cms.contract.EvaluateTransaction("GetAllNovels")
+	novelsResult, err := evaluateTransaction(ctx, cms.novelContract, "GetAllNovels")
 	if err != nil {
 		return nil, fmt.Errorf("获取 novels 失败: %v", err)
 	}
 
 	// 获取所有 userCredits
-	userCreditsResult, err := cms.contract.EvaluateTransaction("GetAllUserCredits")
+	userCreditsResult, err := evaluateTransaction(ctx, cms.creditContract, "GetAllUserCredits")
 	if err != nil {
 		return nil, fmt.Errorf("获取 userCredits 失败: %v", err)
 	}
 
+	// 按共享模型解码后计数，解码失败说明链上数据和模型对不上
+	novels, err := decodeResultList[model.Novel](novelsResult)
+	if err != nil {
+		return nil, fmt.Errorf("解析 novels 失败: %v", err)
+	}
+	userCredits, err := decodeResultList[model.UserCredit](userCreditsResult)
+	if err != nil {
+		return nil, fmt.Errorf("解析 userCredits 失败: %v", err)
+	}
+
 	status := map[string]interface{}{
-		"chaincodeConnected": true,
-		"novelsCount":        len(string(novelsResult)),
-		"userCreditsCount":   len(string(userCreditsResult)),
-		"novelsDataSize":     len(novelsResult),
+		"chaincodeConnected":  true,
+		"novelsCount":         len(novels),
+		"userCreditsCount":    len(userCredits),
+		"novelsDataSize":      len(novelsResult),
 		"userCreditsDataSize": len(userCreditsResult),
 	}
 
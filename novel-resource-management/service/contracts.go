@@ -0,0 +1,73 @@
+package service
+
+import (
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+
+	"novel-resource-management/config"
+)
+
+// 链码里的三个合约，交易按合约名路由
+const (
+	NovelContractName  = "NovelContract"
+	CreditContractName = "CreditContract"
+	AdminContractName  = "AdminContract"
+)
+
+// Chaincode 配置里指定的通道和链码，服务的构造函数从它获取合约
+// dev、staging、prod 的通道名和链码名不同，只需要改配置
+// AdminContract 的交易走平台管理员身份的 gateway，其他合约走服务自己的身份
+type Chaincode struct {
+	network         *client.Network
+	adminNetwork    *client.Network
+	name            string
+	evaluateTimeout time.Duration
+	retry           SubmitRetryConfig
+}
+
+// Contract 链码里的一个合约，带上查询超时和提交交易的重试配置
+type Contract struct {
+	*client.Contract
+	evaluateTimeout time.Duration
+	retry           SubmitRetryConfig
+}
+
+// NewChaincode adminGateway 用平台管理员身份连接，没有单独的管理员身份时和 gateway 相同
+func NewChaincode(gateway, adminGateway *client.Gateway, cfg config.FabricConfig) *Chaincode {
+	return &Chaincode{
+		network:         gateway.GetNetwork(cfg.Channel),
+		adminNetwork:    adminGateway.GetNetwork(cfg.Channel),
+		name:            cfg.Chaincode,
+		evaluateTimeout: cfg.EvaluateTimeout.Duration,
+		retry: SubmitRetryConfig{
+			MaxAttempts: cfg.Retry.MaxAttempts,
+			BaseDelay:   cfg.Retry.BaseDelay.Duration,
+			MaxDelay:    cfg.Retry.MaxDelay.Duration,
+			Timeout:     cfg.Retry.Timeout.Duration,
+		},
+	}
+}
+
+// Contract 链码里名为 contractName 的合约，AdminContract 用管理员身份签名
+func (c *Chaincode) Contract(contractName string) *Contract {
+	network := c.network
+	if contractName == AdminContractName {
+		network = c.adminNetwork
+	}
+	return &Contract{
+		Contract:        network.GetContractWithName(c.name, contractName),
+		evaluateTimeout: c.evaluateTimeout,
+		retry:           c.retry,
+	}
+}
+
+// Network 链码所在的通道，监听链码事件时使用
+func (c *Chaincode) Network() *client.Network {
+	return c.network
+}
+
+// Name 链码名
+func (c *Chaincode) Name() string {
+	return c.name
+}
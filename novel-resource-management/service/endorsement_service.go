@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	model "novel-resource-model/v1"
+)
+
+// EndorsementService 查看和修改链上高价值记录的 key 级别背书策略
+// 用户积分和充值订单的 key 可以要求平台和账务组织共同背书，小说 key 始终使用链码级别策略
+type EndorsementService struct {
+	contract *Contract
+}
+
+func NewEndorsementService(chaincode *Chaincode) *EndorsementService {
+	return &EndorsementService{contract: chaincode.Contract(AdminContractName)}
+}
+
+// GetEndorsementConfig 高价值门槛和账务组织
+func (es *EndorsementService) GetEndorsementConfig(ctx context.Context) (*model.EndorsementConfig, error) {
+	result, err := evaluateTransaction(ctx, es.contract, "GetEndorsementConfig")
+	if err != nil {
+		return nil, fmt.Errorf("get endorsement config failed: %v", err)
+	}
+	return decodeResult[model.EndorsementConfig](result)
+}
+
+// SetEndorsementConfig 修改高价值门槛和账务组织，threshold 为 0 表示不按余额区分
+func (es *EndorsementService) SetEndorsementConfig(ctx context.Context, threshold int, billingMspId string) (*model.EndorsementConfig, error) {
+	result, err := submitWithRetry(ctx, es.contract, "SetEndorsementConfig", strconv.Itoa(threshold), billingMspId)
+	if err != nil {
+		return nil, fmt.Errorf("set endorsement config failed: %v", err)
+	}
+	return decodeResult[model.EndorsementConfig](result)
+}
+
+// GetKeyEndorsementPolicy entityType 是 UserCredit 或 RechargeOrder
+func (es *EndorsementService) GetKeyEndorsementPolicy(ctx context.Context, entityType, entityId string) (*model.KeyEndorsementPolicy, error) {
+	result, err := evaluateTransaction(ctx, es.contract, "GetKeyEndorsementPolicy", entityType, entityId)
+	if err != nil {
+		return nil, fmt.Errorf("get key endorsement policy failed: %v", err)
+	}
+	return decodeResult[model.KeyEndorsementPolicy](result)
+}
+
+// SetKeyEndorsementPolicy orgs 为空表示恢复链码级别策略
+func (es *EndorsementService) SetKeyEndorsementPolicy(ctx context.Context, entityType, entityId string, orgs []string) (*model.KeyEndorsementPolicy, error) {
+	if orgs == nil {
+		orgs = []string{}
+	}
+	// 链码的 []string 参数按 JSON 数组传递
+	orgsJSON, err := json.Marshal(orgs)
+	if err != nil {
+		return nil, fmt.Errorf("marshal orgs failed: %v", err)
+	}
+
+	result, err := submitWithRetry(ctx, es.contract, "SetKeyEndorsementPolicy", entityType, entityId, string(orgsJSON))
+	if err != nil {
+		return nil, fmt.Errorf("set key endorsement policy failed: %v", err)
+	}
+	return decodeResult[model.KeyEndorsementPolicy](result)
+}
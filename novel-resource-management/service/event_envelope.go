@@ -0,0 +1,149 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+
+	model "novel-resource-model/v1"
+)
+
+// EventEnvelope 链码事件信封，和链码中的 EventEnvelope 保持一致
+// 旧版链码直接发送实体JSON，解码时会被包装成 schemaVersion 为 0 的信封
+type EventEnvelope struct {
+	Type          string          `json:"type"`
+	SchemaVersion int             `json:"schemaVersion"`
+	EntityType    string          `json:"entityType"`
+	EntityKey     string          `json:"entityKey"`
+	TxID          string          `json:"txId"`
+	Actor         string          `json:"actor,omitempty"`
+	Timestamp     string          `json:"timestamp,omitempty"`
+	Data          json.RawMessage `json:"data,omitempty"`
+	Previous      json.RawMessage `json:"previous,omitempty"`
+	// History 积分变动类事件（如 ConsumeUserToken）附带的积分历史
+	History json.RawMessage `json:"history,omitempty"`
+	// Holds 本次交易中状态发生变化的积分预留
+	Holds json.RawMessage `json:"holds,omitempty"`
+	// TraceParent 发起交易的请求的 W3C traceparent，由链码从交易的 transient 字段复制过来
+	TraceParent string `json:"traceparent,omitempty"`
+	// BlockNumber 不在链码载荷里，由事件监听方补充，便于下游排序
+	BlockNumber uint64 `json:"blockNumber"`
+}
+
+// LegacySchemaVersion 旧版裸实体事件对应的版本号
+const LegacySchemaVersion = 0
+
+// IsDelete 删除事件只有 previous 没有 data
+func (e *EventEnvelope) IsDelete() bool {
+	return strings.HasPrefix(e.Type, "Delete")
+}
+
+// DecodeEntity 严格解码事件里的实体：删除事件用 previous（删除前的记录），其他事件用 data
+func (e *EventEnvelope) DecodeEntity(v model.Validator) error {
+	part := e.Data
+	if e.IsDelete() {
+		part = e.Previous
+	}
+	if len(part) == 0 || string(part) == "null" {
+		return fmt.Errorf("event %s has no entity", e.Type)
+	}
+	if err := model.Decode(part, v); err != nil {
+		return fmt.Errorf("decode event entity failed: %w", err)
+	}
+	return nil
+}
+
+// DecodeHistory 解码附带的积分历史，没有积分历史时返回 nil
+func (e *EventEnvelope) DecodeHistory() (*model.CreditHistory, error) {
+	if len(e.History) == 0 || string(e.History) == "null" {
+		return nil, nil
+	}
+	var history model.CreditHistory
+	if err := model.Decode(e.History, &history); err != nil {
+		return nil, fmt.Errorf("decode event history failed: %w", err)
+	}
+	return &history, nil
+}
+
+// DecodeHolds 解码状态发生变化的预留，没有预留变化时返回空列表
+func (e *EventEnvelope) DecodeHolds() ([]model.CreditHold, error) {
+	holds, err := model.DecodeList[model.CreditHold](e.Holds)
+	if err != nil {
+		return nil, fmt.Errorf("decode event holds failed: %w", err)
+	}
+	return holds, nil
+}
+
+// DecodeChaincodeEvent 解码链码事件，兼容新版信封和旧版裸实体JSON
+func DecodeChaincodeEvent(event *client.ChaincodeEvent) (*EventEnvelope, error) {
+	envelope, err := decodeEventPayload(event.EventName, event.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if envelope.TxID == "" {
+		envelope.TxID = event.TransactionID
+	}
+	envelope.BlockNumber = event.BlockNumber
+	return envelope, nil
+}
+
+func decodeEventPayload(eventName string, payload []byte) (*EventEnvelope, error) {
+	var envelope EventEnvelope
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to parse event payload: %w", err)
+	}
+
+	// 新版信封一定带 schemaVersion 和 type
+	if envelope.SchemaVersion > LegacySchemaVersion && envelope.Type != "" {
+		return &envelope, nil
+	}
+
+	return wrapLegacyEvent(eventName, payload)
+}
+
+// wrapLegacyEvent 旧版事件载荷就是实体本身，删除事件携带的是删除前的记录
+func wrapLegacyEvent(eventName string, payload []byte) (*EventEnvelope, error) {
+	// 这里只取实体的 key，字段由 DecodeEntity 严格解码
+	var entity struct {
+		ID     string `json:"id"`
+		UserID string `json:"userId"`
+	}
+	if err := json.Unmarshal(payload, &entity); err != nil {
+		return nil, fmt.Errorf("failed to parse legacy event payload: %w", err)
+	}
+
+	envelope := &EventEnvelope{
+		Type:          eventName,
+		SchemaVersion: LegacySchemaVersion,
+		EntityType:    legacyEntityType(eventName),
+	}
+
+	switch envelope.EntityType {
+	case "Novel":
+		envelope.EntityKey = entity.ID
+	default:
+		envelope.EntityKey = entity.UserID
+	}
+
+	if envelope.IsDelete() {
+		envelope.Previous = json.RawMessage(payload)
+	} else {
+		envelope.Data = json.RawMessage(payload)
+	}
+	return envelope, nil
+}
+
+// legacyEntityType 旧版事件只能通过事件名推断实体类型
+func legacyEntityType(eventName string) string {
+	switch {
+	case strings.HasSuffix(eventName, "Novel"):
+		return "Novel"
+	case strings.HasSuffix(eventName, "CreditHistory"):
+		return "CreditHistory"
+	default:
+		return "UserCredit"
+	}
+}
@@ -5,18 +5,24 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"novel-resource-management/metrics"
+	"novel-resource-management/tracing"
+	model "novel-resource-model/v1"
 )
 
 type EventService struct {
 	network      *client.Network
+	chaincode    string
 	mongoService *MongoService
 }
 
-func NewEventService(gateway *client.Gateway) *EventService {
-	//先获取network再获取event
-	network := gateway.GetNetwork("mychannel")
+func NewEventService(chaincode *Chaincode) *EventService {
 
 	// 创建MongoDB服务实例
 	mongoService := NewMongoService()
@@ -26,7 +32,8 @@ func NewEventService(gateway *client.Gateway) *EventService {
 	}
 
 	return &EventService{
-		network:      network,
+		network:      chaincode.Network(),
+		chaincode:    chaincode.Name(),
 		mongoService: mongoService,
 	}
 }
@@ -34,15 +41,19 @@ func NewEventService(gateway *client.Gateway) *EventService {
 func (es *EventService) StartEventListening(ctx context.Context) error {
 	fmt.Println("🎧 Starting event listener...")
 	
-	events, err := es.network.ChaincodeEvents(ctx, "novel-basic")
+	events, err := es.network.ChaincodeEvents(ctx, es.chaincode)
 	if err != nil {
+		eventListener.stopped(err)
 		// 是的，%v是Go语言fmt包中最通用的格式化动词，几乎所有类型都可以用%v来输出其默认格式。
 		// 例如：字符串、数字、结构体、切片、map、error等类型都可以用%v打印出来。
 		// 但%w只能用于fmt.Errorf，并且只能用于error类型的包装，不能用于其他类型。
 		return fmt.Errorf("failed to start event listening: %w", err)
 	}
 	//监听数据
+	eventListener.started()
 	go func() {
+		// 连接断开时 events 会被关闭，就绪检查据此报告监听器已停止
+		defer eventListener.stopped(ctx.Err())
 		for event := range events {
 			//多路复用器
 			select {
@@ -53,7 +64,7 @@ func (es *EventService) StartEventListening(ctx context.Context) error {
 				fmt.Printf("\n<-- Chaincode event received: %s - %s\n", event.EventName, novelOrUserCredit)
 
 				// 处理事件并同步到MongoDB
-				es.processEventAndSyncToMongoDB(event.EventName, event.Payload)
+				es.processEventAndSyncToMongoDB(event)
 			}
 		}
 	}()
@@ -63,7 +74,7 @@ func (es *EventService) StartEventListening(ctx context.Context) error {
 
 // 监听特定事件
 func (es *EventService) ListenForSpecificEvents(ctx context.Context, eventNames []string) error {
-	events, err := es.network.ChaincodeEvents(ctx, "novel-basic", client.WithStartBlock(0))
+	events, err := es.network.ChaincodeEvents(ctx, es.chaincode, client.WithStartBlock(0))
 	if err != nil {
 		return fmt.Errorf("failed to start specific event listening: %w", err)
 	}
@@ -85,7 +96,7 @@ func (es *EventService) ListenForSpecificEvents(ctx context.Context, eventNames
 							event.BlockNumber, event.EventName, novelOrUserCredit)
 
 						// 处理事件并同步到MongoDB
-						es.processEventAndSyncToMongoDB(event.EventName, event.Payload)
+						es.processEventAndSyncToMongoDB(event)
 						break
 					}
 				}
@@ -112,83 +123,239 @@ func formatJSON(data []byte) string {
 }
 
 // processEventAndSyncToMongoDB 处理事件并同步到MongoDB
-func (es *EventService) processEventAndSyncToMongoDB(eventName string, payload []byte) {
-	// 解析事件载荷
-	var eventData map[string]interface{}
-	if err := json.Unmarshal(payload, &eventData); err != nil {
+func (es *EventService) processEventAndSyncToMongoDB(event *client.ChaincodeEvent) {
+	// 解析事件信封（兼容旧版裸实体事件）
+	envelope, err := DecodeChaincodeEvent(event)
+	observeEventLag(event, envelope)
+
+	ctx, span := startProjectionSpan(event, envelope)
+	defer span.End()
+
+	// 不管事件能否解析，这个区块都已经处理过了，查询接口用它说明读模型的新鲜度
+	defer func() {
+		if err := es.mongoService.UpdateSyncedBlock(ctx, event.BlockNumber); err != nil {
+			fmt.Printf("⚠️ %v\n", err)
+		}
+		eventListener.eventProcessed(event.BlockNumber)
+	}()
+
+	if err != nil {
 		fmt.Printf("❌ Failed to parse event payload: %v\n", err)
+		projectionFailed(ctx, event.EventName, err)
 		return
 	}
 
-	// 根据事件类型进行相应的MongoDB操作
-	switch eventName {
-	case "CreateNovel":
-		es.handleCreateNovelEvent(eventData)
-	case "UpdateNovel":
-		es.handleUpdateNovelEvent(eventData)
-	case "CreateUserCredit":
-		es.handleCreateUserCreditEvent(eventData)
-	case "UpdateUserCredit":
-		es.handleUpdateUserCreditEvent(eventData)
+	// 按事件类型把实体严格解码成共享模型，再进行相应的MongoDB操作
+	switch envelope.Type {
+	case "CreateNovel", "UpdateNovel", "DeleteNovel":
+		var novel model.Novel
+		if err = envelope.DecodeEntity(&novel); err != nil {
+			break
+		}
+		switch envelope.Type {
+		case "CreateNovel":
+			es.handleCreateNovelEvent(ctx, &novel)
+		case "UpdateNovel":
+			es.handleUpdateNovelEvent(ctx, &novel)
+		default:
+			es.handleDeleteNovelEvent(ctx, &novel)
+		}
+	case "CreateUserCredit", "UpdateUserCredit", "DeleteUserCredit", "ConsumeUserToken", "RechargeUserCredit",
+		"HoldCredits", "CaptureHold", "ReleaseHold", "ReleaseExpiredHolds":
+		var userCredit model.UserCredit
+		if err = envelope.DecodeEntity(&userCredit); err != nil {
+			break
+		}
+		switch envelope.Type {
+		case "CreateUserCredit":
+			es.handleCreateUserCreditEvent(ctx, &userCredit)
+		case "UpdateUserCredit", "RechargeUserCredit":
+			es.handleUpdateUserCreditEvent(ctx, &userCredit)
+		case "DeleteUserCredit":
+			es.handleDeleteUserCreditEvent(ctx, &userCredit)
+		case "ConsumeUserToken":
+			es.handleConsumeUserTokenEvent(ctx, &userCredit)
+		default:
+			es.handleHoldEvent(ctx, envelope.Type, &userCredit)
+		}
 	case "CreateCreditHistory":
-		es.handleCreateCreditHistoryEvent(eventData)
-	case "ConsumeUserToken":
-		es.handleConsumeUserTokenEvent(eventData)
+		var history model.CreditHistory
+		if err = envelope.DecodeEntity(&history); err != nil {
+			break
+		}
+		es.handleCreateCreditHistoryEvent(ctx, &history)
 	default:
-		fmt.Printf("ℹ️ 未处理的事件类型: %s\n", eventName)
+		fmt.Printf("ℹ️ 未处理的事件类型: %s\n", envelope.Type)
+	}
+	if err != nil {
+		fmt.Printf("❌ Event %s (tx %s) has no usable entity: %v\n", envelope.Type, envelope.TxID, err)
+		projectionFailed(ctx, envelope.Type, err)
+		return
+	}
+
+	// 信封上附带的积分历史和预留
+	es.handleEnvelopeHistory(ctx, envelope)
+	es.handleEnvelopeHolds(ctx, envelope)
+}
+
+// startProjectionSpan 事件处理在监听器的 goroutine 里，和发起交易的请求不在一个调用链上
+// 所以开一个新的 trace，再用 span link 指向信封里的 traceparent（发起交易的请求）
+func startProjectionSpan(event *client.ChaincodeEvent, envelope *EventEnvelope) (context.Context, trace.Span) {
+	options := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("fabric.event", event.EventName),
+			attribute.String("fabric.tx_id", event.TransactionID),
+			attribute.Int64("fabric.block_number", int64(event.BlockNumber)),
+		),
+	}
+	if envelope != nil {
+		if link, ok := tracing.LinkTo(envelope.TraceParent); ok {
+			options = append(options, trace.WithLinks(link))
+		}
+	}
+	return tracing.Start(context.Background(), "Project "+event.EventName, options...)
+}
+
+// projectionFailed 事件没能同步到 MongoDB：计数并把投影的 span 标记为失败
+func projectionFailed(ctx context.Context, event string, err error) {
+	metrics.MongoProjectionFailures.WithLabelValues(event).Inc()
+	tracing.RecordError(trace.SpanFromContext(ctx), err)
+}
+
+// observeEventLag 记录收到的区块号和时间，信封带交易时间戳时记录从交易到收到事件的延迟
+func observeEventLag(event *client.ChaincodeEvent, envelope *EventEnvelope) {
+	now := time.Now()
+	metrics.EventLastBlock.Set(float64(event.BlockNumber))
+	metrics.EventLastReceived.Set(float64(now.UnixNano()) / 1e9)
+	if envelope == nil || envelope.Timestamp == "" {
+		return
+	}
+	if txTime, err := time.Parse(time.RFC3339Nano, envelope.Timestamp); err == nil {
+		metrics.EventLag.Observe(now.Sub(txTime).Seconds())
 	}
 }
 
 // handleCreateNovelEvent 处理创建小说事件
-func (es *EventService) handleCreateNovelEvent(eventData map[string]interface{}) {
+func (es *EventService) handleCreateNovelEvent(ctx context.Context, novel *model.Novel) {
 	fmt.Println("📝 Processing CreateNovel event...")
 
-	if err := es.mongoService.CreateNovelInMongo(eventData); err != nil {
+	if err := es.mongoService.CreateNovelInMongo(ctx, novel); err != nil {
 		fmt.Printf("❌ Failed to sync CreateNovel to MongoDB: %v\n", err)
+		projectionFailed(ctx, "CreateNovel", err)
 	}
 }
 
 // handleUpdateNovelEvent 处理更新小说事件
-func (es *EventService) handleUpdateNovelEvent(eventData map[string]interface{}) {
+func (es *EventService) handleUpdateNovelEvent(ctx context.Context, novel *model.Novel) {
 	fmt.Println("📝 Processing UpdateNovel event...")
 
-	if err := es.mongoService.UpdateNovelInMongo(eventData); err != nil {
+	if err := es.mongoService.UpdateNovelInMongo(ctx, novel); err != nil {
 		fmt.Printf("❌ Failed to sync UpdateNovel to MongoDB: %v\n", err)
+		projectionFailed(ctx, "UpdateNovel", err)
+	}
+}
+
+// handleDeleteNovelEvent 处理删除小说事件，novel 是删除前的记录
+func (es *EventService) handleDeleteNovelEvent(ctx context.Context, novel *model.Novel) {
+	fmt.Println("🗑️ Processing DeleteNovel event...")
+
+	if err := es.mongoService.DeleteNovelInMongo(ctx, novel); err != nil {
+		fmt.Printf("❌ Failed to sync DeleteNovel to MongoDB: %v\n", err)
+		projectionFailed(ctx, "DeleteNovel", err)
 	}
 }
 
 // handleCreateUserCreditEvent 处理创建用户积分事件
-func (es *EventService) handleCreateUserCreditEvent(eventData map[string]interface{}) {
+func (es *EventService) handleCreateUserCreditEvent(ctx context.Context, userCredit *model.UserCredit) {
 	fmt.Println("💰 Processing CreateUserCredit event...")
 
-	if err := es.mongoService.CreateUserCreditInMongo(eventData); err != nil {
+	if err := es.mongoService.CreateUserCreditInMongo(ctx, userCredit); err != nil {
 		fmt.Printf("❌ Failed to sync CreateUserCredit to MongoDB: %v\n", err)
+		projectionFailed(ctx, "CreateUserCredit", err)
 	}
 }
 
 // handleUpdateUserCreditEvent 处理更新用户积分事件
-func (es *EventService) handleUpdateUserCreditEvent(eventData map[string]interface{}) {
-	if err := es.mongoService.UpdateUserCreditInMongo(eventData); err != nil {
+func (es *EventService) handleUpdateUserCreditEvent(ctx context.Context, userCredit *model.UserCredit) {
+	if err := es.mongoService.UpdateUserCreditInMongo(ctx, userCredit); err != nil {
 		fmt.Printf("❌ Failed to sync UpdateUserCredit to MongoDB: %v\n", err)
+		projectionFailed(ctx, "UpdateUserCredit", err)
+	}
+}
+
+// handleDeleteUserCreditEvent 处理删除用户积分事件，userCredit 是删除前的记录
+func (es *EventService) handleDeleteUserCreditEvent(ctx context.Context, userCredit *model.UserCredit) {
+	fmt.Println("🗑️ Processing DeleteUserCredit event...")
+
+	if err := es.mongoService.DeleteUserCreditInMongo(ctx, userCredit); err != nil {
+		fmt.Printf("❌ Failed to sync DeleteUserCredit to MongoDB: %v\n", err)
+		projectionFailed(ctx, "DeleteUserCredit", err)
 	}
 }
 
 // handleCreateCreditHistoryEvent 处理创建积分历史事件
-func (es *EventService) handleCreateCreditHistoryEvent(eventData map[string]interface{}) {
+func (es *EventService) handleCreateCreditHistoryEvent(ctx context.Context, history *model.CreditHistory) {
 	fmt.Println("📜 Processing CreateCreditHistory event...")
 
-	if err := es.mongoService.CreateCreditHistoryInMongo(eventData); err != nil {
+	if err := es.mongoService.CreateCreditHistoryInMongo(ctx, history); err != nil {
 		fmt.Printf("❌ Failed to sync CreateCreditHistory to MongoDB: %v\n", err)
+		projectionFailed(ctx, "CreateCreditHistory", err)
 	}
 }
 
 // handleConsumeUserTokenEvent 处理消费用户代币事件
-func (es *EventService) handleConsumeUserTokenEvent(eventData map[string]interface{}) {
+func (es *EventService) handleConsumeUserTokenEvent(ctx context.Context, userCredit *model.UserCredit) {
 	fmt.Println("🔥 Processing ConsumeUserToken event...")
 
 	// ConsumeUserToken事件会触发UserCredit的更新，所以这里主要是同步UserCredit
-	if err := es.mongoService.UpdateUserCreditInMongo(eventData); err != nil {
+	if err := es.mongoService.UpdateUserCreditInMongo(ctx, userCredit); err != nil {
 		fmt.Printf("❌ Failed to sync ConsumeUserToken to MongoDB: %v\n", err)
+		projectionFailed(ctx, "ConsumeUserToken", err)
+	}
+}
+
+// handleHoldEvent 预留相关事件的 data 是变化后的用户积分
+func (es *EventService) handleHoldEvent(ctx context.Context, eventType string, userCredit *model.UserCredit) {
+	fmt.Printf("🔒 Processing %s event...\n", eventType)
+
+	if err := es.mongoService.UpdateUserCreditInMongo(ctx, userCredit); err != nil {
+		fmt.Printf("❌ Failed to sync %s to MongoDB: %v\n", eventType, err)
+		projectionFailed(ctx, eventType, err)
+	}
+}
+
+// handleEnvelopeHolds 把信封里变化的预留写入 credit_holds
+func (es *EventService) handleEnvelopeHolds(ctx context.Context, envelope *EventEnvelope) {
+	holds, err := envelope.DecodeHolds()
+	if err != nil {
+		fmt.Printf("❌ Failed to parse holds of tx %s: %v\n", envelope.TxID, err)
+		projectionFailed(ctx, "Holds", err)
+		return
+	}
+
+	for i := range holds {
+		if err := es.mongoService.UpsertCreditHoldInMongo(ctx, &holds[i]); err != nil {
+			fmt.Printf("❌ Failed to sync hold of tx %s to MongoDB: %v\n", envelope.TxID, err)
+			projectionFailed(ctx, "Holds", err)
+		}
 	}
 }
 
+// handleEnvelopeHistory 把信封里附带的积分历史写入 credit_histories
+func (es *EventService) handleEnvelopeHistory(ctx context.Context, envelope *EventEnvelope) {
+	history, err := envelope.DecodeHistory()
+	if err != nil {
+		fmt.Printf("❌ Failed to parse credit history of tx %s: %v\n", envelope.TxID, err)
+		projectionFailed(ctx, "CreditHistory", err)
+		return
+	}
+	if history == nil {
+		return
+	}
+
+	if err := es.mongoService.CreateCreditHistoryInMongo(ctx, history); err != nil {
+		fmt.Printf("❌ Failed to sync credit history of tx %s to MongoDB: %v\n", envelope.TxID, err)
+		projectionFailed(ctx, "CreditHistory", err)
+	}
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+
+	"novel-resource-management/database"
+)
+
+// 就绪检查：gRPC 连接、链码查询、MongoDB、事件监听器，任何一项不通过 /readyz 返回 503
+
+const (
+	healthCheckTimeout = 5 * time.Second
+	// readinessProbeNovelID NovelExists 查询用的 ID，只读一个 key，不存在也没关系
+	readinessProbeNovelID = "__readyz__"
+	// maxPendingCommits 最多记录多少个等待投影的提交，监听器停了以后不再无限增长
+	maxPendingCommits = 1024
+)
+
+// 检查结果
+const (
+	HealthStatusUp   = "up"
+	HealthStatusDown = "down"
+)
+
+// listenerState 事件监听器的运行状态
+// main 和 API 各自创建 EventService，所以放在包级别，由 StartEventListening、事件处理和 commitStatus 更新
+type listenerState struct {
+	mu            sync.Mutex
+	running       bool
+	startedAt     time.Time
+	stoppedAt     time.Time
+	lastErr       error
+	lastBlock     uint64
+	lastEventAt   time.Time
+	pendingCommit []pendingCommit
+}
+
+// pendingCommit 本进程提交成功、事件还没处理的交易
+type pendingCommit struct {
+	block       uint64
+	committedAt time.Time
+}
+
+var eventListener = &listenerState{}
+
+func (l *listenerState) started() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running = true
+	l.startedAt = time.Now()
+	l.lastErr = nil
+}
+
+func (l *listenerState) stopped(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running = false
+	l.stoppedAt = time.Now()
+	l.lastErr = err
+}
+
+// eventProcessed 事件处理完，区块号不大于它的提交都已经投影过了
+func (l *listenerState) eventProcessed(block uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if block > l.lastBlock {
+		l.lastBlock = block
+	}
+	l.lastEventAt = time.Now()
+
+	remaining := l.pendingCommit[:0]
+	for _, commit := range l.pendingCommit {
+		if commit.block > block {
+			remaining = append(remaining, commit)
+		}
+	}
+	l.pendingCommit = remaining
+}
+
+// committed 发了链码事件的交易提交成功，记下区块号，等监听器处理到这个区块
+func (l *listenerState) committed(block uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.pendingCommit) >= maxPendingCommits {
+		return
+	}
+	l.pendingCommit = append(l.pendingCommit, pendingCommit{block: block, committedAt: time.Now()})
+}
+
+// check 监听器在运行，并且最早一个没投影的提交等待时间不超过 maxLag
+func (l *listenerState) check(maxLag time.Duration) *DependencyCheck {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	details := map[string]interface{}{
+		"running":        l.running,
+		"lastBlock":      l.lastBlock,
+		"pendingCommits": len(l.pendingCommit),
+		"maxLag":         maxLag.String(),
+	}
+	if !l.startedAt.IsZero() {
+		details["startedAt"] = l.startedAt.Format(time.RFC3339)
+	}
+	if !l.lastEventAt.IsZero() {
+		details["lastEventAt"] = l.lastEventAt.Format(time.RFC3339)
+	}
+
+	if !l.running {
+		message := "event listener is not running"
+		if l.lastErr != nil {
+			message = fmt.Sprintf("event listener stopped: %v", l.lastErr)
+		} else if !l.stoppedAt.IsZero() {
+			message = "event listener stopped at " + l.stoppedAt.Format(time.RFC3339)
+		}
+		return &DependencyCheck{Status: HealthStatusDown, Error: message, Details: details}
+	}
+
+	if len(l.pendingCommit) > 0 {
+		lag := time.Since(l.pendingCommit[0].committedAt)
+		details["lag"] = lag.Round(time.Millisecond).String()
+		if lag > maxLag {
+			return &DependencyCheck{
+				Status:  HealthStatusDown,
+				Error:   fmt.Sprintf("block %d committed %s ago has not been projected", l.pendingCommit[0].block, lag.Round(time.Second)),
+				Details: details,
+			}
+		}
+	}
+	return &DependencyCheck{Status: HealthStatusUp, Details: details}
+}
+
+// DependencyCheck 单个依赖的检查结果
+type DependencyCheck struct {
+	Status  string                 `json:"status"`
+	Latency string                 `json:"latency,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// ReadinessReport /readyz 的返回内容
+type ReadinessReport struct {
+	Ready  bool                        `json:"ready"`
+	Checks map[string]*DependencyCheck `json:"checks"`
+}
+
+type HealthService struct {
+	conn     *grpc.ClientConn
+	contract *Contract
+	db       *database.MongoDBInstance
+	maxLag   time.Duration
+}
+
+// NewHealthService maxLag 是提交后多久还没投影到 MongoDB 就认为监听器落后（配置的 fabric.event_listener_max_lag）
+func NewHealthService(chaincode *Chaincode, conn *grpc.ClientConn, maxLag time.Duration) *HealthService {
+	return &HealthService{
+		conn:     conn,
+		contract: chaincode.Contract(NovelContractName),
+		db:       database.GetMongoInstance(),
+		maxLag:   maxLag,
+	}
+}
+
+// Readiness 并发检查所有依赖，每项最多 healthCheckTimeout
+func (hs *HealthService) Readiness(ctx context.Context) *ReadinessReport {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	checks := map[string]func(context.Context) *DependencyCheck{
+		"grpc":          hs.checkGrpc,
+		"chaincode":     hs.checkChaincode,
+		"mongodb":       hs.checkMongo,
+		"eventListener": func(context.Context) *DependencyCheck { return eventListener.check(hs.maxLag) },
+	}
+
+	report := &ReadinessReport{Ready: true, Checks: make(map[string]*DependencyCheck, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(context.Context) *DependencyCheck) {
+			defer wg.Done()
+			result := check(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status != HealthStatusUp {
+				report.Ready = false
+			}
+		}(name, check)
+	}
+	wg.Wait()
+	return report
+}
+
+// checkGrpc 到 peer 的连接状态，Idle 表示还没有请求，触发一次连接并视为可用
+func (hs *HealthService) checkGrpc(ctx context.Context) *DependencyCheck {
+	state := hs.conn.GetState()
+	details := map[string]interface{}{"state": state.String(), "target": hs.conn.Target()}
+	switch state {
+	case connectivity.Ready:
+		return &DependencyCheck{Status: HealthStatusUp, Details: details}
+	case connectivity.Idle:
+		hs.conn.Connect()
+		return &DependencyCheck{Status: HealthStatusUp, Details: details}
+	default:
+		return &DependencyCheck{Status: HealthStatusDown, Error: "gRPC connection is " + state.String(), Details: details}
+	}
+}
+
+// checkChaincode 用 NovelExists 做一次 evaluate，确认 peer 能执行链码
+// 直接调 EvaluateWithContext，探活不计入 Fabric 指标和链路追踪
+func (hs *HealthService) checkChaincode(ctx context.Context) *DependencyCheck {
+	start := time.Now()
+	_, err := hs.contract.EvaluateWithContext(ctx, "NovelExists", client.WithArguments(readinessProbeNovelID))
+	return timedCheck(start, err)
+}
+
+func (hs *HealthService) checkMongo(ctx context.Context) *DependencyCheck {
+	start := time.Now()
+	return timedCheck(start, hs.db.Ping(ctx))
+}
+
+func timedCheck(start time.Time, err error) *DependencyCheck {
+	result := &DependencyCheck{Status: HealthStatusUp, Latency: time.Since(start).Round(time.Microsecond).String()}
+	if err != nil {
+		result.Status = HealthStatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
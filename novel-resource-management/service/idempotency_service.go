@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"novel-resource-management/config"
+	"novel-resource-management/database"
+)
+
+// IdempotencyService 把 Idempotency-Key 的请求哈希和响应存在 idempotency_keys 集合
+// 第一个请求插入 processing 记录占用 key，处理完写入响应；记录在 IDEMPOTENCY_TTL 后由 TTL 索引删除
+type IdempotencyService struct {
+	records *mongo.Collection
+	ttl     time.Duration
+	lockTTL time.Duration
+}
+
+// NewIdempotencyService 保存时长来自配置的 idempotency 部分
+// lock_ttl 要比 fabric.retry.timeout 长，否则正常处理中的请求也会被重试接手，启动时由配置校验保证
+func NewIdempotencyService(cfg config.IdempotencyConfig) *IdempotencyService {
+	is := &IdempotencyService{
+		records: database.GetMongoInstance().GetCollection("idempotency_keys"),
+		ttl:     cfg.TTL.Duration,
+		lockTTL: cfg.LockTTL.Duration,
+	}
+
+	_, err := is.records.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.M{"expiresAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Printf("⚠️ 创建 idempotency_keys 集合的 TTL 索引失败: %v", err)
+	}
+	return is
+}
+
+// Begin 占用 key，成功时返回 true；key 已经被占用时返回已有的记录
+// 处理中的记录超过 lockTTL 认为原请求已经中断，请求哈希相同的重试可以接手
+func (is *IdempotencyService) Begin(ctx context.Context, key, requestHash, method, path string) (*database.IdempotencyRecord, bool, error) {
+	now := time.Now()
+	record := &database.IdempotencyRecord{
+		ID:          key,
+		RequestHash: requestHash,
+		Method:      method,
+		Path:        path,
+		State:       database.IdempotencyProcessing,
+		LockedUntil: now.Add(is.lockTTL),
+		ExpiresAt:   now.Add(is.ttl),
+		CreatedAt:   now,
+	}
+	_, err := is.records.InsertOne(ctx, record)
+	if err == nil {
+		return record, true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, false, fmt.Errorf("save idempotency key failed: %v", err)
+	}
+
+	existing, err := is.Get(ctx, key)
+	if err != nil || existing == nil {
+		return existing, false, err
+	}
+	if existing.State != database.IdempotencyProcessing || existing.RequestHash != requestHash || now.Before(existing.LockedUntil) {
+		return existing, false, nil
+	}
+
+	result, err := is.records.UpdateOne(ctx, bson.M{
+		"_id":         key,
+		"state":       database.IdempotencyProcessing,
+		"lockedUntil": existing.LockedUntil,
+	}, bson.M{"$set": bson.M{"lockedUntil": now.Add(is.lockTTL)}})
+	if err != nil {
+		return nil, false, fmt.Errorf("take over idempotency key failed: %v", err)
+	}
+	if result.ModifiedCount == 0 {
+		// 另一个重试先接手了
+		return existing, false, nil
+	}
+	log.Printf("⚠️ Idempotency-Key %s 的原请求没有完成，由重试接手", key)
+	existing.LockedUntil = now.Add(is.lockTTL)
+	return existing, true, nil
+}
+
+// Get 读取 key 的记录，不存在时返回 nil
+func (is *IdempotencyService) Get(ctx context.Context, key string) (*database.IdempotencyRecord, error) {
+	var record database.IdempotencyRecord
+	err := is.records.FindOne(ctx, bson.M{"_id": key}).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find idempotency key failed: %v", err)
+	}
+	return &record, nil
+}
+
+// Complete 保存响应，之后的重试直接返回这个响应
+func (is *IdempotencyService) Complete(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	_, err := is.records.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{
+		"state":       database.IdempotencyCompleted,
+		"statusCode":  statusCode,
+		"contentType": contentType,
+		"body":        body,
+	}})
+	if err != nil {
+		return fmt.Errorf("save idempotent response failed: %v", err)
+	}
+	return nil
+}
+
+// Release 删除记录，请求没有产生可以重放的结果时调用，调用方可以用同一个 key 重试
+func (is *IdempotencyService) Release(ctx context.Context, key string) error {
+	if _, err := is.records.DeleteOne(ctx, bson.M{"_id": key}); err != nil {
+		return fmt.Errorf("release idempotency key failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	model "novel-resource-model/v1"
+)
+
+// SpendingLimitService 读取和修改链上的消费限额，限额在链码里扣费时强制执行
+// 剩余额度在 CreditContract 查询，修改限额是 AdminContract 的交易
+type SpendingLimitService struct {
+	contract      *Contract
+	adminContract *Contract
+}
+
+func NewSpendingLimitService(chaincode *Chaincode) *SpendingLimitService {
+	return &SpendingLimitService{
+		contract:      chaincode.Contract(CreditContractName),
+		adminContract: chaincode.Contract(AdminContractName),
+	}
+}
+
+// GetSpendingAllowance 用户当前的限额、用量和剩余额度，remaining 为 -1 表示不限制
+func (ls *SpendingLimitService) GetSpendingAllowance(ctx context.Context, userId string) (*model.SpendingAllowance, error) {
+	result, err := evaluateTransaction(ctx, ls.contract, "GetSpendingAllowance", userId)
+	if err != nil {
+		return nil, fmt.Errorf("get spending allowance failed: %v", err)
+	}
+	return decodeResult[model.SpendingAllowance](result)
+}
+
+// SetSpendingLimit 设置用户单独的限额，0 表示不限制
+func (ls *SpendingLimitService) SetSpendingLimit(ctx context.Context, userId string, daily, weekly, monthly int) (*model.SpendingLimit, error) {
+	result, err := submitWithRetry(ctx, ls.adminContract, "SetSpendingLimit", userId,
+		strconv.Itoa(daily), strconv.Itoa(weekly), strconv.Itoa(monthly))
+	if err != nil {
+		return nil, fmt.Errorf("set spending limit failed: %v", err)
+	}
+	return decodeResult[model.SpendingLimit](result)
+}
+
+// DeleteSpendingLimit 删除用户单独的限额，之后使用全局默认限额
+func (ls *SpendingLimitService) DeleteSpendingLimit(ctx context.Context, userId string) error {
+	if _, err := submitWithRetry(ctx, ls.adminContract, "DeleteSpendingLimit", userId); err != nil {
+		return fmt.Errorf("delete spending limit failed: %v", err)
+	}
+	return nil
+}
+
+// SetDefaultSpendingLimit 设置全局默认限额
+func (ls *SpendingLimitService) SetDefaultSpendingLimit(ctx context.Context, daily, weekly, monthly int) (*model.SpendingLimit, error) {
+	result, err := submitWithRetry(ctx, ls.adminContract, "SetDefaultSpendingLimit",
+		strconv.Itoa(daily), strconv.Itoa(weekly), strconv.Itoa(monthly))
+	if err != nil {
+		return nil, fmt.Errorf("set default spending limit failed: %v", err)
+	}
+	return decodeResult[model.SpendingLimit](result)
+}
+
+// decodeResult 把链码返回的 JSON 严格解码成共享模型并校验
+func decodeResult[T any, P interface {
+	*T
+	model.Validator
+}](result []byte) (*T, error) {
+	var data T
+	if err := model.Decode(result, P(&data)); err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %v", err)
+	}
+	return &data, nil
+}
+
+// decodeResultList 严格解码链码返回的列表，链码返回空切片时 payload 为空，得到空列表
+func decodeResultList[T any, P interface {
+	*T
+	model.Validator
+}](result []byte) ([]T, error) {
+	data, err := model.DecodeList[T, P](result)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %v", err)
+	}
+	return data, nil
+}
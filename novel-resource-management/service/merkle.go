@@ -0,0 +1,129 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Merkle 树的叶子和内部节点加不同前缀（0x00 / 0x01），防止把内部节点伪造成叶子
+// 一层的节点数是奇数时，最后一个节点直接提升到上一层，不和自己配对
+
+// MerkleProofStep 证明路径上的一个兄弟节点，Position 是兄弟节点在左边还是右边
+type MerkleProofStep struct {
+	Hash     string `json:"hash"`
+	Position string `json:"position"` // left, right
+}
+
+// merkleLeafHash sha256(0x00 || collection || 0x00 || docId || 0x00 || canonicalJSON)
+func merkleLeafHash(collection, docID string, canonical []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	h.Write([]byte(collection))
+	h.Write([]byte{0x00})
+	h.Write([]byte(docID))
+	h.Write([]byte{0x00})
+	h.Write(canonical)
+	return h.Sum(nil)
+}
+
+// merkleNodeHash sha256(0x01 || left || right)
+func merkleNodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// merkleParents 计算上一层
+func merkleParents(level [][]byte) [][]byte {
+	parents := make([][]byte, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 == len(level) {
+			parents = append(parents, level[i])
+			continue
+		}
+		parents = append(parents, merkleNodeHash(level[i], level[i+1]))
+	}
+	return parents
+}
+
+// merkleLevels 从叶子到根的每一层，第 0 层是叶子，最后一层只有根；没有叶子时返回 nil
+func merkleLevels(leaves [][]byte) [][][]byte {
+	if len(leaves) == 0 {
+		return nil
+	}
+	levels := [][][]byte{leaves}
+	for level := leaves; len(level) > 1; {
+		level = merkleParents(level)
+		levels = append(levels, level)
+	}
+	return levels
+}
+
+// merkleRoot 没有叶子时返回 sha256("")
+func merkleRoot(leaves [][]byte) []byte {
+	if len(leaves) == 0 {
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	}
+	levels := merkleLevels(leaves)
+	return levels[len(levels)-1][0]
+}
+
+// merkleNodeRef 证明路径上的一个兄弟节点在树里的位置
+type merkleNodeRef struct {
+	Level    int
+	Index    int
+	Position string // left, right
+}
+
+// merkleProofPath 共 count 个叶子时，第 index 个叶子的证明需要的兄弟节点，从下往上
+// 只和树的形状有关，生成证明时按位置读取保存的节点，不用读出整棵树
+func merkleProofPath(count, index int) []merkleNodeRef {
+	path := []merkleNodeRef{}
+	for level, size := 0, count; size > 1; level, size = level+1, (size+1)/2 {
+		if index%2 == 1 {
+			path = append(path, merkleNodeRef{Level: level, Index: index - 1, Position: "left"})
+		} else if index+1 < size {
+			path = append(path, merkleNodeRef{Level: level, Index: index + 1, Position: "right"})
+		}
+		index /= 2
+	}
+	return path
+}
+
+// merkleProof 第 index 个叶子到根的兄弟节点，从下往上
+func merkleProof(leaves [][]byte, index int) []MerkleProofStep {
+	levels := merkleLevels(leaves)
+	proof := []MerkleProofStep{}
+	for _, ref := range merkleProofPath(len(leaves), index) {
+		proof = append(proof, MerkleProofStep{Hash: hex.EncodeToString(levels[ref.Level][ref.Index]), Position: ref.Position})
+	}
+	return proof
+}
+
+// VerifyMerkleProof 用叶子哈希和证明重新计算根，和给定的根比较，哈希都是十六进制
+func VerifyMerkleProof(leafHash string, proof []MerkleProofStep, root string) bool {
+	current, err := hex.DecodeString(leafHash)
+	if err != nil {
+		return false
+	}
+	for _, step := range proof {
+		sibling, err := hex.DecodeString(step.Hash)
+		if err != nil {
+			return false
+		}
+		switch step.Position {
+		case "left":
+			current = merkleNodeHash(sibling, current)
+		case "right":
+			current = merkleNodeHash(current, sibling)
+		default:
+			return false
+		}
+	}
+	expected, err := hex.DecodeString(root)
+	return err == nil && bytes.Equal(current, expected)
+}
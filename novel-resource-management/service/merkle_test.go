@@ -0,0 +1,122 @@
+package service
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testLeaves(count int) [][]byte {
+	leaves := make([][]byte, count)
+	for i := range leaves {
+		leaves[i] = merkleLeafHash("novels", fmt.Sprintf("novel_%d", i), []byte(fmt.Sprintf(`{"i":%d}`, i)))
+	}
+	return leaves
+}
+
+func TestMerkleRoot(t *testing.T) {
+	leaves := testLeaves(5)
+	l := leaves
+
+	tests := []struct {
+		name     string
+		leaves   [][]byte
+		expected []byte
+	}{
+		{name: "single leaf is the root", leaves: l[:1], expected: l[0]},
+		{name: "two leaves", leaves: l[:2], expected: merkleNodeHash(l[0], l[1])},
+		{
+			name:     "odd leaf is promoted",
+			leaves:   l[:3],
+			expected: merkleNodeHash(merkleNodeHash(l[0], l[1]), l[2]),
+		},
+		{
+			name:     "odd node is promoted twice",
+			leaves:   l[:5],
+			expected: merkleNodeHash(merkleNodeHash(merkleNodeHash(l[0], l[1]), merkleNodeHash(l[2], l[3])), l[4]),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, merkleRoot(tt.leaves))
+		})
+	}
+}
+
+func TestMerkleProof(t *testing.T) {
+	tests := []struct {
+		count int
+		// expectedLengths 每个叶子的证明长度，被提升的节点那一层没有兄弟
+		expectedLengths []int
+	}{
+		{count: 1, expectedLengths: []int{0}},
+		{count: 2, expectedLengths: []int{1, 1}},
+		{count: 3, expectedLengths: []int{2, 2, 1}},
+		{count: 5, expectedLengths: []int{3, 3, 3, 3, 1}},
+		{count: 6, expectedLengths: []int{3, 3, 3, 3, 2, 2}},
+		{count: 7, expectedLengths: []int{3, 3, 3, 3, 3, 3, 2}},
+		{count: 9, expectedLengths: []int{4, 4, 4, 4, 4, 4, 4, 4, 1}},
+		{count: 11},
+		{count: 17},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d leaves", tt.count), func(t *testing.T) {
+			leaves := testLeaves(tt.count)
+			root := hex.EncodeToString(merkleRoot(leaves))
+
+			for i, leaf := range leaves {
+				proof := merkleProof(leaves, i)
+				if tt.expectedLengths != nil {
+					require.Len(t, proof, tt.expectedLengths[i], "leaf %d", i)
+				}
+				require.True(t, VerifyMerkleProof(hex.EncodeToString(leaf), proof, root), "leaf %d", i)
+
+				// 换一个叶子、换根或者翻转兄弟节点的位置都不能通过校验
+				other := leaves[(i+1)%len(leaves)]
+				if len(leaves) > 1 {
+					require.False(t, VerifyMerkleProof(hex.EncodeToString(other), proof, root), "leaf %d with another leaf", i)
+					require.False(t, VerifyMerkleProof(hex.EncodeToString(leaf), proof, hex.EncodeToString(other)), "leaf %d with another root", i)
+				}
+				if len(proof) > 0 {
+					flipped := append([]MerkleProofStep(nil), proof...)
+					if flipped[0].Position == "left" {
+						flipped[0].Position = "right"
+					} else {
+						flipped[0].Position = "left"
+					}
+					require.False(t, VerifyMerkleProof(hex.EncodeToString(leaf), flipped, root), "leaf %d with flipped position", i)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyMerkleProofRejectsMalformedInput(t *testing.T) {
+	leaves := testLeaves(3)
+	leaf := hex.EncodeToString(leaves[0])
+	root := hex.EncodeToString(merkleRoot(leaves))
+	proof := merkleProof(leaves, 0)
+
+	tests := []struct {
+		name  string
+		leaf  string
+		proof []MerkleProofStep
+		root  string
+	}{
+		{name: "leaf is not hex", leaf: "zz", proof: proof, root: root},
+		{name: "root is not hex", leaf: leaf, proof: proof, root: "zz"},
+		{name: "step is not hex", leaf: leaf, proof: []MerkleProofStep{{Hash: "zz", Position: "right"}}, root: root},
+		{name: "unknown position", leaf: leaf, proof: []MerkleProofStep{{Hash: proof[0].Hash, Position: "up"}, proof[1]}, root: root},
+		{name: "missing step", leaf: leaf, proof: proof[:1], root: root},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.False(t, VerifyMerkleProof(tt.leaf, tt.proof, tt.root))
+		})
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"strconv"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -12,6 +11,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"novel-resource-management/database"
+	model "novel-resource-model/v1"
 )
 
 type MongoService struct {
@@ -32,117 +32,112 @@ func generateID() string {
 }
 
 // CreateNovelInMongo 在MongoDB中创建Novel记录
-func (ms *MongoService) CreateNovelInMongo(novel map[string]interface{}) error {
+func (ms *MongoService) CreateNovelInMongo(ctx context.Context, novel *model.Novel) error {
 	collection := ms.db.GetCollection("novels")
 
-	// 获取或生成ID
-	id := getString(novel, "id")
-	if id == "" {
-		id = generateID() // 生成唯一ID
-	}
-
-	// 将map转换为Novel结构
-	novelData := &database.Novel{
-		ID:           id, // 使用传入的ID或生成的ID
-		Author:       getString(novel, "author"),
-		StoryOutline: getString(novel, "storyOutline"),
-		Subsections:  getString(novel, "subsections"),
-		Characters:   getString(novel, "characters"),
-		Items:        getString(novel, "items"),
-		TotalScenes:  getString(novel, "totalScenes"),
-		CreatedAt:    getString(novel, "createdAt"),
-		UpdatedAt:    getString(novel, "updatedAt"),
-	}
-
 	// 检查是否已存在相同的novel（根据storyOutline唯一索引）
 	// 因为我们为storyOutline创建了唯一索引，所以只需要检查storyOutline是否重复
-	filter := bson.M{"storyOutline": novelData.StoryOutline}
+	filter := bson.M{"storyOutline": novel.StoryOutline}
 	var existingNovel database.Novel
 	//将结果写入existingNovel，这个好方便呀
-	err := collection.FindOne(context.Background(), filter).Decode(&existingNovel)
+	err := collection.FindOne(ctx, filter).Decode(&existingNovel)
 	if err == nil {
-		log.Printf("Novel already exists in MongoDB, storyOutline: %s", novelData.StoryOutline)
+		log.Printf("Novel already exists in MongoDB, storyOutline: %s", novel.StoryOutline)
 		return nil // 已存在，不重复创建
 	}
 
-	// 插入新记录
-	_, err = collection.InsertOne(context.Background(), novelData)
+	// 插入新记录，_id 就是链上的小说ID，同时写入搜索分词
+	_, err = collection.InsertOne(ctx, &database.NovelDocument{
+		Novel:  *novel,
+		Search: NovelSearchFields(novel),
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create novel in MongoDB: %v", err)
 	}
 
-	log.Printf("✅ Created novel in MongoDB: author=%s", novelData.Author)
+	log.Printf("✅ Created novel in MongoDB: author=%s", novel.Author)
 	return nil
 }
 
 // UpdateNovelInMongo 在MongoDB中更新Novel记录
-func (ms *MongoService) UpdateNovelInMongo(novel map[string]interface{}) error {
+func (ms *MongoService) UpdateNovelInMongo(ctx context.Context, novel *model.Novel) error {
 	collection := ms.db.GetCollection("novels")
 
 	// 构建更新数据
 	updateData := bson.M{
 		//set
 		"$set": bson.M{
-			"author":       getString(novel, "author"),
-			"storyOutline": getString(novel, "storyOutline"),
-			"subsections":  getString(novel, "subsections"),
-			"characters":   getString(novel, "characters"),
-			"items":        getString(novel, "items"),
-			"totalScenes":  getString(novel, "totalScenes"),
-			"updatedAt":    getString(novel, "updatedAt"),
+			"author":       novel.Author,
+			"storyOutline": novel.StoryOutline,
+			"subsections":  novel.Subsections,
+			"characters":   novel.Characters,
+			"items":        novel.Items,
+			"totalScenes":  novel.TotalScenes,
+			"updatedAt":    novel.UpdatedAt,
+			"search":       NovelSearchFields(novel),
 		},
 	}
 
-	// 根据storyOutline查找并更新（因为storyOutline是唯一索引）
-	filter := bson.M{"storyOutline": getString(novel, "storyOutline")}
-	result, err := collection.UpdateOne(context.Background(), filter, updateData)
+	if novel.ID == "" {
+		return fmt.Errorf("novel id is empty, cannot update")
+	}
+
+	// 按 _id 更新，storyOutline 本身可能被这次修改改掉
+	filter := bson.M{"_id": novel.ID}
+	result, err := collection.UpdateOne(ctx, filter, updateData)
 	if err != nil {
 		return fmt.Errorf("failed to update novel in MongoDB: %v", err)
 	}
 
 	if result.MatchedCount == 0 {
 		// 如果没有找到记录，则创建新记录
-		return ms.CreateNovelInMongo(novel)
+		return ms.CreateNovelInMongo(ctx, novel)
+	}
+
+	log.Printf("✅ Updated novel in MongoDB: id=%s", novel.ID)
+	return nil
+}
+
+// DeleteNovelInMongo 在MongoDB中删除Novel记录
+func (ms *MongoService) DeleteNovelInMongo(ctx context.Context, novel *model.Novel) error {
+	collection := ms.db.GetCollection("novels")
+
+	if novel.ID == "" {
+		return fmt.Errorf("novel id is empty, cannot delete")
 	}
 
-	log.Printf("✅ Updated novel in MongoDB: storyOutline=%s", getString(novel, "storyOutline"))
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": novel.ID})
+	if err != nil {
+		return fmt.Errorf("failed to delete novel in MongoDB: %v", err)
+	}
+
+	log.Printf("✅ Deleted novel in MongoDB: id=%s, deleted=%d", novel.ID, result.DeletedCount)
 	return nil
 }
 
 // UserCredit相关的MongoDB操作
 
 // CreateUserCreditInMongo 在MongoDB中创建UserCredit记录
-func (ms *MongoService) CreateUserCreditInMongo(userCredit map[string]interface{}) error {
+func (ms *MongoService) CreateUserCreditInMongo(ctx context.Context, userCredit *model.UserCredit) error {
 	collection := ms.db.GetCollection("user_credits")
 
-	// 获取或生成ID
-	id := getString(userCredit, "id")
-	if id == "" {
-		id = generateID() // 生成唯一ID
-	}
-
-	// 将map转换为UserCredit结构
+	// 链上的用户积分没有 _id，这里生成一个
 	userCreditData := &database.UserCredit{
-		ID:            id, // 使用传入的ID或生成的ID
-		UserID:        getString(userCredit, "userId"),
-		Credit:        getInt(userCredit, "credit"),
-		TotalUsed:     getInt(userCredit, "totalUsed"),
-		TotalRecharge: getInt(userCredit, "totalRecharge"),
-		CreatedAt:     getString(userCredit, "createdAt"),
-		UpdatedAt:     getString(userCredit, "updatedAt"),
+		ID:         generateID(),
+		UserCredit: *userCredit,
 	}
 
 	// 检查是否已存在相同的用户积分记录
 	filter := bson.M{"userId": userCreditData.UserID}
 	var existingUserCredit database.UserCredit
-	err := collection.FindOne(context.Background(), filter).Decode(&existingUserCredit)
+	err := collection.FindOne(ctx, filter).Decode(&existingUserCredit)
 	if err == nil {
 		log.Printf("UserCredit already exists in MongoDB, userId: %s", userCreditData.UserID)
 		return nil // 已存在，不重复创建
 	}
 
 	// 插入新记录
-	_, err = collection.InsertOne(context.Background(), userCreditData)
+	_, err = collection.InsertOne(ctx, userCreditData)
 	if err != nil {
 		return fmt.Errorf("failed to create user credit in MongoDB: %v", err)
 	}
@@ -152,97 +147,160 @@ func (ms *MongoService) CreateUserCreditInMongo(userCredit map[string]interface{
 }
 
 // UpdateUserCreditInMongo 在MongoDB中更新UserCredit记录
-func (ms *MongoService) UpdateUserCreditInMongo(userCredit map[string]interface{}) error {
+func (ms *MongoService) UpdateUserCreditInMongo(ctx context.Context, userCredit *model.UserCredit) error {
 	collection := ms.db.GetCollection("user_credits")
 
 	// 构建更新数据
 	updateData := bson.M{
 		"$set": bson.M{
-			"credit":         getInt(userCredit, "credit"),
-			"totalUsed":      getInt(userCredit, "totalUsed"),
-			"totalRecharge":  getInt(userCredit, "totalRecharge"),
-			"updatedAt":      getString(userCredit, "updatedAt"),
+			"credit":        userCredit.Credit,
+			"totalUsed":     userCredit.TotalUsed,
+			"totalRecharge": userCredit.TotalRecharge,
+			"held":          userCredit.Held,
+			"updatedAt":     userCredit.UpdatedAt,
 		},
 	}
 
 	// 根据userId查找并更新
-	filter := bson.M{"userId": getString(userCredit, "userId")}
-	result, err := collection.UpdateOne(context.Background(), filter, updateData)
+	filter := bson.M{"userId": userCredit.UserID}
+	result, err := collection.UpdateOne(ctx, filter, updateData)
 	if err != nil {
 		return fmt.Errorf("failed to update user credit in MongoDB: %v", err)
 	}
 
 	if result.MatchedCount == 0 {
 		// 如果没有找到记录，则创建新记录
-		return ms.CreateUserCreditInMongo(userCredit)
+		return ms.CreateUserCreditInMongo(ctx, userCredit)
 	}
 
 	log.Printf("✅ Updated user credit in MongoDB: userId=%s, credit=%d",
-		getString(userCredit, "userId"), getInt(userCredit, "credit"))
+		userCredit.UserID, userCredit.Credit)
+	return nil
+}
+
+// DeleteUserCreditInMongo 在MongoDB中删除UserCredit记录
+func (ms *MongoService) DeleteUserCreditInMongo(ctx context.Context, userCredit *model.UserCredit) error {
+	collection := ms.db.GetCollection("user_credits")
+
+	userId := userCredit.UserID
+	if userId == "" {
+		return fmt.Errorf("userId is empty, cannot delete")
+	}
+
+	result, err := collection.DeleteOne(ctx, bson.M{"userId": userId})
+	if err != nil {
+		return fmt.Errorf("failed to delete user credit in MongoDB: %v", err)
+	}
+
+	log.Printf("✅ Deleted user credit in MongoDB: userId=%s, deleted=%d", userId, result.DeletedCount)
 	return nil
 }
 
 // CreateCreditHistoryInMongo 在MongoDB中创建CreditHistory记录
-func (ms *MongoService) CreateCreditHistoryInMongo(creditHistory map[string]interface{}) error {
+func (ms *MongoService) CreateCreditHistoryInMongo(ctx context.Context, creditHistory *model.CreditHistory) error {
 	collection := ms.db.GetCollection("credit_histories")
 
-	// 获取或生成ID
-	id := getString(creditHistory, "id")
+	// 链上的积分历史用交易ID做主键，重放事件时不会重复插入
+	id := creditHistory.TxID
 	if id == "" {
 		id = generateID() // 生成唯一ID
 	}
 
-	// 将map转换为CreditHistory结构
 	creditHistoryData := &database.CreditHistory{
-		ID:          id, // 使用传入的ID或生成的ID
-		UserID:      getString(creditHistory, "userId"),
-		Amount:      getInt(creditHistory, "amount"),
-		Type:        getString(creditHistory, "type"),
-		Description: getString(creditHistory, "description"),
-		Timestamp:   getString(creditHistory, "timestamp"),
-		NovelID:     getString(creditHistory, "novelId"),
+		ID:            id,
+		CreditHistory: *creditHistory,
 	}
 
 	// 插入新记录
-	_, err := collection.InsertOne(context.Background(), creditHistoryData)
+	_, err := collection.InsertOne(ctx, creditHistoryData)
+	if mongo.IsDuplicateKeyError(err) {
+		log.Printf("ℹ️ Credit history %s already exists, skip", id)
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create credit history in MongoDB: %v", err)
 	}
 
 	log.Printf("✅ Created credit history in MongoDB: userId=%s, amount=%d, type=%s",
 		creditHistoryData.UserID, creditHistoryData.Amount, creditHistoryData.Type)
+
+	// 只有新插入的历史才计入汇总，重放的事件在上面已经跳过
+	if err := ms.IncrementNovelUsageDaily(ctx, creditHistoryData); err != nil {
+		log.Printf("⚠️ Failed to update novel usage rollup for %s: %v", id, err)
+	}
 	return nil
 }
 
-// 辅助函数
+// novelUsageDailyIndexes novel_usage_daily 的索引，重建汇总时临时集合也要建一样的索引
+func novelUsageDailyIndexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{Keys: bson.D{{Key: "novelId", Value: 1}, {Key: "date", Value: 1}}},
+		{Keys: bson.M{"date": 1}},
+	}
+}
+
+// IncrementNovelUsageDaily 把一条小说相关的消费历史累加到 novel_usage_daily
+func (ms *MongoService) IncrementNovelUsageDaily(ctx context.Context, history *database.CreditHistory) error {
+	if history.NovelID == "" || history.Type != "consume" || len(history.Timestamp) < len(analyticsDateLayout) {
+		return nil
+	}
 
-// getString 从map中安全获取string值
-func getString(data map[string]interface{}, key string) string {
-	//comma ok 语法
-	if value, exists := data[key]; exists {
-		if str, ok := value.(string); ok {
-			return str
-		}
+	date := history.Timestamp[:len(analyticsDateLayout)]
+	update := bson.M{
+		"$inc": bson.M{
+			"credits": -history.Amount, // 消费历史的 amount 是负数
+			"count":   1,
+			"operations." + operationKey(history.Operation): 1,
+		},
+		"$addToSet":    bson.M{"users": history.UserID},
+		"$set":         bson.M{"updatedAt": time.Now().UTC().Format("2006-01-02 15:04:05")},
+		"$setOnInsert": bson.M{"novelId": history.NovelID, "date": date},
 	}
-	return ""
+
+	collection := ms.db.GetCollection("novel_usage_daily")
+	opts := options.Update().SetUpsert(true)
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": history.NovelID + "|" + date}, update, opts); err != nil {
+		return fmt.Errorf("failed to update novel usage rollup: %v", err)
+	}
+	return nil
 }
 
-// getInt 从map中安全获取int值
-func getInt(data map[string]interface{}, key string) int {
-	if value, exists := data[key]; exists {
-		switch v := value.(type) {
-		case int:
-			return v
-		case float64: // JSON数字默认解析为float64
-			return int(v)
-		case string:
-			// 如果是字符串形式的数字，尝试解析
-			if num, err := strconv.Atoi(v); err == nil {
-				return num
-			}
-		}
+// UpsertCreditHoldInMongo 按 holdId 写入或更新积分预留
+func (ms *MongoService) UpsertCreditHoldInMongo(ctx context.Context, hold *model.CreditHold) error {
+	collection := ms.db.GetCollection("credit_holds")
+
+	if hold.HoldID == "" {
+		return fmt.Errorf("holdId is empty, cannot upsert")
 	}
-	return 0
+
+	opts := options.Replace().SetUpsert(true)
+	if _, err := collection.ReplaceOne(ctx, bson.M{"_id": hold.HoldID}, hold, opts); err != nil {
+		return fmt.Errorf("failed to upsert credit hold in MongoDB: %v", err)
+	}
+
+	log.Printf("✅ Upserted credit hold in MongoDB: holdId=%s, status=%s", hold.HoldID, hold.Status)
+	return nil
+}
+
+// syncStateChaincodeEvents 链码事件同步进度在 sync_state 集合里的 _id
+const syncStateChaincodeEvents = "chaincode_events"
+
+// UpdateSyncedBlock 记录读模型已经处理到的区块，只会往前推进
+func (ms *MongoService) UpdateSyncedBlock(ctx context.Context, blockNumber uint64) error {
+	collection := ms.db.GetCollection("sync_state")
+
+	_, err := collection.UpdateOne(ctx,
+		bson.M{"_id": syncStateChaincodeEvents},
+		bson.M{
+			"$max": bson.M{"blockNumber": blockNumber},
+			"$set": bson.M{"updatedAt": time.Now().Format("2006-01-02 15:04:05")},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update synced block in MongoDB: %v", err)
+	}
+	return nil
 }
 
 // CreateIndexes 创建必要的索引 - 数据库查询加速器
@@ -359,6 +417,72 @@ func (ms *MongoService) CreateIndexes() error {
 	}
 	log.Println("✅ recharge_records 集合的 createdAt 索引创建成功")
 
+	// 第七步：为小说用量汇总创建索引，按小说查日期序列、按日期范围做排行
+	log.Println("📈 为 novel_usage_daily 集合创建 novelId + date 和 date 索引...")
+	novelUsageCollection := ms.db.GetCollection("novel_usage_daily")
+	_, err = novelUsageCollection.Indexes().CreateMany(ctx, novelUsageDailyIndexes())
+	if err != nil {
+		return fmt.Errorf("❌ 创建 novel_usage_daily 集合的索引失败: %v", err)
+	}
+	log.Println("✅ novel_usage_daily 集合的索引创建成功")
+
+	// 第八步：为快照叶子创建索引，生成证明时按快照查找文档、按序号读取兄弟叶子
+	log.Println("🔏 为 audit_snapshot_leaves 集合创建 snapshotId 索引...")
+	auditLeavesCollection := ms.db.GetCollection("audit_snapshot_leaves")
+	_, err = auditLeavesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "snapshotId", Value: 1}, {Key: "collection", Value: 1}, {Key: "docId", Value: 1}}},
+		{Keys: bson.D{{Key: "snapshotId", Value: 1}, {Key: "index", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("❌ 创建 audit_snapshot_leaves 集合的索引失败: %v", err)
+	}
+	log.Println("✅ audit_snapshot_leaves 集合的索引创建成功")
+
+	// 快照的内部节点按快照清理
+	log.Println("🔏 为 audit_snapshot_nodes 集合创建 snapshotId 索引...")
+	_, err = ms.db.GetCollection("audit_snapshot_nodes").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.M{"snapshotId": 1},
+	})
+	if err != nil {
+		return fmt.Errorf("❌ 创建 audit_snapshot_nodes 集合的索引失败: %v", err)
+	}
+	log.Println("✅ audit_snapshot_nodes 集合的索引创建成功")
+
+	// 第九步：为异步交易创建索引，启动时按状态和提交时间找出没有结果的交易
+	log.Println("📮 为 transactions 集合创建 status 索引...")
+	transactionsCollection := ms.db.GetCollection("transactions")
+	_, err = transactionsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "submittedAt", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("❌ 创建 transactions 集合的索引失败: %v", err)
+	}
+	log.Println("✅ transactions 集合的索引创建成功")
+
+	// 第十步：为读模型的列表查询创建索引，过滤和排序字段后面跟唯一字段，和游标分页的排序键一致
+	log.Println("📖 为 novels 和 user_credits 集合创建列表查询索引...")
+	_, err = novelsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "author", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("❌ 创建 novels 集合的列表查询索引失败: %v", err)
+	}
+	_, err = userCreditsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "credit", Value: 1}, {Key: "userId", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("❌ 创建 user_credits 集合的列表查询索引失败: %v", err)
+	}
+	log.Println("✅ 列表查询索引创建成功")
+
+	// 第十一步：为小说创建全文索引，索引建在事件投影生成的 n-gram 分词上，旧数据在这里补上分词
+	log.Println("🔎 为 novels 集合创建全文索引...")
+	if err := ms.EnsureSearchIndex(ctx); err != nil {
+		return fmt.Errorf("❌ 创建 novels 集合的全文索引失败: %v", err)
+	}
+	log.Println("✅ novels 集合的全文索引创建成功")
+
 	log.Println("🎉 所有数据库索引创建完成！查询速度将会大幅提升")
 	return nil
 }
\ No newline at end of file
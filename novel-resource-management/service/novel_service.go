@@ -1,40 +1,30 @@
 package service
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"strings"
 
-	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"novel-resource-management/database"
+	model "novel-resource-model/v1"
 )
 
 type NovelService struct {
-	contract *client.Contract
+	contract *Contract
 }
 
-func NewNovelService(gateway *client.Gateway) (*NovelService, error) {
-	network := gateway.GetNetwork("mychannel")
-	if network == nil {
-		return nil, fmt.Errorf("无法获取network对象")
-
-	}
-	//先有network，再有contract
-	contract := network.GetContract("novel-basic")
-	if contract == nil {
-		return nil, fmt.Errorf("无法获取contract")
-	}
-	return &NovelService{contract: contract}, nil
+func NewNovelService(chaincode *Chaincode) *NovelService {
+	return &NovelService{contract: chaincode.Contract(NovelContractName)}
 }
 
 // create novel
-func (s *NovelService) CreateNovel(id, author, storyOutline,
+func (s *NovelService) CreateNovel(ctx context.Context, id, author, storyOutline,
 	subsections, characters, items, totalScenes string) error {
 
 	fmt.Printf("Creating novel %s...\n", id)
 
-	// 增删改操作需要使用SubmitTransaction，这里已经正确调用了SubmitTransaction方法
+	// 增删改操作需要提交交易，submitWithRetry 在读写冲突时会自动重试
 	// 注意：链码层面已经包含了存在性检查，不需要在服务层重复检查
-	_, err := s.contract.SubmitTransaction("CreateNovel",
+	_, err := submitWithRetry(ctx, s.contract, "CreateNovel",
 		id, author, storyOutline, subsections, characters, items, totalScenes)
 	if err != nil {
 		return fmt.Errorf("failed to create novel %s: %w", id, err)
@@ -43,8 +33,8 @@ func (s *NovelService) CreateNovel(id, author, storyOutline,
 }
 
 // update
-func (s *NovelService) UpdateNovel(id, author, storyOutline, subsections, characters, items, totalScenes string) error {
-	_, err := s.contract.SubmitTransaction("UpdateNovel", id, author, storyOutline, subsections, characters, items, totalScenes)
+func (s *NovelService) UpdateNovel(ctx context.Context, id, author, storyOutline, subsections, characters, items, totalScenes string) error {
+	_, err := submitWithRetry(ctx, s.contract, "UpdateNovel", id, author, storyOutline, subsections, characters, items, totalScenes)
 	if err != nil {
 		return fmt.Errorf("failed to update novel %s: %w", id, err)
 	}
@@ -52,68 +42,62 @@ func (s *NovelService) UpdateNovel(id, author, storyOutline, subsections, charac
 }
 
 // del
-func (s *NovelService) DeleteNovel(id string) error {
-	_, err := s.contract.SubmitTransaction("DeleteNovel", id)
+func (s *NovelService) DeleteNovel(ctx context.Context, id string) error {
+	_, err := submitWithRetry(ctx, s.contract, "DeleteNovel", id)
 	if err != nil {
 		return fmt.Errorf("failed to delete novel %s: %w", id, err)
 	}
 	return nil
 }
 
+// CreateNovelAsync 异步创建小说，返回等待提交的交易，提交结果通过 tracker 查询，提交成功后执行 onCommitted
+func (s *NovelService) CreateNovelAsync(ctx context.Context, tracker *TransactionTracker, callbackURL string, onCommitted CommitHook, id, author, storyOutline,
+	subsections, characters, items, totalScenes string) (*database.TransactionRecord, error) {
+	return tracker.SubmitThen(ctx, s.contract, callbackURL, onCommitted, "CreateNovel", id, author, storyOutline, subsections, characters, items, totalScenes)
+}
+
+// UpdateNovelAsync 异步更新小说
+func (s *NovelService) UpdateNovelAsync(ctx context.Context, tracker *TransactionTracker, callbackURL string, id, author, storyOutline,
+	subsections, characters, items, totalScenes string) (*database.TransactionRecord, error) {
+	return tracker.Submit(ctx, s.contract, callbackURL, "UpdateNovel", id, author, storyOutline, subsections, characters, items, totalScenes)
+}
+
+// DeleteNovelAsync 异步删除小说，提交成功后执行 onCommitted
+func (s *NovelService) DeleteNovelAsync(ctx context.Context, tracker *TransactionTracker, callbackURL string, onCommitted CommitHook, id string) (*database.TransactionRecord, error) {
+	return tracker.SubmitThen(ctx, s.contract, callbackURL, onCommitted, "DeleteNovel", id)
+}
+
 // ReadNovel 读取小说信息
-func (s *NovelService) ReadNovel(id string) (map[string]interface{}, error) {
+func (s *NovelService) ReadNovel(ctx context.Context, id string) (*model.Novel, error) {
 	fmt.Printf("Reading novel %s...\n", id)
 
-	result, err := s.contract.EvaluateTransaction("ReadNovel", id)
+	result, err := evaluateTransaction(ctx, s.contract, "ReadNovel", id)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to read novel %s: %w", id, err)
 	}
 
-	//map[string]interface{}
-	var novelData map[string]interface{}
-
-	err = json.Unmarshal(result, &novelData)
-	if err != nil {
+	// 严格解码：链码返回的字段和共享模型对不上时直接报错，不再默默丢字段
+	var novel model.Novel
+	if err := model.Decode(result, &novel); err != nil {
 		return nil, fmt.Errorf("unmarshal failed:%v", err)
 	}
-
-	return novelData, nil
+	return &novel, nil
 }
 
 // get all novels
-func (s *NovelService) GetAllNovels() ([]map[string]interface{}, error) {
+func (s *NovelService) GetAllNovels(ctx context.Context) ([]model.Novel, error) {
 	fmt.Println("Getting all novels...")
 
-	result, err := s.contract.EvaluateTransaction("GetAllNovels")
+	result, err := evaluateTransaction(ctx, s.contract, "GetAllNovels")
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all novels: %w", err)
 	}
 
-	// 🔍 添加调试信息
-	fmt.Printf("🔍 [DEBUG] 链码返回原始数据长度: %d\n", len(result))
-	fmt.Printf("🔍 [DEBUG] 链码返回原始数据内容: %q\n", string(result))
-
-	// 检查是否为空数据
-	if len(result) == 0 {
-		fmt.Printf("⚠️ [WARNING] 链码返回空数据\n")
-		return []map[string]interface{}{}, nil
-	}
-
-	// 检查是否是有效的JSON开头
-	trimmedResult := strings.TrimSpace(string(result))
-	if !strings.HasPrefix(trimmedResult, "[") {
-		fmt.Printf("❌ [ERROR] 链码返回的不是有效的JSON数组格式，开头是: %q\n", trimmedResult[:10])
-		return nil, fmt.Errorf("invalid JSON format, expected array but got: %s", trimmedResult[:min(50, len(trimmedResult))])
-	}
-
-	var novels []map[string]interface{}
-
-	err = json.Unmarshal(result, &novels)
-
+	// 链码没有数据时可能返回空内容或 null，DecodeList 都会返回空列表
+	novels, err := model.DecodeList[model.Novel](result)
 	if err != nil {
-		fmt.Printf("❌ [ERROR] JSON 解析失败: %v\n", err)
 		fmt.Printf("❌ [ERROR] 尝试解析的数据内容: %q\n", string(result))
 		return nil, fmt.Errorf("unmarshal failed:%w", err)
 	}
@@ -121,10 +105,3 @@ func (s *NovelService) GetAllNovels() ([]map[string]interface{}, error) {
 	fmt.Printf("✅ [SUCCESS] 解析成功，获取到 %d 个小说\n", len(novels))
 	return novels, nil
 }
-
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
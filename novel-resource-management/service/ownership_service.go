@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"novel-resource-management/database"
+)
+
+// OwnershipService 查询资源的所有者，给路由授权策略的 owner 规则使用
+type OwnershipService struct {
+	db *database.MongoDBInstance
+}
+
+func NewOwnershipService() *OwnershipService {
+	return &OwnershipService{
+		db: database.GetMongoInstance(),
+	}
+}
+
+// AddNovel 创建小说的交易提交后把小说记到创建者的 novelIds 里
+// API Key 调用方没有 users 文档，不记录所有者
+func (o *OwnershipService) AddNovel(ctx context.Context, novelID, userID string) error {
+	_, err := o.db.GetCollection("users").UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$addToSet": bson.M{"novelIds": novelID}})
+	if err != nil {
+		return fmt.Errorf("record owner of novel %s failed: %v", novelID, err)
+	}
+	return nil
+}
+
+// RemoveNovel 小说删除后从所有用户的 novelIds 里去掉，之后用同一个ID重新创建的小说属于新的创建者
+func (o *OwnershipService) RemoveNovel(ctx context.Context, novelID string) error {
+	_, err := o.db.GetCollection("users").UpdateMany(ctx, bson.M{"novelIds": novelID}, bson.M{"$pull": bson.M{"novelIds": novelID}})
+	if err != nil {
+		return fmt.Errorf("remove owner of novel %s failed: %v", novelID, err)
+	}
+	return nil
+}
+
+// IsNovelOwner 小说ID在用户的 novelIds 里，创建小说时由 AddNovel 写入
+func (o *OwnershipService) IsNovelOwner(ctx context.Context, novelID, userID string) (bool, error) {
+	return o.exists(ctx, "users", bson.M{"_id": userID, "novelIds": novelID})
+}
+
+// IsHoldOwner 预留属于这个用户
+func (o *OwnershipService) IsHoldOwner(ctx context.Context, holdID, userID string) (bool, error) {
+	return o.exists(ctx, "credit_holds", bson.M{"_id": holdID, "userId": userID})
+}
+
+func (o *OwnershipService) exists(ctx context.Context, collection string, filter bson.M) (bool, error) {
+	if filter["_id"] == "" {
+		return false, nil
+	}
+	count, err := o.db.GetCollection(collection).CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("query %s failed: %v", collection, err)
+	}
+	return count > 0, nil
+}
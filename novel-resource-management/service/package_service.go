@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"novel-resource-management/database"
+)
+
+// packageTimeLayout 套餐活动时间的格式，按 UTC 解析
+const packageTimeLayout = "2006-01-02 15:04:05"
+
+var (
+	// ErrPackageNotFound 套餐不存在或已下架
+	ErrPackageNotFound = errors.New("recharge package not found")
+	// ErrPackagePriceMismatch 支付金额和套餐价格不一致
+	ErrPackagePriceMismatch = errors.New("recharge price does not match package")
+	// ErrPackageExists 创建时 good_id 已存在
+	ErrPackageExists = errors.New("recharge package already exists")
+	// ErrInvalidPackage 套餐字段不合法
+	ErrInvalidPackage = errors.New("invalid recharge package")
+)
+
+// PackageService 充值套餐目录，存在 MongoDB recharge_packages 集合
+type PackageService struct {
+	db *database.MongoDBInstance
+}
+
+func NewPackageService() *PackageService {
+	return &PackageService{
+		db: database.GetMongoInstance(),
+	}
+}
+
+// RechargeGrant 一次充值实际发放的积分
+type RechargeGrant struct {
+	GoodID       string `json:"goodId"`
+	Credits      int    `json:"credits"`
+	BonusCredits int    `json:"bonusCredits"` // 包含活动赠送
+	Total        int    `json:"total"`
+}
+
+// validatePackage 检查套餐字段
+func validatePackage(pkg *database.RechargePackage) error {
+	if pkg.GoodID == "" {
+		return fmt.Errorf("goodId can not be empty")
+	}
+	if pkg.Price <= 0 {
+		return fmt.Errorf("price must be positive")
+	}
+	if pkg.Credits <= 0 {
+		return fmt.Errorf("credits must be positive")
+	}
+	if pkg.BonusCredits < 0 || pkg.PromoBonusCredits < 0 {
+		return fmt.Errorf("bonus credits can not be negative")
+	}
+
+	var start, end time.Time
+	var err error
+	if pkg.PromoStart != "" {
+		if start, err = time.Parse(packageTimeLayout, pkg.PromoStart); err != nil {
+			return fmt.Errorf("invalid promoStart: %v", err)
+		}
+	}
+	if pkg.PromoEnd != "" {
+		if end, err = time.Parse(packageTimeLayout, pkg.PromoEnd); err != nil {
+			return fmt.Errorf("invalid promoEnd: %v", err)
+		}
+	}
+	if !start.IsZero() && !end.IsZero() && !end.After(start) {
+		return fmt.Errorf("promoEnd must be after promoStart")
+	}
+	return nil
+}
+
+// ListPackages 列出套餐，activeOnly 为 true 时只返回上架的
+func (ps *PackageService) ListPackages(activeOnly bool) ([]database.RechargePackage, error) {
+	filter := bson.M{}
+	if activeOnly {
+		filter["active"] = true
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "price", Value: 1}})
+	cursor, err := ps.db.GetCollection("recharge_packages").Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("list recharge packages failed: %v", err)
+	}
+	defer cursor.Close(context.Background())
+
+	packages := []database.RechargePackage{}
+	if err := cursor.All(context.Background(), &packages); err != nil {
+		return nil, fmt.Errorf("decode recharge packages failed: %v", err)
+	}
+	return packages, nil
+}
+
+// GetPackage 按 good_id 读取套餐
+func (ps *PackageService) GetPackage(goodID string) (*database.RechargePackage, error) {
+	var pkg database.RechargePackage
+	err := ps.db.GetCollection("recharge_packages").FindOne(context.Background(), bson.M{"_id": goodID}).Decode(&pkg)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrPackageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get recharge package failed: %v", err)
+	}
+	return &pkg, nil
+}
+
+// CreatePackage 新建套餐
+func (ps *PackageService) CreatePackage(pkg *database.RechargePackage) error {
+	if err := validatePackage(pkg); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+	}
+
+	now := time.Now().UTC().Format(packageTimeLayout)
+	pkg.CreatedAt = now
+	pkg.UpdatedAt = now
+
+	_, err := ps.db.GetCollection("recharge_packages").InsertOne(context.Background(), pkg)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrPackageExists
+	}
+	if err != nil {
+		return fmt.Errorf("create recharge package failed: %v", err)
+	}
+
+	log.Printf("✅ 创建充值套餐: goodId=%s, price=%d, credits=%d", pkg.GoodID, pkg.Price, pkg.Credits)
+	return nil
+}
+
+// UpdatePackage 整体更新套餐，保留创建时间
+func (ps *PackageService) UpdatePackage(pkg *database.RechargePackage) error {
+	if err := validatePackage(pkg); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+	}
+
+	existing, err := ps.GetPackage(pkg.GoodID)
+	if err != nil {
+		return err
+	}
+	pkg.CreatedAt = existing.CreatedAt
+	pkg.UpdatedAt = time.Now().UTC().Format(packageTimeLayout)
+
+	_, err = ps.db.GetCollection("recharge_packages").ReplaceOne(context.Background(), bson.M{"_id": pkg.GoodID}, pkg)
+	if err != nil {
+		return fmt.Errorf("update recharge package failed: %v", err)
+	}
+
+	log.Printf("✅ 更新充值套餐: goodId=%s, price=%d, credits=%d", pkg.GoodID, pkg.Price, pkg.Credits)
+	return nil
+}
+
+// DeletePackage 删除套餐，历史充值记录里保留了 goodId 和发放的积分
+func (ps *PackageService) DeletePackage(goodID string) error {
+	result, err := ps.db.GetCollection("recharge_packages").DeleteOne(context.Background(), bson.M{"_id": goodID})
+	if err != nil {
+		return fmt.Errorf("delete recharge package failed: %v", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrPackageNotFound
+	}
+
+	log.Printf("✅ 删除充值套餐: goodId=%s", goodID)
+	return nil
+}
+
+// ResolveRecharge 根据回调里的 good_id 和 actual_price 计算应发放的积分
+// 套餐不存在、已下架或价格不一致时返回错误，不发放积分
+func (ps *PackageService) ResolveRecharge(goodID string, actualPrice int, at time.Time) (*RechargeGrant, error) {
+	if goodID == "" {
+		return nil, ErrPackageNotFound
+	}
+
+	pkg, err := ps.GetPackage(goodID)
+	if err != nil {
+		return nil, err
+	}
+	if !pkg.Active {
+		return nil, ErrPackageNotFound
+	}
+	if pkg.Price != actualPrice {
+		return nil, fmt.Errorf("%w: package %s costs %d, paid %d", ErrPackagePriceMismatch, goodID, pkg.Price, actualPrice)
+	}
+
+	grant := &RechargeGrant{
+		GoodID:       pkg.GoodID,
+		Credits:      pkg.Credits,
+		BonusCredits: pkg.BonusCredits,
+	}
+	if inPromoWindow(pkg, at) {
+		grant.BonusCredits += pkg.PromoBonusCredits
+	}
+	grant.Total = grant.Credits + grant.BonusCredits
+	return grant, nil
+}
+
+// inPromoWindow 活动开始/结束时间为空表示不限，两个都为空时不算活动
+func inPromoWindow(pkg *database.RechargePackage, at time.Time) bool {
+	if pkg.PromoBonusCredits == 0 || (pkg.PromoStart == "" && pkg.PromoEnd == "") {
+		return false
+	}
+	at = at.UTC()
+	if pkg.PromoStart != "" {
+		start, err := time.Parse(packageTimeLayout, pkg.PromoStart)
+		if err != nil || at.Before(start) {
+			return false
+		}
+	}
+	if pkg.PromoEnd != "" {
+		end, err := time.Parse(packageTimeLayout, pkg.PromoEnd)
+		if err != nil || !at.Before(end) {
+			return false
+		}
+	}
+	return true
+}
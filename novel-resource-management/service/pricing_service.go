@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	model "novel-resource-model/v1"
+)
+
+// PricingService 读取链上的价格表（操作码 -> 积分）
+type PricingService struct {
+	contract *Contract
+}
+
+func NewPricingService(chaincode *Chaincode) *PricingService {
+	return &PricingService{contract: chaincode.Contract(CreditContractName)}
+}
+
+// GetPricing 当前生效的价格表，链上没有配置时链码返回每次 1 积分的默认价格表
+func (ps *PricingService) GetPricing(ctx context.Context) (*model.PricingTable, error) {
+	result, err := evaluateTransaction(ctx, ps.contract, "GetPricing")
+	if err != nil {
+		return nil, fmt.Errorf("get pricing failed: %v", err)
+	}
+	return decodeResult[model.PricingTable](result)
+}
+
+// GetPricingSchedule 所有版本的价格表，包括还没有生效的
+func (ps *PricingService) GetPricingSchedule(ctx context.Context) ([]model.PricingTable, error) {
+	result, err := evaluateTransaction(ctx, ps.contract, "GetPricingSchedule")
+	if err != nil {
+		return nil, fmt.Errorf("get pricing schedule failed: %v", err)
+	}
+	return decodeResultList[model.PricingTable](result)
+}
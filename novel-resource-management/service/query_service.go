@@ -0,0 +1,346 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"novel-resource-management/database"
+	model "novel-resource-model/v1"
+)
+
+// 读写分离：写操作走链码，列表查询读 EventService 同步到 MongoDB 的读模型
+// 读模型比账本落后，返回结果时带上已经同步到的区块，需要强一致的调用方用 ?consistency=ledger 直接查链
+
+const (
+	DefaultQueryLimit = 20
+	MaxQueryLimit     = 100
+)
+
+// ErrInvalidQuery 排序、字段或游标参数不合法
+var ErrInvalidQuery = errors.New("invalid query")
+
+// ListOptions 列表查询的排序、投影和分页参数
+// Sort 是字段名，前面加 - 表示倒序；Fields 为空时返回完整文档；Cursor 是上一页返回的 nextCursor
+type ListOptions struct {
+	Sort   string
+	Fields []string
+	Limit  int
+	Cursor string
+}
+
+// NovelFilter 小说列表的过滤条件，时间是 "2006-01-02 15:04:05" 格式的前缀比较
+type NovelFilter struct {
+	Author      string
+	CreatedFrom string
+	CreatedTo   string
+}
+
+// UserCreditFilter 用户积分列表的过滤条件，nil 表示不限制
+type UserCreditFilter struct {
+	MinCredit *int
+	MaxCredit *int
+}
+
+// ListPage 一页查询结果
+// BlockHeight 是读模型已经处理过事件的最高区块，这一页的数据至少和这个区块一样新
+type ListPage struct {
+	Items       interface{} `json:"items"`
+	Count       int         `json:"count"`
+	NextCursor  string      `json:"nextCursor,omitempty"`
+	BlockHeight uint64      `json:"blockHeight"`
+	SyncedAt    string      `json:"syncedAt,omitempty"`
+}
+
+// queryField 可以投影的字段，key 是 JSON 字段名
+type queryField struct {
+	bson     string
+	numeric  bool
+	sortable bool
+}
+
+// listSpec 一个集合的查询规则，key 是唯一字段，用来在排序值相同时确定顺序
+type listSpec struct {
+	collection  string
+	key         string
+	defaultSort string
+	fields      map[string]queryField
+}
+
+var novelListSpec = listSpec{
+	collection:  "novels",
+	key:         "id",
+	defaultSort: "id",
+	fields: map[string]queryField{
+		"id":           {bson: "_id", sortable: true},
+		"author":       {bson: "author", sortable: true},
+		"storyOutline": {bson: "storyOutline"},
+		"subsections":  {bson: "subsections"},
+		"characters":   {bson: "characters"},
+		"items":        {bson: "items"},
+		"totalScenes":  {bson: "totalScenes"},
+		"createdAt":    {bson: "createdAt", sortable: true},
+		"updatedAt":    {bson: "updatedAt", sortable: true},
+	},
+}
+
+var userCreditListSpec = listSpec{
+	collection:  "user_credits",
+	key:         "userId",
+	defaultSort: "userId",
+	fields: map[string]queryField{
+		"userId":        {bson: "userId", sortable: true},
+		"credit":        {bson: "credit", numeric: true, sortable: true},
+		"totalUsed":     {bson: "totalUsed", numeric: true, sortable: true},
+		"totalRecharge": {bson: "totalRecharge", numeric: true, sortable: true},
+		"held":          {bson: "held", numeric: true, sortable: true},
+		"createdAt":     {bson: "createdAt", sortable: true},
+		"updatedAt":     {bson: "updatedAt", sortable: true},
+	},
+}
+
+// listCursor 游标记录上一页最后一条的排序值和唯一字段
+type listCursor struct {
+	Sort  string          `json:"s"`
+	Value json.RawMessage `json:"v"`
+	Key   string          `json:"k"`
+}
+
+// QueryService 从 MongoDB 读模型查询列表
+type QueryService struct {
+	db *database.MongoDBInstance
+}
+
+func NewQueryService() *QueryService {
+	return &QueryService{
+		db: database.GetMongoInstance(),
+	}
+}
+
+// ListNovels 按条件分页查询小说
+func (qs *QueryService) ListNovels(ctx context.Context, filter NovelFilter, opts ListOptions) (*ListPage, error) {
+	query := novelFilterQuery(filter)
+	return listDocuments[model.Novel](ctx, qs, novelListSpec, query, opts)
+}
+
+// ListUserCredits 按条件分页查询用户积分
+func (qs *QueryService) ListUserCredits(ctx context.Context, filter UserCreditFilter, opts ListOptions) (*ListPage, error) {
+	query := bson.M{}
+	credit := bson.M{}
+	if filter.MinCredit != nil {
+		credit["$gte"] = *filter.MinCredit
+	}
+	if filter.MaxCredit != nil {
+		credit["$lte"] = *filter.MaxCredit
+	}
+	if len(credit) > 0 {
+		query["credit"] = credit
+	}
+	return listDocuments[model.UserCredit](ctx, qs, userCreditListSpec, query, opts)
+}
+
+// SyncState 读模型的同步进度，还没有处理过事件时区块是 0
+func (qs *QueryService) SyncState(ctx context.Context) (*database.SyncState, error) {
+	var state database.SyncState
+	err := qs.db.GetCollection("sync_state").FindOne(ctx, bson.M{"_id": syncStateChaincodeEvents}).Decode(&state)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &database.SyncState{ID: syncStateChaincodeEvents}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read sync state failed: %v", err)
+	}
+	return &state, nil
+}
+
+// listDocuments 按 keyset 分页：排序字段加唯一字段组成排序键，下一页从游标之后开始
+func listDocuments[T any](ctx context.Context, qs *QueryService, spec listSpec, query bson.M, opts ListOptions) (*ListPage, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultQueryLimit
+	}
+	if opts.Limit > MaxQueryLimit {
+		opts.Limit = MaxQueryLimit
+	}
+
+	sortName := opts.Sort
+	if sortName == "" {
+		sortName = spec.defaultSort
+	}
+	descending := strings.HasPrefix(sortName, "-")
+	sortField, ok := spec.fields[strings.TrimPrefix(sortName, "-")]
+	if !ok || !sortField.sortable {
+		return nil, fmt.Errorf("%w: can not sort by %s", ErrInvalidQuery, sortName)
+	}
+	keyField := spec.fields[spec.key]
+	direction := 1
+	if descending {
+		direction = -1
+	}
+	sort := bson.D{{Key: sortField.bson, Value: direction}}
+	if sortField.bson != keyField.bson {
+		sort = append(sort, bson.E{Key: keyField.bson, Value: direction})
+	}
+
+	// 先读同步进度再查数据，保证返回的区块不会比数据新
+	state, err := qs.SyncState(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Cursor != "" {
+		after, err := cursorFilter(opts.Cursor, sortName, sortField, keyField, descending)
+		if err != nil {
+			return nil, err
+		}
+		query = bson.M{"$and": bson.A{query, after}}
+	}
+
+	findOptions := options.Find().SetSort(sort).SetLimit(int64(opts.Limit) + 1)
+	if len(opts.Fields) > 0 {
+		// 排序字段和唯一字段用来生成游标，即使没有请求也要查出来
+		projection := bson.M{sortField.bson: 1, keyField.bson: 1}
+		for _, name := range opts.Fields {
+			field, ok := spec.fields[name]
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown field %s", ErrInvalidQuery, name)
+			}
+			projection[field.bson] = 1
+		}
+		findOptions.SetProjection(projection)
+	}
+
+	cursor, err := qs.db.GetCollection(spec.collection).Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("query %s failed: %v", spec.collection, err)
+	}
+	var docs []T
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("decode %s failed: %v", spec.collection, err)
+	}
+
+	page := &ListPage{
+		BlockHeight: state.BlockNumber,
+		SyncedAt:    state.UpdatedAt,
+	}
+	if len(docs) > opts.Limit {
+		docs = docs[:opts.Limit]
+		last, err := toFieldMap(docs[len(docs)-1])
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor, err = encodeCursor(listCursor{
+			Sort:  sortName,
+			Value: last[strings.TrimPrefix(sortName, "-")],
+			Key:   jsonString(last[spec.key]),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	page.Count = len(docs)
+
+	if len(opts.Fields) == 0 {
+		if docs == nil {
+			docs = []T{}
+		}
+		page.Items = docs
+		return page, nil
+	}
+
+	// 按 JSON 字段名投影，只返回请求的字段
+	items := make([]map[string]json.RawMessage, 0, len(docs))
+	for _, doc := range docs {
+		all, err := toFieldMap(doc)
+		if err != nil {
+			return nil, err
+		}
+		item := make(map[string]json.RawMessage, len(opts.Fields))
+		for _, name := range opts.Fields {
+			if value, ok := all[name]; ok {
+				item[name] = value
+			}
+		}
+		items = append(items, item)
+	}
+	page.Items = items
+	return page, nil
+}
+
+// cursorFilter 游标之后的记录：排序值更大（倒序时更小），或排序值相同且唯一字段更大
+func cursorFilter(raw string, sortName string, sortField, keyField queryField, descending bool) (bson.M, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	var c listCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	if c.Sort != sortName {
+		return nil, fmt.Errorf("%w: cursor was created with sort %s", ErrInvalidQuery, c.Sort)
+	}
+
+	var value interface{}
+	if sortField.numeric {
+		var number int64
+		err = json.Unmarshal(c.Value, &number)
+		value = number
+	} else {
+		var text string
+		if len(c.Value) > 0 {
+			err = json.Unmarshal(c.Value, &text)
+		}
+		value = text
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+
+	op := "$gt"
+	if descending {
+		op = "$lt"
+	}
+	if sortField.bson == keyField.bson {
+		return bson.M{sortField.bson: bson.M{op: value}}, nil
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{sortField.bson: bson.M{op: value}},
+		bson.M{sortField.bson: value, keyField.bson: bson.M{op: c.Key}},
+	}}, nil
+}
+
+func encodeCursor(c listCursor) (string, error) {
+	if c.Value == nil {
+		c.Value = json.RawMessage(`""`)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("encode cursor failed: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// toFieldMap 按 JSON 字段名拆开文档，省略的空字段不会出现
+func toFieldMap(doc interface{}) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("marshal document failed: %v", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("unmarshal document failed: %v", err)
+	}
+	return fields, nil
+}
+
+func jsonString(raw json.RawMessage) string {
+	var text string
+	_ = json.Unmarshal(raw, &text)
+	return text
+}
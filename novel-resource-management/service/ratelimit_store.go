@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"novel-resource-management/database"
+)
+
+// RateLimitStore 把令牌桶存在 MongoDB 的 rate_limits 集合，多个实例共享同一个桶
+// 补充和取令牌在一次 findOneAndUpdate 的聚合管道里完成，并发请求不会重复取到同一个令牌
+// 令牌桶补满之后就没有保存的必要，expiresAt 设成补满的时间，由 TTL 索引清理
+type RateLimitStore struct {
+	buckets *mongo.Collection
+}
+
+func NewRateLimitStore() *RateLimitStore {
+	rs := &RateLimitStore{
+		buckets: database.GetMongoInstance().GetCollection("rate_limits"),
+	}
+
+	_, err := rs.buckets.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.M{"expiresAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Printf("⚠️ 创建 rate_limits 集合的 TTL 索引失败: %v", err)
+	}
+	return rs
+}
+
+// Take 实现 middleware.RateLimitStore，计算方式和 middleware.RefillTokens 相同
+func (rs *RateLimitStore) Take(ctx context.Context, key string, rate float64, burst int, now time.Time) (float64, bool, error) {
+	// MongoDB 的日期精度是毫秒，now 也按毫秒截断，否则桶里的时间会比 now 晚
+	now = now.Truncate(time.Millisecond)
+	elapsedSeconds := bson.M{"$divide": bson.A{
+		bson.M{"$max": bson.A{0, bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updatedAt", now}}}}}},
+		1000,
+	}}
+	refilled := bson.M{"$min": bson.A{burst, bson.M{"$add": bson.A{
+		bson.M{"$ifNull": bson.A{"$tokens", burst}},
+		bson.M{"$multiply": bson.A{elapsedSeconds, rate}},
+	}}}}
+	canTake := bson.M{"$gte": bson.A{"$tokens", 1}}
+	remaining := bson.M{"$cond": bson.A{canTake, bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"tokens": refilled, "updatedAt": now}}},
+		{{Key: "$set", Value: bson.M{"allowed": canTake, "tokens": remaining}}},
+		{{Key: "$set", Value: bson.M{"expiresAt": bson.M{"$add": bson.A{
+			now,
+			bson.M{"$multiply": bson.A{bson.M{"$subtract": bson.A{burst, "$tokens"}}, 1000 / rate}},
+		}}}}},
+	}
+
+	var bucket struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := rs.buckets.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&bucket)
+	if mongo.IsDuplicateKeyError(err) {
+		// 两个请求同时创建同一个桶，后一个 upsert 冲突，重试一次时桶已经存在
+		err = rs.buckets.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&bucket)
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("take rate limit token failed: %v", err)
+	}
+	return bucket.Tokens, bucket.Allowed, nil
+}
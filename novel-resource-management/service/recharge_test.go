@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsTransientRechargeError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name:     "read conflict",
+			err:      fmt.Errorf("recharge user credit failed: %w", &CommitError{TransactionID: "tx1", Code: peer.TxValidationCode_MVCC_READ_CONFLICT}),
+			expected: true,
+		},
+		{
+			name:     "retries exhausted",
+			err:      fmt.Errorf("RechargeUserCredit gave up retrying: %v: %w", context.DeadlineExceeded, &CommitError{Code: peer.TxValidationCode_PHANTOM_READ_CONFLICT}),
+			expected: true,
+		},
+		{name: "timeout", err: fmt.Errorf("recharge user credit failed: %w", context.DeadlineExceeded), expected: true},
+		{name: "peer unavailable", err: status.Error(codes.Unavailable, "connection refused"), expected: true},
+		{name: "gateway deadline", err: status.Error(codes.DeadlineExceeded, "endorse timed out"), expected: true},
+		{name: "chaincode rejected the order", err: status.Error(codes.Aborted, "recharge order o1 already exists"), expected: false},
+		{name: "endorsement policy failure", err: &CommitError{Code: peer.TxValidationCode_ENDORSEMENT_POLICY_FAILURE}, expected: false},
+		{name: "unknown error", err: errors.New("boom"), expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, isTransientRechargeError(tt.err))
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"novel-resource-management/database"
+	model "novel-resource-model/v1"
+)
+
+// 全文搜索：MongoDB 的文本索引按空格和标点分词，连续的中文会被当成一个词，搜不到其中的片段
+// 所以事件投影写小说时，把每个字段切成 n-gram 存在 search 子文档里，文本索引建在 search 上
+// 中文、日文、韩文按单字和相邻两个字切分，其他文字按单词切分并转成小写
+
+const (
+	// MaxSearchLimit 一次搜索最多返回的条数
+	MaxSearchLimit = 50
+	// searchSnippetRadius 高亮片段在命中位置前后保留的字数
+	searchSnippetRadius = 30
+	// searchIndexName novels 集合的文本索引名，同一个集合只能有一个文本索引
+	searchIndexName = "novels_search_text"
+)
+
+// searchFields 参与搜索的字段和权重，作者和大纲命中时排在前面
+var searchFields = []struct {
+	name   string
+	weight int
+	value  func(*model.Novel) string
+}{
+	{"author", 5, func(n *model.Novel) string { return n.Author }},
+	{"storyOutline", 3, func(n *model.Novel) string { return n.StoryOutline }},
+	{"characters", 2, func(n *model.Novel) string { return n.Characters }},
+	{"items", 1, func(n *model.Novel) string { return n.Items }},
+	{"subsections", 1, func(n *model.Novel) string { return n.Subsections }},
+}
+
+// SearchHit 一条搜索结果，Highlights 的 key 是命中的字段，命中的词用 <em></em> 包起来
+type SearchHit struct {
+	Novel      model.Novel       `json:"novel"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
+
+// SearchResult 搜索结果，BlockHeight 和列表查询一样说明读模型的新鲜度
+type SearchResult struct {
+	Hits        []SearchHit `json:"hits"`
+	Count       int         `json:"count"`
+	BlockHeight uint64      `json:"blockHeight"`
+	SyncedAt    string      `json:"syncedAt,omitempty"`
+}
+
+// SearchService 在 MongoDB 读模型上搜索小说
+type SearchService struct {
+	db    *database.MongoDBInstance
+	query *QueryService
+}
+
+func NewSearchService() *SearchService {
+	return &SearchService{
+		db:    database.GetMongoInstance(),
+		query: NewQueryService(),
+	}
+}
+
+// NovelSearchFields 生成小说的 search 子文档，key 是字段名，value 是空格分隔的分词
+func NovelSearchFields(novel *model.Novel) map[string]string {
+	fields := make(map[string]string, len(searchFields))
+	for _, field := range searchFields {
+		fields[field.name] = strings.Join(searchTokens(field.value(novel), true), " ")
+	}
+	return fields
+}
+
+// SearchNovels 按相关度搜索小说，filter 和列表查询的过滤条件一样
+func (ss *SearchService) SearchNovels(ctx context.Context, q string, filter NovelFilter, limit, offset int) (*SearchResult, error) {
+	terms := searchTokens(q, false)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("%w: search query has no searchable words", ErrInvalidQuery)
+	}
+	if limit <= 0 || limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	state, err := ss.query.SyncState(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := novelFilterQuery(filter)
+	query["$text"] = bson.M{"$search": strings.Join(terms, " ")}
+	opts := options.Find().
+		SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}, "search": 0}).
+		SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "_id", Value: 1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+
+	cursor, err := ss.db.GetCollection("novels").Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("search novels failed: %v", err)
+	}
+	var docs []struct {
+		model.Novel `bson:",inline"`
+		Score       float64 `bson:"score"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("decode search results failed: %v", err)
+	}
+
+	result := &SearchResult{
+		Hits:        make([]SearchHit, 0, len(docs)),
+		Count:       len(docs),
+		BlockHeight: state.BlockNumber,
+		SyncedAt:    state.UpdatedAt,
+	}
+	for i := range docs {
+		hit := SearchHit{Novel: docs[i].Novel, Score: docs[i].Score, Highlights: map[string]string{}}
+		for _, field := range searchFields {
+			if snippet, ok := highlight(field.value(&docs[i].Novel), terms); ok {
+				hit.Highlights[field.name] = snippet
+			}
+		}
+		result.Hits = append(result.Hits, hit)
+	}
+	return result, nil
+}
+
+// EnsureSearchIndex 创建文本索引，并给还没有 search 子文档的小说补上分词
+func (ms *MongoService) EnsureSearchIndex(ctx context.Context) error {
+	collection := ms.db.GetCollection("novels")
+
+	keys := bson.D{}
+	weights := bson.D{}
+	for _, field := range searchFields {
+		keys = append(keys, bson.E{Key: "search." + field.name, Value: "text"})
+		weights = append(weights, bson.E{Key: "search." + field.name, Value: field.weight})
+	}
+	// 分词已经在写入时做好了，language none 关闭词干和停用词
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    keys,
+		Options: options.Index().SetName(searchIndexName).SetWeights(weights).SetDefaultLanguage("none"),
+	})
+	if err != nil {
+		return fmt.Errorf("create text index failed: %v", err)
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{"search": bson.M{"$exists": false}})
+	if err != nil {
+		return fmt.Errorf("find novels without search fields failed: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	updated := 0
+	for cursor.Next(ctx) {
+		var novel model.Novel
+		if err := cursor.Decode(&novel); err != nil {
+			return fmt.Errorf("decode novel failed: %v", err)
+		}
+		_, err := collection.UpdateOne(ctx, bson.M{"_id": novel.ID}, bson.M{"$set": bson.M{"search": NovelSearchFields(&novel)}})
+		if err != nil {
+			return fmt.Errorf("update search fields of %s failed: %v", novel.ID, err)
+		}
+		updated++
+	}
+	if updated > 0 {
+		log.Printf("🔎 已为 %d 本小说补充搜索分词", updated)
+	}
+	return cursor.Err()
+}
+
+// novelFilterQuery 把小说过滤条件转换成 MongoDB 查询
+func novelFilterQuery(filter NovelFilter) bson.M {
+	query := bson.M{}
+	if filter.Author != "" {
+		query["author"] = filter.Author
+	}
+	createdAt := bson.M{}
+	if filter.CreatedFrom != "" {
+		createdAt["$gte"] = filter.CreatedFrom
+	}
+	if to := filter.CreatedTo; to != "" {
+		// 只给日期时包含当天
+		if len(to) == len(analyticsDateLayout) {
+			to += " 23:59:59"
+		}
+		createdAt["$lte"] = to
+	}
+	if len(createdAt) > 0 {
+		query["createdAt"] = createdAt
+	}
+	return query
+}
+
+// isCJK 中日韩文字没有空格分隔，需要按 n-gram 切分
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// searchTokens 切分文本：连续的中日韩文字切成相邻两个字的 bigram，其他字母和数字按单词切分并转成小写
+// 写入索引时 unigrams 为 true，额外保留单字，这样单个字也能搜到；搜索时只有单字的片段才用单字
+func searchTokens(text string, unigrams bool) []string {
+	var tokens []string
+	seen := map[string]bool{}
+	add := func(token string) {
+		if !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		switch {
+		case isCJK(runes[i]):
+			j := i
+			for j < len(runes) && isCJK(runes[j]) {
+				j++
+			}
+			run := runes[i:j]
+			if len(run) == 1 || unigrams {
+				for _, r := range run {
+					add(string(r))
+				}
+			}
+			for k := 0; k+1 < len(run); k++ {
+				add(string(run[k : k+2]))
+			}
+			i = j
+		case unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]):
+			j := i
+			for j < len(runes) && !isCJK(runes[j]) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+				j++
+			}
+			add(strings.ToLower(string(runes[i:j])))
+			i = j
+		default:
+			i++
+		}
+	}
+	return tokens
+}
+
+// highlight 在字段里找命中的词，返回第一个命中位置附近的片段，命中的部分用 <em></em> 包起来，其余内容做 HTML 转义
+func highlight(text string, terms []string) (string, bool) {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	matched := make([]bool, len(runes))
+	first := -1
+	for _, term := range terms {
+		termRunes := []rune(term)
+		for i := 0; i+len(termRunes) <= len(lower); i++ {
+			if string(lower[i:i+len(termRunes)]) != term {
+				continue
+			}
+			for k := i; k < i+len(termRunes); k++ {
+				matched[k] = true
+			}
+			if first == -1 || i < first {
+				first = i
+			}
+		}
+	}
+	if first == -1 {
+		return "", false
+	}
+
+	start := max(first-searchSnippetRadius, 0)
+	end := min(first+searchSnippetRadius, len(runes))
+	// 片段结尾落在命中的词中间时延长到词尾
+	for end < len(runes) && matched[end] {
+		end++
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; i++ {
+		if matched[i] && (i == start || !matched[i-1]) {
+			b.WriteString("<em>")
+		}
+		b.WriteString(html.EscapeString(string(runes[i])))
+		if matched[i] && (i == end-1 || !matched[i+1]) {
+			b.WriteString("</em>")
+		}
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchTokens(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		unigrams bool
+		expected []string
+	}{
+		{name: "latin words are lowercased", text: "Hello World", expected: []string{"hello", "world"}},
+		{name: "duplicates are dropped", text: "go Go GO", expected: []string{"go"}},
+		{name: "cjk run becomes bigrams", text: "修仙小说", expected: []string{"修仙", "仙小", "小说"}},
+		{name: "index keeps unigrams", text: "修仙小说", unigrams: true, expected: []string{"修", "仙", "小", "说", "修仙", "仙小", "小说"}},
+		{name: "single cjk character", text: "龙", expected: []string{"龙"}},
+		{name: "single latin character", text: "A", expected: []string{"a"}},
+		{name: "mixed cjk and latin", text: "AI修仙v2版", expected: []string{"ai", "修仙", "v2", "版"}},
+		{name: "single cjk character between words", text: "x大y", expected: []string{"x", "大", "y"}},
+		{name: "kana", text: "カタカナ", expected: []string{"カタ", "タカ", "カナ"}},
+		{name: "punctuation only", text: "，。!? "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, searchTokens(tt.text, tt.unigrams))
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		terms    []string
+		expected string
+		matched  bool
+	}{
+		{name: "no match", text: "hello world", terms: []string{"龙"}},
+		{name: "short text is kept whole", text: "hello world", terms: []string{"world"}, expected: "hello <em>world</em>", matched: true},
+		{name: "case insensitive", text: "Hello", terms: []string{"hello"}, expected: "<em>Hello</em>", matched: true},
+		{name: "html is escaped", text: "<b>龙</b>", terms: []string{"龙"}, expected: "&lt;b&gt;<em>龙</em>&lt;/b&gt;", matched: true},
+		{name: "adjacent matches are merged", text: "修仙小说", terms: []string{"修仙", "仙小"}, expected: "<em>修仙小</em>说", matched: true},
+		{name: "snippet starts at the earliest match", text: "abc龙", terms: []string{"龙", "abc"}, expected: "<em>abc龙</em>", matched: true},
+		{
+			name:     "long text is cut around the first match",
+			text:     strings.Repeat("x", 40) + "龙" + strings.Repeat("y", 40),
+			terms:    []string{"龙"},
+			expected: "…" + strings.Repeat("x", 30) + "<em>龙</em>" + strings.Repeat("y", 29) + "…",
+			matched:  true,
+		},
+		{
+			name:     "snippet end is extended to the end of a match",
+			text:     "龙" + strings.Repeat("x", 28) + "abc" + "zzz",
+			terms:    []string{"龙", "abc"},
+			expected: "<em>龙</em>" + strings.Repeat("x", 28) + "<em>abc</em>…",
+			matched:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snippet, matched := highlight(tt.text, tt.terms)
+			require.Equal(t, tt.matched, matched)
+			require.Equal(t, tt.expected, snippet)
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"novel-resource-management/metrics"
+	"novel-resource-management/tracing"
+)
+
+// 并发修改同一个 key 时，后提交的交易在 commit 阶段会因为读集过期被判为 MVCC_READ_CONFLICT（或范围查询的 PHANTOM_READ_CONFLICT）
+// 这类失败重新背书就能成功，所以所有 SubmitTransaction 都走 submitWithRetry
+
+// SubmitRetryConfig 提交交易的重试配置，来自配置文件的 fabric.retry
+// MaxAttempts 包括第一次提交；Timeout 是一次调用（包括所有重试）的总时长
+type SubmitRetryConfig struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Timeout     time.Duration
+}
+
+// CommitError 交易已经排序出块，但没有通过 peer 的验证，Code 是验证结果
+type CommitError struct {
+	TransactionID string
+	Code          peer.TxValidationCode
+}
+
+func (e *CommitError) Error() string {
+	return fmt.Sprintf("transaction %s failed to commit with status code %d (%s)", e.TransactionID, int32(e.Code), e.Code)
+}
+
+// IsCommitConflict 交易是否因为读写冲突没有提交成功，这类错误可以重新背书后重试
+func IsCommitConflict(err error) bool {
+	var commitErr *CommitError
+	if errors.As(err, &commitErr) {
+		return isConflictCode(commitErr.Code)
+	}
+	var gatewayErr *client.CommitError
+	return errors.As(err, &gatewayErr) && isConflictCode(gatewayErr.Code)
+}
+
+func isConflictCode(code peer.TxValidationCode) bool {
+	return code == peer.TxValidationCode_MVCC_READ_CONFLICT || code == peer.TxValidationCode_PHANTOM_READ_CONFLICT
+}
+
+// evaluateTransaction 查询链码，记录 evaluate 阶段的 span、耗时和结果
+// 带 context 调用时不会用 Gateway 的默认超时，所以按配置的 fabric.evaluate_timeout 自己设置
+func evaluateTransaction(ctx context.Context, contract *Contract, name string, args ...string) ([]byte, error) {
+	ctx, span := tracing.Start(ctx, "Evaluate "+name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(fabricAttributes(contract, name)...))
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, contract.evaluateTimeout)
+	defer cancel()
+
+	start := time.Now()
+	result, err := contract.EvaluateWithContext(ctx, name, client.WithArguments(args...))
+	metrics.ObserveFabric("evaluate", name, "", start, err)
+	tracing.RecordError(span, err)
+	return result, err
+}
+
+// endorseAndSubmit 背书并发给 orderer，不等待提交结果；分开调用是为了分别记录 endorse、submit 两个阶段
+// ctx 里的 trace 通过 transient 字段 traceparent 带进链码，链码把它写进事件，事件监听器据此关联回这个请求
+// emitsEvent 表示背书结果里有没有链码事件，没有事件的交易监听器收不到，就绪检查不用等它
+func endorseAndSubmit(ctx context.Context, contract *Contract, name string, args ...string) (result []byte, commit *client.Commit, emitsEvent bool, err error) {
+	options := []client.ProposalOption{client.WithArguments(args...)}
+	if traceParent := tracing.TraceParent(ctx); traceParent != "" {
+		options = append(options, client.WithTransient(map[string][]byte{tracing.TraceParentKey: []byte(traceParent)}))
+	}
+	proposal, err := contract.NewProposal(name, options...)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("fabric.tx_id", proposal.TransactionID()))
+
+	endorseCtx, span := tracing.Start(ctx, "Endorse "+name, trace.WithSpanKind(trace.SpanKindClient))
+	start := time.Now()
+	transaction, err := proposal.EndorseWithContext(endorseCtx)
+	metrics.ObserveFabric("endorse", name, "", start, err)
+	tracing.RecordError(span, err)
+	span.End()
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	submitCtx, span := tracing.Start(ctx, "Submit "+name, trace.WithSpanKind(trace.SpanKindClient))
+	start = time.Now()
+	commit, err = transaction.SubmitWithContext(submitCtx)
+	metrics.ObserveFabric("submit", name, "", start, err)
+	tracing.RecordError(span, err)
+	span.End()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	envelope, err := transaction.Bytes()
+	return transaction.Result(), commit, err != nil || hasChaincodeEvent(envelope), nil
+}
+
+// hasChaincodeEvent 从交易信封里取出背书时的链码事件，比如没有过期预留的 ReleaseExpiredHolds 不发事件
+// 信封解析失败时按有事件处理，宁可让就绪检查多等
+func hasChaincodeEvent(envelopeBytes []byte) bool {
+	var envelope common.Envelope
+	if err := proto.Unmarshal(envelopeBytes, &envelope); err != nil {
+		return true
+	}
+	var payload common.Payload
+	if err := proto.Unmarshal(envelope.GetPayload(), &payload); err != nil {
+		return true
+	}
+	var transaction peer.Transaction
+	if err := proto.Unmarshal(payload.GetData(), &transaction); err != nil || len(transaction.GetActions()) == 0 {
+		return true
+	}
+	var actionPayload peer.ChaincodeActionPayload
+	if err := proto.Unmarshal(transaction.GetActions()[0].GetPayload(), &actionPayload); err != nil {
+		return true
+	}
+	var responsePayload peer.ProposalResponsePayload
+	if err := proto.Unmarshal(actionPayload.GetAction().GetProposalResponsePayload(), &responsePayload); err != nil {
+		return true
+	}
+	var action peer.ChaincodeAction
+	if err := proto.Unmarshal(responsePayload.GetExtension(), &action); err != nil {
+		return true
+	}
+	var event peer.ChaincodeEvent
+	if err := proto.Unmarshal(action.GetEvents(), &event); err != nil {
+		return true
+	}
+	return event.GetEventName() != ""
+}
+
+// commitStatus 等待交易的提交结果，记录 commit 阶段的 span、耗时、验证码和读写冲突
+func commitStatus(ctx context.Context, commit *client.Commit, name string, emitsEvent bool) (*client.Status, error) {
+	ctx, span := tracing.Start(ctx, "CommitStatus "+name, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("fabric.tx_id", commit.TransactionID())))
+	defer span.End()
+
+	start := time.Now()
+	status, err := commit.StatusWithContext(ctx)
+	if err != nil {
+		metrics.ObserveFabric("commit", name, "", start, err)
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	metrics.ObserveFabric("commit", name, status.Code.String(), start, nil)
+	span.SetAttributes(
+		attribute.String("fabric.validation_code", status.Code.String()),
+		attribute.Int64("fabric.block_number", int64(status.BlockNumber)),
+	)
+	if isConflictCode(status.Code) {
+		metrics.FabricConflicts.WithLabelValues(name, status.Code.String()).Inc()
+	}
+	if !status.Successful {
+		span.SetStatus(otelcodes.Error, status.Code.String())
+	} else if emitsEvent {
+		// 就绪检查用它判断事件监听器有没有落后
+		eventListener.committed(status.BlockNumber)
+	}
+	return status, nil
+}
+
+// submitOnce 背书、提交并等待结果，交易无效时返回 *CommitError
+func submitOnce(ctx context.Context, contract *Contract, name string, args ...string) ([]byte, error) {
+	result, commit, emitsEvent, err := endorseAndSubmit(ctx, contract, name, args...)
+	if err != nil {
+		return nil, err
+	}
+	status, err := commitStatus(ctx, commit, name, emitsEvent)
+	if err != nil {
+		return nil, err
+	}
+	if !status.Successful {
+		return nil, &CommitError{TransactionID: status.TransactionID, Code: status.Code}
+	}
+	return result, nil
+}
+
+// submitWithRetry 提交交易，遇到读写冲突时按带抖动的指数退避重新背书和提交
+func submitWithRetry(ctx context.Context, contract *Contract, name string, args ...string) ([]byte, error) {
+	return submitWithConfig(ctx, contract.retry, contract, name, args...)
+}
+
+// submitWithConfig 每次重试都是一个新的交易，各自有 Endorse、Submit、CommitStatus 子 span
+// 调用方断开连接也要等交易有结果，所以不继承 ctx 的取消，只沿用它的 trace
+func submitWithConfig(ctx context.Context, config SubmitRetryConfig, contract *Contract, name string, args ...string) (result []byte, err error) {
+	ctx, span := tracing.Start(ctx, "SubmitTransaction "+name, trace.WithAttributes(fabricAttributes(contract, name)...))
+	attempt := 1
+	defer func() {
+		span.SetAttributes(attribute.Int("fabric.attempts", attempt))
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), config.Timeout)
+	defer cancel()
+
+	// 冲突次数由 commitStatus 记在 FabricConflicts 里
+	for ; ; attempt++ {
+		result, err = submitOnce(ctx, contract, name, args...)
+		if err == nil {
+			if attempt > 1 {
+				metrics.FabricSubmitOutcomes.WithLabelValues(name, metrics.SubmitSucceededAfterRetry).Inc()
+			} else {
+				metrics.FabricSubmitOutcomes.WithLabelValues(name, metrics.SubmitSucceeded).Inc()
+			}
+			return result, nil
+		}
+		if !IsCommitConflict(err) {
+			metrics.FabricSubmitOutcomes.WithLabelValues(name, metrics.SubmitFailed).Inc()
+			return nil, err
+		}
+
+		if attempt >= config.MaxAttempts {
+			metrics.FabricSubmitOutcomes.WithLabelValues(name, metrics.SubmitExhausted).Inc()
+			return nil, fmt.Errorf("%s still conflicting after %d attempts: %w", name, attempt, err)
+		}
+
+		delay := retryDelay(config, attempt)
+		log.Printf("🔁 %s 读写冲突，%s 后第 %d 次重试: %v", name, delay, attempt, err)
+		select {
+		case <-ctx.Done():
+			metrics.FabricSubmitOutcomes.WithLabelValues(name, metrics.SubmitExhausted).Inc()
+			return nil, fmt.Errorf("%s gave up retrying: %v: %w", name, ctx.Err(), err)
+		case <-time.After(delay):
+		}
+		metrics.FabricSubmitRetries.WithLabelValues(name).Inc()
+	}
+}
+
+func fabricAttributes(contract *Contract, name string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("fabric.chaincode", contract.ChaincodeName()),
+		attribute.String("fabric.contract", contract.ContractName()),
+		attribute.String("fabric.function", name),
+	}
+}
+
+// retryDelay 第 attempt 次失败后的等待时间：BaseDelay * 2^(attempt-1)，不超过 MaxDelay，在 [d/2, d) 之间随机
+func retryDelay(config SubmitRetryConfig, attempt int) time.Duration {
+	delay := config.MaxDelay
+	if shift := attempt - 1; shift < 30 {
+		if backoff := config.BaseDelay << shift; backoff > 0 && backoff < delay {
+			delay = backoff
+		}
+	}
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + rand.N(half)
+}
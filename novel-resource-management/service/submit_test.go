@@ -0,0 +1,82 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// testEnvelope 按 Fabric 交易信封的嵌套结构构造一笔交易，eventName 为空时不带链码事件
+func testEnvelope(t *testing.T, eventName string) []byte {
+	t.Helper()
+	marshal := func(m proto.Message) []byte {
+		data, err := proto.Marshal(m)
+		require.NoError(t, err)
+		return data
+	}
+
+	action := &peer.ChaincodeAction{}
+	if eventName != "" {
+		action.Events = marshal(&peer.ChaincodeEvent{ChaincodeId: "novel", TxId: "tx1", EventName: eventName, Payload: []byte(`{}`)})
+	}
+	responsePayload := marshal(&peer.ProposalResponsePayload{Extension: marshal(action)})
+	actionPayload := marshal(&peer.ChaincodeActionPayload{Action: &peer.ChaincodeEndorsedAction{ProposalResponsePayload: responsePayload}})
+	transaction := marshal(&peer.Transaction{Actions: []*peer.TransactionAction{{Payload: actionPayload}}})
+	return marshal(&common.Envelope{Payload: marshal(&common.Payload{Data: transaction})})
+}
+
+func TestHasChaincodeEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		envelope func(t *testing.T) []byte
+		expected bool
+	}{
+		{name: "event", envelope: func(t *testing.T) []byte { return testEnvelope(t, "ExpireHolds") }, expected: true},
+		{name: "no event", envelope: func(t *testing.T) []byte { return testEnvelope(t, "") }, expected: false},
+		{name: "malformed envelope is treated as an event", envelope: func(t *testing.T) []byte { return []byte{0xff} }, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, hasChaincodeEvent(tt.envelope(t)))
+		})
+	}
+}
+
+func TestListenerLagIgnoresCommitsWithoutEvents(t *testing.T) {
+	tests := []struct {
+		name       string
+		emitsEvent bool
+		processed  bool
+		status     string
+	}{
+		{name: "commit without an event is not waited for", emitsEvent: false, status: HealthStatusUp},
+		{name: "unprojected commit with an event", emitsEvent: true, status: HealthStatusDown},
+		{name: "projected commit with an event", emitsEvent: true, processed: true, status: HealthStatusUp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener := &listenerState{}
+			listener.started()
+
+			// 和 commitStatus 一样，只有发了事件的交易才登记
+			if tt.emitsEvent {
+				listener.committed(7)
+			}
+			if tt.processed {
+				listener.eventProcessed(7)
+			}
+			// 把登记时间往前拨，模拟已经等了很久
+			for i := range listener.pendingCommit {
+				listener.pendingCommit[i].committedAt = time.Now().Add(-time.Minute)
+			}
+
+			require.Equal(t, tt.status, listener.check(time.Second).Status)
+		})
+	}
+}
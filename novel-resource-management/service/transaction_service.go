@@ -0,0 +1,282 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/trace"
+
+	"novel-resource-management/database"
+	"novel-resource-management/tracing"
+)
+
+// 异步提交：背书并发送给 orderer 后立即返回 txId，提交状态由 TransactionTracker 在后台等待并写入 transactions 集合
+// 异步提交不会在读写冲突时自动重试，冲突的交易状态是 invalid，code 是 MVCC_READ_CONFLICT
+
+// 异步交易的状态
+const (
+	TransactionPending   = "pending"
+	TransactionCommitted = "committed"
+	TransactionInvalid   = "invalid"
+	TransactionTimeout   = "timeout"
+)
+
+const (
+	transactionCallbackTimeout = 10 * time.Second
+	transactionTimeLayout      = "2006-01-02 15:04:05"
+)
+
+var (
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrInvalidCallbackURL  = errors.New("callback url must be an absolute http or https url")
+	// ErrCallbackNotPublic 回调从集群内部发出，不能指向本机、内网、链路本地（云厂商元数据 169.254.169.254）等地址
+	ErrCallbackNotPublic = errors.New("callback url must resolve to public addresses only")
+)
+
+// CommitHook 交易提交成功（VALID）后在后台执行，比如记录资源的所有者，失败只记录日志
+type CommitHook func(ctx context.Context) error
+
+// sharedAddressSpace 运营商级 NAT 地址 100.64.0.0/10，net.IP.IsPrivate 不包括它
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP 回调允许连接的地址：排除回环、私有、链路本地、组播、未指定和运营商级 NAT 地址
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip))
+}
+
+// newCallbackClient 回调用的 HTTP 客户端，连接时检查实际连接的 IP，域名解析在校验之后变成内网地址（DNS rebinding）也会被拒绝
+// 不走环境变量里的代理，不跟随重定向
+func newCallbackClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: transactionCallbackTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return ErrCallbackNotPublic
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout:   transactionCallbackTimeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// TransactionTracker 记录异步提交的交易，等待提交状态并回调
+type TransactionTracker struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+	httpClient *http.Client
+}
+
+// NewTransactionTracker 创建追踪器，timeout 是等待提交状态的时长（配置的 fabric.transaction_status_timeout）
+// 进程重启后之前等待中的交易拿不到提交状态，启动时把超过等待时长的标记为 timeout
+func NewTransactionTracker(timeout time.Duration) *TransactionTracker {
+	tracker := &TransactionTracker{
+		collection: database.GetMongoInstance().GetCollection("transactions"),
+		timeout:    timeout,
+		httpClient: newCallbackClient(),
+	}
+	if expired, err := tracker.expireStale(context.Background()); err != nil {
+		log.Printf("⚠️ 标记超时的异步交易失败: %v", err)
+	} else if expired > 0 {
+		log.Printf("⏱️ %d 个异步交易在重启前没有拿到提交状态，已标记为 timeout", expired)
+	}
+	return tracker
+}
+
+// ValidateCallbackURL 回调地址必须是绝对的 http(s) 地址，并且解析出的地址都是公网地址，空字符串表示不回调
+// 这里先拒绝明显的内网地址，真正发回调时连接层还会再检查一次
+func ValidateCallbackURL(ctx context.Context, callbackURL string) error {
+	if callbackURL == "" {
+		return nil
+	}
+	parsed, err := url.Parse(callbackURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return ErrInvalidCallbackURL
+	}
+
+	host := parsed.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !publicIP(ip) {
+			return ErrCallbackNotPublic
+		}
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, transactionCallbackTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("resolve callback host %s failed: %v", host, err)
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return ErrCallbackNotPublic
+		}
+	}
+	return nil
+}
+
+// Submit 背书并提交交易，不等待提交结果，返回状态为 pending 的记录
+// 等待提交结果的 CommitStatus span 也挂在调用方的 trace 下，结束时间可能晚于 HTTP 请求
+func (t *TransactionTracker) Submit(ctx context.Context, contract *Contract, callbackURL string, name string, args ...string) (*database.TransactionRecord, error) {
+	return t.SubmitThen(ctx, contract, callbackURL, nil, name, args...)
+}
+
+// SubmitThen 和 Submit 一样，交易提交成功后再执行 onCommitted，onCommitted 可以为 nil
+func (t *TransactionTracker) SubmitThen(ctx context.Context, contract *Contract, callbackURL string, onCommitted CommitHook, name string, args ...string) (*database.TransactionRecord, error) {
+	if err := ValidateCallbackURL(ctx, callbackURL); err != nil {
+		return nil, err
+	}
+
+	ctx, span := tracing.Start(ctx, "SubmitTransactionAsync "+name, trace.WithAttributes(fabricAttributes(contract, name)...))
+	defer span.End()
+	submitCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), contract.retry.Timeout)
+	defer cancel()
+	_, commit, emitsEvent, err := endorseAndSubmit(submitCtx, contract, name, args...)
+	tracing.RecordError(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("submit %s failed: %v", name, err)
+	}
+
+	now := time.Now().Format(transactionTimeLayout)
+	record := &database.TransactionRecord{
+		TxID:        commit.TransactionID(),
+		Transaction: name,
+		Status:      TransactionPending,
+		CallbackURL: callbackURL,
+		SubmittedAt: now,
+		UpdatedAt:   now,
+	}
+	// 交易已经发给 orderer，记录写不进去也要继续等待结果，只是查询不到
+	if _, err := t.collection.InsertOne(submitCtx, record); err != nil {
+		log.Printf("⚠️ 保存异步交易 %s 失败: %v", record.TxID, err)
+	}
+
+	go t.watch(trace.ContextWithSpanContext(context.Background(), span.SpanContext()), commit, emitsEvent, *record, onCommitted)
+	return record, nil
+}
+
+// Get 按 txId 查询异步交易
+func (t *TransactionTracker) Get(ctx context.Context, txID string) (*database.TransactionRecord, error) {
+	var record database.TransactionRecord
+	err := t.collection.FindOne(ctx, bson.M{"_id": txID}).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find transaction failed: %v", err)
+	}
+
+	// 等待它的进程已经退出时不会再有结果，超过等待时长仍是 pending 的按 timeout 返回
+	if record.Status == TransactionPending {
+		submittedAt, err := time.ParseInLocation(transactionTimeLayout, record.SubmittedAt, time.Local)
+		if err == nil && time.Since(submittedAt) > t.timeout {
+			record.Status = TransactionTimeout
+		}
+	}
+	return &record, nil
+}
+
+// watch 等待提交状态并写回 MongoDB，提交成功时执行 onCommitted，有回调地址时再回调并记录回调结果
+func (t *TransactionTracker) watch(ctx context.Context, commit *client.Commit, emitsEvent bool, record database.TransactionRecord, onCommitted CommitHook) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	status, err := commitStatus(ctx, commit, record.Transaction, emitsEvent)
+	switch {
+	case err != nil:
+		record.Status = TransactionTimeout
+		record.Error = err.Error()
+	case status.Successful:
+		record.Status = TransactionCommitted
+		record.Code = status.Code.String()
+		record.BlockNumber = status.BlockNumber
+	default:
+		record.Status = TransactionInvalid
+		record.Code = status.Code.String()
+		record.BlockNumber = status.BlockNumber
+	}
+	record.UpdatedAt = time.Now().Format(transactionTimeLayout)
+	log.Printf("📮 异步交易 %s (%s) 状态: %s %s", record.TxID, record.Transaction, record.Status, record.Code)
+
+	if record.Status == TransactionCommitted && onCommitted != nil {
+		if err := onCommitted(ctx); err != nil {
+			log.Printf("⚠️ 异步交易 %s 提交后的处理失败: %v", record.TxID, err)
+		}
+	}
+
+	if err := t.save(&record); err != nil {
+		log.Printf("⚠️ 更新异步交易 %s 状态失败: %v", record.TxID, err)
+	}
+	if record.CallbackURL == "" {
+		return
+	}
+	t.callback(&record)
+	if err := t.save(&record); err != nil {
+		log.Printf("⚠️ 保存异步交易 %s 的回调结果失败: %v", record.TxID, err)
+	}
+}
+
+// callback 把最终状态 POST 到回调地址，失败只记录不重试
+func (t *TransactionTracker) callback(record *database.TransactionRecord) {
+	body, err := json.Marshal(record)
+	if err != nil {
+		record.CallbackError = err.Error()
+		return
+	}
+	resp, err := t.httpClient.Post(record.CallbackURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		record.CallbackError = err.Error()
+		log.Printf("⚠️ 异步交易 %s 回调失败: %v", record.TxID, err)
+		return
+	}
+	resp.Body.Close()
+	record.CallbackStatus = resp.StatusCode
+	if resp.StatusCode >= 300 {
+		record.CallbackError = fmt.Sprintf("callback returned status %d", resp.StatusCode)
+	}
+}
+
+func (t *TransactionTracker) save(record *database.TransactionRecord) error {
+	_, err := t.collection.ReplaceOne(context.Background(), bson.M{"_id": record.TxID}, record)
+	return err
+}
+
+// expireStale 把提交时间早于等待时长的 pending 交易标记为 timeout
+func (t *TransactionTracker) expireStale(ctx context.Context) (int64, error) {
+	cutoff := time.Now().Add(-t.timeout).Format(transactionTimeLayout)
+	result, err := t.collection.UpdateMany(ctx,
+		bson.M{"status": TransactionPending, "submittedAt": bson.M{"$lt": cutoff}},
+		bson.M{"$set": bson.M{
+			"status":    TransactionTimeout,
+			"error":     "status was not received before the service restarted",
+			"updatedAt": time.Now().Format(transactionTimeLayout),
+		}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
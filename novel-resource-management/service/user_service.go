@@ -5,10 +5,9 @@ import (
 	"crypto/hmac" //有专门的hmac包
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"os"
 	"sort"
 	"strconv"
 	"strings"
@@ -18,38 +17,33 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"novel-resource-management/database"
+	"novel-resource-management/metrics"
+	"novel-resource-management/tracing"
+	model "novel-resource-model/v1"
 )
 
 type UserCreditService struct {
-	contract *client.Contract
+	contract *Contract
 }
 
 // 新建一个service
-func NewUserCreditService(gateway *client.Gateway) (*UserCreditService, error) {
-	network := gateway.GetNetwork("mychannel")
-	if network == nil {
-		return nil, fmt.Errorf("userCredit network does not exist")
-	}
-
-	contract := network.GetContract("novel-basic")
-	if contract == nil {
-		return nil, fmt.Errorf("userCredit contract does not exist")
-	}
-
+func NewUserCreditService(chaincode *Chaincode) *UserCreditService {
 	return &UserCreditService{
-		contract: contract,
-	}, nil
+		contract: chaincode.Contract(CreditContractName),
+	}
 }
 
 // create
-func (us *UserCreditService) CreateUserCredit(userId string, credit int, totalUsed int, totalRecharge int) error {
+func (us *UserCreditService) CreateUserCredit(ctx context.Context, userId string, credit int, totalUsed int, totalRecharge int) error {
 	// 注意：链码层面已经包含了存在性检查，不需要在服务层重复检查
 	// 移除服务层的ReadUserCredit调用，避免与链码的检查产生MVCC冲突
 
 	// Gateway要求所有参数都是string类型，需要手动转换int参数
-	_, err := us.contract.SubmitTransaction("CreateUserCredit", userId, strconv.Itoa(credit), strconv.Itoa(totalUsed), strconv.Itoa(totalRecharge))
+	_, err := submitWithRetry(ctx, us.contract, "CreateUserCredit", userId, strconv.Itoa(credit), strconv.Itoa(totalUsed), strconv.Itoa(totalRecharge))
 	if err != nil {
 		return fmt.Errorf("create user credit failed:%v", err)
 	}
@@ -57,8 +51,8 @@ func (us *UserCreditService) CreateUserCredit(userId string, credit int, totalUs
 }
 
 // delete
-func (us *UserCreditService) DeleteUserCredit(userId string) error {
-	_, err := us.contract.SubmitTransaction("DeleteUserCredit", userId)
+func (us *UserCreditService) DeleteUserCredit(ctx context.Context, userId string) error {
+	_, err := submitWithRetry(ctx, us.contract, "DeleteUserCredit", userId)
 	if err != nil {
 		return fmt.Errorf("delete user credit failed:%v", err)
 	}
@@ -66,155 +60,204 @@ func (us *UserCreditService) DeleteUserCredit(userId string) error {
 }
 
 // update
-func (us *UserCreditService) UpdateUserCredit(userId string, credit int, totalUsed int, totalRecharge int) error {
+func (us *UserCreditService) UpdateUserCredit(ctx context.Context, userId string, credit int, totalUsed int, totalRecharge int) error {
 	// Gateway要求所有参数都是string类型，需要手动转换int参数
-	_, err := us.contract.SubmitTransaction("UpdateUserCredit", userId, strconv.Itoa(credit), strconv.Itoa(totalUsed), strconv.Itoa(totalRecharge))
+	_, err := submitWithRetry(ctx, us.contract, "UpdateUserCredit", userId, strconv.Itoa(credit), strconv.Itoa(totalUsed), strconv.Itoa(totalRecharge))
 	if err != nil {
 		return fmt.Errorf("updateUserCreditFailed:%v", err)
 	}
 	return nil
 }
 
+// CreateUserCreditAsync 异步创建用户积分，返回等待提交的交易
+func (us *UserCreditService) CreateUserCreditAsync(ctx context.Context, tracker *TransactionTracker, callbackURL string, userId string, credit int, totalUsed int, totalRecharge int) (*database.TransactionRecord, error) {
+	return tracker.Submit(ctx, us.contract, callbackURL, "CreateUserCredit", userId, strconv.Itoa(credit), strconv.Itoa(totalUsed), strconv.Itoa(totalRecharge))
+}
+
+// UpdateUserCreditAsync 异步更新用户积分
+func (us *UserCreditService) UpdateUserCreditAsync(ctx context.Context, tracker *TransactionTracker, callbackURL string, userId string, credit int, totalUsed int, totalRecharge int) (*database.TransactionRecord, error) {
+	return tracker.Submit(ctx, us.contract, callbackURL, "UpdateUserCredit", userId, strconv.Itoa(credit), strconv.Itoa(totalUsed), strconv.Itoa(totalRecharge))
+}
+
+// DeleteUserCreditAsync 异步删除用户积分
+func (us *UserCreditService) DeleteUserCreditAsync(ctx context.Context, tracker *TransactionTracker, callbackURL string, userId string) (*database.TransactionRecord, error) {
+	return tracker.Submit(ctx, us.contract, callbackURL, "DeleteUserCredit", userId)
+}
+
+// ConsumeUserTokenAsync 异步消费积分，扣费后的余额通过事件同步到 MongoDB
+func (us *UserCreditService) ConsumeUserTokenAsync(ctx context.Context, tracker *TransactionTracker, callbackURL string, userId string, operation string, novelId string) (*database.TransactionRecord, error) {
+	return tracker.Submit(ctx, us.contract, callbackURL, "ConsumeUserToken", userId, operation, novelId)
+}
+
 // look up
-func (us *UserCreditService) ReadUserCredit(userId string) (map[string]interface{}, error) {
-	result, err := us.contract.EvaluateTransaction("ReadUserCredit", userId)
+func (us *UserCreditService) ReadUserCredit(ctx context.Context, userId string) (*model.UserCredit, error) {
+	result, err := evaluateTransaction(ctx, us.contract, "ReadUserCredit", userId)
 	if err != nil {
 		return nil, fmt.Errorf("read user credit failed: %v", err)
 	}
-
-	var data map[string]interface{}
-	err = json.Unmarshal(result, &data)
-	if err != nil {
-		return nil, fmt.Errorf("unmarshal failed: %v", err)
-	}
-
-	return data, nil
+	return decodeResult[model.UserCredit](result)
 }
 
-func (us *UserCreditService) GetAllUserCredits() ([]map[string]interface{}, error) {
-	result, err := us.contract.EvaluateTransaction("GetAllUserCredits")
+func (us *UserCreditService) GetAllUserCredits(ctx context.Context) ([]model.UserCredit, error) {
+	result, err := evaluateTransaction(ctx, us.contract, "GetAllUserCredits")
 	if err != nil {
 		return nil, fmt.Errorf("get all user credits failed: %v", err)
 	}
+	return decodeResultList[model.UserCredit](result)
+}
 
-	var data []map[string]interface{}
-	err = json.Unmarshal(result, &data)
+// ConsumeUserToken 按链上价格表消费用户积分，operation 为空时按默认操作计费
+// 读余额、扣费和写积分历史都在链码的同一个交易里完成，避免先读后写的并发问题
+func (us *UserCreditService) ConsumeUserToken(ctx context.Context, userId string, operation string, novelId string) (*model.UserCredit, error) {
+	result, err := submitWithRetry(ctx, us.contract, "ConsumeUserToken", userId, operation, novelId)
 	if err != nil {
-		return nil, fmt.Errorf("unmarshal failed: %v", err)
+		return nil, fmt.Errorf("consume user token failed: %v", err)
 	}
-
-	return data, nil
+	return decodeResult[model.UserCredit](result)
 }
 
-// ConsumeUserToken 消费用户token，每次调用减少一个token，直到减少到0
-func (us *UserCreditService) ConsumeUserToken(userId string) error {
-	// 先读取当前用户积分信息
-	userCredit, err := us.ReadUserCredit(userId)
+// RechargeUserCredit 按订单号给用户入账，同一个订单号在链上只能入账一次
+func (us *UserCreditService) RechargeUserCredit(ctx context.Context, userId string, orderSN string, amount int) (*model.UserCredit, error) {
+	result, err := submitWithRetry(ctx, us.contract, "RechargeUserCredit", userId, orderSN, strconv.Itoa(amount))
 	if err != nil {
-		return fmt.Errorf("读取用户积分失败: %v", err)
+		// 保留原始错误，调用方要据此判断能不能重试
+		return nil, fmt.Errorf("recharge user credit failed: %w", err)
 	}
+	return decodeResult[model.UserCredit](result)
+}
 
-	// 解析当前积分信息
-	// ReadUserCredit方法返回的是map[string]interface{}类型，其中数值类型在JSON解析后会变成float64类型
-	// 所以需要使用类型断言.(float64)先转换为float64，再转换为int类型
-	// userCredit["credit"] 从map中获取credit字段的值
-	credit := int(userCredit["credit"].(float64))
-	totalUsed := int(userCredit["totalUsed"].(float64))
-	totalRecharge := int(userCredit["totalRecharge"].(float64))
+// rechargeOrderNotFound 链码 ReadRechargeOrder 在订单不存在时返回的错误
+const rechargeOrderNotFound = "does not exist"
 
-	// 检查token是否足够
-	if credit <= 0 {
-		return fmt.Errorf("用户 %s 的token不足，当前剩余: %d", userId, credit)
+// ReadRechargeOrder 按订单号读取链上的充值订单，订单不存在时返回 nil
+func (us *UserCreditService) ReadRechargeOrder(ctx context.Context, orderSN string) (*model.RechargeOrder, error) {
+	result, err := evaluateTransaction(ctx, us.contract, "ReadRechargeOrder", orderSN)
+	if err != nil {
+		if strings.Contains(err.Error(), rechargeOrderNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read recharge order failed: %v", err)
 	}
+	return decodeResult[model.RechargeOrder](result)
+}
 
-	// 更新积分信息：减少1个token，增加已使用数量
-	updatedCredit := credit - 1
-	updatedTotalUsed := totalUsed + 1
-
-	// 调用现有的UpdateUserCredit方法更新链上数据
-	err = us.UpdateUserCredit(userId, updatedCredit, updatedTotalUsed, totalRecharge)
+// HoldCredits 预留积分，ttlSeconds 秒内没有扣款或释放会自动退回
+func (us *UserCreditService) HoldCredits(ctx context.Context, userId string, amount int, holdId string, ttlSeconds int) (*model.CreditHold, error) {
+	result, err := submitWithRetry(ctx, us.contract, "HoldCredits", userId, strconv.Itoa(amount), holdId, strconv.Itoa(ttlSeconds))
 	if err != nil {
-		return fmt.Errorf("更新用户积分失败: %v", err)
+		return nil, fmt.Errorf("hold credits failed: %v", err)
 	}
-
-	return nil
+	return decodeResult[model.CreditHold](result)
 }
 
-// AddTokensByEmail 通过邮箱给用户增加token
-func (us *UserCreditService) AddTokensByEmail(email string, amount int) (string, int, error) {
-
-	// 1. 从 MongoDB users 集合查询用户,获取 userId (即 users._id)
-	mongoInstance := database.GetMongoInstance()
-	usersCollection := mongoInstance.GetCollection("users")
-
-	// 使用投影排除日期字段，避免类型转换问题
-	// 这里的投影类似于子视图，只是为了查询需要的字段
-	opts := options.FindOne().SetProjection(bson.M{
-		"_id":       1,
-		"email":     1,
-		"username":  1,
-		"novelIds":  1,
-	})
-
-	var user database.User
-	err := usersCollection.FindOne(context.Background(), bson.M{"email": email}, opts).Decode(&user)
+// CaptureHold 按实际用量扣除预留的积分，剩余部分退回
+func (us *UserCreditService) CaptureHold(ctx context.Context, holdId string, actualAmount int) (*model.CreditHold, error) {
+	result, err := submitWithRetry(ctx, us.contract, "CaptureHold", holdId, strconv.Itoa(actualAmount))
 	if err != nil {
-		return "", 0, fmt.Errorf("用户不存在: %s", email)
+		return nil, fmt.Errorf("capture hold failed: %v", err)
 	}
+	return decodeResult[model.CreditHold](result)
+}
 
-	userId := user.ID
-	log.Printf("✅ 找到用户: email=%s, userId=%s", email, userId)
-
-
-	// 2. 读取当前用户积分信息
-	userCredit, err := us.ReadUserCredit(userId)
+// ReleaseHold 释放预留，积分全部退回
+func (us *UserCreditService) ReleaseHold(ctx context.Context, holdId string) (*model.CreditHold, error) {
+	result, err := submitWithRetry(ctx, us.contract, "ReleaseHold", holdId)
 	if err != nil {
-		return userId, 0, fmt.Errorf("读取用户积分失败: %v", err)
+		return nil, fmt.Errorf("release hold failed: %v", err)
 	}
+	return decodeResult[model.CreditHold](result)
+}
 
-	// 3. 解析当前积分
-	credit := int(userCredit["credit"].(float64))
-	totalUsed := int(userCredit["totalUsed"].(float64))
-	totalRecharge := int(userCredit["totalRecharge"].(float64))
-
-	// 4. 计算新的积分
-	newCredit := credit + amount
-	newTotalRecharge := totalRecharge + amount
+// ReadHold 读取预留
+func (us *UserCreditService) ReadHold(ctx context.Context, holdId string) (*model.CreditHold, error) {
+	result, err := evaluateTransaction(ctx, us.contract, "ReadHold", holdId)
+	if err != nil {
+		return nil, fmt.Errorf("read hold failed: %v", err)
+	}
+	return decodeResult[model.CreditHold](result)
+}
 
-	// 5. 更新链码
-	err = us.UpdateUserCredit(userId, newCredit, totalUsed, newTotalRecharge)
+// GetUserHolds 用户还没有结束的预留
+func (us *UserCreditService) GetUserHolds(ctx context.Context, userId string) ([]model.CreditHold, error) {
+	result, err := evaluateTransaction(ctx, us.contract, "GetUserHolds", userId)
 	if err != nil {
-		return userId, 0, fmt.Errorf("更新链码失败: %v", err)
+		return nil, fmt.Errorf("get user holds failed: %v", err)
 	}
+	return decodeResultList[model.CreditHold](result)
+}
 
-	// 6. 同步更新 MongoDB user_credits 集合
-	userCreditsCollection := mongoInstance.GetCollection("user_credits")
+// ReleaseExpiredHolds 清理用户已经过期的预留，返回清理的数量
+func (us *UserCreditService) ReleaseExpiredHolds(ctx context.Context, userId string) (int, error) {
+	result, err := submitWithRetry(ctx, us.contract, "ReleaseExpiredHolds", userId)
+	if err != nil {
+		return 0, fmt.Errorf("release expired holds failed: %v", err)
+	}
+	released, err := strconv.Atoi(string(result))
+	if err != nil {
+		return 0, fmt.Errorf("parse released count failed: %v", err)
+	}
+	return released, nil
+}
 
-	//更新操作
-	update := bson.M{
-		"$set": bson.M{
-			"credit":         newCredit,
-			"totalRecharge":  newTotalRecharge,
-			"updatedAt":      time.Now().Format("2006-01-02 15:04:05"),
-		},
+// StartHoldExpiryJob 按 interval（配置的 holds.expiry_interval）定时清理过期的预留，ctx 取消后退出，0 表示关闭
+// 链码只在用户预留、消费时顺带清理，用户不再操作时过期的预留会一直占用积分和消费额度
+func (us *UserCreditService) StartHoldExpiryJob(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		log.Println("ℹ️ 定时清理过期预留已关闭")
+		return
+	}
+	log.Printf("⏳ 启动过期预留清理任务，间隔 %s", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			released, err := us.ReleaseAllExpiredHolds(ctx)
+			if err != nil {
+				log.Printf("❌ 清理过期预留失败: %v", err)
+			}
+			if released > 0 {
+				log.Printf("✅ 清理过期预留 %d 个", released)
+			}
+		}
 	}
+}
 
-	//查询，这个有一个上下文，先filter，然后再有一个update方法
-	_, err = userCreditsCollection.UpdateOne(
-		context.Background(),
-		bson.M{"userId": userId},
-		update,
-	)
+// ReleaseAllExpiredHolds 从读模型找出已经过期但还是 held 的预留，按用户调用 ReleaseExpiredHolds
+// 读模型只用来找用户，是否过期由链码按交易时间判断；一个用户失败不影响其他用户，返回第一个错误
+func (us *UserCreditService) ReleaseAllExpiredHolds(ctx context.Context) (int, error) {
+	collection := database.GetMongoInstance().GetCollection("credit_holds")
+	// expiresAt 和链码一样是 UTC 的 "2006-01-02 15:04:05"，可以直接按字符串比较
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+	userIds, err := collection.Distinct(ctx, "userId", bson.M{
+		"status":    model.HoldStatusHeld,
+		"expiresAt": bson.M{"$lte": now},
+	})
 	if err != nil {
-		log.Printf("⚠️ MongoDB 更新失败: %v", err)
-		// 不返回错误,因为链码已经更新成功
-	} else {
-		log.Printf("✅ MongoDB 同步更新成功")
+		return 0, fmt.Errorf("find expired holds failed: %v", err)
 	}
 
-	log.Printf("✅ 充值成功: userId=%s, 增加token=%d, 新积分=%d", userId, amount, newCredit)
-
-	return userId, newCredit, nil
+	total := 0
+	var firstErr error
+	for _, value := range userIds {
+		userId, ok := value.(string)
+		if !ok || userId == "" {
+			continue
+		}
+		released, err := us.ReleaseExpiredHolds(ctx, userId)
+		if err != nil {
+			log.Printf("❌ 清理用户 %s 的过期预留失败: %v", userId, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		total += released
+	}
+	return total, firstErr
 }
 
 // ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
@@ -223,13 +266,16 @@ func (us *UserCreditService) AddTokensByEmail(email string, amount int) (string,
 
 // RechargeRecord 充值记录（用于幂等性保证）
 type RechargeRecord struct {
-	ID          string    `bson:"_id" json:"id"`
-	OrderSN     string    `bson:"orderSn" json:"orderSn"`       // 唯一索引
-	UserID      string    `bson:"userId" json:"userId"`
-	Email       string    `bson:"email" json:"email"`
-	Amount      int       `bson:"amount" json:"amount"`         // 实际充值 token 数量
-	ActualPrice int       `bson:"actualPrice" json:"actualPrice"` // 支付金额（分）
-	Status      string    `bson:"status" json:"status"`         // pending, success, failed
+	ID          string `bson:"_id" json:"id"`
+	OrderSN     string `bson:"orderSn" json:"orderSn"` // 唯一索引
+	UserID      string `bson:"userId" json:"userId"`
+	Email       string `bson:"email" json:"email"`
+	Amount      int    `bson:"amount" json:"amount"`                     // 实际充值 token 数量
+	Balance     int    `bson:"balance" json:"balance"`                   // 入账后的余额，重复回调时原样返回
+	ActualPrice int    `bson:"actualPrice" json:"actualPrice"`           // 支付金额（分）
+	GoodID      string `bson:"goodId,omitempty" json:"goodId,omitempty"` // 充值套餐
+	Reason      string `bson:"reason,omitempty" json:"reason,omitempty"` // 失败原因
+	Status      string `bson:"status" json:"status"`                     // pending, success, failed
 	//time.Time
 	ProcessedAt time.Time `bson:"processedAt" json:"processedAt"`
 	CreatedAt   time.Time `bson:"createdAt" json:"createdAt"`
@@ -258,9 +304,11 @@ func (us *UserCreditService) createRechargeRecord(
 	orderSN string,
 	userID string,
 	email string,
+	goodID string,
 	amount int,
 	actualPrice int,
 	status string,
+	reason string,
 ) error {
 	mongoInstance := database.GetMongoInstance()
 	collection := mongoInstance.GetCollection("recharge_records")
@@ -273,7 +321,9 @@ func (us *UserCreditService) createRechargeRecord(
 		Email:       email,
 		Amount:      amount,
 		ActualPrice: actualPrice,
+		GoodID:      goodID,
 		Status:      status,
+		Reason:      reason,
 		ProcessedAt: now,
 		CreatedAt:   now,
 		UpdatedAt:   now,
@@ -294,6 +344,7 @@ func (us *UserCreditService) updateRechargeRecord(
 	userID string,
 	email string,
 	amount int,
+	balance int,
 	actualPrice int,
 	status string,
 ) error {
@@ -306,6 +357,7 @@ func (us *UserCreditService) updateRechargeRecord(
 			"userId":      userID,
 			"email":       email,
 			"amount":      amount,
+			"balance":     balance,
 			"actualPrice": actualPrice,
 			"status":      status,
 			"processedAt": now,
@@ -326,8 +378,8 @@ func (us *UserCreditService) updateRechargeRecord(
 	return nil
 }
 
-// updateRechargeRecordStatus 仅更新充值记录状态
-func (us *UserCreditService) updateRechargeRecordStatus(orderSN string, status string) error {
+// updateRechargeRecordStatus 仅更新充值记录状态和原因
+func (us *UserCreditService) updateRechargeRecordStatus(orderSN string, status string, reason string) error {
 	mongoInstance := database.GetMongoInstance()
 	collection := mongoInstance.GetCollection("recharge_records")
 
@@ -335,6 +387,7 @@ func (us *UserCreditService) updateRechargeRecordStatus(orderSN string, status s
 	update := bson.M{
 		"$set": bson.M{
 			"status":    status,
+			"reason":    reason,
 			"updatedAt": now,
 		},
 	}
@@ -352,37 +405,105 @@ func (us *UserCreditService) updateRechargeRecordStatus(orderSN string, status s
 	return nil
 }
 
+// deleteRechargeRecord 删除还在 pending 的充值记录，让同一个订单号可以重新回调
+func (us *UserCreditService) deleteRechargeRecord(orderSN string) error {
+	mongoInstance := database.GetMongoInstance()
+	collection := mongoInstance.GetCollection("recharge_records")
+
+	_, err := collection.DeleteOne(context.Background(), bson.M{"orderSn": orderSN, "status": "pending"})
+	if err != nil {
+		return fmt.Errorf("删除充值记录失败: %v", err)
+	}
+
+	log.Printf("🗑️ 删除 pending 充值记录: orderSN=%s", orderSN)
+	return nil
+}
+
+// completeFromLedger 链上已经有这个订单时把充值记录补成成功
+// 入账时的余额已经拿不到了，用链上当前的余额代替
+func (us *UserCreditService) completeFromLedger(ctx context.Context, order *model.RechargeOrder, email string, actualPrice int) (string, int, error) {
+	userCredit, err := us.ReadUserCredit(ctx, order.UserID)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := us.updateRechargeRecord(order.OrderSN, order.UserID, email, order.Amount, userCredit.Credit, actualPrice, "success"); err != nil {
+		log.Printf("⚠️ 补记充值记录失败: orderSN=%s, err=%v", order.OrderSN, err)
+	}
+	log.Printf("✅ 链上已入账，补记充值记录: orderSN=%s, txId=%s", order.OrderSN, order.TxID)
+	return order.UserID, userCredit.Credit, nil
+}
+
+// isTransientRechargeError 充值交易是否可能只是暂时失败：读写冲突、超时、网络不可用或者提交结果未知
+// 这类错误下交易可能根本没上链，也可能已经上链，所以要先查链上订单，再决定是否允许重试
+func isTransientRechargeError(err error) bool {
+	if IsCommitConflict(err) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return true
+	}
+	var submitErr *client.SubmitError
+	var commitStatusErr *client.CommitStatusError
+	if errors.As(err, &submitErr) || errors.As(err, &commitStatusErr) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.DeadlineExceeded, codes.Unavailable, codes.Canceled, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
 // AddTokensByEmailWithIdempotency 带幂等性保证的充值方法
+// 发放的积分由充值套餐（good_id）决定，套餐不存在或价格不一致时拒绝充值
 func (us *UserCreditService) AddTokensByEmailWithIdempotency(
+	ctx context.Context,
 	email string,
 	orderSN string,
+	goodID string,
 	actualPrice int,
 ) (string, int, error) { //多值返回
+	ctx, span := tracing.Start(ctx, "UserCreditService.AddTokensByEmailWithIdempotency")
+	defer span.End()
 
 	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
 	// 第1步：检查订单是否已处理（幂等性检查）
 	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
 	existingRecord, err := us.findRechargeRecordByOrderSN(orderSN)
-
-	// 
 	if err == nil && existingRecord != nil {
-		
 		if existingRecord.Status == "success" {
 			// 幂等性保证：返回之前的结果
-			return existingRecord.UserID, existingRecord.Amount, nil
+			metrics.RechargeOutcomes.WithLabelValues(metrics.RechargeReplayed).Inc()
+			return existingRecord.UserID, existingRecord.Balance, nil
 		}
 
 		if existingRecord.Status == "failed" {
+			metrics.RechargeOutcomes.WithLabelValues(metrics.RechargeFailed).Inc()
 			return "", 0, fmt.Errorf("订单之前处理失败，请人工介入: %s", orderSN)
 		}
 
 		if existingRecord.Status == "pending" {
+			// 之前的请求可能已经上链但没来得及更新记录，先以链上订单为准
+			order, err := us.ReadRechargeOrder(ctx, orderSN)
+			if err == nil && order != nil {
+				metrics.RechargeOutcomes.WithLabelValues(metrics.RechargeReplayed).Inc()
+				return us.completeFromLedger(ctx, order, email, actualPrice)
+			}
+			metrics.RechargeOutcomes.WithLabelValues(metrics.RechargeInProgress).Inc()
 			return "", 0, fmt.Errorf("订单正在处理中: %s", orderSN)
 		}
 	}
 
 	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-	// 第2步：查询用户
+	// 第2步：根据套餐计算充值积分，未知套餐或价格不一致直接拒绝
+	// 被拒绝的请求不写充值记录，否则同一个订单号修正后重新回调也会被当成失败
+	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+	grant, err := NewPackageService().ResolveRecharge(goodID, actualPrice, time.Now())
+	if err != nil {
+		metrics.RechargeOutcomes.WithLabelValues(metrics.RechargeRejected).Inc()
+		return "", 0, err
+	}
+	rechargeAmount := grant.Total
+
+	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+	// 第3步：查询用户
 	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
 	mongoInstance := database.GetMongoInstance()
 	usersCollection := mongoInstance.GetCollection("users")
@@ -395,10 +516,9 @@ func (us *UserCreditService) AddTokensByEmailWithIdempotency(
 	})
 
 	var user database.User
-	err = usersCollection.FindOne(context.Background(), bson.M{"email": email}, opts).Decode(&user)
+	err = usersCollection.FindOne(ctx, bson.M{"email": email}, opts).Decode(&user)
 	if err != nil {
-		// 创建失败记录
-		us.createRechargeRecord(orderSN, "", email, 0, actualPrice, "failed")
+		metrics.RechargeOutcomes.WithLabelValues(metrics.RechargeRejected).Inc()
 		return "", 0, fmt.Errorf("用户不存在: %s", email)
 	}
 
@@ -406,83 +526,59 @@ func (us *UserCreditService) AddTokensByEmailWithIdempotency(
 	log.Printf("✅ 找到用户: email=%s, userId=%s", email, userId)
 
 	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-	// 第3步：创建充值记录（状态：pending）
+	// 第4步：创建充值记录（状态：pending）
 	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-	err = us.createRechargeRecord(orderSN, userId, email, 0, actualPrice, "pending")
+	err = us.createRechargeRecord(orderSN, userId, email, goodID, 0, actualPrice, "pending", "")
 	if err != nil {
 		// 可能是并发插入导致的重复订单
 		existingRecord, _ := us.findRechargeRecordByOrderSN(orderSN)
 		if existingRecord != nil && existingRecord.Status == "success" {
 			log.Printf("⚠️ 并发处理：订单已被其他请求处理: orderSN=%s", orderSN)
-			return existingRecord.UserID, existingRecord.Amount, nil
+			metrics.RechargeOutcomes.WithLabelValues(metrics.RechargeReplayed).Inc()
+			return existingRecord.UserID, existingRecord.Balance, nil
 		}
+		metrics.RechargeOutcomes.WithLabelValues(metrics.RechargeFailed).Inc()
 		return "", 0, fmt.Errorf("创建充值记录失败: %v", err)
 	}
 
 	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-	// 第4步：计算充值金额（目前固定150，后续可配置套餐）
-	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-	const rechargeAmount = 150
-
-	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-	// 第5步：读取当前用户积分
+	// 第5步：链码入账
+	// 链码按订单号写入充值订单，订单 key 需要平台和账务组织共同背书，重复的订单号会被拒绝
 	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-	userCredit, err := us.ReadUserCredit(userId)
+	userCredit, err := us.RechargeUserCredit(ctx, userId, orderSN, rechargeAmount)
 	if err != nil {
-		us.updateRechargeRecordStatus(orderSN, "failed")
-		return userId, 0, fmt.Errorf("读取用户积分失败: %v", err)
-	}
-
-	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-	// 第6步：计算新积分
-	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-	credit := int(userCredit["credit"].(float64))
-	totalUsed := int(userCredit["totalUsed"].(float64))
-	totalRecharge := int(userCredit["totalRecharge"].(float64))
-
-	newCredit := credit + rechargeAmount
-	newTotalRecharge := totalRecharge + rechargeAmount
+		// 超时或者提交结果未知时交易可能已经上链，先查链上订单
+		order, readErr := us.ReadRechargeOrder(ctx, orderSN)
+		if readErr == nil && order != nil {
+			metrics.RechargeOutcomes.WithLabelValues(metrics.RechargeSuccess).Inc()
+			return us.completeFromLedger(ctx, order, email, actualPrice)
+		}
 
-	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-	// 第7步：更新链码
-	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-	err = us.UpdateUserCredit(userId, newCredit, totalUsed, newTotalRecharge)
-	if err != nil {
-		us.updateRechargeRecordStatus(orderSN, "failed")
+		metrics.RechargeOutcomes.WithLabelValues(metrics.RechargeFailed).Inc()
+		switch {
+		case readErr != nil:
+			// 查不到链上状态时保留 pending，下次回调再核对
+			log.Printf("⚠️ 充值结果未知，保留 pending 记录: orderSN=%s, err=%v, readErr=%v", orderSN, err, readErr)
+		case isTransientRechargeError(err):
+			// 链上没有这个订单，删掉 pending 记录让第三方平台重试；链码按订单号去重，不会重复入账
+			us.deleteRechargeRecord(orderSN)
+		default:
+			// 链码明确拒绝了这笔充值，重试也不会成功
+			us.updateRechargeRecordStatus(orderSN, "failed", err.Error())
+		}
 		return userId, 0, fmt.Errorf("更新链码失败: %v", err)
 	}
+	newCredit := userCredit.Credit
 
 	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-	// 第8步：同步更新 MongoDB
+	// 第6步：更新充值记录为成功
+	// user_credits 由链码事件投影更新，这里不直接写
 	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-	userCreditsCollection := mongoInstance.GetCollection("user_credits")
-	update := bson.M{
-		"$set": bson.M{
-			"credit":        newCredit,
-			"totalRecharge": newTotalRecharge,
-			"updatedAt":     time.Now().Format("2006-01-02 15:04:05"),
-		},
-	}
-
-	_, err = userCreditsCollection.UpdateOne(
-		context.Background(),
-		bson.M{"userId": userId},
-		update,
-	)
-	if err != nil {
-		log.Printf("⚠️ MongoDB 同步失败: %v", err)
-		// 不返回错误,因为链码已经更新成功
-	} else {
-		log.Printf("✅ MongoDB 同步更新成功")
-	}
-
-	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-	// 第9步：更新充值记录为成功
-	// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-	us.updateRechargeRecord(orderSN, userId, email, rechargeAmount, actualPrice, "success")
+	us.updateRechargeRecord(orderSN, userId, email, rechargeAmount, newCredit, actualPrice, "success")
 
 	log.Printf("✅ 充值成功: userId=%s, orderSN=%s, amount=%d, newCredit=%d",
 		userId, orderSN, rechargeAmount, newCredit)
+	metrics.RechargeOutcomes.WithLabelValues(metrics.RechargeSuccess).Inc()
 
 	return userId, newCredit, nil
 }
@@ -496,16 +592,6 @@ const (
 	MAX_REQUEST_AGE = 5 * 60
 )
 
-// GetRechargeSecretKey 从环境变量获取充值接口的 HMAC 密钥
-func GetRechargeSecretKey() string {
-	key := os.Getenv("RECHARGE_SECRET_KEY")
-	if key == "" {
-		log.Printf("⚠️ 警告: RECHARGE_SECRET_KEY 环境变量未设置，使用默认值")
-		key = "your-secret-key-change-in-production"
-	}
-	return key
-}
-
 // ComputeHMACSignature 计算 HMAC-SHA256 签名（导出函数）
 func ComputeHMACSignature(params map[string]string, secretKey string) string {
 
@@ -6,23 +6,30 @@ import (
 	"fmt"
 	"github.com/hyperledger/fabric-gateway/pkg/client"
 	"log"
+	"novel-resource-management/config"
 	"novel-resource-management/network"
 	"novel-resource-management/service"
 )
 
 // 1.建立网路连接 => 2.创建身份和签名 => 3.创建网关 => 4.创建服务实例
 func main() {
+	// 0. 加载配置
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("加载配置失败: %v", err)
+	}
+
 	// 1. 建立网络连接
 	fmt.Println("正在建立网络连接...")
-	grpcConnection, err := network.NewGrpcConnection()
+	grpcConnection, err := network.NewGrpcConnection(cfg.Fabric)
 	if err != nil {
 		log.Fatalf("无法建立gRPC连接: %v", err)
 	}
 	defer grpcConnection.Close()
 
 	// 2. 创建身份和签名
-	id := network.NewIdentity()
-	sign := network.NewSign()
+	id := network.NewIdentity(cfg.Fabric)
+	sign := network.NewSign(cfg.Fabric)
 
 	// 3. 创建网关
 	gateway, err := client.Connect(
@@ -36,15 +43,9 @@ func main() {
 	defer gateway.Close()
 
 	// 4. 创建服务实例
-	novelService, err := service.NewNovelService(gateway)
-	if err != nil {
-		log.Fatalf("无法创建小说服务: %v", err)
-	}
-
-	userCreditService, err := service.NewUserCreditService(gateway)
-	if err != nil {
-		log.Fatalf("无法创建用户积分服务: %v", err)
-	}
+	chaincode := service.NewChaincode(gateway, gateway, cfg.Fabric)
+	novelService := service.NewNovelService(chaincode)
+	userCreditService := service.NewUserCreditService(chaincode)
 
 	// 5. 测试小说服务
 	fmt.Println("\n=== 测试小说服务 ===")
@@ -384,6 +384,7 @@ func sendRechargeRequest(req RechargeRequest) (int, error) {
 		params := map[string]string{
 			"actual_price": strconv.Itoa(req.ActualPrice),
 			"email":        req.Email,
+			"good_id":      req.GoodID,
 			"order_sn":     req.OrderSN,
 			"timestamp":    req.Timestamp,
 		}
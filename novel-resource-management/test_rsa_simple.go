@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"novel-resource-management/config"
 	"novel-resource-management/utils"
 	"os"
 	"strings"
@@ -40,7 +41,12 @@ func main() {
 
 	// 初始化RSA工具
 	fmt.Println("正在初始化RSA工具...")
-	if err := utils.InitRSACrypto(); err != nil {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("❌ 加载配置失败: %v\n", err)
+		return
+	}
+	if err := utils.InitRSACrypto(cfg.RSA); err != nil {
 		fmt.Printf("❌ RSA工具初始化失败: %v\n", err)
 		fmt.Println("请检查：")
 		fmt.Println("1. security/rsa_private_key.pem 文件是否存在")
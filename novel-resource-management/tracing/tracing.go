@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"novel-resource-management/config"
+)
+
+// OpenTelemetry 链路追踪：HTTP 请求 -> 服务调用 -> Fabric 背书、提交、等待提交状态 -> 链码事件 -> MongoDB 读模型
+// 交易通过 transient 字段 traceparent 把 trace 带进链码，链码写进事件信封，事件监听器处理事件时用 span link 关联回原请求
+//
+// exporter 由配置 tracing.exporter（环境变量 OTEL_TRACES_EXPORTER）指定：otlp、stdout（或 console）、none，默认 none，只生成 trace ID 不导出
+//
+// 其他环境变量：
+//   OTEL_EXPORTER_OTLP_ENDPOINT 等 OTLP 配置由 otlptracegrpc 按 OpenTelemetry 规范读取
+//   OTEL_SERVICE_NAME          默认 novel-resource-management
+//   OTEL_TRACES_SAMPLER 等采样配置由 SDK 读取，默认全部采样
+
+const (
+	serviceName = "novel-resource-management"
+	tracerName  = "novel-resource-management"
+
+	// TraceParentKey 交易 transient 字段和事件信封里保存 W3C traceparent 的 key
+	TraceParentKey = "traceparent"
+)
+
+// Init 按配置创建 TracerProvider 并设置为全局的，返回的函数在退出前调用，把没发出去的 span 导出
+func Init(ctx context.Context, cfg config.TracingConfig) (func(context.Context) error, error) {
+	options := []sdktrace.TracerProviderOption{}
+
+	exporterName := cfg.Exporter
+	switch exporterName {
+	case "", "none":
+	case "otlp":
+		exporter, err := otlptracegrpc.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("create otlp trace exporter failed: %v", err)
+		}
+		options = append(options, sdktrace.WithBatcher(exporter))
+	case "stdout", "console":
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("create stdout trace exporter failed: %v", err)
+		}
+		options = append(options, sdktrace.WithBatcher(exporter))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter: %s", exporterName)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("create trace resource failed: %v", err)
+	}
+	// OTEL_SERVICE_NAME、OTEL_RESOURCE_ATTRIBUTES 优先
+	if fromEnv, err := resource.New(ctx, resource.WithFromEnv()); err == nil {
+		if merged, err := resource.Merge(res, fromEnv); err == nil {
+			res = merged
+		}
+	}
+	options = append(options, sdktrace.WithResource(res))
+
+	provider := sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if exporterName != "" && exporterName != "none" {
+		log.Printf("🔭 链路追踪已启用，exporter=%s", exporterName)
+	}
+	return provider.Shutdown, nil
+}
+
+// Start 开始一个 span，调用方负责 span.End()
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// RecordError err 不为空时把 span 标记为失败
+func RecordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// TraceParent ctx 里当前 span 的 W3C traceparent，没有 span 时返回空字符串
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get(TraceParentKey)
+}
+
+// LinkTo 把 traceparent 转成 span link，格式不对时返回 false
+func LinkTo(traceParent string) (trace.Link, bool) {
+	if traceParent == "" {
+		return trace.Link{}, false
+	}
+	ctx := propagation.TraceContext{}.Extract(context.Background(), propagation.MapCarrier{TraceParentKey: traceParent})
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return trace.Link{}, false
+	}
+	return trace.Link{SpanContext: spanContext}, true
+}
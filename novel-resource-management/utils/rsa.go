@@ -10,6 +10,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+
+	"novel-resource-management/config"
 )
 
 // RSACrypto RSA加密解密器
@@ -19,10 +21,10 @@ type RSACrypto struct {
 }
 
 // NewRSACrypto 创建RSA加密解密器
-func NewRSACrypto() (*RSACrypto, error) {
-	// 从环境变量或文件读取私钥和公钥
-	privateKeyPEM := getPrivateKey()
-	publicKeyPEM := getPublicKey()
+func NewRSACrypto(cfg config.RSAConfig) (*RSACrypto, error) {
+	// 从配置或文件读取私钥和公钥
+	privateKeyPEM := getPrivateKey(cfg)
+	publicKeyPEM := getPublicKey(cfg)
 	
 	if privateKeyPEM == "" {
 		return nil, fmt.Errorf("未找到RSA私钥配置")
@@ -132,42 +134,42 @@ func (r *RSACrypto) Encrypt(data string) (string, error) {
 }
 
 // getPrivateKey 获取私钥
-func getPrivateKey() string {
-	// 优先从环境变量获取
-	if key := os.Getenv("RSA_PRIVATE_KEY"); key != "" {
-		return key
+func getPrivateKey(cfg config.RSAConfig) string {
+	// 优先使用直接配置的PEM
+	if cfg.PrivateKey != "" {
+		return cfg.PrivateKey
 	}
 	
 	// 尝试从文件读取
-	if data, err := os.ReadFile("security/rsa_private_key.pem"); err == nil {
+	if data, err := os.ReadFile(cfg.PrivateKeyFile); err == nil {
 		return string(data)
 	}
 	
 	// 尝试从备选路径读取
-	if data, err := os.ReadFile("../security/rsa_private_key.pem"); err == nil {
+	if data, err := os.ReadFile("../" + cfg.PrivateKeyFile); err == nil {
 		return string(data)
 	}
 	
-	log.Println("警告: 未找到RSA私钥，请配置RSA_PRIVATE_KEY环境变量或security/rsa_private_key.pem文件")
+	log.Printf("警告: 未找到RSA私钥，请配置RSA_PRIVATE_KEY环境变量或%s文件", cfg.PrivateKeyFile)
 	return ""
 }
 
 // getPublicKey 获取公钥
-func getPublicKey() string {
-	// 优先从环境变量获取
-	if key := os.Getenv("RSA_PUBLIC_KEY"); key != "" {
-		return key
+func getPublicKey(cfg config.RSAConfig) string {
+	// 优先使用直接配置的PEM
+	if cfg.PublicKey != "" {
+		return cfg.PublicKey
 	}
 	
 	// 尝试从文件读取
-	if data, err := os.ReadFile("security/rsa_public_key.pem"); err == nil {
-		log.Printf("✅ 从 security/rsa_public_key.pem 读取公钥成功，大小: %d bytes", len(data))
+	if data, err := os.ReadFile(cfg.PublicKeyFile); err == nil {
+		log.Printf("✅ 从 %s 读取公钥成功，大小: %d bytes", cfg.PublicKeyFile, len(data))
 		return string(data)
 	}
 	
 	// 尝试从备选路径读取
-	if data, err := os.ReadFile("../security/rsa_public_key.pem"); err == nil {
-		log.Printf("✅ 从 ../security/rsa_public_key.pem 读取公钥成功，大小: %d bytes", len(data))
+	if data, err := os.ReadFile("../" + cfg.PublicKeyFile); err == nil {
+		log.Printf("✅ 从 ../%s 读取公钥成功，大小: %d bytes", cfg.PublicKeyFile, len(data))
 		return string(data)
 	}
 	
@@ -179,14 +181,14 @@ func getPublicKey() string {
 var globalRSACrypto *RSACrypto
 
 // InitRSACrypto 初始化全局RSA加密解密器
-func InitRSACrypto() error {
+func InitRSACrypto(cfg config.RSAConfig) error {
 	if globalRSACrypto != nil {
 		log.Printf("信息: RSA加密解解密器已经初始化，跳过")
 		return nil
 	}
 	
 	var err error
-	globalRSACrypto, err = NewRSACrypto()
+	globalRSACrypto, err = NewRSACrypto(cfg)
 	if err != nil {
 		log.Printf("❌ RSA加密解密器初始化失败: %v", err)
 		return err
@@ -0,0 +1,3 @@
+module novel-resource-model
+
+go 1.23.0
@@ -0,0 +1,113 @@
+package model
+
+import "fmt"
+
+// 预留的状态
+const (
+	HoldStatusHeld     = "held"
+	HoldStatusCaptured = "captured"
+	HoldStatusReleased = "released"
+	HoldStatusExpired  = "expired"
+)
+
+// UserCredit 用户积分，账本 key 是 UserID
+type UserCredit struct {
+	UserID        string `json:"userId" bson:"userId"`
+	Credit        int    `json:"credit" bson:"credit"`
+	TotalUsed     int    `json:"totalUsed" bson:"totalUsed"`
+	TotalRecharge int    `json:"totalRecharge" bson:"totalRecharge"`
+	Held          int    `json:"held" bson:"held"` // 被预留（HoldCredits）的积分，已经从 Credit 中扣除
+	CreatedAt     string `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	UpdatedAt     string `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+// Validate 用户积分必须有 userId，各项积分不能为负
+func (u *UserCredit) Validate() error {
+	if u.UserID == "" {
+		return fmt.Errorf("userId can not be empty")
+	}
+	if u.Credit < 0 || u.TotalUsed < 0 || u.TotalRecharge < 0 || u.Held < 0 {
+		return fmt.Errorf("credit of %s can not be negative", u.UserID)
+	}
+	return nil
+}
+
+// CreditHistory 积分变动历史，消费时 Amount 为负数
+type CreditHistory struct {
+	UserID      string `json:"userId" bson:"userId"`
+	Amount      int    `json:"amount" bson:"amount"` //积分变动的数额
+	Type        string `json:"type" bson:"type"`     // "consume", "recharge", "reward"
+	Description string `json:"description" bson:"description"`
+	Timestamp   string `json:"timestamp" bson:"timestamp"`
+	NovelID     string `json:"novelId,omitempty" bson:"novelId,omitempty"`
+	Operation   string `json:"operation,omitempty" bson:"operation,omitempty"` // 消费时的操作码，见 PricingTable
+	TxID        string `json:"txId,omitempty" bson:"txId,omitempty"`
+}
+
+// Validate 积分历史必须有 userId 和 type
+func (h *CreditHistory) Validate() error {
+	if h.UserID == "" {
+		return fmt.Errorf("userId can not be empty")
+	}
+	if h.Type == "" {
+		return fmt.Errorf("credit history type can not be empty")
+	}
+	return nil
+}
+
+// CreditHold 两阶段扣费的积分预留，MongoDB 里 holdId 作为 _id
+type CreditHold struct {
+	HoldID         string `json:"holdId" bson:"_id"`
+	UserID         string `json:"userId" bson:"userId"`
+	Amount         int    `json:"amount" bson:"amount"`                           // 预留的积分
+	CapturedAmount int    `json:"capturedAmount,omitempty" bson:"capturedAmount"` // 实际扣除的积分
+	Status         string `json:"status" bson:"status"`                           // held, captured, released, expired
+	ExpiresAt      string `json:"expiresAt" bson:"expiresAt"`
+	CreatedAt      string `json:"createdAt" bson:"createdAt"`
+	UpdatedAt      string `json:"updatedAt" bson:"updatedAt"`
+}
+
+// Validate 检查预留的 id、金额和状态
+func (h *CreditHold) Validate() error {
+	if h.HoldID == "" {
+		return fmt.Errorf("holdId can not be empty")
+	}
+	if h.UserID == "" {
+		return fmt.Errorf("userId can not be empty")
+	}
+	if h.Amount <= 0 {
+		return fmt.Errorf("hold amount must be positive")
+	}
+	if h.CapturedAmount < 0 || h.CapturedAmount > h.Amount {
+		return fmt.Errorf("captured amount must be between 0 and %d", h.Amount)
+	}
+	switch h.Status {
+	case HoldStatusHeld, HoldStatusCaptured, HoldStatusReleased, HoldStatusExpired:
+		return nil
+	default:
+		return fmt.Errorf("unknown hold status %q", h.Status)
+	}
+}
+
+// RechargeOrder 充值订单，同一个订单号只能入账一次
+type RechargeOrder struct {
+	OrderSN   string `json:"orderSn" bson:"orderSn"`
+	UserID    string `json:"userId" bson:"userId"`
+	Amount    int    `json:"amount" bson:"amount"`
+	TxID      string `json:"txId" bson:"txId"`
+	CreatedAt string `json:"createdAt" bson:"createdAt"`
+}
+
+// Validate 订单号、用户和正数金额都是必需的
+func (o *RechargeOrder) Validate() error {
+	if o.OrderSN == "" {
+		return fmt.Errorf("orderSn can not be empty")
+	}
+	if o.UserID == "" {
+		return fmt.Errorf("userId can not be empty")
+	}
+	if o.Amount <= 0 {
+		return fmt.Errorf("recharge amount must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Validator 模型自带的字段校验
+type Validator interface {
+	Validate() error
+}
+
+// Decode 严格解码一个模型：不认识的字段、多余的内容都会报错，解码后再做字段校验
+func Decode(data []byte, v Validator) error {
+	if err := decodeStrict(data, v); err != nil {
+		return err
+	}
+	return v.Validate()
+}
+
+// DecodeList 严格解码模型列表，null 或空内容返回空列表，每个元素都会校验
+func DecodeList[T any, P interface {
+	*T
+	Validator
+}](data []byte) ([]T, error) {
+	items := []T{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return items, nil
+	}
+	if err := decodeStrict(data, &items); err != nil {
+		return nil, err
+	}
+	if items == nil {
+		return []T{}, nil
+	}
+	for i := range items {
+		if err := P(&items[i]).Validate(); err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+	}
+	return items, nil
+}
+
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("decode %T failed: %w", v, err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return fmt.Errorf("decode %T failed: unexpected data after value", v)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package model_test
+
+import (
+	"strings"
+	"testing"
+
+	model "novel-resource-model/v1"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		expectedErr string
+	}{
+		{name: "decodes valid record", data: `{"userId":"user1","credit":100,"totalUsed":0,"totalRecharge":100,"held":0}`},
+		{name: "rejects unknown field", data: `{"userId":"user1","credits":100}`, expectedErr: `unknown field "credits"`},
+		{name: "rejects wrong type", data: `{"userId":"user1","credit":"100"}`, expectedErr: "cannot unmarshal string"},
+		{name: "rejects trailing data", data: `{"userId":"user1"} {}`, expectedErr: "unexpected data after value"},
+		{name: "rejects missing userId", data: `{"credit":100}`, expectedErr: "userId can not be empty"},
+		{name: "rejects negative credit", data: `{"userId":"user1","credit":-1}`, expectedErr: "credit of user1 can not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var credit model.UserCredit
+			err := model.Decode([]byte(tt.data), &credit)
+			if tt.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if credit.UserID != "user1" || credit.Credit != 100 {
+					t.Fatalf("unexpected record: %+v", credit)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestDecodeList(t *testing.T) {
+	for _, data := range []string{"", "null", "[]"} {
+		novels, err := model.DecodeList[model.Novel]([]byte(data))
+		if err != nil {
+			t.Fatalf("decode %q: %v", data, err)
+		}
+		if novels == nil || len(novels) != 0 {
+			t.Fatalf("decode %q: expected empty list, got %#v", data, novels)
+		}
+	}
+
+	novels, err := model.DecodeList[model.Novel]([]byte(`[{"id":"n1","author":"a"},{"id":"n2"}]`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(novels) != 2 || novels[1].ID != "n2" {
+		t.Fatalf("unexpected novels: %+v", novels)
+	}
+
+	_, err = model.DecodeList[model.Novel]([]byte(`[{"id":"n1"},{"author":"a"}]`))
+	if err == nil || err.Error() != "item 1: novel id can not be empty" {
+		t.Fatalf("expected validation error of item 1, got %v", err)
+	}
+}
+
+func TestCreditHoldValidate(t *testing.T) {
+	valid := model.CreditHold{HoldID: "h1", UserID: "user1", Amount: 10, CapturedAmount: 4, Status: model.HoldStatusCaptured}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := map[string]func(h *model.CreditHold){
+		"holdId can not be empty":                  func(h *model.CreditHold) { h.HoldID = "" },
+		"hold amount must be positive":             func(h *model.CreditHold) { h.Amount = 0; h.CapturedAmount = 0 },
+		"captured amount must be between 0 and 10": func(h *model.CreditHold) { h.CapturedAmount = 11 },
+		`unknown hold status "pending"`:            func(h *model.CreditHold) { h.Status = "pending" },
+	}
+	for expectedErr, mutate := range tests {
+		hold := valid
+		mutate(&hold)
+		if err := hold.Validate(); err == nil || err.Error() != expectedErr {
+			t.Errorf("expected %q, got %v", expectedErr, err)
+		}
+	}
+}
+
+func TestPricingTableValidate(t *testing.T) {
+	defaults := model.PricingTable{Operations: map[string]int{"default": 1}}
+	if err := defaults.Validate(); err != nil {
+		t.Fatalf("default pricing without effectiveFrom should be valid: %v", err)
+	}
+
+	overrides := model.PricingTable{
+		Operations:     map[string]int{"default": 1},
+		NovelOverrides: map[string]map[string]int{"n1": {"image": 5}},
+	}
+	if err := overrides.Validate(); err == nil || err.Error() != "novel n1 overrides unknown operation image" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cost, err := overrides.CostOf("default", "n1")
+	if err != nil || cost != 1 {
+		t.Fatalf("unexpected cost %d, %v", cost, err)
+	}
+}
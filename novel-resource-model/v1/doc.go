@@ -0,0 +1,8 @@
+// Package model 链码和管理服务共用的领域模型（v1）
+//
+// 链码把这些结构体按 JSON 写进账本，管理服务从网关结果、链码事件和 MongoDB 里读出同样的结构体，
+// 所以字段同时带 json 和 bson 标签。字段有不兼容的改动时新建 v2 包，不要直接修改这里。
+package model
+
+// Version 模型版本，和包路径里的版本一致
+const Version = "v1"
@@ -0,0 +1,42 @@
+package model
+
+import "fmt"
+
+// EndorsementConfig 高价值记录的背书配置
+// 用户余额（可用 + 预留）不低于 HighValueThreshold 时，积分 key 需要平台和账务组织背书，0 表示不按余额区分
+type EndorsementConfig struct {
+	HighValueThreshold int    `json:"highValueThreshold" bson:"highValueThreshold"`
+	BillingMSPID       string `json:"billingMspId" bson:"billingMspId"`
+	UpdatedAt          string `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+	UpdatedBy          string `json:"updatedBy,omitempty" bson:"updatedBy,omitempty"`
+}
+
+// Validate 门槛不能为负，账务组织不能为空
+func (c *EndorsementConfig) Validate() error {
+	if c.HighValueThreshold < 0 {
+		return fmt.Errorf("high value threshold can not be negative")
+	}
+	if c.BillingMSPID == "" {
+		return fmt.Errorf("billingMspId can not be empty")
+	}
+	return nil
+}
+
+// KeyEndorsementPolicy 一个 key 当前的背书策略，KeyLevel 为 false 表示使用链码级别策略
+type KeyEndorsementPolicy struct {
+	EntityType string   `json:"entityType" bson:"entityType"`
+	EntityID   string   `json:"entityId" bson:"entityId"`
+	KeyLevel   bool     `json:"keyLevel" bson:"keyLevel"`
+	Orgs       []string `json:"orgs" bson:"orgs"`
+}
+
+// Validate 检查实体，key 级别策略至少要有一个组织
+func (p *KeyEndorsementPolicy) Validate() error {
+	if p.EntityType == "" || p.EntityID == "" {
+		return fmt.Errorf("entityType and entityId can not be empty")
+	}
+	if p.KeyLevel && len(p.Orgs) == 0 {
+		return fmt.Errorf("key level policy of %s %s has no orgs", p.EntityType, p.EntityID)
+	}
+	return nil
+}
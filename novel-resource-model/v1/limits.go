@@ -0,0 +1,62 @@
+package model
+
+import "fmt"
+
+// Unlimited SpendingAllowance 中表示没有限额
+const Unlimited = -1
+
+// 限额来源
+const (
+	LimitSourceUser    = "user"
+	LimitSourceDefault = "default"
+	LimitSourceNone    = "none"
+)
+
+// SpendingLimit 消费限额，0 表示不限制
+type SpendingLimit struct {
+	UserID    string `json:"userId,omitempty" bson:"userId,omitempty"` // 全局默认限额为空
+	Daily     int    `json:"daily" bson:"daily"`
+	Weekly    int    `json:"weekly" bson:"weekly"`
+	Monthly   int    `json:"monthly" bson:"monthly"`
+	UpdatedAt string `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+	UpdatedBy string `json:"updatedBy,omitempty" bson:"updatedBy,omitempty"`
+}
+
+// Validate 限额不能为负
+func (l *SpendingLimit) Validate() error {
+	if l.Daily < 0 || l.Weekly < 0 || l.Monthly < 0 {
+		return fmt.Errorf("spending limits can not be negative")
+	}
+	return nil
+}
+
+// SpendingWindow 三个时间窗口的数值
+type SpendingWindow struct {
+	Daily   int `json:"daily" bson:"daily"`
+	Weekly  int `json:"weekly" bson:"weekly"`
+	Monthly int `json:"monthly" bson:"monthly"`
+}
+
+// SpendingAllowance 用户当前的限额、用量和剩余额度，Remaining 为 -1 表示不限制
+// Held 是还没有结束的预留，也会占用额度
+type SpendingAllowance struct {
+	UserID    string         `json:"userId" bson:"userId"`
+	Source    string         `json:"source" bson:"source"`
+	Limit     SpendingWindow `json:"limit" bson:"limit"`
+	Used      SpendingWindow `json:"used" bson:"used"`
+	Held      int            `json:"held" bson:"held"`
+	Remaining SpendingWindow `json:"remaining" bson:"remaining"`
+}
+
+// Validate 检查 userId 和限额来源
+func (a *SpendingAllowance) Validate() error {
+	if a.UserID == "" {
+		return fmt.Errorf("userId can not be empty")
+	}
+	switch a.Source {
+	case LimitSourceUser, LimitSourceDefault, LimitSourceNone:
+		return nil
+	default:
+		return fmt.Errorf("unknown limit source %q", a.Source)
+	}
+}
@@ -0,0 +1,24 @@
+package model
+
+import "fmt"
+
+// Novel 小说资源，账本 key 和 MongoDB _id 都是 ID
+type Novel struct {
+	ID           string `json:"id" bson:"_id,omitempty"`
+	Author       string `json:"author,omitempty" bson:"author,omitempty"`
+	StoryOutline string `json:"storyOutline,omitempty" bson:"storyOutline,omitempty"`
+	Subsections  string `json:"subsections,omitempty" bson:"subsections,omitempty"`
+	Characters   string `json:"characters,omitempty" bson:"characters,omitempty"`
+	Items        string `json:"items,omitempty" bson:"items,omitempty"`
+	TotalScenes  string `json:"totalScenes,omitempty" bson:"totalScenes,omitempty"`
+	CreatedAt    string `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	UpdatedAt    string `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+// Validate 小说必须有 ID
+func (n *Novel) Validate() error {
+	if n.ID == "" {
+		return fmt.Errorf("novel id can not be empty")
+	}
+	return nil
+}
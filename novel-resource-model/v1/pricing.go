@@ -0,0 +1,60 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// PricingTable 价格表：操作码 -> 消耗的积分，可以按小说单独定价
+type PricingTable struct {
+	EffectiveFrom  string                    `json:"effectiveFrom" bson:"effectiveFrom"` // RFC3339，从这个时间（按交易时间戳）开始生效
+	Operations     map[string]int            `json:"operations" bson:"operations"`
+	NovelOverrides map[string]map[string]int `json:"novelOverrides,omitempty" bson:"novelOverrides,omitempty"` // novelId -> 操作码 -> 积分
+	UpdatedAt      string                    `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+	UpdatedBy      string                    `json:"updatedBy,omitempty" bson:"updatedBy,omitempty"`
+}
+
+// CostOf 计算某个操作的价格，小说单独定价优先
+func (p *PricingTable) CostOf(operation string, novelId string) (int, error) {
+	if novelId != "" {
+		if cost, ok := p.NovelOverrides[novelId][operation]; ok {
+			return cost, nil
+		}
+	}
+	cost, ok := p.Operations[operation]
+	if !ok {
+		return 0, fmt.Errorf("unknown operation %s", operation)
+	}
+	return cost, nil
+}
+
+// Validate 检查操作码和价格，effectiveFrom 为空表示默认价格表
+func (p *PricingTable) Validate() error {
+	if len(p.Operations) == 0 {
+		return fmt.Errorf("pricing table has no operations")
+	}
+	for operation, cost := range p.Operations {
+		if operation == "" {
+			return fmt.Errorf("operation code can not be empty")
+		}
+		if cost < 0 {
+			return fmt.Errorf("cost of operation %s can not be negative", operation)
+		}
+	}
+	for novelId, overrides := range p.NovelOverrides {
+		for operation, cost := range overrides {
+			if _, ok := p.Operations[operation]; !ok {
+				return fmt.Errorf("novel %s overrides unknown operation %s", novelId, operation)
+			}
+			if cost < 0 {
+				return fmt.Errorf("cost of operation %s for novel %s can not be negative", operation, novelId)
+			}
+		}
+	}
+	if p.EffectiveFrom != "" {
+		if _, err := time.Parse(time.RFC3339, p.EffectiveFrom); err != nil {
+			return fmt.Errorf("invalid effectiveFrom %q: %v", p.EffectiveFrom, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// SnapshotAnchor 一次 MongoDB 读模型快照的 Merkle 根，TakenAt 是 UTC RFC3339
+type SnapshotAnchor struct {
+	Root       string `json:"root" bson:"root"`
+	Count      int    `json:"count" bson:"count"`
+	TakenAt    string `json:"takenAt" bson:"takenAt"`
+	TxID       string `json:"txId" bson:"txId"`
+	AnchoredAt string `json:"anchoredAt" bson:"anchoredAt"`
+	AnchoredBy string `json:"anchoredBy,omitempty" bson:"anchoredBy,omitempty"`
+}
+
+// Validate root 必须是 SHA-256 十六进制，count 不能为负，takenAt 必须是 RFC3339
+func (a *SnapshotAnchor) Validate() error {
+	if decoded, err := hex.DecodeString(a.Root); err != nil || len(decoded) != 32 {
+		return fmt.Errorf("root must be a hex encoded sha256 hash")
+	}
+	if a.Count < 0 {
+		return fmt.Errorf("count can not be negative")
+	}
+	if _, err := time.Parse(time.RFC3339, a.TakenAt); err != nil {
+		return fmt.Errorf("invalid takenAt: %v", err)
+	}
+	return nil
+}
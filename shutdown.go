@@ -1,11 +1,14 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
@@ -372,43 +375,66 @@ func runDaemonMode() {
 	}
 }
 
+// defaultReadyzURL Novel API 的就绪检查地址，可以用 NOVEL_READYZ_URL 覆盖
+const defaultReadyzURL = "http://localhost:8080/readyz"
+
+// readinessReport /readyz 的返回内容，checks 里是 Fabric、MongoDB、事件监听器各自的状态
+type readinessReport struct {
+	Status string `json:"status"`
+	Checks map[string]struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	} `json:"checks"`
+}
+
 // monitorServices 监控服务状态
+// API 在运行时以 /readyz 的结果为准；API 不响应时才检查 Fabric 端口，判断是不是所有服务都停了
 func monitorServices() error {
 	fmt.Printf("🔍 [%s] 检查服务状态...\n", time.Now().Format("15:04:05"))
 
-	// 检查关键端口
-	portsToCheck := map[string]string{
-		"8080": "Novel API",
-		"7051": "Fabric Peer1",
-		"7050": "Fabric Peer2",
-		"9051": "Fabric Orderer1",
-		"9050": "Fabric Orderer2",
-	}
-
-	var activeServices []string
-	var failedServices []string
+	report, err := fetchReadiness()
+	if err != nil {
+		fmt.Printf("❌ Novel API 不可用: %v\n", err)
+
+		// 检查 Fabric 端口
+		portsToCheck := map[string]string{
+			"7051": "Fabric Peer1",
+			"7050": "Fabric Peer2",
+			"9051": "Fabric Orderer1",
+			"9050": "Fabric Orderer2",
+		}
 
-	for port, serviceName := range portsToCheck {
-		if isPortActive(port) {
-			activeServices = append(activeServices, serviceName)
-		} else {
-			failedServices = append(failedServices, serviceName)
+		var activeServices []string
+		for port, serviceName := range portsToCheck {
+			if isPortActive(port) {
+				activeServices = append(activeServices, serviceName)
+			}
 		}
-	}
 
-	// 报告状态
-	if len(activeServices) > 0 {
+		// 如果所有服务都停止了，自动退出
+		if len(activeServices) == 0 {
+			fmt.Println("🎉 所有服务已停止，守护进程退出")
+			os.Exit(0)
+		}
 		fmt.Printf("✅ 运行中的服务: %v\n", activeServices)
-	}
-
-	if len(failedServices) > 0 {
-		fmt.Printf("❌ 停止的服务: %v\n", failedServices)
-	}
-
-	// 如果所有服务都停止了，自动退出
-	if len(activeServices) == 0 {
-		fmt.Println("🎉 所有服务已停止，守护进程退出")
-		os.Exit(0)
+	} else {
+		// 报告每个依赖的状态
+		names := make([]string, 0, len(report.Checks))
+		for name := range report.Checks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			check := report.Checks[name]
+			if check.Status == "up" {
+				fmt.Printf("✅ %s: %s\n", name, check.Status)
+			} else {
+				fmt.Printf("❌ %s: %s %s\n", name, check.Status, check.Error)
+			}
+		}
+		if report.Status != "ready" {
+			fmt.Println("⚠️ Novel API 未就绪")
+		}
 	}
 
 	// 检查是否有异常状态
@@ -420,6 +446,27 @@ func monitorServices() error {
 	return nil
 }
 
+// fetchReadiness 请求 /readyz，未就绪时返回 503，body 里同样有各依赖的详情
+func fetchReadiness() (*readinessReport, error) {
+	url := os.Getenv("NOVEL_READYZ_URL")
+	if url == "" {
+		url = defaultReadyzURL
+	}
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var report readinessReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, fmt.Errorf("解析 %s 返回内容失败 (HTTP %d): %v", url, resp.StatusCode, err)
+	}
+	return &report, nil
+}
+
 // isPortActive 检查端口是否活跃
 func isPortActive(port string) bool {
 	cmd := exec.Command("lsof", "-t", "-i", ":"+port)